@@ -0,0 +1,150 @@
+package miniprogram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	apiCode2Session   = "/sns/jscode2session"
+	apiGetPaidUnionId = "/wxa/getpaidunionid"
+	apiGetPhoneNumber = "/wxa/business/getuserphonenumber"
+)
+
+// session_key 没有明确的有效期， 用户每次登录都会重新保存
+const defaultSessionKeyTTL = 7 * 24 * time.Hour
+
+var ErrorSessionKeyNotFound = errors.New("session_key not found, login required")
+
+type Session struct {
+	Openid     string `json:"openid"`
+	SessionKey string `json:"session_key"`
+	Unionid    string `json:"unionid"` // 绑定了开放平台才有
+}
+
+/*
+登录凭证校验
+
+通过 wx.login 接口获得临时登录凭证 code 后传到开发者服务器调用此接口完成登录流程
+
+See: https://developers.weixin.qq.com/miniprogram/dev/api-backend/open-api/login/auth.code2Session.html
+
+GET https://api.weixin.qq.com/sns/jscode2session?appid=APPID&secret=SECRET&js_code=JSCODE&grant_type=authorization_code
+*/
+func (miniProgram *MiniProgram) Code2Session(ctx context.Context, jsCode string) (*Session, error) {
+	params := url.Values{}
+	params.Add("appid", miniProgram.Config.Appid)
+	params.Add("secret", miniProgram.Config.Secret)
+	params.Add("js_code", jsCode)
+	params.Add("grant_type", "authorization_code")
+
+	body, err := miniProgram.Client.HTTPGetWithoutToken(ctx, apiCode2Session, params)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{}
+	if err = json.Unmarshal(body, session); err != nil {
+		return nil, fmt.Errorf("unmarshal %s response: %w", apiCode2Session, err)
+	}
+	return session, nil
+}
+
+func (miniProgram *MiniProgram) sessionKeyKey(openid string) string {
+	return fmt.Sprintf("session-key:miniprogram:%s:%s", miniProgram.Config.Appid, openid)
+}
+
+// Login 登录凭证校验， 并保存 session_key， 供 GetSessionKey 解密数据使用
+// session_key 不能下发到小程序
+func (miniProgram *MiniProgram) Login(ctx context.Context, jsCode string) (*Session, error) {
+	session, err := miniProgram.Code2Session(ctx, jsCode)
+	if err != nil {
+		return nil, err
+	}
+	err = miniProgram.cache.Set(miniProgram.sessionKeyKey(session.Openid), session.SessionKey, defaultSessionKeyTTL)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSessionKey 获取 Login 保存的 session_key
+func (miniProgram *MiniProgram) GetSessionKey(openid string) (string, error) {
+	sessionKey := ""
+	exist, err := miniProgram.cache.Get(miniProgram.sessionKeyKey(openid), &sessionKey)
+	if err != nil {
+		return "", err
+	}
+	if !exist || sessionKey == "" {
+		return "", ErrorSessionKeyNotFound
+	}
+	return sessionKey, nil
+}
+
+/*
+用户支付完成后， 获取该用户的 UnionId， 无需用户授权
+
+See: https://developers.weixin.qq.com/miniprogram/dev/api-backend/open-api/user-info/auth.getPaidUnionId.html
+
+GET https://api.weixin.qq.com/wxa/getpaidunionid?access_token=ACCESS_TOKEN&openid=OPENID&transaction_id=TRANSACTION_ID
+*/
+func (miniProgram *MiniProgram) GetPaidUnionId(ctx context.Context, openid, transactionId string) (string, error) {
+	return miniProgram.getPaidUnionId(ctx, func(params url.Values) {
+		params.Add("openid", openid)
+		params.Add("transaction_id", transactionId)
+	})
+}
+
+/*
+用户支付完成后， 用商户订单号获取该用户的 UnionId
+
+See: https://developers.weixin.qq.com/miniprogram/dev/api-backend/open-api/user-info/auth.getPaidUnionId.html
+
+GET https://api.weixin.qq.com/wxa/getpaidunionid?access_token=ACCESS_TOKEN&openid=OPENID&mch_id=MCH_ID&out_trade_no=OUT_TRADE_NO
+*/
+func (miniProgram *MiniProgram) GetPaidUnionIdByOutTradeNo(
+	ctx context.Context, openid, mchId, outTradeNo string,
+) (string, error) {
+	return miniProgram.getPaidUnionId(ctx, func(params url.Values) {
+		params.Add("openid", openid)
+		params.Add("mch_id", mchId)
+		params.Add("out_trade_no", outTradeNo)
+	})
+}
+
+func (miniProgram *MiniProgram) getPaidUnionId(ctx context.Context, paramFunc func(url.Values)) (string, error) {
+	result := struct {
+		Unionid string `json:"unionid"`
+	}{}
+	err := miniProgram.Client.ApiGetWrapper(ctx, apiGetPaidUnionId, paramFunc, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.Unionid, nil
+}
+
+/*
+获取用户手机号
+
+code 为手机号快速验证组件(getPhoneNumber)返回的动态令牌， 与 wx.login 的 code 不同， 只能使用一次
+
+See: https://developers.weixin.qq.com/miniprogram/dev/OpenApiDoc/user-info/phone-number/getPhoneNumber.html
+
+POST https://api.weixin.qq.com/wxa/business/getuserphonenumber?access_token=ACCESS_TOKEN
+*/
+func (miniProgram *MiniProgram) GetPhoneNumber(ctx context.Context, code string) (*PhoneNumber, error) {
+	result := struct {
+		PhoneInfo PhoneNumber `json:"phone_info"`
+	}{}
+	err := miniProgram.Client.ApiPostWrapper(ctx, apiGetPhoneNumber, map[string]string{
+		"code": code,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result.PhoneInfo, nil
+}
@@ -0,0 +1,76 @@
+package miniprogram
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogin(t *testing.T) {
+	server := wxtest.NewServer()
+	defer server.Close()
+	server.AddMiniProgram("appid", "secret")
+	user := server.AddMiniProgramUser(wxtest.MiniProgramUser{
+		OpenID:          "openid1",
+		UnionID:         "unionid1",
+		PhoneNumber:     "13800138000",
+		PurePhoneNumber: "13800138000",
+		CountryCode:     "86",
+		Transactions:    []string{"4200000001", "out_trade_no_1"},
+	})
+
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	miniProgram := New(cache, cache, &Config{
+		Appid:  "appid",
+		Secret: "secret",
+	}, utils.WithServerUrl(server.URL))
+	ctx := context.Background()
+
+	// 登录之前没有 session_key
+	_, err := miniProgram.GetSessionKey("openid1")
+	require.True(t, errors.Is(err, ErrorSessionKeyNotFound))
+
+	code := server.MiniProgramLoginCode("openid1")
+	session, err := miniProgram.Login(ctx, code)
+	require.Equal(t, nil, err)
+	require.Equal(t, "openid1", session.Openid)
+	require.Equal(t, "unionid1", session.Unionid)
+	sessionKey, err := miniProgram.GetSessionKey("openid1")
+	require.Equal(t, nil, err)
+	require.Equal(t, user.SessionKey, sessionKey)
+
+	// code 只能使用一次
+	_, err = miniProgram.Login(ctx, code)
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeCodeBeenUsed}))
+	_, err = miniProgram.Code2Session(ctx, "invalid")
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeInvalidCode}))
+
+	// 支付后获取 unionid
+	unionid, err := miniProgram.GetPaidUnionId(ctx, "openid1", "4200000001")
+	require.Equal(t, nil, err)
+	require.Equal(t, "unionid1", unionid)
+	unionid, err = miniProgram.GetPaidUnionIdByOutTradeNo(ctx, "openid1", "mch_id", "out_trade_no_1")
+	require.Equal(t, nil, err)
+	require.Equal(t, "unionid1", unionid)
+	_, err = miniProgram.GetPaidUnionId(ctx, "openid1", "4200000002")
+	require.NotEqual(t, nil, err)
+
+	// 获取手机号
+	phoneCode := server.MiniProgramPhoneCode("openid1")
+	phoneNumber, err := miniProgram.GetPhoneNumber(ctx, phoneCode)
+	require.Equal(t, nil, err)
+	require.Equal(t, "13800138000", phoneNumber.PurePhoneNumber)
+	require.Equal(t, "86", phoneNumber.CountryCode)
+	require.Equal(t, "appid", phoneNumber.Watermark.Appid)
+	_, err = miniProgram.GetPhoneNumber(ctx, phoneCode)
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeInvalidCode}))
+
+	// 小程序和接口共用一个 access_token
+	require.Equal(t, 1, server.RequestCount("/cgi-bin/token"))
+}
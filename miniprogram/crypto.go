@@ -0,0 +1,127 @@
+package miniprogram
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrorInvalidEncryptedData = errors.New("invalid encrypted data")
+	ErrorWatermarkMismatch    = errors.New("watermark appid mismatch")
+)
+
+// Watermark 敏感数据的水印， appid 是数据所属的小程序
+type Watermark struct {
+	Appid     string `json:"appid"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// UserInfo wx.getUserInfo 的 encryptedData 解密结果
+type UserInfo struct {
+	OpenID    string    `json:"openId"`
+	NickName  string    `json:"nickName"`
+	Gender    int       `json:"gender"`
+	Language  string    `json:"language"`
+	City      string    `json:"city"`
+	Province  string    `json:"province"`
+	Country   string    `json:"country"`
+	AvatarUrl string    `json:"avatarUrl"`
+	UnionID   string    `json:"unionId"` // 绑定了开放平台才有
+	Watermark Watermark `json:"watermark"`
+}
+
+// PhoneNumber 用户手机号， getPhoneNumber 的 encryptedData 解密结果或者 GetPhoneNumber 的返回
+type PhoneNumber struct {
+	PhoneNumber     string    `json:"phoneNumber"`     // 用户绑定的手机号（国外手机号会有区号）
+	PurePhoneNumber string    `json:"purePhoneNumber"` // 没有区号的手机号
+	CountryCode     string    `json:"countryCode"`     // 区号
+	Watermark       Watermark `json:"watermark"`
+}
+
+/*
+开放数据校验与解密
+
+对称解密使用的算法为 AES-128-CBC，数据采用PKCS#7填充， 密钥为 session_key， 初始向量为 iv， 都经过 base64 编码，
+解密之后校验 watermark 中的 appid
+
+See: https://developers.weixin.qq.com/miniprogram/dev/framework/open-ability/signature.html
+*/
+func (miniProgram *MiniProgram) DecryptData(sessionKey, encryptedData, iv string, v interface{}) error {
+	plaintext, err := decryptData(sessionKey, encryptedData, iv)
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		Watermark Watermark `json:"watermark"`
+	}{}
+	if err = json.Unmarshal(plaintext, &result); err != nil {
+		return ErrorInvalidEncryptedData
+	}
+	if result.Watermark.Appid != miniProgram.Config.Appid {
+		return ErrorWatermarkMismatch
+	}
+	return json.Unmarshal(plaintext, v)
+}
+
+// DecryptUserInfo 解密用户信息
+func (miniProgram *MiniProgram) DecryptUserInfo(sessionKey, encryptedData, iv string) (*UserInfo, error) {
+	userInfo := &UserInfo{}
+	if err := miniProgram.DecryptData(sessionKey, encryptedData, iv, userInfo); err != nil {
+		return nil, err
+	}
+	return userInfo, nil
+}
+
+// DecryptPhoneNumber 解密手机号， 新版本建议使用 GetPhoneNumber
+func (miniProgram *MiniProgram) DecryptPhoneNumber(sessionKey, encryptedData, iv string) (*PhoneNumber, error) {
+	phoneNumber := &PhoneNumber{}
+	if err := miniProgram.DecryptData(sessionKey, encryptedData, iv, phoneNumber); err != nil {
+		return nil, err
+	}
+	return phoneNumber, nil
+}
+
+// CheckSignature 校验 wx.getUserInfo 返回的 rawData， signature = sha1( rawData + session_key )
+func CheckSignature(sessionKey, rawData, signature string) bool {
+	h := sha1.New()
+	_, _ = io.WriteString(h, rawData+sessionKey)
+	expected := fmt.Sprintf("%x", h.Sum(nil))
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
+}
+
+func decryptData(sessionKey, encryptedData, iv string) ([]byte, error) {
+	aesKey, err := base64.StdEncoding.DecodeString(sessionKey)
+	if err != nil || len(aesKey) != aes.BlockSize {
+		return nil, ErrorInvalidEncryptedData
+	}
+	aesIV, err := base64.StdEncoding.DecodeString(iv)
+	if err != nil || len(aesIV) != aes.BlockSize {
+		return nil, ErrorInvalidEncryptedData
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrorInvalidEncryptedData
+	}
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, aesIV).CryptBlocks(plaintext, ciphertext)
+
+	// PKCS#7 去除补位， session_key 错误时补位一般也不正确
+	amountToPad := int(plaintext[len(plaintext)-1])
+	if amountToPad < 1 || amountToPad > aes.BlockSize {
+		return nil, ErrorInvalidEncryptedData
+	}
+	return plaintext[:len(plaintext)-amountToPad], nil
+}
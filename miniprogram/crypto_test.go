@@ -0,0 +1,58 @@
+package miniprogram
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecryptData(t *testing.T) {
+	miniProgram := New(nil, nil, &Config{Appid: "appid", Secret: "secret"})
+	sessionKey := "tiihtNczf5v6AKRyjwEUhQ=="
+
+	encryptedData, iv, err := wxtest.MiniProgramEncryptedData("appid", sessionKey, wxtest.H{
+		"openId":   "openid1",
+		"nickName": "Band",
+		"gender":   1,
+		"unionId":  "unionid1",
+	})
+	require.Equal(t, nil, err)
+	userInfo, err := miniProgram.DecryptUserInfo(sessionKey, encryptedData, iv)
+	require.Equal(t, nil, err)
+	require.Equal(t, "openid1", userInfo.OpenID)
+	require.Equal(t, "Band", userInfo.NickName)
+	require.Equal(t, 1, userInfo.Gender)
+	require.Equal(t, "unionid1", userInfo.UnionID)
+	require.Equal(t, "appid", userInfo.Watermark.Appid)
+
+	// session_key 错误
+	_, err = miniProgram.DecryptUserInfo("WwEKvEmf9LqPIyNpsYAdEw==", encryptedData, iv)
+	require.NotEqual(t, nil, err)
+	_, err = miniProgram.DecryptUserInfo("invalid", encryptedData, iv)
+	require.True(t, errors.Is(err, ErrorInvalidEncryptedData))
+
+	// 其他小程序的数据
+	encryptedData, iv, err = wxtest.MiniProgramEncryptedData("appid2", sessionKey, wxtest.H{
+		"phoneNumber":     "13800138000",
+		"purePhoneNumber": "13800138000",
+		"countryCode":     "86",
+	})
+	require.Equal(t, nil, err)
+	_, err = miniProgram.DecryptPhoneNumber(sessionKey, encryptedData, iv)
+	require.True(t, errors.Is(err, ErrorWatermarkMismatch))
+	phoneNumber, err := New(nil, nil, &Config{Appid: "appid2"}).DecryptPhoneNumber(sessionKey, encryptedData, iv)
+	require.Equal(t, nil, err)
+	require.Equal(t, "13800138000", phoneNumber.PhoneNumber)
+}
+
+func TestCheckSignature(t *testing.T) {
+	sessionKey := "HyVFkGl5F5OQWJZZaNzBBg=="
+	rawData := `{"nickName":"Band","gender":1}`
+	signature := fmt.Sprintf("%x", sha1.Sum([]byte(rawData+sessionKey)))
+	require.True(t, CheckSignature(sessionKey, rawData, signature))
+	require.False(t, CheckSignature(sessionKey, rawData+" ", signature))
+}
@@ -0,0 +1,60 @@
+package miniprogram
+
+import (
+	"fmt"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+var (
+	WXServerUrl = "https://api.weixin.qq.com" // 微信 api 服务器地址
+)
+
+/*
+小程序配置
+*/
+type Config struct {
+	Appid  string
+	Secret string
+}
+
+type MiniProgram struct {
+	Config *Config
+	Client *utils.Client
+
+	cache utils.Cache // 保存 session_key
+}
+
+// New opts 可以指定 http.Client / 超时 / 代理 / 服务器地址等， 参考 utils.ClientOption
+func New(cache utils.Cache, locker utils.Lock, config *Config, opts ...utils.ClientOption) *MiniProgram {
+	instance := &MiniProgram{
+		Config: config,
+		cache:  cache,
+	}
+	instance.Client = utils.NewClient(
+		WXServerUrl, utils.NewAccessTokenCache(instance, cache, locker, 0), opts...,
+	)
+	return instance
+}
+
+// GetAccessToken 接口 weixin.AccessTokenGetter 实现
+func (miniProgram *MiniProgram) GetAccessToken() (accessToken string, expiresIn int, err error) {
+	accessToken, expiresIn, err = miniProgram.refreshAccessTokenFromWXServer()
+	return
+}
+
+// GetAccessTokenKey 接口 weixin.AccessTokenGetter 实现
+func (miniProgram *MiniProgram) GetAccessTokenKey() string {
+	return fmt.Sprintf(
+		"access-token:miniprogram:%s",
+		miniProgram.Config.Appid,
+	)
+}
+
+// GetAccessTokenLockKey 接口 weixin.AccessTokenGetter 实现
+func (miniProgram *MiniProgram) GetAccessTokenLockKey() string {
+	return fmt.Sprintf(
+		"access-token:miniprogram:%s.lock",
+		miniProgram.Config.Appid,
+	)
+}
@@ -0,0 +1,71 @@
+package miniprogram
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const apiToken = "/cgi-bin/token"
+
+// ErrorEmptyAccessToken 接口没有返回 access_token 也没有返回错误码
+var ErrorEmptyAccessToken = errors.New("empty access_token")
+
+/*
+从微信服务器获取新的 AccessToken
+See: https://developers.weixin.qq.com/miniprogram/dev/api-backend/open-api/access-token/auth.getAccessToken.html
+*/
+func (miniProgram *MiniProgram) refreshAccessTokenFromWXServer() (accessToken string, expiresIn int, err error) {
+	params := url.Values{}
+	params.Add("appid", miniProgram.Config.Appid)
+	params.Add("secret", miniProgram.Config.Secret)
+	params.Add("grant_type", "client_credential")
+	url := miniProgram.Client.ServerUrl() + apiToken + "?" + params.Encode()
+
+	response, err := miniProgram.Client.HTTPClient().Get(url)
+	if err != nil {
+		// url 里面有 secret， 不能出现在错误信息里
+		err = utils.StripUrlError(err)
+		return
+	}
+
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("GET %s RETURN %s", apiToken, response.Status)
+		return
+	}
+
+	resp, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return
+	}
+
+	var result = struct {
+		AccessToken string  `json:"access_token"`
+		ExpiresIn   int     `json:"expires_in"`
+		Errcode     float64 `json:"errcode"`
+		Errmsg      string  `json:"errmsg"`
+	}{}
+
+	err = json.Unmarshal(resp, &result)
+	if err != nil {
+		err = fmt.Errorf("unmarshal %s response: %w", apiToken, err)
+		return
+	}
+
+	if result.AccessToken == "" {
+		if result.Errcode != 0 {
+			err = utils.NewWeixinError(apiToken, int64(result.Errcode), result.Errmsg)
+			return
+		}
+		err = ErrorEmptyAccessToken
+		return
+	}
+
+	return result.AccessToken, result.ExpiresIn, nil
+}
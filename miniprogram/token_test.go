@@ -0,0 +1,49 @@
+package miniprogram
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAccessTokenError(t *testing.T) {
+	status, body := http.StatusOK, "{}"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer ts.Close()
+	miniProgram := New(nil, nil, &Config{
+		Appid:  "appid",
+		Secret: "SECRET_VALUE",
+	}, utils.WithServerUrl(ts.URL))
+
+	// 没有 access_token 也没有错误码
+	_, _, err := miniProgram.GetAccessToken()
+	require.True(t, errors.Is(err, ErrorEmptyAccessToken))
+
+	// 错误信息里不能有 secret
+	status = http.StatusBadGateway
+	_, _, err = miniProgram.GetAccessToken()
+	require.NotEqual(t, nil, err)
+	require.False(t, strings.Contains(err.Error(), "SECRET_VALUE"))
+
+	status, body = http.StatusOK, "<html>"
+	_, _, err = miniProgram.GetAccessToken()
+	var syntaxErr *json.SyntaxError
+	require.True(t, errors.As(err, &syntaxErr))
+
+	// 网络错误的信息里也不能有 secret
+	ts.Close()
+	_, _, err = miniProgram.GetAccessToken()
+	var urlErr *url.Error
+	require.True(t, errors.As(err, &urlErr))
+	require.False(t, strings.Contains(err.Error(), "SECRET_VALUE"))
+}
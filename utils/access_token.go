@@ -77,6 +77,37 @@ func (atc *AccessTokenCache) GetAccessToken() (accessToken string, err error) {
 	return atc.refreshAccessToken()
 }
 
+// InvalidateAccessToken 服务器返回token失效， 删除缓存并强制刷新
+// staleAccessToken 是失效的token， 如果缓存的token已经被别人刷新了， 直接使用新的token
+func (atc *AccessTokenCache) InvalidateAccessToken(staleAccessToken string) (accessToken string, err error) {
+	lockKey := atc.accessTokenGetter.GetAccessTokenLockKey()
+	locked, err := atc.accessTokenLock.LockTimeout(
+		lockKey, defaultLockTimeout, defaultLockRetryTime, defaultLockRetryTimeout,
+	)
+	if err != nil || !locked {
+		// 出错或者加锁失败
+		return "", err
+	}
+	defer atc.accessTokenLock.UnLock(lockKey)
+
+	// 是不是别人已经刷新了Token
+	accessToken, err = atc.getCachedAccessToken()
+	if err != nil {
+		return "", err
+	} else if accessToken != "" && accessToken != staleAccessToken {
+		return accessToken, nil
+	}
+
+	// 删除失效的token
+	err = atc.cache.Delete(atc.accessTokenGetter.GetAccessTokenKey())
+	if err != nil {
+		return "", err
+	}
+	_ = atc.cache.Delete(atc.getAccessTokenExpiresKey())
+
+	return atc.refreshAccessToken()
+}
+
 func (atc *AccessTokenCache) getCachedAccessToken() (accessToken string, err error) {
 	accessTokenCacheKey := atc.accessTokenGetter.GetAccessTokenKey()
 	exist := false
@@ -102,17 +133,72 @@ func (atc *AccessTokenCache) refreshAccessToken() (accessToken string, err error
 	}
 
 	// 减去提前刷新的时间
-	expires := expiresIn - atc.expireBefore // 秒
+	expires := time.Duration(expiresIn-atc.expireBefore) * time.Second
 	accessTokenCacheKey := atc.accessTokenGetter.GetAccessTokenKey()
-	err = atc.cache.Set(accessTokenCacheKey, accessToken, time.Duration(expires)*time.Second)
+	err = atc.cache.Set(accessTokenCacheKey, accessToken, expires)
 	if err != nil {
 		// 如果存到缓存失败， token依然是可用的，
 		// 因为如果缓存出了问题， 下次刷新Token也会失败， 不会导致token配额用尽
 		return accessToken, nil
 	}
+
+	// 记录缓存的过期时间， 供后台刷新使用， 失败不影响token使用
+	_ = atc.cache.Set(
+		atc.getAccessTokenExpiresKey(), time.Now().Add(expires).Unix(), expires,
+	)
 	return
 }
 
+// 缓存的过期时间的key
+func (atc *AccessTokenCache) getAccessTokenExpiresKey() string {
+	return atc.accessTokenGetter.GetAccessTokenKey() + ".expires"
+}
+
+// getCachedAccessTokenExpires 获取缓存token的过期时间， 不存在返回零值
+func (atc *AccessTokenCache) getCachedAccessTokenExpires() (expiresAt time.Time, err error) {
+	var timestamp int64
+	exist, err := atc.cache.Get(atc.getAccessTokenExpiresKey(), &timestamp)
+	if err != nil || !exist {
+		return
+	}
+	return time.Unix(timestamp, 0), nil
+}
+
+// refreshAccessTokenBefore 如果缓存的token在ahead时间内过期， 加锁刷新
+func (atc *AccessTokenCache) refreshAccessTokenBefore(ahead time.Duration) (refreshed bool, err error) {
+	expiresAt, err := atc.getCachedAccessTokenExpires()
+	if err != nil {
+		return
+	}
+	if !expiresAt.IsZero() && time.Until(expiresAt) > ahead {
+		return false, nil
+	}
+
+	lockKey := atc.accessTokenGetter.GetAccessTokenLockKey()
+	locked, err := atc.accessTokenLock.LockTimeout(
+		lockKey, defaultLockTimeout, defaultLockRetryTime, defaultLockRetryTimeout,
+	)
+	if err != nil || !locked {
+		return false, err
+	}
+	defer atc.accessTokenLock.UnLock(lockKey)
+
+	// 是不是别的副本已经刷新了
+	expiresAt, err = atc.getCachedAccessTokenExpires()
+	if err != nil {
+		return
+	}
+	if !expiresAt.IsZero() && time.Until(expiresAt) > ahead {
+		return false, nil
+	}
+
+	_, err = atc.refreshAccessToken()
+	if err != nil {
+		return
+	}
+	return true, nil
+}
+
 // TokenResponse 刷新token相应体
 type TokenResponse struct {
 	AccessToken string  `json:"access_token"`
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+const (
+	defaultRefreshInterval time.Duration = 60 * time.Second // 缺省每分钟检查一次
+	defaultRefreshAhead    time.Duration = 5 * time.Minute  // 缺省在缓存过期前5分钟刷新
+	defaultRefreshJitter   time.Duration = 60 * time.Second // 缺省随机提前最多1分钟， 避免多个副本同时刷新
+
+	RefreshResultSuccess = "success"
+	RefreshResultFailure = "failure"
+)
+
+var (
+	// MeasureAccessTokenRefresh 后台刷新token的次数
+	MeasureAccessTokenRefresh = stats.Int64(
+		"lixinio/weixin/access_token_refresh", "Number of access token background refreshes", stats.UnitDimensionless,
+	)
+	// KeyAccessToken token的key
+	KeyAccessToken = tag.MustNewKey("access_token_key")
+	// KeyRefreshResult 刷新结果 success/failure
+	KeyRefreshResult = tag.MustNewKey("result")
+
+	// AccessTokenRefreshView 按token和结果统计刷新次数， 使用者通过 view.Register 注册
+	AccessTokenRefreshView = &view.View{
+		Name:        "lixinio/weixin/access_token_refresh_count",
+		Description: "Count of access token background refreshes by key and result",
+		Measure:     MeasureAccessTokenRefresh,
+		TagKeys:     []tag.Key{KeyAccessToken, KeyRefreshResult},
+		Aggregation: view.Count(),
+	}
+)
+
+// AccessTokenRefresher 后台主动刷新token， 避免请求时才发现token过期
+type AccessTokenRefresher struct {
+	mutex    sync.Mutex
+	caches   []*AccessTokenCache
+	interval time.Duration // 检查间隔
+	ahead    time.Duration // 在缓存过期前多久刷新
+	jitter   time.Duration // 随机再提前的最大时长
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewAccessTokenRefresher 参数为0时使用缺省值
+func NewAccessTokenRefresher(interval, ahead, jitter time.Duration) *AccessTokenRefresher {
+	if interval == 0 {
+		interval = defaultRefreshInterval
+	}
+	if ahead == 0 {
+		ahead = defaultRefreshAhead
+	}
+	if jitter == 0 {
+		jitter = defaultRefreshJitter
+	}
+	return &AccessTokenRefresher{
+		interval: interval,
+		ahead:    ahead,
+		jitter:   jitter,
+	}
+}
+
+// Register 注册需要后台刷新的token， 比如 officialAccount.Client.AccessTokenCache()
+func (r *AccessTokenRefresher) Register(accessTokenCache *AccessTokenCache) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.caches = append(r.caches, accessTokenCache)
+}
+
+// Start 启动后台刷新， ctx 取消或者调用 Stop 后退出
+func (r *AccessTokenRefresher) Start(ctx context.Context) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.cancel != nil {
+		// 已经启动
+		return
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+	go r.run(ctx, r.done)
+}
+
+// Stop 停止后台刷新， 等待正在进行的刷新完成
+func (r *AccessTokenRefresher) Stop() {
+	r.mutex.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.mutex.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+func (r *AccessTokenRefresher) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	// 启动时先检查一次
+	r.refreshAll(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			r.refreshAll(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *AccessTokenRefresher) refreshAll(ctx context.Context) {
+	r.mutex.Lock()
+	caches := make([]*AccessTokenCache, len(r.caches))
+	copy(caches, r.caches)
+	r.mutex.Unlock()
+
+	for _, accessTokenCache := range caches {
+		if ctx.Err() != nil {
+			return
+		}
+		r.refresh(ctx, accessTokenCache)
+	}
+}
+
+func (r *AccessTokenRefresher) refresh(ctx context.Context, accessTokenCache *AccessTokenCache) {
+	ahead := r.ahead
+	if r.jitter > 0 {
+		ahead += time.Duration(rand.Int63n(int64(r.jitter)))
+	}
+
+	refreshed, err := accessTokenCache.refreshAccessTokenBefore(ahead)
+	if err == nil && !refreshed {
+		// 还没到刷新时间或者别的副本已经刷新
+		return
+	}
+
+	result := RefreshResultSuccess
+	if err != nil {
+		result = RefreshResultFailure
+	}
+	_ = stats.RecordWithTags(
+		ctx,
+		[]tag.Mutator{
+			tag.Upsert(KeyAccessToken, accessTokenCache.accessTokenGetter.GetAccessTokenKey()),
+			tag.Upsert(KeyRefreshResult, result),
+		},
+		MeasureAccessTokenRefresh.M(1),
+	)
+}
@@ -0,0 +1,93 @@
+package utils_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+)
+
+type tokenGetter struct {
+	count     int32
+	expiresIn int
+}
+
+func (g *tokenGetter) GetAccessToken() (string, int, error) {
+	n := atomic.AddInt32(&g.count, 1)
+	return fmt.Sprintf("token%d", n), g.expiresIn, nil
+}
+
+func (g *tokenGetter) GetAccessTokenKey() string {
+	return fmt.Sprintf("access-token:refresher:%d", g.expiresIn)
+}
+
+func (g *tokenGetter) GetAccessTokenLockKey() string {
+	return g.GetAccessTokenKey() + ".lock"
+}
+
+func TestAccessTokenRefresher(t *testing.T) {
+	require.Equal(t, nil, view.Register(utils.AccessTokenRefreshView))
+	defer view.Unregister(utils.AccessTokenRefreshView)
+
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+
+	// 缓存1秒就过期， 每次检查都要刷新
+	shortGetter := &tokenGetter{expiresIn: 2}
+	shortCache := utils.NewAccessTokenCache(shortGetter, cache, cache, 1)
+	// 缓存足够长， 只需要首次刷新
+	longGetter := &tokenGetter{expiresIn: 7200}
+	longCache := utils.NewAccessTokenCache(longGetter, cache, cache, 0)
+
+	refresher := utils.NewAccessTokenRefresher(20*time.Millisecond, 0, time.Millisecond)
+	refresher.Register(shortCache)
+	refresher.Register(longCache)
+	refresher.Start(context.Background())
+	time.Sleep(100 * time.Millisecond)
+	refresher.Stop()
+
+	require.GreaterOrEqual(t, atomic.LoadInt32(&shortGetter.count), int32(3))
+	require.Equal(t, int32(1), atomic.LoadInt32(&longGetter.count))
+
+	// 请求时直接使用后台刷新的token
+	token, err := longCache.GetAccessToken()
+	require.Equal(t, nil, err)
+	require.Equal(t, "token1", token)
+	require.Equal(t, int32(1), atomic.LoadInt32(&longGetter.count))
+
+	rows, err := view.RetrieveData(utils.AccessTokenRefreshView.Name)
+	require.Equal(t, nil, err)
+	require.NotEmpty(t, rows)
+
+	// 停止之后不再刷新
+	count := atomic.LoadInt32(&shortGetter.count)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, count, atomic.LoadInt32(&shortGetter.count))
+}
+
+func TestAccessTokenRefresherContext(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+
+	getter := &tokenGetter{expiresIn: 2}
+	refresher := utils.NewAccessTokenRefresher(10*time.Millisecond, 0, time.Millisecond)
+	refresher.Register(utils.NewAccessTokenCache(getter, cache, cache, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	refresher.Start(ctx)
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+
+	count := atomic.LoadInt32(&getter.count)
+	require.Greater(t, count, int32(0))
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(t, count, atomic.LoadInt32(&getter.count))
+	refresher.Stop()
+}
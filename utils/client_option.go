@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultAccessTokenParam = "access_token"
+
+type clientOptions struct {
+	serverUrl        string
+	accessTokenParam string
+	httpClient       *http.Client
+	transport        http.RoundTripper
+	proxy            func(*http.Request) (*url.URL, error)
+	timeout          time.Duration
+	retryPolicy      *RetryPolicy
+	limiter          Limiter
+}
+
+// ClientOption 配置 Client， 比如 official_account.New / agent.New / open.New 的可选参数
+type ClientOption func(*clientOptions)
+
+// WithServerUrl 替换服务器地址， 比如指向本地的模拟服务器
+func WithServerUrl(serverUrl string) ClientOption {
+	return func(options *clientOptions) {
+		options.serverUrl = serverUrl
+	}
+}
+
+// WithAccessTokenParam 附加token的参数名， 比如第三方平台的 component_access_token
+func WithAccessTokenParam(name string) ClientOption {
+	return func(options *clientOptions) {
+		options.accessTokenParam = name
+	}
+}
+
+// WithHTTPClient 使用指定的 http.Client， 以便共享连接池， 此时忽略 WithTransport/WithProxy/WithTimeout
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(options *clientOptions) {
+		options.httpClient = httpClient
+	}
+}
+
+// WithTransport 底层的 RoundTripper， 缺省 http.DefaultTransport， 外层依然附加trace
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(options *clientOptions) {
+		options.transport = transport
+	}
+}
+
+// WithProxy 通过代理访问服务器
+func WithProxy(proxyUrl *url.URL) ClientOption {
+	return func(options *clientOptions) {
+		options.proxy = http.ProxyURL(proxyUrl)
+	}
+}
+
+// WithTimeout 单次请求的超时时间
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(options *clientOptions) {
+		options.timeout = timeout
+	}
+}
+
+// WithRetryPolicy 重试策略， nil 表示不重试
+func WithRetryPolicy(retryPolicy *RetryPolicy) ClientOption {
+	return func(options *clientOptions) {
+		options.retryPolicy = retryPolicy
+	}
+}
+
+// WithLimiter 客户端限流
+func WithLimiter(limiter Limiter) ClientOption {
+	return func(options *clientOptions) {
+		options.limiter = limiter
+	}
+}
+
+func (options *clientOptions) newHTTPClient() *http.Client {
+	if options.httpClient != nil {
+		return options.httpClient
+	}
+
+	transport := options.transport
+	if options.proxy != nil {
+		base, ok := transport.(*http.Transport)
+		if transport == nil {
+			base, ok = http.DefaultTransport.(*http.Transport)
+		}
+		if ok {
+			base = base.Clone()
+			base.Proxy = options.proxy
+			transport = base
+		}
+	}
+
+	return &http.Client{
+		Transport: newTransport(transport, options.accessTokenParam),
+		Timeout:   options.timeout,
+	}
+}
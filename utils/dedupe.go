@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// 微信服务器5秒内收不到响应会断掉连接并重试， 共三次
+const defaultCallbackDedupeTTL = 5 * time.Minute
+
+// CallbackDeduplicator 识别重试的推送， 避免同一条消息/事件处理多次
+// See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Receiving_standard_messages.html
+type CallbackDeduplicator struct {
+	locker Lock
+	ttl    time.Duration
+}
+
+// NewCallbackDeduplicator ttl 为记录保存的时长， 0表示缺省5分钟
+// 使用 Lock 原子地占用 key， 多个副本同时收到重试也只有一个能处理
+func NewCallbackDeduplicator(locker Lock, ttl time.Duration) *CallbackDeduplicator {
+	if ttl <= 0 {
+		ttl = defaultCallbackDedupeTTL
+	}
+	return &CallbackDeduplicator{
+		locker: locker,
+		ttl:    ttl,
+	}
+}
+
+// CallbackDedupeKey 消息使用 MsgId 排重， 事件使用 FromUserName + CreateTime 排重
+// toUserName 区分不同的公众号/企业应用
+func CallbackDedupeKey(toUserName, fromUserName, createTime, event, msgId string) string {
+	if msgId != "" {
+		return fmt.Sprintf("callback-dedupe:%s:msg:%s", toUserName, msgId)
+	}
+	return fmt.Sprintf("callback-dedupe:%s:event:%s:%s:%s", toUserName, fromUserName, createTime, event)
+}
+
+// Acquire 第一次收到返回 true， 重复推送返回 false
+func (d *CallbackDeduplicator) Acquire(key string) (bool, error) {
+	return d.locker.Lock(key, d.ttl)
+}
+
+// Release 处理失败时删除记录， 以便微信重试时重新处理
+func (d *CallbackDeduplicator) Release(key string) error {
+	return d.locker.UnLock(key)
+}
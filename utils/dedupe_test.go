@@ -0,0 +1,44 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallbackDeduplicator(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	deduplicator := utils.NewCallbackDeduplicator(cache, 0)
+	key := utils.CallbackDedupeKey("gh_123456", "openid", "1348831860", "", "1234567890123456")
+
+	// 并发的重试只有一个能处理
+	type result struct {
+		first bool
+		err   error
+	}
+	results := make(chan result, 50)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			first, err := deduplicator.Acquire(key)
+			results <- result{first, err}
+		}()
+	}
+	acquired := 0
+	for i := 0; i < cap(results); i++ {
+		r := <-results
+		require.Equal(t, nil, r.err)
+		if r.first {
+			acquired++
+		}
+	}
+	require.Equal(t, 1, acquired)
+
+	// 处理失败释放之后可以重新处理
+	require.Equal(t, nil, deduplicator.Release(key))
+	first, err := deduplicator.Acquire(key)
+	require.Equal(t, nil, err)
+	require.True(t, first)
+}
@@ -0,0 +1,187 @@
+package utils
+
+// 全局错误码
+// 公众号 https://developers.weixin.qq.com/doc/offiaccount/Getting_Started/Global_Return_Code.html
+// 企业微信 https://work.weixin.qq.com/api/doc/90000/90139/90313
+
+const (
+	// 公众号/企业微信 通用
+	ErrcodeSystemBusy         int64 = -1    // 系统繁忙，此时请开发者稍候再试
+	ErrcodeInvalidCredential  int64 = 40001 // 获取 access_token 时 AppSecret 错误，或者 access_token 无效
+	ErrcodeInvalidGrantType   int64 = 40002 // 不合法的凭证类型
+	ErrcodeInvalidOpenid      int64 = 40003 // 不合法的 OpenID / UserID
+	ErrcodeInvalidAppid       int64 = 40013 // 不合法的 AppID / CorpID
+	ErrcodeInvalidAccessToken int64 = 40014 // 不合法的 access_token
+	ErrcodeInvalidCode        int64 = 40029 // 不合法的 oauth_code
+	ErrcodeInvalidAppSecret   int64 = 40125 // 无效的 AppSecret
+	ErrcodeCodeBeenUsed       int64 = 40163 // oauth_code 已使用
+	ErrcodeInvalidIp          int64 = 40164 // 调用接口的IP地址不在白名单中
+	ErrcodeAccessTokenMissing int64 = 41001 // 缺少 access_token 参数
+	ErrcodeAccessTokenExpired int64 = 42001 // access_token 超时
+	ErrcodeRefreshTokenExpire int64 = 42002 // refresh_token 超时
+	ErrcodeRequireSubscribe   int64 = 43004 // 需要接收者关注
+	ErrcodeContentSizeLimit   int64 = 45002 // 消息内容超过限制
+	ErrcodeApiFreqOutOfLimit  int64 = 45009 // 接口调用超过限制
+	ErrcodeApiMinuteQuota     int64 = 45011 // API 调用太频繁，请稍候再试
+	ErrcodeResponseOutOfTime  int64 = 45015 // 回复时间超过限制(用户48小时内没有互动)
+	ErrcodeOutOfResponseLimit int64 = 45047 // 客服接口下行条数超过上限
+	ErrcodeApiUnauthorized    int64 = 48001 // api 功能未授权
+	ErrcodeApiForbidden       int64 = 48002 // 粉丝拒收消息 / API 接口被禁用
+	ErrcodeUserUnauthorized   int64 = 50001 // 用户未授权该 api
+	ErrcodeRiskyContent       int64 = 87014 // 内容含有违法违规内容
+
+	// 公众号网页授权
+	ErrcodeInvalidRefreshToken int64 = 40030 // 不合法的 refresh_token
+
+	// 素材
+	ErrcodeInvalidMediaType int64 = 40004 // 不合法的媒体文件类型
+	ErrcodeInvalidMediaID   int64 = 40007 // 不合法的媒体文件 id
+	ErrcodeInvalidMediaSize int64 = 40009 // 不合法的媒体文件大小
+	ErrcodeMediaMissing     int64 = 41005 // 缺少多媒体文件数据
+
+	// 企业微信
+	ErrcodeInvalidAgentid       int64 = 40056 // 不合法的 agentid
+	ErrcodeMaxConcurrentCall    int64 = 45033 // 接口并发调用超过限制
+	ErrcodeDepartmentNameExists int64 = 60008 // 部门名称已存在
+	ErrcodeNoPrivilege          int64 = 60011 // 指定的成员/部门/标签参数无权限
+	ErrcodeIpNotAllowed         int64 = 60020 // 不允许的 IP 地址访问
+	ErrcodeUseridExists         int64 = 60102 // UserID 已存在
+	ErrcodeMobileExists         int64 = 60104 // 手机号码已存在
+	ErrcodeUseridNotFound       int64 = 60111 // UserID 不存在
+	ErrcodeInvalidPartyId       int64 = 60123 // 无效的部门 id
+	ErrcodeInvalidContactTarget int64 = 81013 // UserID、部门ID、标签ID全部非法或无权限
+
+	// 公众号模板消息/订阅消息
+	ErrcodeInvalidTemplateId int64 = 40037 // 不合法的模板id
+	ErrcodeInvalidIndustryId int64 = 40102 // 不合法的行业id
+	ErrcodeUserRefuseMessage int64 = 43101 // 用户拒绝接受消息
+	ErrcodeTemplateSizeLimit int64 = 45026 // 模板数量超出限制
+
+	// 公众号自定义菜单
+	ErrcodeMenuNotExist            int64 = 46003 // 不存在的菜单数据
+	ErrcodeConditionalMenuNotExist int64 = 65301 // 不存在此 menuid 对应的个性化菜单
+	ErrcodeNoDefaultMenu           int64 = 65303 // 没有默认菜单，不能创建个性化菜单
+	ErrcodeEmptyMatchRule          int64 = 65304 // MatchRule 信息为空
+
+	// 公众号客服
+	ErrcodeInvalidKfAccount   int64 = 65401 // 无效客服帐号
+	ErrcodeKfAccountExists    int64 = 65406 // 已经存在的客服帐号
+	ErrcodeKfSessionNotFound  int64 = 65413 // 不存在对应用户的会话信息
+	ErrcodeKfSessionOccupied  int64 = 65414 // 粉丝正在被其他客服接待
+	ErrcodeKfAccountOffline   int64 = 65415 // 客服不在线
+	ErrcodeInvalidQueryParams int64 = 65416 // 查询参数不合法
+)
+
+// 常用错误码的哨兵值， 配合 errors.Is 使用
+var (
+	ErrorInvalidCredential  = WeixinError{Errcode: ErrcodeInvalidCredential, Errmsg: "invalid credential"}
+	ErrorInvalidOpenid      = WeixinError{Errcode: ErrcodeInvalidOpenid, Errmsg: "invalid openid"}
+	ErrorInvalidCode        = WeixinError{Errcode: ErrcodeInvalidCode, Errmsg: "invalid code"}
+	ErrorCodeBeenUsed       = WeixinError{Errcode: ErrcodeCodeBeenUsed, Errmsg: "code been used"}
+	ErrorInvalidIp          = WeixinError{Errcode: ErrcodeInvalidIp, Errmsg: "invalid ip"}
+	ErrorRefreshTokenExpire = WeixinError{Errcode: ErrcodeRefreshTokenExpire, Errmsg: "refresh_token expired"}
+	ErrorRequireSubscribe   = WeixinError{Errcode: ErrcodeRequireSubscribe, Errmsg: "require subscribe"}
+	ErrorApiFreqOutOfLimit  = WeixinError{Errcode: ErrcodeApiFreqOutOfLimit, Errmsg: "api freq out of limit"}
+	ErrorApiMinuteQuota     = WeixinError{Errcode: ErrcodeApiMinuteQuota, Errmsg: "api minute-quota reach limit"}
+	ErrorResponseOutOfTime  = WeixinError{Errcode: ErrcodeResponseOutOfTime, Errmsg: "response out of time limit"}
+	ErrorOutOfResponseLimit = WeixinError{Errcode: ErrcodeOutOfResponseLimit, Errmsg: "out of response count limit"}
+	ErrorApiUnauthorized    = WeixinError{Errcode: ErrcodeApiUnauthorized, Errmsg: "api unauthorized"}
+	ErrorApiForbidden       = WeixinError{Errcode: ErrcodeApiForbidden, Errmsg: "api forbidden"}
+	ErrorUserUnauthorized   = WeixinError{Errcode: ErrcodeUserUnauthorized, Errmsg: "user unauthorized"}
+	ErrorRiskyContent       = WeixinError{Errcode: ErrcodeRiskyContent, Errmsg: "risky content"}
+	ErrorUserRefuseMessage  = WeixinError{Errcode: ErrcodeUserRefuseMessage, Errmsg: "user refuse to accept the msg"}
+	ErrorInvalidMediaID     = WeixinError{Errcode: ErrcodeInvalidMediaID, Errmsg: "invalid media_id"}
+
+	ErrorMaxConcurrentCall = WeixinError{Errcode: ErrcodeMaxConcurrentCall, Errmsg: "max concurrent call limit"}
+	ErrorNoPrivilege       = WeixinError{Errcode: ErrcodeNoPrivilege, Errmsg: "no privilege"}
+	ErrorIpNotAllowed      = WeixinError{Errcode: ErrcodeIpNotAllowed, Errmsg: "ip not allowed"}
+	ErrorUseridNotFound    = WeixinError{Errcode: ErrcodeUseridNotFound, Errmsg: "userid not found"}
+)
+
+var errcodeDescriptions = map[int64]string{
+	ErrcodeSystemBusy:         "系统繁忙，此时请开发者稍候再试",
+	ErrcodeInvalidCredential:  "AppSecret 错误，或者 access_token 无效",
+	ErrcodeInvalidGrantType:   "不合法的凭证类型",
+	ErrcodeInvalidOpenid:      "不合法的 OpenID / UserID",
+	ErrcodeInvalidAppid:       "不合法的 AppID / CorpID",
+	ErrcodeInvalidAccessToken: "不合法的 access_token",
+	ErrcodeInvalidCode:        "不合法的 oauth_code",
+	ErrcodeInvalidAppSecret:   "无效的 AppSecret",
+	ErrcodeCodeBeenUsed:       "oauth_code 已使用",
+	ErrcodeInvalidIp:          "调用接口的IP地址不在白名单中",
+	ErrcodeAccessTokenMissing: "缺少 access_token 参数",
+	ErrcodeAccessTokenExpired: "access_token 超时",
+	ErrcodeRefreshTokenExpire: "refresh_token 超时",
+	ErrcodeRequireSubscribe:   "需要接收者关注",
+	ErrcodeContentSizeLimit:   "消息内容超过限制",
+	ErrcodeApiFreqOutOfLimit:  "接口调用超过限制",
+	ErrcodeApiMinuteQuota:     "API 调用太频繁，请稍候再试",
+	ErrcodeResponseOutOfTime:  "回复时间超过限制",
+	ErrcodeOutOfResponseLimit: "客服接口下行条数超过上限",
+	ErrcodeApiUnauthorized:    "api 功能未授权",
+	ErrcodeApiForbidden:       "api 接口被禁用",
+	ErrcodeUserUnauthorized:   "用户未授权该 api",
+	ErrcodeRiskyContent:       "内容含有违法违规内容",
+
+	ErrcodeInvalidRefreshToken: "不合法的 refresh_token",
+
+	ErrcodeInvalidMediaType: "不合法的媒体文件类型",
+	ErrcodeInvalidMediaID:   "不合法的媒体文件 id",
+	ErrcodeInvalidMediaSize: "不合法的媒体文件大小",
+	ErrcodeMediaMissing:     "缺少多媒体文件数据",
+
+	ErrcodeInvalidAgentid:       "不合法的 agentid",
+	ErrcodeMaxConcurrentCall:    "接口并发调用超过限制",
+	ErrcodeDepartmentNameExists: "部门名称已存在",
+	ErrcodeNoPrivilege:          "指定的成员/部门/标签参数无权限",
+	ErrcodeIpNotAllowed:         "不允许的 IP 地址访问",
+	ErrcodeUseridExists:         "UserID 已存在",
+	ErrcodeMobileExists:         "手机号码已存在",
+	ErrcodeUseridNotFound:       "UserID 不存在",
+	ErrcodeInvalidPartyId:       "无效的部门 id",
+	ErrcodeInvalidContactTarget: "UserID、部门ID、标签ID全部非法或无权限",
+
+	ErrcodeInvalidTemplateId: "不合法的模板id",
+	ErrcodeInvalidIndustryId: "不合法的行业id",
+	ErrcodeUserRefuseMessage: "用户拒绝接受消息",
+	ErrcodeTemplateSizeLimit: "模板数量超出限制",
+
+	ErrcodeMenuNotExist:            "不存在的菜单数据",
+	ErrcodeConditionalMenuNotExist: "不存在此 menuid 对应的个性化菜单",
+	ErrcodeNoDefaultMenu:           "没有默认菜单，不能创建个性化菜单",
+	ErrcodeEmptyMatchRule:          "MatchRule 信息为空",
+
+	ErrcodeInvalidKfAccount:   "无效客服帐号",
+	ErrcodeKfAccountExists:    "已经存在的客服帐号",
+	ErrcodeKfSessionNotFound:  "不存在对应用户的会话信息",
+	ErrcodeKfSessionOccupied:  "粉丝正在被其他客服接待",
+	ErrcodeKfAccountOffline:   "客服不在线",
+	ErrcodeInvalidQueryParams: "查询参数不合法",
+}
+
+// ErrcodeDescription 错误码说明， 未收录的返回空
+func ErrcodeDescription(errcode int64) string {
+	return errcodeDescriptions[errcode]
+}
+
+// IsAccessTokenErrcode 表示 access_token 失效， 需要刷新 access_token 的错误码
+func IsAccessTokenErrcode(errcode int64) bool {
+	switch errcode {
+	case ErrcodeInvalidCredential,
+		ErrcodeInvalidAccessToken,
+		ErrcodeAccessTokenMissing,
+		ErrcodeAccessTokenExpired:
+		return true
+	}
+	return false
+}
+
+// IsOauthTokenErrcode 网页授权的 access_token 或者 refresh_token 无效/过期， 需要用户重新授权
+// 系统繁忙、调用超过限制等其他错误不表示凭证无效
+func IsOauthTokenErrcode(errcode int64) bool {
+	switch errcode {
+	case ErrcodeInvalidRefreshToken, ErrcodeRefreshTokenExpire:
+		return true
+	}
+	return IsAccessTokenErrcode(errcode)
+}
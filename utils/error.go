@@ -2,8 +2,11 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
+	"strings"
 )
 
 // https://github.com/silenceper/wechat/blob/813684e55535af7fb4cb29c3e3a9e2a02384b34e/util/error.go
@@ -14,6 +17,76 @@ type CommonError struct {
 	ErrMsg  string `json:"errmsg"`
 }
 
+var (
+	// ErrorAccessToken access_token 无效/过期/缺失， 匹配 40001 40014 41001 42001
+	ErrorAccessToken = errors.New("access token error")
+	// ErrorSystemBusy 系统繁忙， 匹配 -1
+	ErrorSystemBusy = errors.New("system busy")
+
+	ridPattern  = regexp.MustCompile(`rid:\s*([0-9a-zA-Z\-]+)`)
+	hintPattern = regexp.MustCompile(`hint:\s*\[([^\]]*)\]`)
+)
+
+// WeixinError 微信/企业微信接口返回的错误
+// 可以用 errors.Is(err, utils.ErrorApiFreqOutOfLimit) 判断具体的错误码，
+// 或者 errors.As(err, &utils.WeixinError{}) 获取详细信息
+type WeixinError struct {
+	Errcode int64  `json:"errcode"`
+	Errmsg  string `json:"errmsg"`
+	Api     string `json:"-"` // 接口路径
+	Rid     string `json:"-"` // 微信的请求ID， 从errmsg中解析
+	Hint    string `json:"-"` // 企业微信的请求ID， 从errmsg中解析
+}
+
+// NewWeixinError 构造错误， 并从errmsg中解析rid/hint
+func NewWeixinError(api string, errcode int64, errmsg string) WeixinError {
+	we := WeixinError{
+		Errcode: errcode,
+		Errmsg:  errmsg,
+		Api:     api,
+	}
+	if match := ridPattern.FindStringSubmatch(errmsg); match != nil {
+		we.Rid = match[1]
+	}
+	if match := hintPattern.FindStringSubmatch(errmsg); match != nil {
+		we.Hint = match[1]
+	}
+	return we
+}
+
+func (we WeixinError) Error() string {
+	var builder strings.Builder
+	if we.Api != "" {
+		builder.WriteString(we.Api)
+		builder.WriteString(" ")
+	}
+	fmt.Fprintf(&builder, "errcode=%d, errmsg=%s", we.Errcode, we.Errmsg)
+	return builder.String()
+}
+
+// Is 支持 errors.Is， 错误码相同即认为是同一个错误
+func (we WeixinError) Is(target error) bool {
+	switch target {
+	case ErrorAccessToken:
+		return IsAccessTokenErrcode(we.Errcode)
+	case ErrorSystemBusy:
+		return we.Errcode == ErrcodeSystemBusy
+	}
+
+	switch t := target.(type) {
+	case WeixinError:
+		return t.Errcode == we.Errcode
+	case *WeixinError:
+		return t != nil && t.Errcode == we.Errcode
+	}
+	return false
+}
+
+// Description 错误码的说明， 未收录的错误码返回空
+func (we WeixinError) Description() string {
+	return ErrcodeDescription(we.Errcode)
+}
+
 // DecodeWithCommonError 将返回值按照CommonError解析
 func DecodeWithCommonError(response []byte, apiName string) (err error) {
 	var commError CommonError
@@ -22,7 +95,7 @@ func DecodeWithCommonError(response []byte, apiName string) (err error) {
 		return
 	}
 	if commError.ErrCode != 0 {
-		return fmt.Errorf("%s Error , errcode=%d , errmsg=%s", apiName, commError.ErrCode, commError.ErrMsg)
+		return NewWeixinError(apiName, commError.ErrCode, commError.ErrMsg)
 	}
 	return nil
 }
@@ -47,7 +120,7 @@ func DecodeWithError(response []byte, obj interface{}, apiName string) error {
 		return fmt.Errorf("errcode or errmsg is invalid")
 	}
 	if errCode.Int() != 0 {
-		return fmt.Errorf("%s Error , errcode=%d , errmsg=%s", apiName, errCode.Int(), errMsg.String())
+		return NewWeixinError(apiName, errCode.Int(), errMsg.String())
 	}
 	return nil
 }
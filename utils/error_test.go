@@ -0,0 +1,62 @@
+package utils_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeixinError(t *testing.T) {
+	err := fmt.Errorf("wrap: %w", utils.NewWeixinError(
+		"/cgi-bin/message/custom/send", 45009,
+		"reach max api daily quota limit rid: 60f5a3f0-4d0c0b22-1f0c1a53",
+	))
+	require.True(t, errors.Is(err, utils.ErrorApiFreqOutOfLimit))
+	require.False(t, errors.Is(err, utils.ErrorApiUnauthorized))
+	require.False(t, errors.Is(err, utils.ErrorAccessToken))
+
+	weixinErr := utils.WeixinError{}
+	require.True(t, errors.As(err, &weixinErr))
+	require.Equal(t, int64(45009), weixinErr.Errcode)
+	require.Equal(t, "/cgi-bin/message/custom/send", weixinErr.Api)
+	require.Equal(t, "60f5a3f0-4d0c0b22-1f0c1a53", weixinErr.Rid)
+	require.Equal(t, "接口调用超过限制", weixinErr.Description())
+
+	// 企业微信
+	err = utils.NewWeixinError(
+		"/cgi-bin/user/get", 60011,
+		"no privilege to access/modify contact/party/agent , hint: [1626343416_13_b0f7a9d8], from ip: 1.2.3.4",
+	)
+	require.True(t, errors.Is(err, utils.ErrorNoPrivilege))
+	require.True(t, errors.As(err, &weixinErr))
+	require.Equal(t, "1626343416_13_b0f7a9d8", weixinErr.Hint)
+
+	for _, errcode := range []int64{40001, 40014, 41001, 42001} {
+		require.True(t, errors.Is(utils.NewWeixinError("", errcode, ""), utils.ErrorAccessToken))
+	}
+	require.True(t, errors.Is(utils.NewWeixinError("", -1, ""), utils.ErrorSystemBusy))
+}
+
+func TestResponseFilter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"errcode":48001,"errmsg":"api unauthorized"}`)
+	}))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/cgi-bin/menu/create")
+	require.Equal(t, nil, err)
+	defer response.Body.Close()
+
+	_, err = utils.ResponseFilter(response)
+	require.True(t, errors.Is(err, utils.ErrorApiUnauthorized))
+	require.Equal(t, "/cgi-bin/menu/create errcode=48001, errmsg=api unauthorized", err.Error())
+
+	err = utils.DecodeWithCommonError([]byte(`{"errcode":60111,"errmsg":"userid not found"}`), "GetUser")
+	require.True(t, errors.Is(err, utils.ErrorUseridNotFound))
+	require.Equal(t, nil, utils.DecodeWithCommonError([]byte(`{"errcode":0,"errmsg":"ok"}`), "GetUser"))
+}
@@ -28,24 +28,14 @@ import (
 	"net/url"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
 var (
-	ErrorAccessToken = errors.New("access token error")
-	ErrorSystemBusy  = errors.New("system busy")
-	UserAgent        = "lixinio/weixin"
+	UserAgent = "lixinio/weixin"
 )
 
-type WeixinError struct {
-	Errcode int64  `json:"errcode"`
-	Errmsg  string `json:"errmsg"`
-}
-
-func (we WeixinError) Error() string {
-	return we.Errmsg
-}
-
 func filterFlags(content string) string {
 	for i, char := range content {
 		if char == ' ' || char == ';' {
@@ -70,16 +60,59 @@ type Client struct {
 	serverUrl        string
 	userAgent        string
 	accessTokenCache *AccessTokenCache
+	accessTokenParam string // 附加token的参数名， 缺省 access_token
+	httpClient       *http.Client
+	retryPolicy      *RetryPolicy
+	limiter          Limiter
 }
 
-func NewClient(serverUrl string, accessTokenCache *AccessTokenCache) *Client {
-	return &Client{
+// NewClient serverUrl 为缺省的服务器地址， 可以通过 WithServerUrl 覆盖
+func NewClient(serverUrl string, accessTokenCache *AccessTokenCache, opts ...ClientOption) *Client {
+	options := &clientOptions{
 		serverUrl:        serverUrl,
+		accessTokenParam: defaultAccessTokenParam,
+		retryPolicy:      DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &Client{
+		serverUrl:        options.serverUrl,
 		userAgent:        UserAgent,
 		accessTokenCache: accessTokenCache,
+		accessTokenParam: options.accessTokenParam,
+		httpClient:       options.newHTTPClient(),
+		retryPolicy:      options.retryPolicy,
+		limiter:          options.limiter,
 	}
 }
 
+// ServerUrl 服务器地址， 比如 https://api.weixin.qq.com
+func (client *Client) ServerUrl() string {
+	return client.serverUrl
+}
+
+// HTTPClient 发送请求的 http.Client， 不会附加 access_token， 用于获取token等接口
+func (client *Client) HTTPClient() *http.Client {
+	return client.httpClient
+}
+
+// SetRetryPolicy 设置重试策略， nil 表示不重试
+func (client *Client) SetRetryPolicy(retryPolicy *RetryPolicy) {
+	client.retryPolicy = retryPolicy
+}
+
+// SetLimiter 设置客户端限流， 避免触发 45009 等频率限制， nil 表示不限流
+func (client *Client) SetLimiter(limiter Limiter) {
+	client.limiter = limiter
+}
+
+// AccessTokenCache 获取token缓存对象， 比如注册到 AccessTokenRefresher
+func (client *Client) AccessTokenCache() *AccessTokenCache {
+	return client.accessTokenCache
+}
+
 // HTTPGet GET 请求
 func (client *Client) HTTPGet(ctx context.Context, uri string) (resp []byte, err error) {
 	return client.HTTPGetWithParams(ctx, uri, url.Values{})
@@ -99,6 +132,18 @@ func (client *Client) HTTPGetWithParams(ctx context.Context, uri string, params
 	return client.httpDo(req.WithContext(ctx))
 }
 
+// HTTPGetWithoutToken 不附加 access_token 的 GET 请求， 用于网页授权等使用用户token或者secret的接口
+// 错误码不会导致刷新 access_token， 也不会重试(oauth_code 只能使用一次)
+func (client *Client) HTTPGetWithoutToken(ctx context.Context, uri string, params url.Values) (resp []byte, err error) {
+	req, err := http.NewRequest(http.MethodGet, client.serverUrl+uri+"?"+params.Encode(), nil)
+	if err != nil {
+		return
+	}
+
+	req.Header.Add("User-Agent", client.userAgent)
+	return client.do(req.WithContext(ctx))
+}
+
 // 素材下载， 需要根据Content-Type来判断Body， 可以是json，可能是二进制
 func (client *Client) HTTPGetWithParamsRaw(ctx context.Context, uri string, params url.Values) (resp *http.Response, err error) {
 	newUrl, err := client.applyAccessToken(uri, params)
@@ -112,9 +157,39 @@ func (client *Client) HTTPGetWithParamsRaw(ctx context.Context, uri string, para
 		return
 	}
 
-	cli := &http.Client{Transport: newTransport()}
 	req.Header.Add("User-Agent", client.userAgent)
-	return cli.Do(req.WithContext(ctx))
+	if client.limiter != nil {
+		if err = client.limiter.Wait(ctx, req.URL.Path); err != nil {
+			return
+		}
+	}
+	resp, err = client.httpClient.Do(req.WithContext(ctx))
+	return resp, StripUrlError(err)
+}
+
+// HTTPPostRaw 和 HTTPGetWithParamsRaw 一样， 用于 POST 方式的素材下载
+func (client *Client) HTTPPostRaw(
+	ctx context.Context, uri string, payload io.Reader, contentType string,
+) (resp *http.Response, err error) {
+	newUrl, err := client.applyAccessToken(uri, url.Values{})
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, client.serverUrl+newUrl, payload)
+	if err != nil {
+		return
+	}
+
+	req.Header.Add("Content-Type", contentType)
+	req.Header.Add("User-Agent", client.userAgent)
+	if client.limiter != nil {
+		if err = client.limiter.Wait(ctx, req.URL.Path); err != nil {
+			return
+		}
+	}
+	resp, err = client.httpClient.Do(req.WithContext(ctx))
+	return resp, StripUrlError(err)
 }
 
 //HTTPPost POST 请求
@@ -124,30 +199,68 @@ func (client *Client) HTTPUpload(
 	payload io.Reader,
 	key, filename string,
 	length int64,
+) (resp []byte, err error) {
+	return client.HTTPUploadWithFields(ctx, uri, nil, payload, key, filename, length)
+}
+
+// HTTPUploadWithFields 和 HTTPUpload 一样流式上传， fields 是文件之前的普通表单字段
+// 比如公众号永久视频素材的 description
+func (client *Client) HTTPUploadWithFields(
+	ctx context.Context,
+	uri string,
+	fields map[string]string,
+	payload io.Reader,
+	key, filename string,
+	length int64,
 ) (resp []byte, err error) {
 	// 头部大小
 	bodyBuffer := new(bytes.Buffer)
 	bodyWriter := multipart.NewWriter(bodyBuffer)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = bodyWriter.WriteField(name, fields[name]); err != nil {
+			return
+		}
+	}
 	_, err = bodyWriter.CreateFormFile(key, path.Base(filename))
 	if err != nil {
 		return
 	}
+	header := bodyBuffer.Bytes()
 	// 尾部
-	closeBuffer := bytes.NewBufferString(fmt.Sprintf("\r\n--%s--\r\n", bodyWriter.Boundary()))
+	footer := []byte(fmt.Sprintf("\r\n--%s--\r\n", bodyWriter.Boundary()))
 
 	newUrl, err := client.applyAccessToken(uri, url.Values{})
 	if err != nil {
 		return
 	}
 
-	reader := io.MultiReader(bodyBuffer, payload, closeBuffer)
+	reader := io.MultiReader(bytes.NewReader(header), payload, bytes.NewReader(footer))
 	req, err := http.NewRequest(http.MethodPost, client.serverUrl+newUrl, ioutil.NopCloser(reader))
 	if err != nil {
 		return
 	}
 	req.TransferEncoding = []string{"identity"}
 	req.Header.Add("Content-Type", bodyWriter.FormDataContentType())
-	req.ContentLength = length + int64(closeBuffer.Len()) + int64(bodyBuffer.Len())
+	req.ContentLength = length + int64(len(footer)) + int64(len(header))
+
+	// 文件等可以 Seek 的内容， access_token 失效或者系统繁忙时可以重新上传
+	if seeker, ok := payload.(io.Seeker); ok {
+		if offset, seekErr := seeker.Seek(0, io.SeekCurrent); seekErr == nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+					return nil, err
+				}
+				return ioutil.NopCloser(
+					io.MultiReader(bytes.NewReader(header), payload, bytes.NewReader(footer)),
+				), nil
+			}
+		}
+	}
 
 	return client.httpDo(req.WithContext(ctx))
 }
@@ -193,52 +306,68 @@ func (client *Client) HTTPPost(
 func (client *Client) httpDo(req *http.Request) (resp []byte, err error) {
 	req.Header.Add("User-Agent", client.userAgent)
 
-	cli := &http.Client{Transport: newTransport()}
-	response, err := cli.Do(req)
-	if err != nil {
-		return
-	}
-	defer response.Body.Close()
-
-	resp, err = ResponseFilter(response)
+	resp, err = client.do(req)
 
-	// 发现 access_token 过期
-	if err == ErrorAccessToken {
-		// 通知到位后 access_token 会被刷新，那么可以 retry 了
+	// 发现 access_token 失效
+	if errors.Is(err, ErrorAccessToken) {
+		tokenErr := err
+		// 删除缓存的 access_token 并强制刷新，然后 retry 一次
+		q := req.URL.Query()
 		var accessToken string
-		accessToken, err = client.accessTokenCache.GetAccessToken()
+		accessToken, err = client.accessTokenCache.InvalidateAccessToken(q.Get(client.accessTokenParam))
 		if err != nil {
 			return
 		}
 
 		// 换新
-		q := req.URL.Query()
-		q.Set("access_token", accessToken)
+		q.Set(client.accessTokenParam, accessToken)
 		req.URL.RawQuery = q.Encode()
 
-		response, err = http.DefaultClient.Do(req)
-		if err != nil {
-			return
+		if rewindBody(req) != nil {
+			// 请求体无法重放(比如不能 Seek 的流式上传)， 返回原来的错误，
+			// 缓存的 access_token 已经刷新， 调用者可以重新上传
+			return nil, tokenErr
 		}
-		defer response.Body.Close()
+		resp, err = client.do(req)
+	}
 
-		resp, err = ResponseFilter(response)
+	// 比如 -1 系统繁忙，此时请开发者稍候再试
+	// 按照重试策略退避重试
+	policy := client.retryPolicy
+	if policy == nil {
+		return
+	}
+	for attempt := 1; attempt < policy.MaxAttempts && policy.retryable(err); attempt++ {
+		if sleepContext(req.Context(), policy.backoff(attempt)) != nil {
+			// 取消了， 返回最后一次的错误
+			return
+		}
+		if rewindBody(req) != nil {
+			// 请求体无法重放， 不能重试
+			return
+		}
+		resp, err = client.do(req)
 	}
 
-	// -1 系统繁忙，此时请开发者稍候再试
-	// 重试一次
-	if err == ErrorSystemBusy {
+	return
+}
 
-		response, err = http.DefaultClient.Do(req)
-		if err != nil {
+// do 发送一次请求， 如果设置了限流， 先等待
+func (client *Client) do(req *http.Request) (resp []byte, err error) {
+	if client.limiter != nil {
+		if err = client.limiter.Wait(req.Context(), req.URL.Path); err != nil {
 			return
 		}
-		defer response.Body.Close()
+	}
 
-		resp, err = ResponseFilter(response)
+	response, err := client.httpClient.Do(req)
+	if err != nil {
+		err = StripUrlError(err)
+		return
 	}
+	defer response.Body.Close()
 
-	return
+	return ResponseFilter(response)
 }
 
 /*
@@ -249,7 +378,7 @@ func (client *Client) applyAccessToken(oldUrl string, params url.Values) (newUrl
 	if err != nil {
 		return
 	}
-	params.Add("access_token", accessToken)
+	params.Add(client.accessTokenParam, accessToken)
 	if strings.Contains(oldUrl, "?") {
 		newUrl = oldUrl + "&" + params.Encode()
 	} else {
@@ -258,6 +387,21 @@ func (client *Client) applyAccessToken(oldUrl string, params url.Values) (newUrl
 	return
 }
 
+// StripUrlError 移除网络错误(*url.Error)里面地址的参数，
+// 请求地址里面有 access_token / secret / js_code 等， 不能出现在错误信息里
+func StripUrlError(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	u, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil {
+		return &url.Error{Op: urlErr.Op, URL: "", Err: urlErr.Err}
+	}
+	u.RawQuery, u.Fragment, u.User = "", "", nil
+	return &url.Error{Op: urlErr.Op, URL: u.String(), Err: urlErr.Err}
+}
+
 /*
 筛查微信 api 服务器响应，判断以下错误：
 
@@ -276,25 +420,20 @@ func ResponseFilter(response *http.Response) (resp []byte, err error) {
 		return
 	}
 
-	errorResponse := WeixinError{}
+	errorResponse := CommonError{}
 	err = json.Unmarshal(resp, &errorResponse)
 	if err != nil {
 		return
 	}
 
-	if errorResponse.Errcode == 40014 {
-		err = ErrorAccessToken
-		return
-	}
-
-	//  -1	系统繁忙，此时请开发者稍候再试
-	if errorResponse.Errcode == -1 {
-		err = ErrorSystemBusy
-		return
-	}
-
-	if errorResponse.Errcode != 0 {
-		err = errorResponse
+	// access_token 失效可以用 errors.Is(err, ErrorAccessToken) 判断
+	// -1 系统繁忙可以用 errors.Is(err, ErrorSystemBusy) 判断
+	if errorResponse.ErrCode != 0 {
+		api := ""
+		if response.Request != nil && response.Request.URL != nil {
+			api = response.Request.URL.Path
+		}
+		err = NewWeixinError(api, errorResponse.ErrCode, errorResponse.ErrMsg)
 		return
 	}
 
@@ -0,0 +1,259 @@
+package utils_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidAccessToken(t *testing.T) {
+	for _, errcode := range []int{40001, 40014, 41001, 42001} {
+		t.Run(fmt.Sprintf("%d", errcode), func(t *testing.T) {
+			cache := memory.NewMemory(nil)
+			defer cache.Close()
+
+			getter := &tokenGetter{expiresIn: 7200}
+			accessTokenCache := utils.NewAccessTokenCache(getter, cache, cache, 0)
+
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				if r.URL.Query().Get("access_token") == "token1" {
+					fmt.Fprintf(w, `{"errcode":%d,"errmsg":"invalid credential"}`, errcode)
+					return
+				}
+				fmt.Fprintf(w, `{"errcode":0,"errmsg":"ok","token":"%s"}`, r.URL.Query().Get("access_token"))
+			}))
+			defer server.Close()
+
+			client := utils.NewClient(server.URL, accessTokenCache)
+			result := struct {
+				Token string `json:"token"`
+			}{}
+			err := client.ApiGetNullWrapper(context.Background(), "/cgi-bin/test", &result)
+			require.Equal(t, nil, err)
+			// 删除缓存并刷新， 只重试一次
+			require.Equal(t, "token2", result.Token)
+			require.Equal(t, int32(2), atomic.LoadInt32(&getter.count))
+			require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+			// 后续请求使用新的token
+			token, err := accessTokenCache.GetAccessToken()
+			require.Equal(t, nil, err)
+			require.Equal(t, "token2", token)
+		})
+	}
+}
+
+func TestInvalidAccessTokenRefreshed(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+
+	getter := &tokenGetter{expiresIn: 7200}
+	accessTokenCache := utils.NewAccessTokenCache(getter, cache, cache, 0)
+
+	token, err := accessTokenCache.GetAccessToken()
+	require.Equal(t, nil, err)
+	require.Equal(t, "token1", token)
+
+	// 失效的token被刷新
+	token, err = accessTokenCache.InvalidateAccessToken("token1")
+	require.Equal(t, nil, err)
+	require.Equal(t, "token2", token)
+
+	// 别人已经刷新过了， 不再刷新
+	token, err = accessTokenCache.InvalidateAccessToken("token1")
+	require.Equal(t, nil, err)
+	require.Equal(t, "token2", token)
+	require.Equal(t, int32(2), atomic.LoadInt32(&getter.count))
+}
+
+func TestUploadInvalidAccessToken(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	getter := &tokenGetter{expiresIn: 7200}
+	accessTokenCache := utils.NewAccessTokenCache(getter, cache, cache, 0)
+
+	var requests int32
+	var expired atomic.Value
+	expired.Store("token1")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		file, _, err := r.FormFile("media")
+		if err != nil {
+			fmt.Fprint(w, `{"errcode":41005,"errmsg":"media data missing"}`)
+			return
+		}
+		defer file.Close()
+		data, _ := ioutil.ReadAll(file)
+		if r.URL.Query().Get("access_token") == expired.Load() {
+			fmt.Fprint(w, `{"errcode":42001,"errmsg":"access_token expired"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"errcode":0,"errmsg":"ok","content":"%s","description":"%s"}`, data, r.FormValue("description"))
+	}))
+	defer server.Close()
+
+	client := utils.NewClient(server.URL, accessTokenCache)
+	ctx := context.Background()
+	fields := map[string]string{"description": "desc"}
+	result := struct {
+		Content     string `json:"content"`
+		Description string `json:"description"`
+	}{}
+
+	// 可以 Seek 的内容刷新 token 后重新上传
+	resp, err := client.HTTPUploadWithFields(ctx, "/cgi-bin/upload", fields, strings.NewReader("content"), "media", "a.txt", 7)
+	require.Equal(t, nil, err)
+	require.Equal(t, nil, json.Unmarshal(resp, &result))
+	require.Equal(t, "content", result.Content)
+	require.Equal(t, "desc", result.Description)
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// 不能重放的内容返回原来的错误， token 已经刷新
+	expired.Store("token2")
+	atomic.StoreInt32(&requests, 0)
+	reader := io.MultiReader(strings.NewReader("content"))
+	_, err = client.HTTPUploadWithFields(ctx, "/cgi-bin/upload", fields, reader, "media", "a.txt", 7)
+	require.True(t, errors.Is(err, utils.ErrorAccessToken))
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	token, err := accessTokenCache.GetAccessToken()
+	require.Equal(t, nil, err)
+	require.Equal(t, "token3", token)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	accessTokenCache := utils.NewAccessTokenCache(&tokenGetter{expiresIn: 7200}, cache, cache, 0)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != `{"key":"value"}` {
+			// 重试时请求体必须完整
+			fmt.Fprint(w, `{"errcode":40035,"errmsg":"invalid args"}`)
+			return
+		}
+		if atomic.AddInt32(&requests, 1) < 3 {
+			fmt.Fprint(w, `{"errcode":45009,"errmsg":"api freq out of limit"}`)
+			return
+		}
+		fmt.Fprint(w, `{"errcode":0,"errmsg":"ok"}`)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	payload := map[string]string{"key": "value"}
+
+	// 缺省策略不重试 45009
+	client := utils.NewClient(server.URL, accessTokenCache)
+	err := client.ApiPostWrapper(ctx, "/cgi-bin/test", payload, nil)
+	require.True(t, errors.Is(err, utils.ErrorApiFreqOutOfLimit))
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// 退避重试
+	atomic.StoreInt32(&requests, 0)
+	client.SetRetryPolicy(&utils.RetryPolicy{
+		MaxAttempts:       3,
+		InitialBackoff:    10 * time.Millisecond,
+		Multiplier:        2,
+		RetryableErrcodes: map[int64]bool{utils.ErrcodeApiFreqOutOfLimit: true},
+	})
+	begin := time.Now()
+	err = client.ApiPostWrapper(ctx, "/cgi-bin/test", payload, nil)
+	require.Equal(t, nil, err)
+	require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	require.GreaterOrEqual(t, int64(time.Since(begin)), int64(30*time.Millisecond))
+
+	// 超过最多次数
+	atomic.StoreInt32(&requests, 0)
+	client.SetRetryPolicy(&utils.RetryPolicy{
+		MaxAttempts:       2,
+		RetryableErrcodes: map[int64]bool{utils.ErrcodeApiFreqOutOfLimit: true},
+	})
+	err = client.ApiPostWrapper(ctx, "/cgi-bin/test", payload, nil)
+	require.True(t, errors.Is(err, utils.ErrorApiFreqOutOfLimit))
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestPathLimiter(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	accessTokenCache := utils.NewAccessTokenCache(&tokenGetter{expiresIn: 7200}, cache, cache, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"errcode":0,"errmsg":"ok"}`)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := utils.NewClient(server.URL, accessTokenCache)
+	client.SetLimiter(utils.NewPathLimiter(utils.Limit{}, map[string]utils.Limit{
+		"/cgi-bin/limited": {Rate: 20, Burst: 1},
+	}))
+
+	// 不限流
+	begin := time.Now()
+	for i := 0; i < 5; i++ {
+		require.Equal(t, nil, client.ApiGetNullWrapper(ctx, "/cgi-bin/unlimited", nil))
+	}
+	require.Less(t, int64(time.Since(begin)), int64(50*time.Millisecond))
+
+	// 每秒20次
+	begin = time.Now()
+	for i := 0; i < 5; i++ {
+		require.Equal(t, nil, client.ApiGetNullWrapper(ctx, "/cgi-bin/limited", nil))
+	}
+	require.GreaterOrEqual(t, int64(time.Since(begin)), int64(190*time.Millisecond))
+
+	// 令牌用完， 等待超时
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err := client.ApiGetNullWrapper(timeoutCtx, "/cgi-bin/limited", nil)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestStripUrlError(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	accessTokenCache := utils.NewAccessTokenCache(&tokenGetter{expiresIn: 7200}, cache, cache, 0)
+
+	// 服务器已经关闭， 返回网络错误
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	ctx := context.Background()
+	client := utils.NewClient(server.URL, accessTokenCache)
+	params := url.Values{}
+	params.Add("appid", "appid")
+	params.Add("secret", "SECRET_VALUE")
+	params.Add("js_code", "JS_CODE")
+	_, err := client.HTTPGetWithoutToken(ctx, "/sns/jscode2session", params)
+	var urlErr *url.Error
+	require.True(t, errors.As(err, &urlErr))
+	require.Equal(t, server.URL+"/sns/jscode2session", urlErr.URL)
+	require.False(t, strings.Contains(err.Error(), "SECRET_VALUE"))
+	require.False(t, strings.Contains(err.Error(), "JS_CODE"))
+
+	// access_token 也不能出现在错误信息里
+	err = client.ApiGetNullWrapper(ctx, "/cgi-bin/get", nil)
+	require.True(t, errors.As(err, &urlErr))
+	require.False(t, strings.Contains(err.Error(), "access_token"))
+
+	require.Equal(t, nil, utils.StripUrlError(nil))
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const jsNonceStrLength = 16
+
+// ticketGetter jsapi_ticket 等票据和 access_token 一样有效期7200秒并且调用次数有限，
+// 实现 AccessTokenGetter 接口， 复用 AccessTokenCache 的缓存和加锁
+type ticketGetter struct {
+	key   string
+	fetch func(context.Context) (string, int64, error)
+}
+
+// 票据缓存过期后从服务器获取， 和 access_token 一样没有 context
+func (getter *ticketGetter) GetAccessToken() (string, int, error) {
+	ticket, expiresIn, err := getter.fetch(context.Background())
+	return ticket, int(expiresIn), err
+}
+
+func (getter *ticketGetter) GetAccessTokenKey() string {
+	return getter.key
+}
+
+func (getter *ticketGetter) GetAccessTokenLockKey() string {
+	return getter.key + ".lock"
+}
+
+// NewTicketCache 票据缓存， key 为缓存的key， fetch 直接从服务器获取票据
+// 通过 GetAccessToken 获取缓存的票据， 也可以加到 AccessTokenRefresher 后台刷新
+func NewTicketCache(
+	key string,
+	fetch func(ctx context.Context) (ticket string, expiresIn int64, err error),
+	cache Cache,
+	locker Lock,
+) *AccessTokenCache {
+	return NewAccessTokenCache(&ticketGetter{key: key, fetch: fetch}, cache, locker, 0)
+}
+
+// JSConfig wx.config 需要的签名参数， 企业微信的 AppID 为企业ID
+type JSConfig struct {
+	AppID     string `json:"appId"`
+	Timestamp int64  `json:"timestamp"`
+	NonceStr  string `json:"nonceStr"`
+	Signature string `json:"signature"`
+}
+
+// JSApiSignature JS-SDK 签名， url 为当前网页的URL， 不包含#及其后面部分
+// See: https://developers.weixin.qq.com/doc/offiaccount/OA_Web_Apps/JS-SDK.html#62
+func JSApiSignature(ticket, nonceStr string, timestamp int64, url string) string {
+	if i := strings.Index(url, "#"); i >= 0 {
+		url = url[:i]
+	}
+	content := fmt.Sprintf(
+		"jsapi_ticket=%s&noncestr=%s&timestamp=%d&url=%s",
+		ticket, nonceStr, timestamp, url,
+	)
+	return fmt.Sprintf("%x", sha1.Sum([]byte(content)))
+}
+
+// NewJSNonceStr JS-SDK 签名用的随机字符串
+func NewJSNonceStr() string {
+	return GetRandString(jsNonceStrLength)
+}
+
+// NewJSConfig 用新的随机字符串和当前时间签名
+func NewJSConfig(appID, ticket, url string) *JSConfig {
+	config := &JSConfig{
+		AppID:     appID,
+		Timestamp: time.Now().Unix(),
+		NonceStr:  NewJSNonceStr(),
+	}
+	config.Signature = JSApiSignature(ticket, config.NonceStr, config.Timestamp, url)
+	return config
+}
+
+// CardSignature 卡券签名， 所有参与签名的值(包括 api_ticket)按字典序排序后拼接， 再做sha1
+// See: https://developers.weixin.qq.com/doc/offiaccount/OA_Web_Apps/JS-SDK.html#54
+func CardSignature(values ...string) string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(sorted, ""))))
+}
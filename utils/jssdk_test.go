@@ -0,0 +1,33 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSApiSignature(t *testing.T) {
+	// 官方文档的示例
+	ticket := "sM4AOVdWfPE4DxkXGEs8VMCPGGVi4C3VM0P37wVUCFvkVAy_90u5h9nbSlYy3-Sl-HhTdfl2fzFy1AOcHKP7qg"
+	signature := "0f9de62fce790f9a083d5c99e95740ceb90c27ed"
+	require.Equal(t, signature, utils.JSApiSignature(
+		ticket, "Wm3WZYTPz0wzccnW", 1414587457, "http://mp.weixin.qq.com?params=value",
+	))
+	require.Equal(t, signature, utils.JSApiSignature(
+		ticket, "Wm3WZYTPz0wzccnW", 1414587457, "http://mp.weixin.qq.com?params=value#/home",
+	))
+
+	config := utils.NewJSConfig("appid", ticket, "http://mp.weixin.qq.com")
+	require.Equal(t, "appid", config.AppID)
+	require.Equal(t, 16, len(config.NonceStr))
+	require.Equal(t, utils.JSApiSignature(
+		ticket, config.NonceStr, config.Timestamp, "http://mp.weixin.qq.com",
+	), config.Signature)
+}
+
+func TestCardSignature(t *testing.T) {
+	require.Equal(t, utils.CardSignature("b", "", "a", "c"), utils.CardSignature("c", "a", "b"))
+	require.NotEqual(t, utils.CardSignature("a", "b"), utils.CardSignature("a", "c"))
+	require.Equal(t, 40, len(utils.CardSignature("ticket")))
+}
@@ -0,0 +1,200 @@
+package memory
+
+// 进程内缓存， 实现 utils.Cache / utils.Lock
+// 适用于单元测试、命令行工具以及单副本服务， 多副本部署请使用 utils/redis
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCleanupInterval = time.Minute // 缺省每分钟清理一次过期数据
+)
+
+// ErrorInvalidTimeout 过期时间为负数， 和 redis SETEX 一样拒绝
+var ErrorInvalidTimeout = errors.New("invalid expire time")
+
+type item struct {
+	data    []byte
+	expires time.Time // 零值表示不过期
+}
+
+func (i *item) expired(now time.Time) bool {
+	return !i.expires.IsZero() && now.After(i.expires)
+}
+
+//Memory 内存缓存
+type Memory struct {
+	mutex sync.Mutex
+	items map[string]*item
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// Config 内存缓存属性
+type Config struct {
+	CleanupInterval time.Duration `yml:"cleanup_interval" json:"cleanup_interval"` // 清理过期数据的间隔
+}
+
+//NewMemory 实例化， 同时启动清理过期数据的janitor， 不再使用时调用Close
+func NewMemory(opts *Config) *Memory {
+	interval := defaultCleanupInterval
+	if opts != nil && opts.CleanupInterval > 0 {
+		interval = opts.CleanupInterval
+	}
+
+	m := &Memory{
+		items: map[string]*item{},
+		stop:  make(chan struct{}),
+	}
+	go m.janitor(interval)
+	return m
+}
+
+// Close 停止janitor
+func (m *Memory) Close() {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+}
+
+func (m *Memory) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.deleteExpired()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (m *Memory) deleteExpired() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	for key, item := range m.items {
+		if item.expired(now) {
+			delete(m.items, key)
+		}
+	}
+}
+
+// 调用者需持有锁， 过期的数据视为不存在
+func (m *Memory) get(key string) *item {
+	item, ok := m.items[key]
+	if !ok {
+		return nil
+	}
+	if item.expired(time.Now()) {
+		delete(m.items, key)
+		return nil
+	}
+	return item
+}
+
+// 调用者需持有锁， timeout == 0 表示不过期， 负数由调用者拒绝
+func (m *Memory) set(key string, data []byte, timeout time.Duration) {
+	item := &item{data: data}
+	if timeout > 0 {
+		item.expires = time.Now().Add(timeout)
+	}
+	m.items[key] = item
+}
+
+//Get 获取一个值
+func (m *Memory) Get(key string, value interface{}) (exist bool, err error) {
+	m.mutex.Lock()
+	item := m.get(key)
+	m.mutex.Unlock()
+
+	if item == nil {
+		// 不存在特殊处理
+		return false, nil
+	}
+
+	// 序列化， 和redis保持一致， 避免调用者拿到共享的对象
+	if err = json.Unmarshal(item.data, value); err != nil {
+		return
+	}
+
+	return true, nil
+}
+
+//Set 设置一个值
+func (m *Memory) Set(key string, val interface{}, timeout time.Duration) (err error) {
+	var data []byte
+	if timeout < 0 {
+		return ErrorInvalidTimeout
+	}
+	if data, err = json.Marshal(val); err != nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.set(key, data, timeout)
+	return
+}
+
+//IsExist 判断key是否存在
+func (m *Memory) IsExist(key string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.get(key) != nil
+}
+
+//Delete 删除
+func (m *Memory) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.items, key)
+	return nil
+}
+
+// Lock 加锁， 锁到期自动释放
+func (m *Memory) Lock(key string, expire time.Duration) (bool, error) {
+	if expire < 0 {
+		return false, ErrorInvalidTimeout
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.get(key) != nil {
+		// 已经被别人锁住
+		return false, nil
+	}
+	m.set(key, []byte("1"), expire)
+	return true, nil
+}
+
+func (m *Memory) LockTimeout(key string, expire, timeout, sleep time.Duration) (bool, error) {
+	var total time.Duration = 0
+	for total < timeout {
+		result, err := m.Lock(key, expire)
+		if err != nil {
+			return result, err
+		}
+		if result {
+			// lock success
+			return result, nil
+		}
+		// lock fail
+		time.Sleep(sleep)
+		total += sleep
+	}
+	// lock fail
+	return false, nil
+}
+
+func (m *Memory) UnLock(key string) error {
+	return m.Delete(key)
+}
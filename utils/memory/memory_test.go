@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	cache := NewMemory(&Config{CleanupInterval: 10 * time.Millisecond})
+	defer cache.Close()
+
+	value := ""
+	exist, err := cache.Get("key", &value)
+	require.Equal(t, nil, err)
+	require.False(t, exist)
+
+	require.Equal(t, nil, cache.Set("key", "value", 50*time.Millisecond))
+	require.True(t, cache.IsExist("key"))
+	exist, err = cache.Get("key", &value)
+	require.Equal(t, nil, err)
+	require.True(t, exist)
+	require.Equal(t, "value", value)
+
+	// 过期
+	time.Sleep(100 * time.Millisecond)
+	require.False(t, cache.IsExist("key"))
+	exist, err = cache.Get("key", &value)
+	require.Equal(t, nil, err)
+	require.False(t, exist)
+
+	// 不过期
+	require.Equal(t, nil, cache.Set("key", "value", 0))
+	time.Sleep(30 * time.Millisecond)
+	require.True(t, cache.IsExist("key"))
+	require.Equal(t, nil, cache.Delete("key"))
+	require.False(t, cache.IsExist("key"))
+
+	// 负数过期时间和 redis SETEX 一样报错， 不能当作不过期
+	require.Equal(t, ErrorInvalidTimeout, cache.Set("key", "value", -time.Second))
+	require.False(t, cache.IsExist("key"))
+}
+
+func TestJanitor(t *testing.T) {
+	cache := NewMemory(&Config{CleanupInterval: 10 * time.Millisecond})
+	defer cache.Close()
+
+	for i := 0; i < 10; i++ {
+		require.Equal(t, nil, cache.Set(fmt.Sprintf("key%d", i), i, 10*time.Millisecond))
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	require.Empty(t, cache.items)
+}
+
+func TestLock(t *testing.T) {
+	locker := NewMemory(nil)
+	defer locker.Close()
+
+	locked, err := locker.Lock("lock", time.Second)
+	require.Equal(t, nil, err)
+	require.True(t, locked)
+
+	locked, err = locker.Lock("lock", time.Second)
+	require.Equal(t, nil, err)
+	require.False(t, locked)
+
+	locked, err = locker.Lock("negative", -time.Second)
+	require.Equal(t, ErrorInvalidTimeout, err)
+	require.False(t, locked)
+
+	// 等待超时
+	locked, err = locker.LockTimeout("lock", time.Second, 30*time.Millisecond, 10*time.Millisecond)
+	require.Equal(t, nil, err)
+	require.False(t, locked)
+
+	require.Equal(t, nil, locker.UnLock("lock"))
+	locked, err = locker.LockTimeout("lock", time.Second, 30*time.Millisecond, 10*time.Millisecond)
+	require.Equal(t, nil, err)
+	require.True(t, locked)
+
+	// 锁到期自动释放
+	locked, err = locker.Lock("expire", 20*time.Millisecond)
+	require.Equal(t, nil, err)
+	require.True(t, locked)
+	locked, err = locker.LockTimeout("expire", time.Second, 200*time.Millisecond, 10*time.Millisecond)
+	require.Equal(t, nil, err)
+	require.True(t, locked)
+}
+
+type tokenGetter struct {
+	count int32
+}
+
+func (g *tokenGetter) GetAccessToken() (string, int, error) {
+	n := atomic.AddInt32(&g.count, 1)
+	// 模拟网络请求
+	time.Sleep(50 * time.Millisecond)
+	return fmt.Sprintf("token%d", n), 7200, nil
+}
+
+func (g *tokenGetter) GetAccessTokenKey() string {
+	return "access-token:memory:test"
+}
+
+func (g *tokenGetter) GetAccessTokenLockKey() string {
+	return "access-token:memory:test.lock"
+}
+
+func TestAccessTokenCache(t *testing.T) {
+	cache := NewMemory(nil)
+	defer cache.Close()
+
+	getter := &tokenGetter{}
+	accessTokenCache := utils.NewAccessTokenCache(getter, cache, cache, 0)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 20)
+	errs := make([]error, 20)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = accessTokenCache.GetAccessToken()
+		}(i)
+	}
+	wg.Wait()
+
+	// 并发获取， 只刷新一次
+	require.Equal(t, int32(1), atomic.LoadInt32(&getter.count))
+	for i := range tokens {
+		require.Equal(t, nil, errs[i])
+		require.Equal(t, "token1", tokens[i])
+	}
+	require.False(t, cache.IsExist(getter.GetAccessTokenLockKey()))
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TrackRecord Track 时记录的数据
+type TrackRecord struct {
+	Value       string    `json:"value"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// MsgTracker 通过 msgid 关联发送的消息和任务完成事件， 比如公众号模板消息和群发的 JOBFINISH 事件
+type MsgTracker struct {
+	cache  Cache
+	prefix string
+	ttl    time.Duration
+}
+
+// NewMsgTracker kind 区分消息类型， appid 区分不同的公众号， ttl 为记录保存的时长
+func NewMsgTracker(cache Cache, kind, appid string, ttl time.Duration) *MsgTracker {
+	return &MsgTracker{
+		cache:  cache,
+		prefix: fmt.Sprintf("%s:%s", kind, appid),
+		ttl:    ttl,
+	}
+}
+
+func (tracker *MsgTracker) key(msgID string) string {
+	return fmt.Sprintf("%s:%s", tracker.prefix, msgID)
+}
+
+// Track 记录接口返回的 msgid 对应的业务数据， 比如订单号
+func (tracker *MsgTracker) Track(msgID int64, value string) error {
+	return tracker.cache.Set(tracker.key(strconv.FormatInt(msgID, 10)), &TrackRecord{
+		Value:       value,
+		SubmittedAt: time.Now(),
+	}, tracker.ttl)
+}
+
+// Lookup 查找事件的 msgid 对应的记录， 记录过期或者没有 Track 时 found 为 false
+func (tracker *MsgTracker) Lookup(msgID string) (record TrackRecord, found bool, err error) {
+	found, err = tracker.cache.Get(tracker.key(msgID), &record)
+	return
+}
+
+// Forget 删除记录
+func (tracker *MsgTracker) Forget(msgID string) error {
+	return tracker.cache.Delete(tracker.key(msgID))
+}
+
+// Finish 查找记录交给 handler 处理， handler 成功后删除记录
+// handler 返回错误时保留记录， 微信服务器重试时还能找到
+func (tracker *MsgTracker) Finish(msgID string, handler func(record TrackRecord, found bool) error) error {
+	record, found, err := tracker.Lookup(msgID)
+	if err != nil {
+		return err
+	}
+	if err = handler(record, found); err != nil {
+		return err
+	}
+	if found {
+		return tracker.Forget(msgID)
+	}
+	return nil
+}
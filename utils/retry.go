@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts    = 2                      // 缺省重试一次
+	defaultRetryInitialBackoff = 100 * time.Millisecond // 缺省首次重试前等待100毫秒
+	defaultRetryMaxBackoff     = 5 * time.Second        // 缺省单次等待不超过5秒
+	defaultRetryMultiplier     = 2.0                    // 缺省指数退避
+)
+
+var errBodyNotRewindable = errors.New("request body can not be rewound")
+
+// RetryPolicy 重试策略， 只重试 RetryableErrcodes 中的错误码
+type RetryPolicy struct {
+	MaxAttempts       int            // 最多请求次数(包括第一次)， 1表示不重试
+	InitialBackoff    time.Duration  // 首次重试前等待的时长
+	MaxBackoff        time.Duration  // 单次等待的最大时长
+	Multiplier        float64        // 每次重试等待时长的倍数
+	Jitter            float64        // 0-1， 随机减少等待时长的比例， 避免多个副本同时重试
+	RetryableErrcodes map[int64]bool // 需要重试的错误码
+}
+
+// DefaultRetryPolicy 缺省策略， 系统繁忙时稍候重试一次
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    defaultRetryMaxAttempts,
+		InitialBackoff: defaultRetryInitialBackoff,
+		MaxBackoff:     defaultRetryMaxBackoff,
+		Multiplier:     defaultRetryMultiplier,
+		Jitter:         0.2,
+		RetryableErrcodes: map[int64]bool{
+			ErrcodeSystemBusy: true,
+		},
+	}
+}
+
+func (policy *RetryPolicy) retryable(err error) bool {
+	we := WeixinError{}
+	if !errors.As(err, &we) {
+		return false
+	}
+	return policy.RetryableErrcodes[we.Errcode]
+}
+
+// backoff 第attempt次重试前等待的时长， attempt从1开始
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(policy.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if policy.MaxBackoff > 0 && delay > float64(policy.MaxBackoff) {
+		delay = float64(policy.MaxBackoff)
+	}
+	if policy.Jitter > 0 {
+		delay -= delay * policy.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// 重新设置请求体， 用于重试
+func rewindBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.GetBody == nil {
+		return errBodyNotRewindable
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Limiter 客户端限流， 按接口路径等待
+type Limiter interface {
+	Wait(ctx context.Context, api string) error
+}
+
+// Limit 令牌桶参数， Rate 为每秒请求数， 0表示不限流
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PathLimiter 每个接口路径一个令牌桶
+type PathLimiter struct {
+	mutex        sync.Mutex
+	defaultLimit Limit
+	limits       map[string]Limit
+	buckets      map[string]*tokenBucket
+}
+
+// NewPathLimiter limits 指定特定接口的限制， 其他接口使用 defaultLimit
+func NewPathLimiter(defaultLimit Limit, limits map[string]Limit) *PathLimiter {
+	return &PathLimiter{
+		defaultLimit: defaultLimit,
+		limits:       limits,
+		buckets:      map[string]*tokenBucket{},
+	}
+}
+
+func (limiter *PathLimiter) Wait(ctx context.Context, api string) error {
+	limiter.mutex.Lock()
+	bucket, ok := limiter.buckets[api]
+	if !ok {
+		limit, ok := limiter.limits[api]
+		if !ok {
+			limit = limiter.defaultLimit
+		}
+		if limit.Rate > 0 {
+			bucket = newTokenBucket(limit)
+		}
+		limiter.buckets[api] = bucket
+	}
+	limiter.mutex.Unlock()
+
+	if bucket == nil {
+		// 不限流
+		return nil
+	}
+	return bucket.wait(ctx)
+}
+
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit Limit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// reserve 预定一个令牌， 返回需要等待的时长
+func (bucket *tokenBucket) reserve() time.Duration {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	now := time.Now()
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+	bucket.last = now
+
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+// cancel 归还未使用的令牌
+func (bucket *tokenBucket) cancel() {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+	bucket.tokens++
+}
+
+func (bucket *tokenBucket) wait(ctx context.Context) error {
+	if err := sleepContext(ctx, bucket.reserve()); err != nil {
+		bucket.cancel()
+		return err
+	}
+	return nil
+}
@@ -11,8 +11,12 @@ import (
 // 在Trace的时候， 移除access-token / secret
 // 	secret : https://developers.weixin.qq.com/doc/offiaccount/OA_Web_Apps/Wechat_webpage_authorization.html
 
+// 缺省移除的参数， 第三方平台的接口使用 component_access_token， 企业微信获取 token 使用 corpsecret
+var strippedParams = []string{"access_token", "component_access_token", "secret", "corpsecret"}
+
 type AccessTokenStripTransport struct {
-	Base http.RoundTripper
+	Base   http.RoundTripper
+	Params []string // 额外移除的参数， 比如 WithAccessTokenParam 指定的参数名
 }
 
 func (t *AccessTokenStripTransport) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -20,7 +24,7 @@ func (t *AccessTokenStripTransport) RoundTrip(req *http.Request) (*http.Response
 
 	span := trace.FromContext(req.Context())
 	if span == nil {
-		return nil, err
+		return resp, err
 	}
 
 	u := req.URL
@@ -28,13 +32,13 @@ func (t *AccessTokenStripTransport) RoundTrip(req *http.Request) (*http.Response
 
 	// 如果存在， 重置
 	edit := false
-	if q.Get("access_token") != "" {
-		q.Set("access_token", "")
-		edit = true
-	}
-	if q.Get("secret") != "" {
-		q.Set("secret", "")
-		edit = true
+	for _, params := range [][]string{strippedParams, t.Params} {
+		for _, param := range params {
+			if q.Get(param) != "" {
+				q.Set(param, "")
+				edit = true
+			}
+		}
 	}
 
 	if edit {
@@ -47,10 +51,14 @@ func (t *AccessTokenStripTransport) RoundTrip(req *http.Request) (*http.Response
 	return resp, err
 }
 
-func newTransport() http.RoundTripper {
+func newTransport(base http.RoundTripper, accessTokenParam string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
 	return &ochttp.Transport{
 		Base: &AccessTokenStripTransport{
-			Base: http.DefaultTransport,
+			Base:   base,
+			Params: []string{accessTokenParam},
 		},
 	}
 }
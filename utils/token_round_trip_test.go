@@ -0,0 +1,67 @@
+package utils_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/trace"
+)
+
+type spanExporter struct {
+	mutex sync.Mutex
+	urls  []string
+}
+
+func (e *spanExporter) ExportSpan(s *trace.SpanData) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if traced, ok := s.Attributes[ochttp.URLAttribute].(string); ok {
+		e.urls = append(e.urls, traced)
+	}
+}
+
+func TestAccessTokenStripTransport(t *testing.T) {
+	exporter := &spanExporter{}
+	trace.RegisterExporter(exporter)
+	defer trace.UnregisterExporter(exporter)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"errcode":0,"errmsg":"ok"}`)
+	}))
+	defer server.Close()
+
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	ctx := context.Background()
+	for _, param := range []string{"access_token", "component_access_token", "suite_access_token"} {
+		getter := &tokenGetter{expiresIn: 7200}
+		client := utils.NewClient(
+			server.URL, utils.NewAccessTokenCache(getter, cache, cache, 0), utils.WithAccessTokenParam(param),
+		)
+		require.Equal(t, nil, client.ApiGetWrapper(ctx, "/cgi-bin/test", func(params url.Values) {
+			params.Add("secret", "secret1")
+			params.Add("corpsecret", "CORP_SECRET")
+		}, nil))
+	}
+
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	require.Equal(t, 3, len(exporter.urls))
+	for _, traced := range exporter.urls {
+		require.False(t, strings.Contains(traced, "token1"), traced)
+		require.False(t, strings.Contains(traced, "secret1"), traced)
+		require.False(t, strings.Contains(traced, "CORP_SECRET"), traced)
+	}
+}
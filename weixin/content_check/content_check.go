@@ -19,7 +19,7 @@ const (
 	imgCheckFieldName = "img_check"
 	imgCheckFileName  = "img_check"
 
-	SensitiveImgErrCode = 87014
+	SensitiveImgErrCode = 87014 // 同 utils.ErrcodeRiskyContent， 保持无类型常量兼容 int 比较
 )
 
 // ContentCheckApi 内容检测api
@@ -106,8 +106,7 @@ func (api *ContentCheckApi) CheckImg(ctx context.Context, imgURL string) (sensit
 
 	resp, err := api.Client.Upload(ctx, apiImgSecCheck, imgCheckFieldName, imgCheckFileName, imgResp.Body)
 	if err != nil {
-		weixinErr := utils.WeixinError{}
-		if errors.As(err, &weixinErr) && weixinErr.Errcode == SensitiveImgErrCode {
+		if errors.Is(err, utils.ErrorRiskyContent) {
 			return true, nil
 		}
 		return true, err
@@ -0,0 +1,124 @@
+package custom_service_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestApi(t *testing.T) (*CustomServiceApi, *wxtest.Server) {
+	server, officialAccount, _ := fixture.NewOfficialAccount(
+		t, wxtest.OfficialAccountUser{OpenID: "openid1"}, wxtest.OfficialAccountUser{OpenID: "openid2"},
+	)
+	return NewOfficialAccountApi(officialAccount), server
+}
+
+func TestSend(t *testing.T) {
+	api, server := newTestApi(t)
+	ctx := context.Background()
+
+	require.Equal(t, nil, api.SendText(ctx, "openid1", "hello"))
+	require.Equal(t, nil, api.SendNews(ctx, "openid1", Article{
+		Title: "title", Description: "description", Url: "https://example.com", PicUrl: "https://example.com/a.jpg",
+	}))
+	require.Equal(t, nil, api.SendMsgMenu(ctx, "openid1", &MsgMenu{
+		HeadContent: "您对本次服务是否满意呢?",
+		List:        []MsgMenuItem{{ID: "101", Content: "满意"}, {ID: "102", Content: "不满意"}},
+		TailContent: "欢迎再次光临",
+	}))
+	require.Equal(t, nil, api.SendMiniProgramPage(ctx, "openid1", &MiniProgramPage{
+		Title: "title", Appid: "wxappid", PagePath: "pages/index", ThumbMediaID: "MEDIA_ID",
+	}))
+	require.Equal(t, nil, api.Typing(ctx, "openid1", true))
+
+	// 不存在的用户
+	err := api.SendImage(ctx, "openid3", "MEDIA_ID")
+	require.True(t, errors.Is(err, utils.ErrorInvalidOpenid))
+
+	// 以客服帐号发送
+	message := &Message{
+		ToUser:        "openid2",
+		MsgType:       MsgTypeText,
+		Text:          &Text{Content: "hello"},
+		CustomService: &CustomService{KfAccount: "test1@test"},
+	}
+	err = api.Send(ctx, message)
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeInvalidKfAccount}))
+	require.Equal(t, nil, api.AddKfAccount(ctx, "test1@test", "客服1"))
+	require.Equal(t, nil, api.Send(ctx, message))
+
+	messages := server.OfficialAccountMessages()
+	require.Equal(t, 5, len(messages))
+	sent := []Message{}
+	for _, raw := range messages {
+		message := Message{}
+		require.Equal(t, nil, json.Unmarshal(raw, &message))
+		sent = append(sent, message)
+	}
+	require.Equal(t, "hello", sent[0].Text.Content)
+	require.Equal(t, "https://example.com", sent[1].News.Articles[0].Url)
+	require.Equal(t, MsgTypeMsgMenu, sent[2].MsgType)
+	require.Equal(t, "102", sent[2].MsgMenu.List[1].ID)
+	require.Equal(t, "pages/index", sent[3].MiniProgramPage.PagePath)
+	require.Equal(t, "test1@test", sent[4].CustomService.KfAccount)
+	require.Equal(t, (*Media)(nil), sent[4].Image)
+}
+
+func TestKfAccount(t *testing.T) {
+	api, _ := newTestApi(t)
+	ctx := context.Background()
+
+	require.Equal(t, nil, api.AddKfAccount(ctx, "test1@test", "客服1"))
+	require.Equal(t, nil, api.AddKfAccount(ctx, "test2@test", "客服2"))
+	err := api.AddKfAccount(ctx, "test1@test", "客服1")
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeKfAccountExists}))
+
+	require.Equal(t, nil, api.UpdateKfAccount(ctx, "test2@test", "客服二"))
+	require.Equal(t, nil, api.InviteKfWorker(ctx, "test2@test", "test_kfwx"))
+	accounts, err := api.GetKfList(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 2, len(accounts))
+	require.Equal(t, "客服1", accounts[0].KfNick)
+	require.Equal(t, "客服二", accounts[1].KfNick)
+	require.Equal(t, "test_kfwx", accounts[1].InviteWx)
+	require.Equal(t, InviteStatusWaiting, accounts[1].InviteStatus)
+
+	// 会话
+	require.Equal(t, nil, api.CreateSession(ctx, "test1@test", "openid1"))
+	err = api.CreateSession(ctx, "test2@test", "openid1")
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeKfSessionOccupied}))
+	session, err := api.GetSession(ctx, "openid1")
+	require.Equal(t, nil, err)
+	require.Equal(t, "test1@test", session.KfAccount)
+	sessions, err := api.GetSessionList(ctx, "test1@test")
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, len(sessions))
+	require.Equal(t, "openid1", sessions[0].OpenID)
+	online, err := api.GetOnlineKfList(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, online[0].AcceptedCase)
+	require.Equal(t, 0, online[1].AcceptedCase)
+	waitCase, err := api.GetWaitCase(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 0, waitCase.Count)
+
+	require.Equal(t, nil, api.CloseSession(ctx, "test1@test", "openid1"))
+	err = api.CloseSession(ctx, "test1@test", "openid1")
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeKfSessionNotFound}))
+	session, err = api.GetSession(ctx, "openid1")
+	require.Equal(t, nil, err)
+	require.Equal(t, "", session.KfAccount)
+
+	require.Equal(t, nil, api.DeleteKfAccount(ctx, "test1@test"))
+	err = api.DeleteKfAccount(ctx, "test1@test")
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeInvalidKfAccount}))
+	accounts, err = api.GetKfList(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, len(accounts))
+}
@@ -0,0 +1,324 @@
+package custom_service_api
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	apiKfAccountAdd      = "/customservice/kfaccount/add"
+	apiKfAccountUpdate   = "/customservice/kfaccount/update"
+	apiKfAccountDelete   = "/customservice/kfaccount/del"
+	apiKfAccountInvite   = "/customservice/kfaccount/inviteworker"
+	apiKfAccountHeadImg  = "/customservice/kfaccount/uploadheadimg"
+	apiGetKfList         = "/cgi-bin/customservice/getkflist"
+	apiGetOnlineKfList   = "/cgi-bin/customservice/getonlinekflist"
+	apiKfSessionCreate   = "/customservice/kfsession/create"
+	apiKfSessionClose    = "/customservice/kfsession/close"
+	apiKfSessionGet      = "/customservice/kfsession/getsession"
+	apiKfSessionList     = "/customservice/kfsession/getsessionlist"
+	apiKfSessionWaitCase = "/customservice/kfsession/getwaitcase"
+	apiGetMsgList        = "/customservice/msgrecord/getmsglist"
+)
+
+// 客服在线状态
+const (
+	KfStatusWeb = 1 // web 在线
+)
+
+// 邀请绑定状态
+const (
+	InviteStatusWaiting  = "waiting"
+	InviteStatusRejected = "rejected"
+	InviteStatusExpired  = "expired"
+)
+
+// KfAccount 客服帐号， 格式为 帐号前缀@公众号微信号
+type KfAccount struct {
+	KfAccount        string `json:"kf_account"`
+	KfNick           string `json:"kf_nick"`
+	KfID             string `json:"kf_id"`
+	KfHeadImgUrl     string `json:"kf_headimgurl"`
+	KfWx             string `json:"kf_wx"`              // 绑定的微信号， 未绑定为空
+	InviteWx         string `json:"invite_wx"`          // 邀请绑定的微信号
+	InviteExpireTime int64  `json:"invite_expire_time"` // 邀请的过期时间
+	InviteStatus     string `json:"invite_status"`      // 邀请的状态
+}
+
+type OnlineKfAccount struct {
+	KfAccount    string `json:"kf_account"`
+	Status       int    `json:"status"`
+	KfID         string `json:"kf_id"`
+	AcceptedCase int    `json:"accepted_case"` // 正在接待的会话数
+}
+
+// Session 客户的会话状态， KfAccount 为空表示没有被接入
+type Session struct {
+	KfAccount  string `json:"kf_account"`
+	CreateTime int64  `json:"createtime"`
+}
+
+type SessionItem struct {
+	OpenID     string `json:"openid"`
+	CreateTime int64  `json:"createtime"`
+}
+
+type WaitCaseItem struct {
+	OpenID     string `json:"openid"`
+	LatestTime int64  `json:"latest_time"` // 粉丝的最后一条消息的时间
+}
+
+type WaitCaseList struct {
+	Count        int            `json:"count"`
+	WaitCaseList []WaitCaseItem `json:"waitcaselist"`
+}
+
+type MsgRecord struct {
+	OpenID   string `json:"openid"`
+	OperCode int    `json:"opercode"` // 操作码， 2002(客服发送信息)， 2003(客服接收消息)
+	Text     string `json:"text"`
+	Time     int64  `json:"time"`
+	Worker   string `json:"worker"`
+}
+
+type MsgRecordList struct {
+	RecordList []MsgRecord `json:"recordlist"`
+	Number     int         `json:"number"`
+	MsgID      int64       `json:"msgid"` // 下一次查询的 msgid
+}
+
+/*
+添加客服帐号
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Customer_Service_Management.html
+
+POST https://api.weixin.qq.com/customservice/kfaccount/add?access_token=ACCESS_TOKEN
+*/
+func (api *CustomServiceApi) AddKfAccount(ctx context.Context, kfAccount, nickname string) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiKfAccountAdd, map[string]string{
+		"kf_account": kfAccount,
+		"nickname":   nickname,
+	}, &result)
+}
+
+/*
+设置客服信息
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Customer_Service_Management.html
+
+POST https://api.weixin.qq.com/customservice/kfaccount/update?access_token=ACCESS_TOKEN
+*/
+func (api *CustomServiceApi) UpdateKfAccount(ctx context.Context, kfAccount, nickname string) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiKfAccountUpdate, map[string]string{
+		"kf_account": kfAccount,
+		"nickname":   nickname,
+	}, &result)
+}
+
+/*
+删除客服帐号
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Customer_Service_Management.html
+
+GET https://api.weixin.qq.com/customservice/kfaccount/del?access_token=ACCESS_TOKEN&kf_account=KFACCOUNT
+*/
+func (api *CustomServiceApi) DeleteKfAccount(ctx context.Context, kfAccount string) error {
+	var result utils.CommonError
+	return api.Client.ApiGetWrapper(ctx, apiKfAccountDelete, func(params url.Values) {
+		params.Add("kf_account", kfAccount)
+	}, &result)
+}
+
+/*
+邀请绑定客服帐号
+
+新添加的客服帐号是不能直接使用的， 只有客服人员用微信号绑定了客服账号后， 方可登录Web客服进行操作
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Customer_Service_Management.html
+
+POST https://api.weixin.qq.com/customservice/kfaccount/inviteworker?access_token=ACCESS_TOKEN
+*/
+func (api *CustomServiceApi) InviteKfWorker(ctx context.Context, kfAccount, inviteWx string) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiKfAccountInvite, map[string]string{
+		"kf_account": kfAccount,
+		"invite_wx":  inviteWx,
+	}, &result)
+}
+
+/*
+上传客服头像
+
+头像图片文件必须是jpg格式， 推荐使用640*640大小的图片以达到最佳效果
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Customer_Service_Management.html
+
+POST https://api.weixin.qq.com/customservice/kfaccount/uploadheadimg?access_token=ACCESS_TOKEN&kf_account=KFACCOUNT
+*/
+func (api *CustomServiceApi) UploadKfHeadImg(
+	ctx context.Context, kfAccount, filename string, content io.Reader,
+) error {
+	params := url.Values{}
+	params.Add("kf_account", kfAccount)
+	_, err := api.Client.Upload(ctx, apiKfAccountHeadImg+"?"+params.Encode(), "media", filename, content)
+	return err
+}
+
+/*
+获取所有客服账号
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Customer_Service_Management.html
+
+GET https://api.weixin.qq.com/cgi-bin/customservice/getkflist?access_token=ACCESS_TOKEN
+*/
+func (api *CustomServiceApi) GetKfList(ctx context.Context) ([]KfAccount, error) {
+	result := struct {
+		utils.CommonError
+		KfList []KfAccount `json:"kf_list"`
+	}{}
+	if err := api.Client.ApiGetNullWrapper(ctx, apiGetKfList, &result); err != nil {
+		return nil, err
+	}
+	return result.KfList, nil
+}
+
+/*
+获取在线客服
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Customer_Service_Management.html
+
+GET https://api.weixin.qq.com/cgi-bin/customservice/getonlinekflist?access_token=ACCESS_TOKEN
+*/
+func (api *CustomServiceApi) GetOnlineKfList(ctx context.Context) ([]OnlineKfAccount, error) {
+	result := struct {
+		utils.CommonError
+		KfOnlineList []OnlineKfAccount `json:"kf_online_list"`
+	}{}
+	if err := api.Client.ApiGetNullWrapper(ctx, apiGetOnlineKfList, &result); err != nil {
+		return nil, err
+	}
+	return result.KfOnlineList, nil
+}
+
+/*
+创建会话
+
+客服帐号必须已经绑定微信号且在线
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Session_control.html
+
+POST https://api.weixin.qq.com/customservice/kfsession/create?access_token=ACCESS_TOKEN
+*/
+func (api *CustomServiceApi) CreateSession(ctx context.Context, kfAccount, openID string) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiKfSessionCreate, map[string]string{
+		"kf_account": kfAccount,
+		"openid":     openID,
+	}, &result)
+}
+
+/*
+关闭会话
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Session_control.html
+
+POST https://api.weixin.qq.com/customservice/kfsession/close?access_token=ACCESS_TOKEN
+*/
+func (api *CustomServiceApi) CloseSession(ctx context.Context, kfAccount, openID string) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiKfSessionClose, map[string]string{
+		"kf_account": kfAccount,
+		"openid":     openID,
+	}, &result)
+}
+
+/*
+获取客户会话状态
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Session_control.html
+
+GET https://api.weixin.qq.com/customservice/kfsession/getsession?access_token=ACCESS_TOKEN&openid=OPENID
+*/
+func (api *CustomServiceApi) GetSession(ctx context.Context, openID string) (*Session, error) {
+	var result Session
+	err := api.Client.ApiGetWrapper(ctx, apiKfSessionGet, func(params url.Values) {
+		params.Add("openid", openID)
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+/*
+获取客服会话列表
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Session_control.html
+
+GET https://api.weixin.qq.com/customservice/kfsession/getsessionlist?access_token=ACCESS_TOKEN&kf_account=KFACCOUNT
+*/
+func (api *CustomServiceApi) GetSessionList(ctx context.Context, kfAccount string) ([]SessionItem, error) {
+	result := struct {
+		utils.CommonError
+		SessionList []SessionItem `json:"sessionlist"`
+	}{}
+	err := api.Client.ApiGetWrapper(ctx, apiKfSessionList, func(params url.Values) {
+		params.Add("kf_account", kfAccount)
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.SessionList, nil
+}
+
+/*
+获取未接入会话列表
+
+最多返回100条数据， 按照来访顺序
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Session_control.html
+
+GET https://api.weixin.qq.com/customservice/kfsession/getwaitcase?access_token=ACCESS_TOKEN
+*/
+func (api *CustomServiceApi) GetWaitCase(ctx context.Context) (*WaitCaseList, error) {
+	var result WaitCaseList
+	if err := api.Client.ApiGetNullWrapper(ctx, apiKfSessionWaitCase, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+/*
+获取聊天记录
+
+startTime 和 endTime 必须在同一天， msgID 第一次传1， 之后传上一次返回的 MsgID， number 最大10000
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Customer_Service/Obtain_chat_transcript.html
+
+POST https://api.weixin.qq.com/customservice/msgrecord/getmsglist?access_token=ACCESS_TOKEN
+*/
+func (api *CustomServiceApi) GetMsgList(
+	ctx context.Context, startTime, endTime, msgID int64, number int,
+) (*MsgRecordList, error) {
+	params := &struct {
+		StartTime int64 `json:"starttime"`
+		EndTime   int64 `json:"endtime"`
+		MsgID     int64 `json:"msgid"`
+		Number    int   `json:"number"`
+	}{
+		StartTime: startTime,
+		EndTime:   endTime,
+		MsgID:     msgID,
+		Number:    number,
+	}
+	var result MsgRecordList
+	if err := api.Client.ApiPostWrapper(ctx, apiGetMsgList, params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,215 @@
+// Package custom_service_api 客服消息和客服帐号管理
+package custom_service_api
+
+import (
+	"context"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/official_account"
+)
+
+const (
+	apiSend   = "/cgi-bin/message/custom/send"
+	apiTyping = "/cgi-bin/message/custom/typing"
+)
+
+// 客服消息类型
+const (
+	MsgTypeText            = "text"
+	MsgTypeImage           = "image"
+	MsgTypeVoice           = "voice"
+	MsgTypeVideo           = "video"
+	MsgTypeMusic           = "music"
+	MsgTypeNews            = "news"            // 图文消息(点击跳转到外链)
+	MsgTypeMpNews          = "mpnews"          // 图文消息(点击跳转到图文消息页面)， 使用素材 media_id
+	MsgTypeMpNewsArticle   = "mpnewsarticle"   // 图文消息(点击跳转到图文消息页面)， 使用发布后的 article_id
+	MsgTypeMsgMenu         = "msgmenu"         // 菜单消息
+	MsgTypeWxCard          = "wxcard"          // 卡券
+	MsgTypeMiniProgramPage = "miniprogrampage" // 小程序卡片
+)
+
+// 输入状态
+const (
+	CommandTyping       = "Typing"
+	CommandCancelTyping = "CancelTyping"
+)
+
+type CustomServiceApi struct {
+	*utils.Client
+}
+
+func NewOfficialAccountApi(officialAccount *official_account.OfficialAccount) *CustomServiceApi {
+	return &CustomServiceApi{
+		Client: officialAccount.Client,
+	}
+}
+
+type Text struct {
+	Content string `json:"content"` // 文本消息内容， 支持 <a href="url">链接</a>
+}
+
+type Media struct {
+	MediaID string `json:"media_id"`
+}
+
+type Video struct {
+	MediaID      string `json:"media_id"`
+	ThumbMediaID string `json:"thumb_media_id"`
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type Music struct {
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+	MusicUrl     string `json:"musicurl"`
+	HQMusicUrl   string `json:"hqmusicurl"`
+	ThumbMediaID string `json:"thumb_media_id"`
+}
+
+// Article 图文消息， 只能有1条
+type Article struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Url         string `json:"url"`
+	PicUrl      string `json:"picurl"`
+}
+
+type News struct {
+	Articles []Article `json:"articles"`
+}
+
+type MpNewsArticle struct {
+	ArticleID string `json:"article_id"`
+}
+
+// MsgMenuItem 用户点击后， 推送一条内容为 Content 的文本消息， 并带上 bizmsgmenuid
+type MsgMenuItem struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+}
+
+type MsgMenu struct {
+	HeadContent string        `json:"head_content"`
+	List        []MsgMenuItem `json:"list"`
+	TailContent string        `json:"tail_content"`
+}
+
+type WxCard struct {
+	CardID string `json:"card_id"`
+}
+
+type MiniProgramPage struct {
+	Title        string `json:"title"`
+	Appid        string `json:"appid"`
+	PagePath     string `json:"pagepath"`
+	ThumbMediaID string `json:"thumb_media_id"`
+}
+
+type CustomService struct {
+	KfAccount string `json:"kf_account"`
+}
+
+// Message 客服消息， MsgType 决定哪个字段有效
+type Message struct {
+	ToUser          string           `json:"touser"`
+	MsgType         string           `json:"msgtype"`
+	Text            *Text            `json:"text,omitempty"`
+	Image           *Media           `json:"image,omitempty"`
+	Voice           *Media           `json:"voice,omitempty"`
+	Video           *Video           `json:"video,omitempty"`
+	Music           *Music           `json:"music,omitempty"`
+	News            *News            `json:"news,omitempty"`
+	MpNews          *Media           `json:"mpnews,omitempty"`
+	MpNewsArticle   *MpNewsArticle   `json:"mpnewsarticle,omitempty"`
+	MsgMenu         *MsgMenu         `json:"msgmenu,omitempty"`
+	WxCard          *WxCard          `json:"wxcard,omitempty"`
+	MiniProgramPage *MiniProgramPage `json:"miniprogrampage,omitempty"`
+	// CustomService 以某个客服帐号来发消息(在微信6.0.2及以上版本中显示自定义头像)
+	CustomService *CustomService `json:"customservice,omitempty"`
+}
+
+/*
+发送客服消息
+
+当用户和公众号产生特定动作的交互以后(比如发送消息、点击菜单、关注等)，
+48小时内可以调用客服接口发送消息给用户， 超时返回 45015
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Service_Center_messages.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/custom/send?access_token=ACCESS_TOKEN
+*/
+func (api *CustomServiceApi) Send(ctx context.Context, message *Message) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiSend, message, &result)
+}
+
+func (api *CustomServiceApi) SendText(ctx context.Context, toUser, content string) error {
+	return api.Send(ctx, &Message{ToUser: toUser, MsgType: MsgTypeText, Text: &Text{Content: content}})
+}
+
+func (api *CustomServiceApi) SendImage(ctx context.Context, toUser, mediaID string) error {
+	return api.Send(ctx, &Message{ToUser: toUser, MsgType: MsgTypeImage, Image: &Media{MediaID: mediaID}})
+}
+
+func (api *CustomServiceApi) SendVoice(ctx context.Context, toUser, mediaID string) error {
+	return api.Send(ctx, &Message{ToUser: toUser, MsgType: MsgTypeVoice, Voice: &Media{MediaID: mediaID}})
+}
+
+func (api *CustomServiceApi) SendVideo(ctx context.Context, toUser string, video *Video) error {
+	return api.Send(ctx, &Message{ToUser: toUser, MsgType: MsgTypeVideo, Video: video})
+}
+
+func (api *CustomServiceApi) SendMusic(ctx context.Context, toUser string, music *Music) error {
+	return api.Send(ctx, &Message{ToUser: toUser, MsgType: MsgTypeMusic, Music: music})
+}
+
+func (api *CustomServiceApi) SendNews(ctx context.Context, toUser string, article Article) error {
+	return api.Send(ctx, &Message{
+		ToUser: toUser, MsgType: MsgTypeNews, News: &News{Articles: []Article{article}},
+	})
+}
+
+func (api *CustomServiceApi) SendMpNews(ctx context.Context, toUser, mediaID string) error {
+	return api.Send(ctx, &Message{ToUser: toUser, MsgType: MsgTypeMpNews, MpNews: &Media{MediaID: mediaID}})
+}
+
+func (api *CustomServiceApi) SendMpNewsArticle(ctx context.Context, toUser, articleID string) error {
+	return api.Send(ctx, &Message{
+		ToUser: toUser, MsgType: MsgTypeMpNewsArticle, MpNewsArticle: &MpNewsArticle{ArticleID: articleID},
+	})
+}
+
+func (api *CustomServiceApi) SendMsgMenu(ctx context.Context, toUser string, menu *MsgMenu) error {
+	return api.Send(ctx, &Message{ToUser: toUser, MsgType: MsgTypeMsgMenu, MsgMenu: menu})
+}
+
+func (api *CustomServiceApi) SendWxCard(ctx context.Context, toUser, cardID string) error {
+	return api.Send(ctx, &Message{ToUser: toUser, MsgType: MsgTypeWxCard, WxCard: &WxCard{CardID: cardID}})
+}
+
+func (api *CustomServiceApi) SendMiniProgramPage(ctx context.Context, toUser string, page *MiniProgramPage) error {
+	return api.Send(ctx, &Message{ToUser: toUser, MsgType: MsgTypeMiniProgramPage, MiniProgramPage: page})
+}
+
+/*
+客服输入状态
+
+下发 Typing 后， 用户的对话界面显示"对方正在输入"， 持续15秒或者下发消息/CancelTyping 之后取消，
+同一个用户每分钟最多下发20次
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Service_Center_messages.html#客服输入状态
+
+POST https://api.weixin.qq.com/cgi-bin/message/custom/typing?access_token=ACCESS_TOKEN
+*/
+func (api *CustomServiceApi) Typing(ctx context.Context, toUser string, typing bool) error {
+	command := CommandCancelTyping
+	if typing {
+		command = CommandTyping
+	}
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiTyping, map[string]string{
+		"touser":  toUser,
+		"command": command,
+	}, &result)
+}
@@ -0,0 +1,315 @@
+// Package mass_api 群发消息
+package mass_api
+
+import (
+	"context"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/official_account"
+)
+
+const (
+	apiSendAll     = "/cgi-bin/message/mass/sendall"
+	apiSend        = "/cgi-bin/message/mass/send"
+	apiPreview     = "/cgi-bin/message/mass/preview"
+	apiDelete      = "/cgi-bin/message/mass/delete"
+	apiGet         = "/cgi-bin/message/mass/get"
+	apiGetSpeed    = "/cgi-bin/message/mass/speed/get"
+	apiSetSpeed    = "/cgi-bin/message/mass/speed/set"
+	apiUploadVideo = "/cgi-bin/media/uploadvideo"
+)
+
+// 群发消息类型
+const (
+	MsgTypeMpNews  = "mpnews" // 图文消息， 使用永久图文素材的 media_id
+	MsgTypeText    = "text"
+	MsgTypeVoice   = "voice"
+	MsgTypeImage   = "image"
+	MsgTypeMpVideo = "mpvideo"
+	MsgTypeWxCard  = "wxcard"
+)
+
+// 群发消息的状态
+const (
+	MsgStatusSendSuccess = "SEND_SUCCESS"
+	MsgStatusSending     = "SENDING"
+	MsgStatusSendFail    = "SEND_FAIL"
+	MsgStatusDelete      = "DELETE"
+)
+
+// 群发速度， 0-4 分别对应 80w/60w/45w/30w/10w 每分钟
+const (
+	SpeedLevel80W = iota
+	SpeedLevel60W
+	SpeedLevel45W
+	SpeedLevel30W
+	SpeedLevel10W
+)
+
+type MassApi struct {
+	*utils.Client
+}
+
+func NewOfficialAccountApi(officialAccount *official_account.OfficialAccount) *MassApi {
+	return &MassApi{
+		Client: officialAccount.Client,
+	}
+}
+
+type Text struct {
+	Content string `json:"content"`
+}
+
+type Media struct {
+	MediaID string `json:"media_id"`
+}
+
+// Images 图片消息， 最多20张
+type Images struct {
+	MediaIDs           []string `json:"media_ids"`
+	Recommend          string   `json:"recommend,omitempty"` // 推荐语
+	NeedOpenComment    int      `json:"need_open_comment,omitempty"`
+	OnlyFansCanComment int      `json:"only_fans_can_comment,omitempty"`
+}
+
+// MpVideo 视频消息， 按标签群发时 MediaID 需要先经过 UploadVideo 转换
+type MpVideo struct {
+	MediaID     string `json:"media_id"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type WxCard struct {
+	CardID string `json:"card_id"`
+}
+
+// Message 群发消息， MsgType 决定哪个字段有效
+type Message struct {
+	MsgType string   `json:"msgtype"`
+	MpNews  *Media   `json:"mpnews,omitempty"`
+	Text    *Text    `json:"text,omitempty"`
+	Voice   *Media   `json:"voice,omitempty"`
+	Images  *Images  `json:"images,omitempty"`
+	MpVideo *MpVideo `json:"mpvideo,omitempty"`
+	WxCard  *WxCard  `json:"wxcard,omitempty"`
+	// SendIgnoreReprint 图文被判定为转载时， 1 继续群发(转载)， 0 停止群发
+	SendIgnoreReprint int `json:"send_ignore_reprint,omitempty"`
+	// ClientMsgID 开发者侧群发 msgid， 24小时内相同的 clientmsgid 只会群发一次， 最长64字节
+	ClientMsgID string `json:"clientmsgid,omitempty"`
+}
+
+func NewTextMessage(content string) *Message {
+	return &Message{MsgType: MsgTypeText, Text: &Text{Content: content}}
+}
+
+func NewMpNewsMessage(mediaID string) *Message {
+	return &Message{MsgType: MsgTypeMpNews, MpNews: &Media{MediaID: mediaID}}
+}
+
+func NewVoiceMessage(mediaID string) *Message {
+	return &Message{MsgType: MsgTypeVoice, Voice: &Media{MediaID: mediaID}}
+}
+
+func NewImagesMessage(mediaIDs ...string) *Message {
+	return &Message{MsgType: MsgTypeImage, Images: &Images{MediaIDs: mediaIDs}}
+}
+
+func NewMpVideoMessage(video *MpVideo) *Message {
+	return &Message{MsgType: MsgTypeMpVideo, MpVideo: video}
+}
+
+func NewWxCardMessage(cardID string) *Message {
+	return &Message{MsgType: MsgTypeWxCard, WxCard: &WxCard{CardID: cardID}}
+}
+
+// Filter 群发的接收者， IsToAll 为 true 时忽略 TagID
+type Filter struct {
+	IsToAll bool `json:"is_to_all"`
+	TagID   int  `json:"tag_id"`
+}
+
+// SendResult 群发任务， MsgID 和群发任务完成事件(MASSSENDJOBFINISH)中的 MsgID 对应
+type SendResult struct {
+	utils.CommonError
+	Type      string `json:"type"`
+	MsgID     int64  `json:"msg_id"`
+	MsgDataID int64  `json:"msg_data_id"` // 图文消息的数据ID， 用于图文分析数据接口
+}
+
+type MsgStatus struct {
+	utils.CommonError
+	MsgID     int64  `json:"msg_id"`
+	MsgStatus string `json:"msg_status"`
+}
+
+type Speed struct {
+	utils.CommonError
+	Speed     int `json:"speed"`     // 群发速度的级别
+	RealSpeed int `json:"realspeed"` // 群发速度的真实值， 单位: 万/分钟
+}
+
+/*
+根据标签进行群发
+
+群发任务提交成功后， 结果通过群发任务完成事件(MASSSENDJOBFINISH)推送， 参考 JobTracker
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Batch_Sends_and_Originality_Checks.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/mass/sendall?access_token=ACCESS_TOKEN
+*/
+func (api *MassApi) SendAll(ctx context.Context, filter *Filter, message *Message) (*SendResult, error) {
+	payload := struct {
+		Filter *Filter `json:"filter"`
+		*Message
+	}{Filter: filter, Message: message}
+	result := &SendResult{}
+	if err := api.Client.ApiPostWrapper(ctx, apiSendAll, payload, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SendToAll 群发给所有粉丝
+func (api *MassApi) SendToAll(ctx context.Context, message *Message) (*SendResult, error) {
+	return api.SendAll(ctx, &Filter{IsToAll: true}, message)
+}
+
+// SendByTag 群发给标签下的粉丝
+func (api *MassApi) SendByTag(ctx context.Context, tagID int, message *Message) (*SendResult, error) {
+	return api.SendAll(ctx, &Filter{TagID: tagID}, message)
+}
+
+/*
+根据OpenID列表群发
+
+toUsers 至少2个， 最多10000个
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Batch_Sends_and_Originality_Checks.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/mass/send?access_token=ACCESS_TOKEN
+*/
+func (api *MassApi) Send(ctx context.Context, toUsers []string, message *Message) (*SendResult, error) {
+	payload := struct {
+		ToUser []string `json:"touser"`
+		*Message
+	}{ToUser: toUsers, Message: message}
+	result := &SendResult{}
+	if err := api.Client.ApiPostWrapper(ctx, apiSend, payload, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+预览接口
+
+发送给指定用户预览群发消息的效果， 每日调用上限为100次
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Batch_Sends_and_Originality_Checks.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/mass/preview?access_token=ACCESS_TOKEN
+*/
+func (api *MassApi) Preview(ctx context.Context, toUser string, message *Message) error {
+	payload := struct {
+		ToUser string `json:"touser"`
+		*Message
+	}{ToUser: toUser, Message: message}
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiPreview, payload, &result)
+}
+
+// PreviewByWxName 通过微信号预览， 优先于 OpenID
+func (api *MassApi) PreviewByWxName(ctx context.Context, wxName string, message *Message) error {
+	payload := struct {
+		ToWxName string `json:"towxname"`
+		*Message
+	}{ToWxName: wxName, Message: message}
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiPreview, payload, &result)
+}
+
+/*
+删除群发
+
+只能删除图文消息和视频消息， 群发发出半小时内可以删除， articleIdx 为要删除的文章在图文消息中的位置(从1开始)， 0 表示删除全部
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Batch_Sends_and_Originality_Checks.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/mass/delete?access_token=ACCESS_TOKEN
+*/
+func (api *MassApi) Delete(ctx context.Context, msgID int64, articleIdx int) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiDelete, map[string]interface{}{
+		"msg_id":      msgID,
+		"article_idx": articleIdx,
+	}, &result)
+}
+
+/*
+查询群发消息发送状态
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Batch_Sends_and_Originality_Checks.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/mass/get?access_token=ACCESS_TOKEN
+*/
+func (api *MassApi) Get(ctx context.Context, msgID int64) (*MsgStatus, error) {
+	result := &MsgStatus{}
+	err := api.Client.ApiPostWrapper(ctx, apiGet, map[string]interface{}{
+		"msg_id": msgID,
+	}, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+获取群发速度
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Batch_Sends_and_Originality_Checks.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/mass/speed/get?access_token=ACCESS_TOKEN
+*/
+func (api *MassApi) GetSpeed(ctx context.Context) (*Speed, error) {
+	result := &Speed{}
+	if err := api.Client.ApiPostWrapper(ctx, apiGetSpeed, struct{}{}, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+设置群发速度
+
+speed 为 SpeedLevel80W-SpeedLevel10W
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Batch_Sends_and_Originality_Checks.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/mass/speed/set?access_token=ACCESS_TOKEN
+*/
+func (api *MassApi) SetSpeed(ctx context.Context, speed int) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiSetSpeed, map[string]int{
+		"speed": speed,
+	}, &result)
+}
+
+/*
+上传群发视频
+
+按标签群发视频时， 需要先把临时视频素材的 media_id 转换成群发用的 media_id
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Batch_Sends_and_Originality_Checks.html
+
+POST https://api.weixin.qq.com/cgi-bin/media/uploadvideo?access_token=ACCESS_TOKEN
+*/
+func (api *MassApi) UploadVideo(ctx context.Context, video *MpVideo) (string, error) {
+	result := struct {
+		utils.CommonError
+		MediaID string `json:"media_id"`
+	}{}
+	if err := api.Client.ApiPostWrapper(ctx, apiUploadVideo, video, &result); err != nil {
+		return "", err
+	}
+	return result.MediaID, nil
+}
@@ -0,0 +1,106 @@
+package mass_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/server_api"
+	"github.com/lixinio/weixin/weixin/user_api"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMass(t *testing.T) {
+	server, officialAccount, cache := fixture.NewOfficialAccount(t)
+	for _, openid := range []string{"openid1", "openid2", "openid3"} {
+		server.AddOfficialAccountUser(wxtest.OfficialAccountUser{OpenID: openid})
+	}
+	api := NewOfficialAccountApi(officialAccount)
+	ctx := context.Background()
+
+	userApi := user_api.NewOfficialAccountApi(officialAccount)
+	tag, err := userApi.CreateTag(ctx, "weekly")
+	require.Equal(t, nil, err)
+	require.Equal(t, nil, userApi.BatchTagging(ctx, tag.Tag.ID, []string{"openid1", "openid2"}))
+
+	// 按标签群发， 并跟踪群发任务
+	message := NewMpNewsMessage("MEDIA_ID")
+	message.SendIgnoreReprint = 1
+	result, err := api.SendByTag(ctx, tag.Tag.ID, message)
+	require.Equal(t, nil, err)
+	require.NotEqual(t, int64(0), result.MsgID)
+	tracker := NewJobTracker(cache, "appid", 0)
+	require.Equal(t, nil, tracker.Track(result.MsgID, "weekly-42"))
+
+	status, err := api.Get(ctx, result.MsgID)
+	require.Equal(t, nil, err)
+	require.Equal(t, MsgStatusSending, status.MsgStatus)
+
+	var jobs []*JobResult
+	router := server_api.NewRouter(server_api.NewOfficialAccountApi(fixture.Token, fixture.EncodingAESKey, officialAccount))
+	router.OnMassSendJobFinish(tracker.OnJobFinish(func(ctx *server_api.Context, result *JobResult) error {
+		jobs = append(jobs, result)
+		return nil
+	}))
+	event, ok := server.MassSendJobFinish(result.MsgID)
+	require.True(t, ok)
+	callback := wxtest.NewOfficialAccountCallback(fixture.Token, fixture.EncodingAESKey, "appid")
+	reply, err := callback.Invoke(router, event)
+	require.Equal(t, nil, err)
+	require.Equal(t, http.StatusOK, reply.StatusCode)
+
+	require.Equal(t, 1, len(jobs))
+	require.True(t, jobs[0].Success())
+	require.True(t, jobs[0].Found)
+	require.Equal(t, "weekly-42", jobs[0].Value)
+	require.Equal(t, 2, jobs[0].TotalCount)
+	require.Equal(t, 2, jobs[0].SentCount)
+	require.False(t, jobs[0].SubmittedAt.IsZero())
+
+	status, err = api.Get(ctx, result.MsgID)
+	require.Equal(t, nil, err)
+	require.Equal(t, MsgStatusSendSuccess, status.MsgStatus)
+	require.Equal(t, nil, api.Delete(ctx, result.MsgID, 0))
+	status, err = api.Get(ctx, result.MsgID)
+	require.Equal(t, nil, err)
+	require.Equal(t, MsgStatusDelete, status.MsgStatus)
+
+	// 按 OpenID 列表群发和预览
+	_, err = api.Send(ctx, []string{"openid1", "openid3"}, NewTextMessage("hello"))
+	require.Equal(t, nil, err)
+	_, err = api.Send(ctx, []string{"openid1"}, NewTextMessage("hello"))
+	require.NotEqual(t, nil, err)
+	require.Equal(t, nil, api.Preview(ctx, "openid3", NewImagesMessage("MEDIA_ID1", "MEDIA_ID2")))
+	require.Equal(t, nil, api.PreviewByWxName(ctx, "wxname", NewVoiceMessage("MEDIA_ID")))
+
+	sent := []map[string]interface{}{}
+	for _, raw := range server.MassMessages() {
+		message := map[string]interface{}{}
+		require.Equal(t, nil, json.Unmarshal(raw, &message))
+		sent = append(sent, message)
+	}
+	require.Equal(t, 4, len(sent))
+	require.Equal(t, map[string]interface{}{
+		"filter":              map[string]interface{}{"is_to_all": false, "tag_id": float64(tag.Tag.ID)},
+		"msgtype":             MsgTypeMpNews,
+		"mpnews":              map[string]interface{}{"media_id": "MEDIA_ID"},
+		"send_ignore_reprint": float64(1),
+	}, sent[0])
+	require.Equal(t, []interface{}{"openid1", "openid3"}, sent[1]["touser"])
+	require.Equal(t, "wxname", sent[3]["towxname"])
+
+	// 群发速度
+	require.Equal(t, nil, api.SetSpeed(ctx, SpeedLevel30W))
+	speed, err := api.GetSpeed(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, SpeedLevel30W, speed.Speed)
+	require.Equal(t, 30, speed.RealSpeed)
+
+	_, err = api.UploadVideo(ctx, &MpVideo{MediaID: "invalid", Title: "title"})
+	require.True(t, errors.Is(err, utils.ErrorInvalidMediaID))
+}
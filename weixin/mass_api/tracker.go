@@ -0,0 +1,78 @@
+package mass_api
+
+import (
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/server_api"
+)
+
+// 大量粉丝的群发可能持续数小时， 保留三天
+const defaultJobTrackerTTL = 72 * time.Hour
+
+// JobResult 群发任务完成事件和 Track 时记录的数据
+type JobResult struct {
+	MsgID       string
+	Status      string
+	TotalCount  int
+	FilterCount int
+	SentCount   int
+	ErrorCount  int
+	Value       string    // Track 记录的数据
+	SubmittedAt time.Time // Track 的时间
+	Found       bool      // 是否找到 Track 的记录， 记录过期或者不是通过 Track 群发的为 false
+}
+
+// Success 群发是否成功， 成功时也可能有部分粉丝发送失败， 参考 ErrorCount
+func (result *JobResult) Success() bool {
+	return result.Status == server_api.MassSendStatusSuccess
+}
+
+// JobTracker 通过 msg_id 关联提交的群发任务和群发任务完成事件(MASSSENDJOBFINISH)
+type JobTracker struct {
+	*utils.MsgTracker
+}
+
+// NewJobTracker appid 用于区分不同的公众号， ttl 为记录保存的时长， 0表示缺省三天
+func NewJobTracker(cache utils.Cache, appid string, ttl time.Duration) *JobTracker {
+	if ttl <= 0 {
+		ttl = defaultJobTrackerTTL
+	}
+	return &JobTracker{
+		MsgTracker: utils.NewMsgTracker(cache, "mass-send", appid, ttl),
+	}
+}
+
+func jobResult(event *server_api.EventMassSendJobFinish, record utils.TrackRecord, found bool) *JobResult {
+	return &JobResult{
+		MsgID:       event.MsgID,
+		Status:      event.Status,
+		TotalCount:  event.TotalCount,
+		FilterCount: event.FilterCount,
+		SentCount:   event.SentCount,
+		ErrorCount:  event.ErrorCount,
+		Value:       record.Value,
+		SubmittedAt: record.SubmittedAt,
+		Found:       found,
+	}
+}
+
+// Resolve 查找事件对应的记录
+func (tracker *JobTracker) Resolve(event *server_api.EventMassSendJobFinish) (*JobResult, error) {
+	record, found, err := tracker.Lookup(event.MsgID)
+	if err != nil {
+		return nil, err
+	}
+	return jobResult(event, record, found), nil
+}
+
+// OnJobFinish 生成 server_api.Router.OnMassSendJobFinish 的处理函数， handler 成功后删除记录
+func (tracker *JobTracker) OnJobFinish(
+	handler func(ctx *server_api.Context, result *JobResult) error,
+) func(ctx *server_api.Context, event server_api.EventMassSendJobFinish) (interface{}, error) {
+	return func(ctx *server_api.Context, event server_api.EventMassSendJobFinish) (interface{}, error) {
+		return nil, tracker.Finish(event.MsgID, func(record utils.TrackRecord, found bool) error {
+			return handler(ctx, jobResult(&event, record, found))
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package material_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	apiAddMaterial      = "/cgi-bin/material/add_material"
+	apiGetMaterial      = "/cgi-bin/material/get_material"
+	apiDelMaterial      = "/cgi-bin/material/del_material"
+	apiGetMaterialCount = "/cgi-bin/material/get_materialcount"
+	apiBatchGetMaterial = "/cgi-bin/material/batchget_material"
+)
+
+// Material 永久素材， 只有图片素材返回 Url
+type Material struct {
+	utils.CommonError
+	MediaID string `json:"media_id"`
+	Url     string `json:"url"`
+}
+
+// VideoDescription 永久视频素材的描述
+type VideoDescription struct {
+	Title        string `json:"title"`
+	Introduction string `json:"introduction"`
+}
+
+// VideoInfo 永久视频素材
+type VideoInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	DownUrl     string `json:"down_url"`
+}
+
+// NewsArticle 永久图文素材中的文章
+type NewsArticle struct {
+	Title              string `json:"title"`
+	ThumbMediaID       string `json:"thumb_media_id"`
+	ThumbUrl           string `json:"thumb_url"`
+	ShowCoverPic       int    `json:"show_cover_pic"`
+	Author             string `json:"author"`
+	Digest             string `json:"digest"`
+	Content            string `json:"content"`
+	Url                string `json:"url"`
+	ContentSourceUrl   string `json:"content_source_url"`
+	NeedOpenComment    int    `json:"need_open_comment"`
+	OnlyFansCanComment int    `json:"only_fans_can_comment"`
+}
+
+type MaterialCount struct {
+	utils.CommonError
+	VoiceCount int `json:"voice_count"`
+	VideoCount int `json:"video_count"`
+	ImageCount int `json:"image_count"`
+	NewsCount  int `json:"news_count"`
+}
+
+// MaterialItem 素材列表中的素材， 图文素材的内容在 Content
+type MaterialItem struct {
+	MediaID    string `json:"media_id"`
+	Name       string `json:"name"`
+	UpdateTime int64  `json:"update_time"`
+	Url        string `json:"url"`
+	Content    *struct {
+		NewsItem   []NewsArticle `json:"news_item"`
+		CreateTime int64         `json:"create_time"`
+		UpdateTime int64         `json:"update_time"`
+	} `json:"content,omitempty"`
+}
+
+type MaterialList struct {
+	utils.CommonError
+	TotalCount int            `json:"total_count"`
+	ItemCount  int            `json:"item_count"`
+	Item       []MaterialItem `json:"item"`
+}
+
+func (api *MaterialApi) addMaterial(
+	ctx context.Context, mediaType string, fields map[string]string,
+	filename string, length int64, content io.Reader,
+) (*Material, error) {
+	params := url.Values{}
+	params.Add("type", mediaType)
+	resp, err := api.upload(ctx, apiAddMaterial+"?"+params.Encode(), fields, filename, length, content)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Material{}
+	if err = json.Unmarshal(resp, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+新增其他类型永久素材
+
+mediaType 为 image/voice/thumb， 视频用 AddVideo
+length 为文件大小， 不知道大小时传0
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Adding_Permanent_Assets.html
+
+POST(@media) https://api.weixin.qq.com/cgi-bin/material/add_material?access_token=ACCESS_TOKEN&type=TYPE
+*/
+func (api *MaterialApi) AddMaterial(
+	ctx context.Context, mediaType, filename string, length int64, content io.Reader,
+) (*Material, error) {
+	if mediaType == MediaTypeVideo {
+		return nil, ErrorVideoDescription
+	}
+	return api.addMaterial(ctx, mediaType, nil, filename, length, content)
+}
+
+/*
+新增永久视频素材
+
+需要额外提交视频的标题和描述， 大的视频文件建议传入 length 以 Content-Length 流式上传
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Adding_Permanent_Assets.html
+
+POST(@media) https://api.weixin.qq.com/cgi-bin/material/add_material?access_token=ACCESS_TOKEN&type=video
+*/
+func (api *MaterialApi) AddVideo(
+	ctx context.Context, filename string, length int64, content io.Reader, description *VideoDescription,
+) (*Material, error) {
+	if description == nil {
+		return nil, ErrorVideoDescription
+	}
+	data, err := json.Marshal(description)
+	if err != nil {
+		return nil, err
+	}
+	return api.addMaterial(ctx, MediaTypeVideo, map[string]string{
+		"description": string(data),
+	}, filename, length, content)
+}
+
+/*
+获取永久素材
+
+图片/语音/缩略图素材返回文件内容， 调用者负责关闭 Body； 视频和图文素材返回 ErrorNotBinaryMedia
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Getting_Permanent_Assets.html
+
+POST https://api.weixin.qq.com/cgi-bin/material/get_material?access_token=ACCESS_TOKEN
+*/
+func (api *MaterialApi) GetMaterial(ctx context.Context, mediaID string) (*http.Response, error) {
+	body, err := json.Marshal(map[string]string{"media_id": mediaID})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := api.Client.HTTPPostRaw(ctx, apiGetMaterial, bytes.NewReader(body), "application/json;charset=utf-8")
+	if err != nil {
+		return nil, err
+	}
+	return mediaResponse(resp)
+}
+
+/*
+获取永久视频素材
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Getting_Permanent_Assets.html
+
+POST https://api.weixin.qq.com/cgi-bin/material/get_material?access_token=ACCESS_TOKEN
+*/
+func (api *MaterialApi) GetVideo(ctx context.Context, mediaID string) (*VideoInfo, error) {
+	result := struct {
+		utils.CommonError
+		VideoInfo
+	}{}
+	err := api.Client.ApiPostWrapper(ctx, apiGetMaterial, map[string]string{
+		"media_id": mediaID,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result.VideoInfo, nil
+}
+
+/*
+获取永久图文素材
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Getting_Permanent_Assets.html
+
+POST https://api.weixin.qq.com/cgi-bin/material/get_material?access_token=ACCESS_TOKEN
+*/
+func (api *MaterialApi) GetNews(ctx context.Context, mediaID string) ([]NewsArticle, error) {
+	result := struct {
+		utils.CommonError
+		NewsItem []NewsArticle `json:"news_item"`
+	}{}
+	err := api.Client.ApiPostWrapper(ctx, apiGetMaterial, map[string]string{
+		"media_id": mediaID,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.NewsItem, nil
+}
+
+/*
+删除永久素材
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Deleting_Permanent_Assets.html
+
+POST https://api.weixin.qq.com/cgi-bin/material/del_material?access_token=ACCESS_TOKEN
+*/
+func (api *MaterialApi) DeleteMaterial(ctx context.Context, mediaID string) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiDelMaterial, map[string]string{
+		"media_id": mediaID,
+	}, &result)
+}
+
+/*
+获取素材总数
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Get_the_total_of_all_materials.html
+
+GET https://api.weixin.qq.com/cgi-bin/material/get_materialcount?access_token=ACCESS_TOKEN
+*/
+func (api *MaterialApi) GetMaterialCount(ctx context.Context) (*MaterialCount, error) {
+	result := &MaterialCount{}
+	if err := api.Client.ApiGetNullWrapper(ctx, apiGetMaterialCount, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+获取素材列表
+
+mediaType 为 image/video/voice/news， offset 从0开始， count 取值 1-20
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Get_materials_list.html
+
+POST https://api.weixin.qq.com/cgi-bin/material/batchget_material?access_token=ACCESS_TOKEN
+*/
+func (api *MaterialApi) BatchGetMaterial(
+	ctx context.Context, mediaType string, offset, count int,
+) (*MaterialList, error) {
+	result := &MaterialList{}
+	err := api.Client.ApiPostWrapper(ctx, apiBatchGetMaterial, map[string]interface{}{
+		"type":   mediaType,
+		"offset": offset,
+		"count":  count,
+	}, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
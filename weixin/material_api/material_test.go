@@ -0,0 +1,137 @@
+package material_api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	imageData = []byte("\x89PNG\r\n\x1a\nfake image")
+	videoData = []byte(strings.Repeat("fake video ", 1024))
+)
+
+func newTestApi(t *testing.T) *MaterialApi {
+	_, officialAccount, _ := fixture.NewOfficialAccount(t)
+	return NewOfficialAccountApi(officialAccount)
+}
+
+func readAll(t *testing.T, resp *http.Response) []byte {
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.Equal(t, nil, err)
+	return data
+}
+
+func download(t *testing.T, url string) []byte {
+	resp, err := http.Get(url)
+	require.Equal(t, nil, err)
+	return readAll(t, resp)
+}
+
+func TestUploadExpiredAccessToken(t *testing.T) {
+	server, officialAccount, _ := fixture.NewOfficialAccount(t)
+	api := NewOfficialAccountApi(officialAccount)
+	ctx := context.Background()
+
+	// 可以 Seek 的内容刷新 token 后重新上传
+	for _, length := range []int64{int64(len(imageData)), 0} {
+		server.ExpireAccessTokens()
+		image, err := api.Upload(ctx, MediaTypeImage, "a.png", length, bytes.NewReader(imageData))
+		require.Equal(t, nil, err)
+		resp, err := api.Get(ctx, image.MediaID)
+		require.Equal(t, nil, err)
+		require.Equal(t, imageData, readAll(t, resp))
+	}
+
+	// 不能重放的内容返回 token 失效的错误， 再次上传使用新的 token
+	server.ExpireAccessTokens()
+	_, err := api.Upload(ctx, MediaTypeImage, "a.png", 0, io.MultiReader(bytes.NewReader(imageData)))
+	require.True(t, errors.Is(err, utils.ErrorAccessToken))
+	_, err = api.Upload(ctx, MediaTypeImage, "a.png", 0, io.MultiReader(bytes.NewReader(imageData)))
+	require.Equal(t, nil, err)
+}
+
+func TestMedia(t *testing.T) {
+	api := newTestApi(t)
+	ctx := context.Background()
+
+	// 不知道大小时 chunked 上传
+	image, err := api.Upload(ctx, MediaTypeImage, "/tmp/a.png", 0, bytes.NewReader(imageData))
+	require.Equal(t, nil, err)
+	require.Equal(t, MediaTypeImage, image.Type)
+	require.NotEqual(t, int64(0), image.CreatedAt)
+	resp, err := api.Get(ctx, image.MediaID)
+	require.Equal(t, nil, err)
+	require.Equal(t, imageData, readAll(t, resp))
+
+	video, err := api.Upload(ctx, MediaTypeVideo, "a.mp4", int64(len(videoData)), bytes.NewReader(videoData))
+	require.Equal(t, nil, err)
+	_, err = api.Get(ctx, video.MediaID)
+	require.Equal(t, ErrorNotBinaryMedia, err)
+	videoUrl, err := api.GetVideoUrl(ctx, video.MediaID)
+	require.Equal(t, nil, err)
+	require.Equal(t, videoData, download(t, videoUrl))
+
+	url, err := api.UploadImg(ctx, "b.png", int64(len(imageData)), bytes.NewReader(imageData))
+	require.Equal(t, nil, err)
+	require.Equal(t, imageData, download(t, url))
+
+	_, err = api.Get(ctx, "invalid")
+	require.True(t, errors.Is(err, utils.ErrorInvalidMediaID))
+	_, err = api.Upload(ctx, "doc", "a.txt", 0, strings.NewReader("text"))
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeInvalidMediaType}))
+}
+
+func TestMaterial(t *testing.T) {
+	api := newTestApi(t)
+	ctx := context.Background()
+
+	image, err := api.AddMaterial(ctx, MediaTypeImage, "a.png", 0, bytes.NewReader(imageData))
+	require.Equal(t, nil, err)
+	require.Equal(t, imageData, download(t, image.Url))
+	resp, err := api.GetMaterial(ctx, image.MediaID)
+	require.Equal(t, nil, err)
+	require.Equal(t, imageData, readAll(t, resp))
+
+	_, err = api.AddMaterial(ctx, MediaTypeVideo, "a.mp4", 0, bytes.NewReader(videoData))
+	require.Equal(t, ErrorVideoDescription, err)
+	video, err := api.AddVideo(ctx, "a.mp4", int64(len(videoData)), bytes.NewReader(videoData), &VideoDescription{
+		Title:        "标题",
+		Introduction: "描述",
+	})
+	require.Equal(t, nil, err)
+	_, err = api.GetMaterial(ctx, video.MediaID)
+	require.Equal(t, ErrorNotBinaryMedia, err)
+	videoInfo, err := api.GetVideo(ctx, video.MediaID)
+	require.Equal(t, nil, err)
+	require.Equal(t, "标题", videoInfo.Title)
+	require.Equal(t, "描述", videoInfo.Description)
+	require.Equal(t, videoData, download(t, videoInfo.DownUrl))
+
+	count, err := api.GetMaterialCount(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, count.ImageCount)
+	require.Equal(t, 1, count.VideoCount)
+
+	list, err := api.BatchGetMaterial(ctx, MediaTypeImage, 0, 20)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, list.TotalCount)
+	require.Equal(t, image.MediaID, list.Item[0].MediaID)
+	require.Equal(t, "a.png", list.Item[0].Name)
+
+	require.Equal(t, nil, api.DeleteMaterial(ctx, image.MediaID))
+	_, err = api.GetMaterial(ctx, image.MediaID)
+	require.True(t, errors.Is(err, utils.ErrorInvalidMediaID))
+	err = api.DeleteMaterial(ctx, image.MediaID)
+	require.True(t, errors.Is(err, utils.ErrorInvalidMediaID))
+}
@@ -0,0 +1,225 @@
+// Package material_api 素材管理
+package material_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/official_account"
+)
+
+const (
+	apiUpload    = "/cgi-bin/media/upload"
+	apiUploadImg = "/cgi-bin/media/uploadimg"
+	apiGet       = "/cgi-bin/media/get"
+)
+
+const (
+	MediaTypeImage = "image"
+	MediaTypeVoice = "voice"
+	MediaTypeVideo = "video"
+	MediaTypeThumb = "thumb" // 缩略图
+	MediaTypeNews  = "news"  // 图文， 只用于 BatchGetMaterial
+)
+
+const mediaFieldName = "media"
+
+var (
+	// 视频和图文素材下载时返回的是json， 需要用 GetVideoUrl/GetVideo/GetNews
+	ErrorNotBinaryMedia = errors.New("media is not binary, use GetVideoUrl/GetVideo/GetNews")
+	// 永久视频素材需要标题和描述， 用 AddVideo 上传
+	ErrorVideoDescription = errors.New("video material requires description, use AddVideo")
+)
+
+type MaterialApi struct {
+	*utils.Client
+}
+
+func NewOfficialAccountApi(officialAccount *official_account.OfficialAccount) *MaterialApi {
+	return &MaterialApi{
+		Client: officialAccount.Client,
+	}
+}
+
+// Media 临时素材， 3天后 media_id 失效
+type Media struct {
+	utils.CommonError
+	Type      string `json:"type"`
+	MediaID   string `json:"media_id"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+/*
+上传素材文件， 不会把文件读到内存
+
+length 大于0或者 content 可以 Seek(比如 *os.File)时设置 Content-Length 用 Client.HTTPUploadWithFields 上传，
+适合大的视频文件， access_token 失效时可以重新上传； 否则一边读取 content 一边用 chunked 编码上传
+*/
+func (api *MaterialApi) upload(
+	ctx context.Context, uri string, fields map[string]string,
+	filename string, length int64, content io.Reader,
+) ([]byte, error) {
+	if seeker, ok := content.(io.Seeker); ok && length <= 0 {
+		var err error
+		if length, err = remainingLength(seeker); err != nil {
+			return nil, err
+		}
+	}
+	if length > 0 {
+		return api.Client.HTTPUploadWithFields(ctx, uri, fields, content, mediaFieldName, filename, length)
+	}
+
+	r, w := io.Pipe()
+	// 请求提前失败时让写入的 goroutine 退出
+	defer r.Close()
+	m := multipart.NewWriter(w)
+	go func() {
+		w.CloseWithError(writeMultipart(m, fields, filename, content))
+	}()
+	return api.Client.HTTPPost(ctx, uri, r, m.FormDataContentType())
+}
+
+// remainingLength 从当前位置到结尾的长度， 不改变当前位置
+func remainingLength(seeker io.Seeker) (int64, error) {
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = seeker.Seek(current, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return end - current, nil
+}
+
+func writeMultipart(m *multipart.Writer, fields map[string]string, filename string, content io.Reader) error {
+	for name, value := range fields {
+		if err := m.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	part, err := m.CreateFormFile(mediaFieldName, path.Base(filename))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(part, content); err != nil {
+		return err
+	}
+	return m.Close()
+}
+
+// 下载的素材是文件时返回 response， 调用者负责关闭 Body
+func mediaResponse(resp *http.Response) (*http.Response, error) {
+	ct := utils.ContentType(resp)
+	if resp.StatusCode == http.StatusOK && ct != "application/json" && ct != "text/plain" {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	if _, err := utils.ResponseFilter(resp); err != nil {
+		return nil, err
+	}
+	return nil, ErrorNotBinaryMedia
+}
+
+/*
+新增临时素材
+
+图片(image) 10M， 语音(voice) 2M， 视频(video) 10MB， 缩略图(thumb) 64KB
+length 为文件大小， 不知道大小时传0
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/New_temporary_materials.html
+
+POST(@media) https://api.weixin.qq.com/cgi-bin/media/upload?access_token=ACCESS_TOKEN&type=TYPE
+*/
+func (api *MaterialApi) Upload(
+	ctx context.Context, mediaType, filename string, length int64, content io.Reader,
+) (*Media, error) {
+	params := url.Values{}
+	params.Add("type", mediaType)
+	resp, err := api.upload(ctx, apiUpload+"?"+params.Encode(), nil, filename, length, content)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Media{}
+	if err = json.Unmarshal(resp, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+获取临时素材
+
+视频素材返回 ErrorNotBinaryMedia， 用 GetVideoUrl 获取下载地址
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Get_temporary_materials.html
+
+GET https://api.weixin.qq.com/cgi-bin/media/get?access_token=ACCESS_TOKEN&media_id=MEDIA_ID
+*/
+func (api *MaterialApi) Get(ctx context.Context, mediaID string) (*http.Response, error) {
+	params := url.Values{}
+	params.Add("media_id", mediaID)
+	resp, err := api.Client.HTTPGetWithParamsRaw(ctx, apiGet, params)
+	if err != nil {
+		return nil, err
+	}
+	return mediaResponse(resp)
+}
+
+/*
+获取临时视频素材的下载地址
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Get_temporary_materials.html
+
+GET https://api.weixin.qq.com/cgi-bin/media/get?access_token=ACCESS_TOKEN&media_id=MEDIA_ID
+*/
+func (api *MaterialApi) GetVideoUrl(ctx context.Context, mediaID string) (string, error) {
+	result := struct {
+		utils.CommonError
+		VideoUrl string `json:"video_url"`
+	}{}
+	err := api.Client.ApiGetWrapper(ctx, apiGet, func(params url.Values) {
+		params.Add("media_id", mediaID)
+	}, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.VideoUrl, nil
+}
+
+/*
+上传图文消息内的图片获取URL
+
+只支持 jpg/png， 1MB 以下， 不占用素材库的数量限制
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Adding_Permanent_Assets.html
+
+POST(@media) https://api.weixin.qq.com/cgi-bin/media/uploadimg?access_token=ACCESS_TOKEN
+*/
+func (api *MaterialApi) UploadImg(ctx context.Context, filename string, length int64, content io.Reader) (string, error) {
+	resp, err := api.upload(ctx, apiUploadImg, nil, filename, length, content)
+	if err != nil {
+		return "", err
+	}
+
+	result := struct {
+		utils.CommonError
+		Url string `json:"url"`
+	}{}
+	if err = json.Unmarshal(resp, &result); err != nil {
+		return "", err
+	}
+	return result.Url, nil
+}
@@ -0,0 +1,210 @@
+package menu_api
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 菜单的限制
+// See: https://developers.weixin.qq.com/doc/offiaccount/Custom_Menus/Creating_Custom-Defined_Menu.html
+const (
+	MaxButtons      = 3    // 一级菜单最多3个
+	MaxSubButtons   = 5    // 二级菜单最多5个
+	MaxNameBytes    = 16   // 一级菜单标题不超过16个字节
+	MaxSubNameBytes = 60   // 二级菜单标题不超过60个字节
+	MaxKeyBytes     = 128  // key 不超过128字节
+	MaxUrlBytes     = 1024 // url 不超过1024字节
+)
+
+var (
+	ErrorInvalidMenu         = errors.New("invalid menu")
+	ErrorMissingMatchRule    = fmt.Errorf("%w: conditional menu requires matchrule", ErrorInvalidMenu)
+	ErrorUnexpectedMatchRule = fmt.Errorf("%w: default menu must not have matchrule", ErrorInvalidMenu)
+)
+
+func ClickButton(name, key string) *Button {
+	return &Button{Type: MenuTypeClick, Name: name, Key: key}
+}
+
+func ViewButton(name, url string) *Button {
+	return &Button{Type: MenuTypeView, Name: name, Url: url}
+}
+
+func ScanCodePushButton(name, key string) *Button {
+	return &Button{Type: MenuTypeScanCodePush, Name: name, Key: key}
+}
+
+func ScanCodeWaitMsgButton(name, key string) *Button {
+	return &Button{Type: MenuTypeScanCodeWaitMsg, Name: name, Key: key}
+}
+
+func PicSysPhotoButton(name, key string) *Button {
+	return &Button{Type: MenuTypePicSysPhoto, Name: name, Key: key}
+}
+
+func PicPhotoOrAlbumButton(name, key string) *Button {
+	return &Button{Type: MenuTypePicPhotoOrAlbum, Name: name, Key: key}
+}
+
+func PicWeixinButton(name, key string) *Button {
+	return &Button{Type: MenuTypePicWeixin, Name: name, Key: key}
+}
+
+func LocationSelectButton(name, key string) *Button {
+	return &Button{Type: MenuTypeLocationSelect, Name: name, Key: key}
+}
+
+func MediaButton(name, mediaID string) *Button {
+	return &Button{Type: MenuTypeMediaID, Name: name, MediaID: mediaID}
+}
+
+func ArticleButton(name, articleID string) *Button {
+	return &Button{Type: MenuTypeArticleID, Name: name, ArticleID: articleID}
+}
+
+func ArticleViewButton(name, articleID string) *Button {
+	return &Button{Type: MenuTypeArticleViewLimited, Name: name, ArticleID: articleID}
+}
+
+// MiniProgramButton url 为不支持小程序的老版本客户端打开的网页
+func MiniProgramButton(name, appid, pagepath, url string) *Button {
+	return &Button{Type: MenuTypeMiniProgram, Name: name, AppID: appid, PagePath: pagepath, Url: url}
+}
+
+// SubMenu 包含二级菜单的一级菜单
+func SubMenu(name string, buttons ...*Button) *Button {
+	return &Button{Name: name, SubButton: buttons}
+}
+
+// Builder 构造菜单， Build 时检查菜单是否符合微信的限制
+type Builder struct {
+	menu Menu
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Add 添加一级菜单
+func (builder *Builder) Add(buttons ...*Button) *Builder {
+	builder.menu.Button = append(builder.menu.Button, buttons...)
+	return builder
+}
+
+// MatchRule 设置个性化菜单的匹配规则
+func (builder *Builder) MatchRule(matchRule *MatchRule) *Builder {
+	builder.menu.MatchRule = matchRule
+	return builder
+}
+
+func (builder *Builder) Build() (*Menu, error) {
+	if err := builder.menu.Validate(); err != nil {
+		return nil, err
+	}
+	menu := builder.menu
+	return &menu, nil
+}
+
+// Validate 检查菜单个数、标题长度和每种类型必填的字段， 错误可以用 errors.Is(err, ErrorInvalidMenu) 判断
+func (menu *Menu) Validate() error {
+	if len(menu.Button) == 0 || len(menu.Button) > MaxButtons {
+		return fmt.Errorf("%w: button count %d, must be 1-%d", ErrorInvalidMenu, len(menu.Button), MaxButtons)
+	}
+	for i, button := range menu.Button {
+		path := fmt.Sprintf("button[%d]", i)
+		if button == nil {
+			return fmt.Errorf("%w: %s is nil", ErrorInvalidMenu, path)
+		}
+		if err := checkName(path, button.Name, MaxNameBytes); err != nil {
+			return err
+		}
+		if len(button.SubButton) == 0 {
+			if err := checkButton(path, button); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(button.SubButton) > MaxSubButtons {
+			return fmt.Errorf(
+				"%w: %s sub_button count %d, must be 1-%d",
+				ErrorInvalidMenu, path, len(button.SubButton), MaxSubButtons,
+			)
+		}
+		for j, subButton := range button.SubButton {
+			subPath := fmt.Sprintf("%s.sub_button[%d]", path, j)
+			if subButton == nil {
+				return fmt.Errorf("%w: %s is nil", ErrorInvalidMenu, subPath)
+			}
+			if len(subButton.SubButton) > 0 {
+				return fmt.Errorf("%w: %s can not have sub_button", ErrorInvalidMenu, subPath)
+			}
+			if err := checkName(subPath, subButton.Name, MaxSubNameBytes); err != nil {
+				return err
+			}
+			if err := checkButton(subPath, subButton); err != nil {
+				return err
+			}
+		}
+	}
+
+	if menu.MatchRule != nil {
+		switch menu.MatchRule.ClientPlatformType {
+		case "", ClientPlatformIOS, ClientPlatformAndroid, ClientPlatformOthers:
+		default:
+			return fmt.Errorf(
+				"%w: invalid client_platform_type %s", ErrorInvalidMenu, menu.MatchRule.ClientPlatformType,
+			)
+		}
+		if menu.MatchRule.TagID == "" && menu.MatchRule.ClientPlatformType == "" {
+			return fmt.Errorf("%w: matchrule is empty", ErrorInvalidMenu)
+		}
+	}
+	return nil
+}
+
+func checkName(path, name string, maxBytes int) error {
+	if name == "" {
+		return fmt.Errorf("%w: %s name is empty", ErrorInvalidMenu, path)
+	}
+	if len(name) > maxBytes {
+		return fmt.Errorf("%w: %s name exceeds %d bytes", ErrorInvalidMenu, path, maxBytes)
+	}
+	return nil
+}
+
+func checkField(path, field, value string, maxBytes int) error {
+	if value == "" {
+		return fmt.Errorf("%w: %s %s is required", ErrorInvalidMenu, path, field)
+	}
+	if maxBytes > 0 && len(value) > maxBytes {
+		return fmt.Errorf("%w: %s %s exceeds %d bytes", ErrorInvalidMenu, path, field, maxBytes)
+	}
+	return nil
+}
+
+// 检查没有二级菜单的按钮
+func checkButton(path string, button *Button) error {
+	switch button.Type {
+	case MenuTypeClick, MenuTypeScanCodePush, MenuTypeScanCodeWaitMsg,
+		MenuTypePicSysPhoto, MenuTypePicPhotoOrAlbum, MenuTypePicWeixin, MenuTypeLocationSelect:
+		return checkField(path, "key", button.Key, MaxKeyBytes)
+	case MenuTypeView:
+		return checkField(path, "url", button.Url, MaxUrlBytes)
+	case MenuTypeMediaID, MenuTypeViewLimited:
+		return checkField(path, "media_id", button.MediaID, 0)
+	case MenuTypeArticleID, MenuTypeArticleViewLimited:
+		return checkField(path, "article_id", button.ArticleID, 0)
+	case MenuTypeMiniProgram:
+		if err := checkField(path, "url", button.Url, MaxUrlBytes); err != nil {
+			return err
+		}
+		if err := checkField(path, "appid", button.AppID, 0); err != nil {
+			return err
+		}
+		return checkField(path, "pagepath", button.PagePath, 0)
+	case "":
+		return fmt.Errorf("%w: %s type is required", ErrorInvalidMenu, path)
+	}
+	return fmt.Errorf("%w: %s unknown type %s", ErrorInvalidMenu, path, button.Type)
+}
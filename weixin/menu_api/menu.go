@@ -0,0 +1,252 @@
+// Package menu_api 自定义菜单
+package menu_api
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/official_account"
+)
+
+const (
+	apiCreate             = "/cgi-bin/menu/create"
+	apiGet                = "/cgi-bin/menu/get"
+	apiDelete             = "/cgi-bin/menu/delete"
+	apiGetCurrentSelfMenu = "/cgi-bin/get_current_selfmenu_info"
+	apiAddConditional     = "/cgi-bin/menu/addconditional"
+	apiDeleteConditional  = "/cgi-bin/menu/delconditional"
+	apiTryMatch           = "/cgi-bin/menu/trymatch"
+)
+
+// 菜单类型， 和 server_api 中的菜单事件对应
+const (
+	MenuTypeClick              = "click"                // 点击推事件
+	MenuTypeView               = "view"                 // 跳转URL
+	MenuTypeScanCodePush       = "scancode_push"        // 扫码推事件
+	MenuTypeScanCodeWaitMsg    = "scancode_waitmsg"     // 扫码推事件且弹出“消息接收中”提示框
+	MenuTypePicSysPhoto        = "pic_sysphoto"         // 弹出系统拍照发图
+	MenuTypePicPhotoOrAlbum    = "pic_photo_or_album"   // 弹出拍照或者相册发图
+	MenuTypePicWeixin          = "pic_weixin"           // 弹出微信相册发图器
+	MenuTypeLocationSelect     = "location_select"      // 弹出地理位置选择器
+	MenuTypeMediaID            = "media_id"             // 下发消息(除文本消息)
+	MenuTypeViewLimited        = "view_limited"         // 跳转图文消息URL
+	MenuTypeArticleID          = "article_id"           // 下发发布后的图文消息
+	MenuTypeArticleViewLimited = "article_view_limited" // 跳转发布后的图文消息URL
+	MenuTypeMiniProgram        = "view_miniprogram"     // 跳转小程序
+)
+
+// 个性化菜单的客户端版本
+const (
+	ClientPlatformIOS     = "1"
+	ClientPlatformAndroid = "2"
+	ClientPlatformOthers  = "3"
+)
+
+type MenuApi struct {
+	*utils.Client
+}
+
+func NewOfficialAccountApi(officialAccount *official_account.OfficialAccount) *MenuApi {
+	return &MenuApi{
+		Client: officialAccount.Client,
+	}
+}
+
+// Button 菜单按钮， 有 SubButton 的一级菜单不需要 Type
+type Button struct {
+	Type      string    `json:"type,omitempty"`
+	Name      string    `json:"name"`
+	Key       string    `json:"key,omitempty"`
+	Url       string    `json:"url,omitempty"`
+	MediaID   string    `json:"media_id,omitempty"`
+	ArticleID string    `json:"article_id,omitempty"`
+	AppID     string    `json:"appid,omitempty"`
+	PagePath  string    `json:"pagepath,omitempty"`
+	SubButton []*Button `json:"sub_button,omitempty"`
+}
+
+// MatchRule 个性化菜单的匹配规则， 至少一个字段不为空
+type MatchRule struct {
+	TagID              string `json:"tag_id,omitempty"`
+	ClientPlatformType string `json:"client_platform_type,omitempty"`
+}
+
+// Menu 菜单， MatchRule 不为空表示个性化菜单
+type Menu struct {
+	Button    []*Button   `json:"button"`
+	MatchRule *MatchRule  `json:"matchrule,omitempty"`
+	MenuID    json.Number `json:"menuid,omitempty"` // 微信有时返回数字， 有时返回字符串
+}
+
+type MenuInfo struct {
+	Menu            Menu   `json:"menu"`
+	ConditionalMenu []Menu `json:"conditionalmenu"`
+}
+
+type SelfMenuNews struct {
+	Title      string `json:"title"`
+	Author     string `json:"author"`
+	Digest     string `json:"digest"`
+	ShowCover  int    `json:"show_cover"`
+	CoverUrl   string `json:"cover_url"`
+	ContentUrl string `json:"content_url"`
+	SourceUrl  string `json:"source_url"`
+}
+
+// SelfMenuButton 菜单按钮， 在公众平台官网设置的菜单 Type 为 text/img/photo/video/voice/news， 内容在 Value/NewsInfo
+type SelfMenuButton struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Key       string `json:"key"`
+	Url       string `json:"url"`
+	Value     string `json:"value"`
+	SubButton *struct {
+		List []SelfMenuButton `json:"list"`
+	} `json:"sub_button,omitempty"`
+	NewsInfo *struct {
+		List []SelfMenuNews `json:"list"`
+	} `json:"news_info,omitempty"`
+}
+
+type SelfMenuInfo struct {
+	IsMenuOpen   int `json:"is_menu_open"`
+	SelfMenuInfo struct {
+		Button []SelfMenuButton `json:"button"`
+	} `json:"selfmenu_info"`
+}
+
+/*
+创建自定义菜单
+
+提交前先调用 Menu.Validate 检查菜单， menu.MatchRule 必须为空， 个性化菜单使用 AddConditional
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Custom_Menus/Creating_Custom-Defined_Menu.html
+
+POST https://api.weixin.qq.com/cgi-bin/menu/create?access_token=ACCESS_TOKEN
+*/
+func (api *MenuApi) Create(ctx context.Context, menu *Menu) error {
+	if menu.MatchRule != nil {
+		return ErrorUnexpectedMatchRule
+	}
+	if err := menu.Validate(); err != nil {
+		return err
+	}
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiCreate, &Menu{Button: menu.Button}, &result)
+}
+
+/*
+查询自定义菜单
+
+仅能查询到使用 API 设置的菜单， 包含个性化菜单
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Custom_Menus/Getting_Custom_Menu_Configurations.html
+
+GET https://api.weixin.qq.com/cgi-bin/menu/get?access_token=ACCESS_TOKEN
+*/
+func (api *MenuApi) Get(ctx context.Context) (*MenuInfo, error) {
+	var result MenuInfo
+	if err := api.Client.ApiGetNullWrapper(ctx, apiGet, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+/*
+删除自定义菜单
+
+同时删除所有个性化菜单
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Custom_Menus/Deleting_Custom-Defined_Menu.html
+
+GET https://api.weixin.qq.com/cgi-bin/menu/delete?access_token=ACCESS_TOKEN
+*/
+func (api *MenuApi) Delete(ctx context.Context) error {
+	var result utils.CommonError
+	return api.Client.ApiGetNullWrapper(ctx, apiDelete, &result)
+}
+
+/*
+查询当前使用的自定义菜单
+
+包括 API 设置的菜单和公众平台官网设置的菜单， 公众号没有开启菜单时 IsMenuOpen 为0
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Custom_Menus/Querying_Custom_Menus.html
+
+GET https://api.weixin.qq.com/cgi-bin/get_current_selfmenu_info?access_token=ACCESS_TOKEN
+*/
+func (api *MenuApi) GetCurrentSelfMenuInfo(ctx context.Context) (*SelfMenuInfo, error) {
+	var result SelfMenuInfo
+	if err := api.Client.ApiGetNullWrapper(ctx, apiGetCurrentSelfMenu, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+/*
+创建个性化菜单
+
+必须先创建默认菜单， 返回 menuid
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Custom_Menus/Personalized_menu_interface.html
+
+POST https://api.weixin.qq.com/cgi-bin/menu/addconditional?access_token=ACCESS_TOKEN
+*/
+func (api *MenuApi) AddConditional(ctx context.Context, menu *Menu) (string, error) {
+	if menu.MatchRule == nil {
+		return "", ErrorMissingMatchRule
+	}
+	if err := menu.Validate(); err != nil {
+		return "", err
+	}
+	result := struct {
+		utils.CommonError
+		MenuID json.Number `json:"menuid"`
+	}{}
+	err := api.Client.ApiPostWrapper(ctx, apiAddConditional, &Menu{
+		Button:    menu.Button,
+		MatchRule: menu.MatchRule,
+	}, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.MenuID.String(), nil
+}
+
+/*
+删除个性化菜单
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Custom_Menus/Personalized_menu_interface.html
+
+POST https://api.weixin.qq.com/cgi-bin/menu/delconditional?access_token=ACCESS_TOKEN
+*/
+func (api *MenuApi) DeleteConditional(ctx context.Context, menuID string) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiDeleteConditional, map[string]string{
+		"menuid": menuID,
+	}, &result)
+}
+
+/*
+测试个性化菜单匹配结果
+
+userID 可以是粉丝的 OpenID， 也可以是粉丝的微信号
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Custom_Menus/Personalized_menu_interface.html
+
+POST https://api.weixin.qq.com/cgi-bin/menu/trymatch?access_token=ACCESS_TOKEN
+*/
+func (api *MenuApi) TryMatch(ctx context.Context, userID string) ([]*Button, error) {
+	result := struct {
+		utils.CommonError
+		Button []*Button `json:"button"`
+	}{}
+	err := api.Client.ApiPostWrapper(ctx, apiTryMatch, map[string]string{
+		"user_id": userID,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Button, nil
+}
@@ -0,0 +1,131 @@
+package menu_api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/user_api"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	_, err := NewBuilder().Build()
+	require.True(t, errors.Is(err, ErrorInvalidMenu))
+
+	for _, c := range []struct {
+		button *Button
+		reason string
+	}{
+		{ClickButton("今日歌曲", ""), "button[0] key is required"},
+		{ViewButton("", "https://example.com"), "button[0] name is empty"},
+		{ViewButton("一二三四五六", "https://example.com"), "button[0] name exceeds 16 bytes"},
+		{MiniProgramButton("小程序", "wxappid", "", "https://example.com"), "button[0] pagepath is required"},
+		{&Button{Type: "unknown", Name: "菜单"}, "button[0] unknown type unknown"},
+		{&Button{Name: "菜单"}, "button[0] type is required"},
+		{ClickButton("菜单", strings.Repeat("k", MaxKeyBytes+1)), "button[0] key exceeds 128 bytes"},
+		{
+			SubMenu("菜单", ViewButton("1", "url"), ViewButton("2", "url"), ViewButton("3", "url"),
+				ViewButton("4", "url"), ViewButton("5", "url"), ViewButton("6", "url")),
+			"button[0] sub_button count 6",
+		},
+		{SubMenu("菜单", SubMenu("子菜单", ViewButton("1", "url"))), "button[0].sub_button[0] can not have sub_button"},
+		{SubMenu("菜单", ClickButton("子菜单", "")), "button[0].sub_button[0] key is required"},
+	} {
+		_, err := NewBuilder().Add(c.button).Build()
+		require.True(t, errors.Is(err, ErrorInvalidMenu), c.reason)
+		require.Contains(t, err.Error(), c.reason)
+	}
+
+	_, err = NewBuilder().Add(
+		ClickButton("1", "1"), ClickButton("2", "2"), ClickButton("3", "3"), ClickButton("4", "4"),
+	).Build()
+	require.Contains(t, err.Error(), "button count 4")
+
+	_, err = NewBuilder().Add(ClickButton("1", "1")).MatchRule(&MatchRule{}).Build()
+	require.Contains(t, err.Error(), "matchrule is empty")
+	_, err = NewBuilder().Add(ClickButton("1", "1")).MatchRule(&MatchRule{ClientPlatformType: "4"}).Build()
+	require.Contains(t, err.Error(), "invalid client_platform_type")
+
+	// 二级菜单的标题可以更长
+	_, err = NewBuilder().Add(SubMenu("菜单", ViewButton("一二三四五六七八", "https://example.com"))).Build()
+	require.Equal(t, nil, err)
+}
+
+func TestMenu(t *testing.T) {
+	_, officialAccount, _ := fixture.NewOfficialAccount(
+		t, wxtest.OfficialAccountUser{OpenID: "openid1"}, wxtest.OfficialAccountUser{OpenID: "openid2"},
+	)
+	api := NewOfficialAccountApi(officialAccount)
+	ctx := context.Background()
+
+	menu, err := NewBuilder().Add(
+		ClickButton("今日歌曲", "V1001_TODAY_MUSIC"),
+		SubMenu("菜单",
+			ViewButton("搜索", "https://www.soso.com/"),
+			MiniProgramButton("wxa", "wx286b93c14bbf93aa", "pages/lunar/index", "https://mp.weixin.qq.com"),
+			ClickButton("赞一下我们", "V1001_GOOD"),
+		),
+	).Build()
+	require.Equal(t, nil, err)
+
+	// 没有默认菜单不能创建个性化菜单
+	_, err = api.AddConditional(ctx, &Menu{Button: menu.Button, MatchRule: &MatchRule{TagID: "100"}})
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeNoDefaultMenu}))
+	require.Equal(t, ErrorUnexpectedMatchRule, api.Create(ctx, &Menu{Button: menu.Button, MatchRule: &MatchRule{TagID: "100"}}))
+	require.Equal(t, nil, api.Create(ctx, menu))
+
+	info, err := api.Get(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, menu.Button, info.Menu.Button)
+	require.NotEqual(t, "", info.Menu.MenuID.String())
+
+	selfMenu, err := api.GetCurrentSelfMenuInfo(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, selfMenu.IsMenuOpen)
+	require.Equal(t, "V1001_TODAY_MUSIC", selfMenu.SelfMenuInfo.Button[0].Key)
+	require.Equal(t, "https://www.soso.com/", selfMenu.SelfMenuInfo.Button[1].SubButton.List[0].Url)
+
+	// 个性化菜单
+	userApi := user_api.NewOfficialAccountApi(officialAccount)
+	tag, err := userApi.CreateTag(ctx, "vip")
+	require.Equal(t, nil, err)
+	require.Equal(t, nil, userApi.BatchTagging(ctx, tag.Tag.ID, []string{"openid2"}))
+
+	_, err = api.AddConditional(ctx, menu)
+	require.Equal(t, ErrorMissingMatchRule, err)
+	vipMenu, err := NewBuilder().
+		Add(ViewButton("会员中心", "https://example.com/vip")).
+		MatchRule(&MatchRule{TagID: strconv.Itoa(tag.Tag.ID)}).
+		Build()
+	require.Equal(t, nil, err)
+	menuID, err := api.AddConditional(ctx, vipMenu)
+	require.Equal(t, nil, err)
+	require.NotEqual(t, "", menuID)
+
+	buttons, err := api.TryMatch(ctx, "openid1")
+	require.Equal(t, nil, err)
+	require.Equal(t, menu.Button, buttons)
+	buttons, err = api.TryMatch(ctx, "openid2")
+	require.Equal(t, nil, err)
+	require.Equal(t, vipMenu.Button, buttons)
+
+	info, err = api.Get(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, len(info.ConditionalMenu))
+	require.Equal(t, menuID, info.ConditionalMenu[0].MenuID.String())
+	require.Equal(t, strconv.Itoa(tag.Tag.ID), info.ConditionalMenu[0].MatchRule.TagID)
+
+	require.Equal(t, nil, api.DeleteConditional(ctx, menuID))
+	err = api.DeleteConditional(ctx, menuID)
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeConditionalMenuNotExist}))
+
+	require.Equal(t, nil, api.Delete(ctx))
+	_, err = api.Get(ctx)
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeMenuNotExist}))
+}
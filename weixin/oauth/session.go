@@ -0,0 +1,397 @@
+// Package oauth 公众号网页授权的会话管理
+//
+// Redirect 生成签名的 state 并跳转到授权页， Callback 校验 state 后用 code 换取网页授权 access_token，
+// 按 openid 保存到缓存并设置登录 cookie； Middleware 从 cookie 中取出用户， token 过期时用 refresh_token 刷新，
+// 下游通过 UserFromContext 获取用户
+package oauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/official_account"
+)
+
+const (
+	defaultCookieName  = "weixin_oauth"
+	defaultStateTTL    = 10 * time.Minute
+	defaultSessionTTL  = 7 * 24 * time.Hour
+	refreshTokenTTL    = 30 * 24 * time.Hour // refresh_token 有效期30天
+	tokenExpireBefore  = 5 * time.Minute     // 提前5分钟刷新
+	stateNonceLength   = 16
+	stateCookieSuffix  = "_state"
+	nextParam          = "next"
+	purposeState       = "state"
+	purposeStateCookie = "state-cookie"
+	purposeSession     = "session"
+)
+
+var (
+	ErrorInvalidState   = errors.New("invalid oauth state")
+	ErrorAuthorizeDeny  = errors.New("user denied oauth authorize")
+	ErrorNotLoggedIn    = errors.New("oauth session not found")
+	ErrorSecretRequired = errors.New("oauth secret is required")
+)
+
+type Config struct {
+	RedirectUri  string        // Callback 的完整URL， 域名需要在公众号后台配置为网页授权域名
+	Scope        string        // snsapi_base 或者 snsapi_userinfo， 缺省 snsapi_base
+	Secret       string        // 签名 state 和 cookie 的密钥
+	CookieName   string        // 登录 cookie 的名字， 缺省 weixin_oauth
+	CookiePath   string        // 缺省 /
+	CookieSecure bool          // 只在 https 下发送 cookie
+	StateTTL     time.Duration // 授权流程的有效期， 缺省10分钟
+	SessionTTL   time.Duration // 登录的有效期， 缺省7天， 不超过 refresh_token 的30天
+	DefaultNext  string        // 授权后缺省跳转的地址， 缺省 /
+
+	// ErrorHandler 授权失败或者未登录时调用， 缺省返回 401/403/500
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// User 已登录的用户
+type User struct {
+	Openid      string
+	Unionid     string // 绑定了开放平台才有
+	Scope       string
+	AccessToken string // 网页授权的 access_token， 不允许传给客户端
+}
+
+type contextKey struct{}
+
+// UserFromContext Middleware 之后的 handler 获取当前用户
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(contextKey{}).(*User)
+	return user, ok
+}
+
+// 缓存的用户token
+type token struct {
+	official_account.OauthAccessToken
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+type Session struct {
+	officialAccount *official_account.OfficialAccount
+	cache           utils.Cache
+	config          Config
+	now             func() time.Time
+}
+
+func New(officialAccount *official_account.OfficialAccount, cache utils.Cache, config *Config) (*Session, error) {
+	if config.Secret == "" {
+		return nil, ErrorSecretRequired
+	}
+	session := &Session{
+		officialAccount: officialAccount,
+		cache:           cache,
+		config:          *config,
+		now:             time.Now,
+	}
+	c := &session.config
+	if c.Scope == "" {
+		c.Scope = official_account.ScopeSnsapiBase
+	}
+	if c.CookieName == "" {
+		c.CookieName = defaultCookieName
+	}
+	if c.CookiePath == "" {
+		c.CookiePath = "/"
+	}
+	if c.StateTTL == 0 {
+		c.StateTTL = defaultStateTTL
+	}
+	if c.SessionTTL == 0 {
+		c.SessionTTL = defaultSessionTTL
+	}
+	if c.SessionTTL > refreshTokenTTL {
+		c.SessionTTL = refreshTokenTTL
+	}
+	if c.DefaultNext == "" {
+		c.DefaultNext = "/"
+	}
+	if c.ErrorHandler == nil {
+		c.ErrorHandler = defaultErrorHandler
+	}
+	return session, nil
+}
+
+func defaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrorNotLoggedIn):
+		status = http.StatusUnauthorized
+	case errors.Is(err, ErrorInvalidState), errors.Is(err, ErrorAuthorizeDeny), errors.As(err, &utils.WeixinError{}):
+		status = http.StatusForbidden
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// 签名的值 base64(value).base64(hmac(purpose|value))， purpose 区分不同的用途
+func (session *Session) sign(purpose, value string) string {
+	mac := hmac.New(sha256.New, []byte(session.config.Secret))
+	mac.Write([]byte(purpose + "|" + value))
+	return base64.RawURLEncoding.EncodeToString([]byte(value)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (session *Session) verify(purpose, signed string) (string, bool) {
+	i := strings.LastIndex(signed, ".")
+	if i < 0 {
+		return "", false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(signed[:i])
+	if err != nil {
+		return "", false
+	}
+	if !hmac.Equal([]byte(session.sign(purpose, string(value))), []byte(signed)) {
+		return "", false
+	}
+	return string(value), true
+}
+
+// 签名的 "内容|过期时间"， 过期返回 false
+func (session *Session) verifyExpires(purpose, signed string) (string, bool) {
+	value, ok := session.verify(purpose, signed)
+	if !ok {
+		return "", false
+	}
+	i := strings.LastIndex(value, "|")
+	if i < 0 {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(value[i+1:], 10, 64)
+	if err != nil || session.now().Unix() >= expires {
+		return "", false
+	}
+	return value[:i], true
+}
+
+func (session *Session) setCookie(w http.ResponseWriter, name, value string, ttl time.Duration) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     session.config.CookiePath,
+		Secure:   session.config.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode, // 从授权页跳转回来需要带上 cookie
+	}
+	if ttl > 0 {
+		cookie.Expires = session.now().Add(ttl)
+		cookie.MaxAge = int(ttl.Seconds())
+	} else {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// 只允许跳转到本站的地址， 避免 open redirect
+// 浏览器会去掉 \t \n 等控制字符并把 \ 当作 /， 比如 /\t/evil.com 会变成 //evil.com， 所以一律拒绝
+func (session *Session) safeNext(next string) string {
+	if strings.ContainsRune(next, '\\') || strings.IndexFunc(next, unicode.IsControl) >= 0 {
+		return session.config.DefaultNext
+	}
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil ||
+		!strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") {
+		return session.config.DefaultNext
+	}
+	return next
+}
+
+// AuthorizeUrl 生成授权页地址， 并设置和 state 绑定的 cookie， 授权后跳转到 next
+func (session *Session) AuthorizeUrl(w http.ResponseWriter, next string) string {
+	nonce := utils.GetRandString(stateNonceLength)
+	expires := session.now().Add(session.config.StateTTL).Unix()
+	// state 最多128字节， 跳转地址保存在 cookie 里
+	state := session.sign(purposeState, nonce+"|"+strconv.FormatInt(expires, 10))
+	session.setCookie(
+		w, session.config.CookieName+stateCookieSuffix,
+		session.sign(purposeStateCookie, nonce+"|"+session.safeNext(next)),
+		session.config.StateTTL,
+	)
+	return session.officialAccount.GetAuthorizeUrl(session.config.RedirectUri, session.config.Scope, state)
+}
+
+// Redirect 跳转到授权页， 授权后跳转到参数 next 指定的本站地址
+func (session *Session) Redirect() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := session.AuthorizeUrl(w, r.URL.Query().Get(nextParam))
+		http.Redirect(w, r, url, http.StatusFound)
+	})
+}
+
+// 校验 state 和 cookie 是同一个授权流程， 返回授权后跳转的地址
+func (session *Session) checkState(r *http.Request, state string) (string, error) {
+	nonce, ok := session.verifyExpires(purposeState, state)
+	if !ok {
+		return "", ErrorInvalidState
+	}
+	cookie, err := r.Cookie(session.config.CookieName + stateCookieSuffix)
+	if err != nil {
+		return "", fmt.Errorf("%w: state cookie not found", ErrorInvalidState)
+	}
+	value, ok := session.verify(purposeStateCookie, cookie.Value)
+	if !ok || !strings.HasPrefix(value, nonce+"|") {
+		return "", fmt.Errorf("%w: state cookie mismatch", ErrorInvalidState)
+	}
+	return session.safeNext(strings.TrimPrefix(value, nonce+"|")), nil
+}
+
+// Callback 授权后的回调， 用 code 换取 token 并登录， 然后跳转到 Redirect 时指定的地址
+func (session *Session) Callback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		next, err := session.checkState(r, query.Get("state"))
+		if err != nil {
+			session.config.ErrorHandler(w, r, err)
+			return
+		}
+		// 一个 state 只能用一次
+		session.setCookie(w, session.config.CookieName+stateCookieSuffix, "", 0)
+
+		code := query.Get("code")
+		if code == "" {
+			session.config.ErrorHandler(w, r, ErrorAuthorizeDeny)
+			return
+		}
+		accessToken, err := session.officialAccount.GetSnsAccessToken(r.Context(), code)
+		if err != nil {
+			session.config.ErrorHandler(w, r, err)
+			return
+		}
+		if err = session.saveToken(&accessToken); err != nil {
+			session.config.ErrorHandler(w, r, err)
+			return
+		}
+
+		expires := session.now().Add(session.config.SessionTTL).Unix()
+		session.setCookie(
+			w, session.config.CookieName,
+			session.sign(purposeSession, accessToken.Openid+"|"+strconv.FormatInt(expires, 10)),
+			session.config.SessionTTL,
+		)
+		http.Redirect(w, r, next, http.StatusFound)
+	})
+}
+
+func (session *Session) tokenKey(openid string) string {
+	return fmt.Sprintf("oauth-token:officialaccount:%s:%s", session.officialAccount.Config.Appid, openid)
+}
+
+func (session *Session) saveToken(accessToken *official_account.OauthAccessToken) error {
+	expiresIn := time.Duration(accessToken.ExpiresIn)*time.Second - tokenExpireBefore
+	return session.cache.Set(session.tokenKey(accessToken.Openid), &token{
+		OauthAccessToken: *accessToken,
+		ExpiresAt:        session.now().Add(expiresIn).Unix(),
+	}, refreshTokenTTL)
+}
+
+// Token 获取用户的网页授权 access_token， 过期了用 refresh_token 刷新
+// 没有登录或者 refresh_token 失效返回 ErrorNotLoggedIn
+func (session *Session) Token(ctx context.Context, openid string) (*official_account.OauthAccessToken, error) {
+	cached := &token{}
+	exist, err := session.cache.Get(session.tokenKey(openid), cached)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, ErrorNotLoggedIn
+	}
+	if session.now().Unix() < cached.ExpiresAt {
+		return &cached.OauthAccessToken, nil
+	}
+
+	accessToken, err := session.officialAccount.RefreshToken(ctx, cached.RefreshToken)
+	if err != nil {
+		var we utils.WeixinError
+		if errors.As(err, &we) && utils.IsOauthTokenErrcode(we.Errcode) {
+			// refresh_token 失效， 需要重新授权， 系统繁忙等其他错误保留登录
+			_ = session.cache.Delete(session.tokenKey(openid))
+			return nil, fmt.Errorf("%w: %v", ErrorNotLoggedIn, err)
+		}
+		return nil, err
+	}
+	if accessToken.Unionid == "" {
+		accessToken.Unionid = cached.Unionid
+	}
+	if err = session.saveToken(&accessToken); err != nil {
+		return nil, err
+	}
+	return &accessToken, nil
+}
+
+// User 从登录 cookie 获取用户， 没有登录返回 ErrorNotLoggedIn
+func (session *Session) User(r *http.Request) (*User, error) {
+	cookie, err := r.Cookie(session.config.CookieName)
+	if err != nil {
+		return nil, ErrorNotLoggedIn
+	}
+	openid, ok := session.verifyExpires(purposeSession, cookie.Value)
+	if !ok {
+		return nil, ErrorNotLoggedIn
+	}
+	accessToken, err := session.Token(r.Context(), openid)
+	if err != nil {
+		return nil, err
+	}
+	return &User{
+		Openid:      accessToken.Openid,
+		Unionid:     accessToken.Unionid,
+		Scope:       accessToken.Scope,
+		AccessToken: accessToken.AccessToken,
+	}, nil
+}
+
+// UserInfo 拉取用户信息， 需要 snsapi_userinfo 授权
+func (session *Session) UserInfo(ctx context.Context, openid, lang string) (*official_account.OauthUserInfo, error) {
+	accessToken, err := session.Token(ctx, openid)
+	if err != nil {
+		return nil, err
+	}
+	userInfo, err := session.officialAccount.GetUserInfo(ctx, accessToken.AccessToken, openid, lang)
+	if err != nil {
+		return nil, err
+	}
+	return &userInfo, nil
+}
+
+// Middleware 要求登录， 未登录的 GET 请求跳转到授权页， 授权后回到当前地址， 其他请求调用 ErrorHandler
+func (session *Session) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := session.User(r)
+		if errors.Is(err, ErrorNotLoggedIn) && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			http.Redirect(w, r, session.AuthorizeUrl(w, r.URL.RequestURI()), http.StatusFound)
+			return
+		} else if err != nil {
+			session.config.ErrorHandler(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, user)))
+	})
+}
+
+// Logout 删除登录 cookie 和缓存的 token
+func (session *Session) Logout(w http.ResponseWriter, r *http.Request) error {
+	session.setCookie(w, session.config.CookieName, "", 0)
+	cookie, err := r.Cookie(session.config.CookieName)
+	if err != nil {
+		return nil
+	}
+	if openid, ok := session.verify(purposeSession, cookie.Value); ok {
+		if i := strings.LastIndex(openid, "|"); i >= 0 {
+			return session.cache.Delete(session.tokenKey(openid[:i]))
+		}
+	}
+	return nil
+}
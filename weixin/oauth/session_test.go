@@ -0,0 +1,204 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/weixin/official_account"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+// 模拟浏览器， 保存 cookie
+type browser struct {
+	handler http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func (b *browser) do(method, target string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for _, cookie := range b.cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	b.handler.ServeHTTP(w, r)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(b.cookies, cookie.Name)
+		} else {
+			b.cookies[cookie.Name] = cookie
+		}
+	}
+	return w
+}
+
+func (b *browser) request() *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range b.cookies {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func TestSession(t *testing.T) {
+	server, officialAccount, cache := fixture.NewOfficialAccount(t, wxtest.OfficialAccountUser{
+		OpenID: "openid1", Nickname: "nickname", UnionID: "unionid1",
+	})
+
+	_, err := New(officialAccount, cache, &Config{})
+	require.Equal(t, ErrorSecretRequired, err)
+	session, err := New(officialAccount, cache, &Config{
+		RedirectUri: "https://example.com/oauth/callback",
+		Scope:       official_account.ScopeSnsapiUserinfo,
+		Secret:      "secret",
+	})
+	require.Equal(t, nil, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/login", session.Redirect())
+	mux.Handle("/oauth/callback", session.Callback())
+	mux.Handle("/profile", session.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		require.True(t, ok)
+		fmt.Fprintf(w, "%s %s %s", user.Openid, user.Unionid, user.Scope)
+	})))
+	b := &browser{handler: mux, cookies: map[string]*http.Cookie{}}
+
+	// 未登录跳转到授权页
+	w := b.do(http.MethodPost, "/profile")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	w = b.do(http.MethodGet, "/profile?tab=1")
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.Equal(t, nil, err)
+	require.Equal(t, "/connect/oauth2/authorize", location.Path)
+	require.Equal(t, "appid", location.Query().Get("appid"))
+	require.Equal(t, official_account.ScopeSnsapiUserinfo, location.Query().Get("scope"))
+	state := location.Query().Get("state")
+	require.True(t, len(state) <= 128)
+
+	// state 被篡改或者不是同一个浏览器
+	code := server.OauthCode("openid1", official_account.ScopeSnsapiUserinfo)
+	w = b.do(http.MethodGet, "/oauth/callback?code="+code+"&state=x"+state)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	other := &browser{handler: mux, cookies: map[string]*http.Cookie{}}
+	w = other.do(http.MethodGet, "/oauth/callback?code="+code+"&state="+url.QueryEscape(state))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// 授权后回到原来的页面
+	w = b.do(http.MethodGet, "/oauth/callback?code="+code+"&state="+url.QueryEscape(state))
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "/profile?tab=1", w.Header().Get("Location"))
+	w = b.do(http.MethodGet, "/profile")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "openid1 unionid1 snsapi_userinfo", w.Body.String())
+
+	// state 只能用一次
+	w = b.do(http.MethodGet, "/oauth/callback?code="+code+"&state="+url.QueryEscape(state))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	userInfo, err := session.UserInfo(b.request().Context(), "openid1", official_account.LANG_zh_CN)
+	require.Equal(t, nil, err)
+	require.Equal(t, "nickname", userInfo.Nickname)
+
+	// token 过期后用 refresh_token 刷新
+	session.now = func() time.Time { return time.Now().Add(3 * time.Hour) }
+	w = b.do(http.MethodGet, "/profile")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "openid1 unionid1 snsapi_userinfo", w.Body.String())
+	require.Equal(t, 1, server.RequestCount("/sns/oauth2/refresh_token"))
+
+	// 系统繁忙不影响登录， refresh_token 失效才需要重新授权
+	ctx := b.request().Context()
+	session.now = func() time.Time { return time.Now().Add(6 * time.Hour) }
+	server.InjectErrcode("/sns/oauth2/refresh_token", utils.ErrcodeSystemBusy, 1)
+	_, err = session.Token(ctx, "openid1")
+	require.True(t, errors.Is(err, utils.ErrorSystemBusy))
+	require.False(t, errors.Is(err, ErrorNotLoggedIn))
+	accessToken, err := session.Token(ctx, "openid1")
+	require.Equal(t, nil, err)
+	session.now = time.Now
+
+	server.InjectErrcode("/sns/auth", utils.ErrcodeSystemBusy, 1)
+	_, err = officialAccount.Auth(ctx, accessToken.AccessToken, "openid1")
+	require.True(t, errors.Is(err, utils.ErrorSystemBusy))
+	valid, err := officialAccount.Auth(ctx, accessToken.AccessToken, "openid1")
+	require.Equal(t, nil, err)
+	require.True(t, valid)
+	valid, err = officialAccount.Auth(ctx, "invalid", "openid1")
+	require.Equal(t, nil, err)
+	require.False(t, valid)
+
+	session.now = func() time.Time { return time.Now().Add(9 * time.Hour) }
+	server.InjectErrcode("/sns/oauth2/refresh_token", utils.ErrcodeInvalidRefreshToken, 1)
+	_, err = session.Token(ctx, "openid1")
+	require.True(t, errors.Is(err, ErrorNotLoggedIn))
+	_, err = session.Token(ctx, "openid1")
+	require.Equal(t, ErrorNotLoggedIn, err)
+	session.now = time.Now
+
+	// 网页授权不需要公众号的 access_token
+	require.Equal(t, 0, server.RequestCount("/cgi-bin/token"))
+
+	require.Equal(t, nil, session.Logout(httptest.NewRecorder(), b.request()))
+	_, err = session.Token(b.request().Context(), "openid1")
+	require.Equal(t, ErrorNotLoggedIn, err)
+}
+
+func TestRedirectNext(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	officialAccount := official_account.New(cache, cache, &official_account.Config{Appid: "appid"})
+	session, err := New(officialAccount, cache, &Config{
+		RedirectUri: "https://example.com/oauth/callback",
+		Secret:      "secret",
+	})
+	require.Equal(t, nil, err)
+
+	require.Equal(t, "/page?a=1", session.safeNext("/page?a=1"))
+	for _, next := range []string{
+		"", "page", "https://evil.com", "//evil.com", "/\\evil.com", "/page\\..\\",
+		"/\t/evil.com", "/\n/evil.com", "/\r//evil.com", "https:/evil.com", "/%2F/evil.com",
+	} {
+		require.Equal(t, "/", session.safeNext(next), next)
+	}
+
+	// 浏览器去掉 %09 %0a 之后是 //evil.com
+	for _, next := range []string{"/%09/evil.com", "/%0a/evil.com", "/%5C/evil.com", "%2F%2Fevil.com"} {
+		w := httptest.NewRecorder()
+		session.Redirect().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login?next="+next, nil))
+		r := httptest.NewRequest(http.MethodGet, "/oauth/callback", nil)
+		for _, cookie := range w.Result().Cookies() {
+			r.AddCookie(cookie)
+		}
+		location, err := url.Parse(w.Header().Get("Location"))
+		require.Equal(t, nil, err)
+		redirect, err := session.checkState(r, location.Query().Get("state"))
+		require.Equal(t, nil, err)
+		require.Equal(t, "/", redirect, next)
+	}
+
+	// 过期的 state
+	w := httptest.NewRecorder()
+	location, err := url.Parse(session.AuthorizeUrl(w, "/page"))
+	require.Equal(t, nil, err)
+	r := httptest.NewRequest(http.MethodGet, "/oauth/callback", nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	state := location.Query().Get("state")
+	next, err := session.checkState(r, state)
+	require.Equal(t, nil, err)
+	require.Equal(t, "/page", next)
+	session.now = func() time.Time { return time.Now().Add(defaultStateTTL) }
+	_, err = session.checkState(r, state)
+	require.Equal(t, ErrorInvalidState, err)
+}
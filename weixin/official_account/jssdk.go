@@ -0,0 +1,114 @@
+package official_account
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const CardSignTypeSHA1 = "SHA1"
+
+// JSApiTicketCache jsapi_ticket 的缓存， 可以加到 utils.AccessTokenRefresher 后台刷新
+func (officialAccount *OfficialAccount) JSApiTicketCache() *utils.AccessTokenCache {
+	return officialAccount.jsapiTicketCache
+}
+
+// WxCardTicketCache 卡券 api_ticket 的缓存
+func (officialAccount *OfficialAccount) WxCardTicketCache() *utils.AccessTokenCache {
+	return officialAccount.wxCardTicketCache
+}
+
+// GetCachedJSApiTicket 优先从缓存获取 jsapi_ticket
+func (officialAccount *OfficialAccount) GetCachedJSApiTicket() (string, error) {
+	return officialAccount.jsapiTicketCache.GetAccessToken()
+}
+
+// GetCachedWxCardApiTicket 优先从缓存获取卡券 api_ticket
+func (officialAccount *OfficialAccount) GetCachedWxCardApiTicket() (string, error) {
+	return officialAccount.wxCardTicketCache.GetAccessToken()
+}
+
+/*
+JS-SDK 使用权限签名
+
+返回 wx.config 需要的 appId/timestamp/nonceStr/signature， url 为调用JS接口页面的完整URL， #及其后面部分会被去掉
+
+See: https://developers.weixin.qq.com/doc/offiaccount/OA_Web_Apps/JS-SDK.html#62
+*/
+func (officialAccount *OfficialAccount) SignJSConfig(url string) (*utils.JSConfig, error) {
+	ticket, err := officialAccount.GetCachedJSApiTicket()
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewJSConfig(officialAccount.Config.Appid, ticket, url), nil
+}
+
+// ChooseCardConfig wx.chooseCard 的参数
+type ChooseCardConfig struct {
+	ShopID    string `json:"shopId"`
+	CardType  string `json:"cardType"`
+	CardID    string `json:"cardId"`
+	Timestamp int64  `json:"timestamp"`
+	NonceStr  string `json:"nonceStr"`
+	SignType  string `json:"signType"`
+	CardSign  string `json:"cardSign"`
+}
+
+/*
+拉取适用卡券列表(wx.chooseCard)的签名
+
+shopID/cardType/cardID 都可以为空， 用卡券 api_ticket 签名
+
+See: https://developers.weixin.qq.com/doc/offiaccount/OA_Web_Apps/JS-SDK.html#54
+*/
+func (officialAccount *OfficialAccount) SignChooseCard(shopID, cardType, cardID string) (*ChooseCardConfig, error) {
+	ticket, err := officialAccount.GetCachedWxCardApiTicket()
+	if err != nil {
+		return nil, err
+	}
+	config := &ChooseCardConfig{
+		ShopID:    shopID,
+		CardType:  cardType,
+		CardID:    cardID,
+		Timestamp: time.Now().Unix(),
+		NonceStr:  utils.NewJSNonceStr(),
+		SignType:  CardSignTypeSHA1,
+	}
+	config.CardSign = utils.CardSignature(
+		ticket, officialAccount.Config.Appid, shopID,
+		strconv.FormatInt(config.Timestamp, 10), config.NonceStr, cardID, cardType,
+	)
+	return config, nil
+}
+
+// CardExt wx.addCard 的 cardExt， json 编码后作为字符串传入
+type CardExt struct {
+	Code      string `json:"code,omitempty"`
+	Openid    string `json:"openid,omitempty"`
+	Timestamp string `json:"timestamp"`
+	NonceStr  string `json:"nonce_str"`
+	Signature string `json:"signature"`
+}
+
+/*
+批量添加卡券(wx.addCard)的 cardExt 签名
+
+code 仅自定义code模式的卡券需要， openid 仅指定领取者的卡券需要
+
+See: https://developers.weixin.qq.com/doc/offiaccount/OA_Web_Apps/JS-SDK.html#53
+*/
+func (officialAccount *OfficialAccount) SignCardExt(cardID, code, openid string) (*CardExt, error) {
+	ticket, err := officialAccount.GetCachedWxCardApiTicket()
+	if err != nil {
+		return nil, err
+	}
+	ext := &CardExt{
+		Code:      code,
+		Openid:    openid,
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		NonceStr:  utils.NewJSNonceStr(),
+	}
+	ext.Signature = utils.CardSignature(ticket, ext.Timestamp, cardID, code, openid, ext.NonceStr)
+	return ext, nil
+}
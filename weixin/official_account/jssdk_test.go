@@ -0,0 +1,54 @@
+package official_account_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/official_account"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+const apiGetJSApiTicket = "/cgi-bin/ticket/getticket"
+
+func TestSignJSConfig(t *testing.T) {
+	server, officialAccount, _ := fixture.NewOfficialAccount(t)
+
+	// 票据只获取一次
+	url := "https://example.com/page?id=1"
+	config, err := officialAccount.SignJSConfig(url + "#top")
+	require.Equal(t, nil, err)
+	_, err = officialAccount.SignJSConfig(url)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, server.RequestCount(apiGetJSApiTicket))
+
+	ticket, err := officialAccount.GetCachedJSApiTicket()
+	require.Equal(t, nil, err)
+	require.Equal(t, "appid", config.AppID)
+	require.Equal(t, utils.JSApiSignature(ticket, config.NonceStr, config.Timestamp, url), config.Signature)
+
+	// 卡券使用另外的票据
+	cardTicket, err := officialAccount.GetCachedWxCardApiTicket()
+	require.Equal(t, nil, err)
+	require.NotEqual(t, ticket, cardTicket)
+	chooseCard, err := officialAccount.SignChooseCard("", "GROUPON", "")
+	require.Equal(t, nil, err)
+	require.Equal(t, official_account.CardSignTypeSHA1, chooseCard.SignType)
+	require.Equal(t, utils.CardSignature(
+		cardTicket, "appid", "", strconv.FormatInt(chooseCard.Timestamp, 10), chooseCard.NonceStr, "", "GROUPON",
+	), chooseCard.CardSign)
+
+	ext, err := officialAccount.SignCardExt("CARD_ID", "", "openid")
+	require.Equal(t, nil, err)
+	require.Equal(t, utils.CardSignature(
+		cardTicket, ext.Timestamp, "CARD_ID", "openid", ext.NonceStr,
+	), ext.Signature)
+	require.Equal(t, 2, server.RequestCount(apiGetJSApiTicket))
+
+	// 失效后重新获取
+	newTicket, err := officialAccount.JSApiTicketCache().InvalidateAccessToken(ticket)
+	require.Equal(t, nil, err)
+	require.NotEqual(t, ticket, newTicket)
+	require.Equal(t, 3, server.RequestCount(apiGetJSApiTicket))
+}
@@ -30,8 +30,11 @@ package official_account
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+
+	"github.com/lixinio/weixin/utils"
 )
 
 var OauthAuthorizeServerUrl = "https://open.weixin.qq.com"
@@ -79,6 +82,7 @@ type OauthAccessToken struct {
 	RefreshToken string `json:"refresh_token"`
 	Openid       string `json:"openid"`
 	Scope        string `json:"scope"`
+	Unionid      string `json:"unionid"` // 绑定了开放平台才有
 }
 
 /*
@@ -98,7 +102,7 @@ func (officialAccount *OfficialAccount) GetSnsAccessToken(ctx context.Context, c
 	params.Add("grant_type", "authorization_code")
 
 	var body []byte
-	body, err = officialAccount.Client.HTTPGetWithParams(ctx, apiAccessToken, params)
+	body, err = officialAccount.Client.HTTPGetWithoutToken(ctx, apiAccessToken, params)
 	if err != nil {
 		return
 	}
@@ -128,7 +132,7 @@ func (officialAccount *OfficialAccount) RefreshToken(ctx context.Context, refres
 	params.Add("grant_type", "refresh_token")
 
 	var body []byte
-	body, err = officialAccount.Client.HTTPGetWithParams(ctx, apiRefreshToken, params)
+	body, err = officialAccount.Client.HTTPGetWithoutToken(ctx, apiRefreshToken, params)
 	if err != nil {
 		return
 	}
@@ -178,7 +182,7 @@ func (officialAccount *OfficialAccount) GetUserInfo(
 	params.Add("lang", lang)
 
 	var body []byte
-	body, err = officialAccount.Client.HTTPGetWithParams(ctx, apiUserInfo, params)
+	body, err = officialAccount.Client.HTTPGetWithoutToken(ctx, apiUserInfo, params)
 	if err != nil {
 		return
 	}
@@ -207,8 +211,13 @@ func (officialAccount *OfficialAccount) Auth(
 	params.Add("openid", openid)
 
 	var body []byte
-	body, err = officialAccount.Client.HTTPGetWithParams(ctx, apiAuth, params)
+	body, err = officialAccount.Client.HTTPGetWithoutToken(ctx, apiAuth, params)
 	if err != nil {
+		var we utils.WeixinError
+		if errors.As(err, &we) && utils.IsOauthTokenErrcode(we.Errcode) {
+			// 凭证无效， 系统繁忙等其他错误返回 err
+			return false, nil
+		}
 		return
 	}
 
@@ -235,6 +244,8 @@ func (officialAccount *OfficialAccount) Auth(
 
 sapi_ticket是公众号用于调用微信JS接口的临时票据。正常情况下，jsapi_ticket的有效期为7200秒，通过access_token来获取。由于获取jsapi_ticket的api调用次数非常有限，频繁刷新jsapi_ticket会导致api调用受限，影响自身业务，开发者必须在自己的服务全局缓存jsapi_ticket
 
+本方法不做缓存， 一般使用 GetCachedJSApiTicket 或者 SignJSConfig
+
 See: https://developers.weixin.qq.com/doc/offiaccount/OA_Web_Apps/JS-SDK.html#62
 
 GET https://api.weixin.qq.com/cgi-bin/ticket/getticket?access_token=ACCESS_TOKEN&type=jsapi
@@ -250,6 +261,8 @@ func (officialAccount *OfficialAccount) GetJSApiTicket(
 
 商户在调用授权页前需要先获取一个7200s过期的授权页ticket，在获取授权页接口中，该ticket作为参数传入，加强安全性。
 
+本方法不做缓存， 一般使用 GetCachedWxCardApiTicket
+
 See: https://developers.weixin.qq.com/doc/offiaccount/WeChat_Invoice/E_Invoice/Vendor_API_List.html#1
 
 GET https://api.weixin.qq.com/cgi-bin/ticket/getticket?access_token=ACCESS_TOKEN&type=wx_card
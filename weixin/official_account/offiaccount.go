@@ -21,16 +21,55 @@ type Config struct {
 type OfficialAccount struct {
 	Config *Config
 	Client *utils.Client
+
+	jsapiTicketCache  *utils.AccessTokenCache // 缓存 jsapi_ticket
+	wxCardTicketCache *utils.AccessTokenCache // 缓存 卡券 api_ticket
+}
+
+// New opts 可以指定 http.Client / 超时 / 代理 / 服务器地址等， 参考 utils.ClientOption
+func New(cache utils.Cache, locker utils.Lock, config *Config, opts ...utils.ClientOption) *OfficialAccount {
+	instance := &OfficialAccount{
+		Config: config,
+	}
+	instance.init(instance, cache, locker, opts...)
+	return instance
 }
 
-func New(cache utils.Cache, locker utils.Lock, config *Config) *OfficialAccount {
+// NewWithAccessTokenGetter 由 accessTokenGetter 提供 access_token， 而不是用 Secret 获取
+// 比如第三方平台代公众号调用接口时使用 authorizer_access_token， 参考 wxopen/open.Authorizer
+func NewWithAccessTokenGetter(
+	cache utils.Cache,
+	locker utils.Lock,
+	config *Config,
+	accessTokenGetter utils.AccessTokenGetter,
+	opts ...utils.ClientOption,
+) *OfficialAccount {
 	instance := &OfficialAccount{
 		Config: config,
 	}
-	instance.Client = utils.NewClient(WXServerUrl, utils.NewAccessTokenCache(instance, cache, locker, 0))
+	instance.init(accessTokenGetter, cache, locker, opts...)
 	return instance
 }
 
+func (officialAccount *OfficialAccount) init(
+	accessTokenGetter utils.AccessTokenGetter,
+	cache utils.Cache,
+	locker utils.Lock,
+	opts ...utils.ClientOption,
+) {
+	officialAccount.Client = utils.NewClient(
+		WXServerUrl, utils.NewAccessTokenCache(accessTokenGetter, cache, locker, 0), opts...,
+	)
+	officialAccount.jsapiTicketCache = utils.NewTicketCache(
+		fmt.Sprintf("jsapi-ticket:officialaccount:%s", officialAccount.Config.Appid),
+		officialAccount.GetJSApiTicket, cache, locker,
+	)
+	officialAccount.wxCardTicketCache = utils.NewTicketCache(
+		fmt.Sprintf("wx-card-ticket:officialaccount:%s", officialAccount.Config.Appid),
+		officialAccount.GetWxCardApiTicket, cache, locker,
+	)
+}
+
 // GetAccessToken 接口 weixin.AccessTokenGetter 实现
 func (officialAccount *OfficialAccount) GetAccessToken() (accessToken string, expiresIn int, err error) {
 	accessToken, expiresIn, err = officialAccount.refreshAccessTokenFromWXServer()
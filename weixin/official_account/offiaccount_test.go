@@ -0,0 +1,59 @@
+package official_account
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type countingTransport struct {
+	count int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.count, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cgi-bin/token":
+			require.Equal(t, "appid", r.URL.Query().Get("appid"))
+			require.Equal(t, "secret", r.URL.Query().Get("secret"))
+			fmt.Fprint(w, `{"access_token":"ACCESS_TOKEN","expires_in":7200}`)
+		case "/cgi-bin/ticket/getticket":
+			require.Equal(t, "ACCESS_TOKEN", r.URL.Query().Get("access_token"))
+			fmt.Fprint(w, `{"errcode":0,"errmsg":"ok","ticket":"TICKET","expires_in":7200}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+
+	transport := &countingTransport{}
+	officialAccount := New(cache, cache, &Config{
+		Appid:  "appid",
+		Secret: "secret",
+	}, utils.WithServerUrl(server.URL), utils.WithHTTPClient(&http.Client{Transport: transport}))
+
+	ticket, expiresIn, err := officialAccount.GetJSApiTicket(context.Background())
+	require.Equal(t, nil, err)
+	require.Equal(t, "TICKET", ticket)
+	require.Equal(t, int64(7200), expiresIn)
+	// 获取token和ticket都走注入的 http.Client
+	require.Equal(t, int32(2), atomic.LoadInt32(&transport.count))
+
+	// 缺省使用微信服务器
+	require.Equal(t, WXServerUrl, New(cache, cache, &Config{}).Client.ServerUrl())
+}
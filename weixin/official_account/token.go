@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+
+	"github.com/lixinio/weixin/utils"
 )
 
 /*
@@ -18,16 +20,18 @@ func (officialAccount *OfficialAccount) refreshAccessTokenFromWXServer() (access
 	params.Add("appid", officialAccount.Config.Appid)
 	params.Add("secret", officialAccount.Config.Secret)
 	params.Add("grant_type", "client_credential")
-	url := WXServerUrl + "/cgi-bin/token?" + params.Encode()
+	url := officialAccount.Client.ServerUrl() + "/cgi-bin/token?" + params.Encode()
 
-	response, err := http.Get(url)
+	response, err := officialAccount.Client.HTTPClient().Get(url)
 	if err != nil {
+		// url 里面有 secret， 不能出现在错误信息里
+		err = utils.StripUrlError(err)
 		return
 	}
 
 	defer response.Body.Close()
 	if response.StatusCode != http.StatusOK {
-		err = fmt.Errorf("GET %s RETURN %s", url, response.Status)
+		err = fmt.Errorf("GET %s RETURN %s", "/cgi-bin/token", response.Status)
 		return
 	}
 
@@ -50,6 +54,10 @@ func (officialAccount *OfficialAccount) refreshAccessTokenFromWXServer() (access
 	}
 
 	if result.AccessToken == "" {
+		if result.Errcode != 0 {
+			err = utils.NewWeixinError("/cgi-bin/token", int64(result.Errcode), result.Errmsg)
+			return
+		}
 		err = fmt.Errorf("%s", string(resp))
 		return
 	}
@@ -0,0 +1,199 @@
+// Package qrcode_api 带参数二维码和短key托管
+package qrcode_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/official_account"
+)
+
+const (
+	DefaultShowQrcodeServerUrl = "https://mp.weixin.qq.com" // 换取二维码图片的服务器地址
+
+	apiCreate     = "/cgi-bin/qrcode/create"
+	apiShowQrcode = "/cgi-bin/showqrcode"
+)
+
+// 二维码类型
+const (
+	ActionQrScene         = "QR_SCENE"           // 临时的整型参数值
+	ActionQrStrScene      = "QR_STR_SCENE"       // 临时的字符串参数值
+	ActionQrLimitScene    = "QR_LIMIT_SCENE"     // 永久的整型参数值
+	ActionQrLimitStrScene = "QR_LIMIT_STR_SCENE" // 永久的字符串参数值
+)
+
+const (
+	MaxExpireSeconds = 2592000 // 临时二维码最长30天
+	MaxLimitSceneID  = 100000  // 永久二维码的整型参数最大值
+	MaxSceneStrBytes = 64      // 字符串参数最长64字节
+
+	// 未关注用户扫码关注时， 关注事件的 EventKey 为 qrscene_ 加上场景值
+	SubscribeScenePrefix = "qrscene_"
+)
+
+var ErrorInvalidScene = errors.New("invalid qrcode scene")
+
+type QrcodeApi struct {
+	*utils.Client
+	// ShowQrcodeServerUrl 换取二维码图片的服务器地址， 缺省 DefaultShowQrcodeServerUrl， 测试时可以指向模拟服务器
+	ShowQrcodeServerUrl string
+}
+
+func NewOfficialAccountApi(officialAccount *official_account.OfficialAccount) *QrcodeApi {
+	return &QrcodeApi{
+		Client:              officialAccount.Client,
+		ShowQrcodeServerUrl: DefaultShowQrcodeServerUrl,
+	}
+}
+
+type Scene struct {
+	SceneID  int    `json:"scene_id,omitempty"`
+	SceneStr string `json:"scene_str,omitempty"`
+}
+
+// Request 创建二维码的参数， 永久二维码不需要 ExpireSeconds
+type Request struct {
+	ExpireSeconds int    `json:"expire_seconds,omitempty"`
+	ActionName    string `json:"action_name"`
+	ActionInfo    struct {
+		Scene Scene `json:"scene"`
+	} `json:"action_info"`
+}
+
+type Qrcode struct {
+	utils.CommonError
+	Ticket        string `json:"ticket"`         // 用于换取二维码图片
+	ExpireSeconds int    `json:"expire_seconds"` // 永久二维码为0
+	Url           string `json:"url"`            // 二维码图片解析后的地址， 可以自行生成二维码图片
+}
+
+func checkScene(request *Request) error {
+	scene := request.ActionInfo.Scene
+	switch request.ActionName {
+	case ActionQrScene:
+		if scene.SceneID == 0 {
+			return fmt.Errorf("%w: scene_id is required", ErrorInvalidScene)
+		}
+	case ActionQrLimitScene:
+		if scene.SceneID < 1 || scene.SceneID > MaxLimitSceneID {
+			return fmt.Errorf("%w: scene_id must be 1-%d", ErrorInvalidScene, MaxLimitSceneID)
+		}
+	case ActionQrStrScene, ActionQrLimitStrScene:
+		if scene.SceneStr == "" || len(scene.SceneStr) > MaxSceneStrBytes {
+			return fmt.Errorf("%w: scene_str must be 1-%d bytes", ErrorInvalidScene, MaxSceneStrBytes)
+		}
+	default:
+		return fmt.Errorf("%w: unknown action_name %s", ErrorInvalidScene, request.ActionName)
+	}
+	if request.ExpireSeconds < 0 || request.ExpireSeconds > MaxExpireSeconds {
+		return fmt.Errorf("%w: expire_seconds must be 0-%d", ErrorInvalidScene, MaxExpireSeconds)
+	}
+	return nil
+}
+
+/*
+生成带参数的二维码
+
+临时二维码最多30天， 缺省60秒； 永久二维码最多10万个
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Account_Management/Generating_a_Parametric_QR_Code.html
+
+POST https://api.weixin.qq.com/cgi-bin/qrcode/create?access_token=TOKEN
+*/
+func (api *QrcodeApi) Create(ctx context.Context, request *Request) (*Qrcode, error) {
+	if err := checkScene(request); err != nil {
+		return nil, err
+	}
+	result := &Qrcode{}
+	if err := api.Client.ApiPostWrapper(ctx, apiCreate, request, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func newRequest(actionName string, expireSeconds int, scene Scene) *Request {
+	request := &Request{ExpireSeconds: expireSeconds, ActionName: actionName}
+	request.ActionInfo.Scene = scene
+	return request
+}
+
+// CreateTemporary 临时二维码， 整型参数值为32位非0整数
+func (api *QrcodeApi) CreateTemporary(ctx context.Context, sceneID int, expireSeconds int) (*Qrcode, error) {
+	return api.Create(ctx, newRequest(ActionQrScene, expireSeconds, Scene{SceneID: sceneID}))
+}
+
+// CreateTemporaryStr 临时二维码， 字符串参数值
+func (api *QrcodeApi) CreateTemporaryStr(ctx context.Context, sceneStr string, expireSeconds int) (*Qrcode, error) {
+	return api.Create(ctx, newRequest(ActionQrStrScene, expireSeconds, Scene{SceneStr: sceneStr}))
+}
+
+// CreatePermanent 永久二维码， 整型参数值为1-100000
+func (api *QrcodeApi) CreatePermanent(ctx context.Context, sceneID int) (*Qrcode, error) {
+	return api.Create(ctx, newRequest(ActionQrLimitScene, 0, Scene{SceneID: sceneID}))
+}
+
+// CreatePermanentStr 永久二维码， 字符串参数值
+func (api *QrcodeApi) CreatePermanentStr(ctx context.Context, sceneStr string) (*Qrcode, error) {
+	return api.Create(ctx, newRequest(ActionQrLimitStrScene, 0, Scene{SceneStr: sceneStr}))
+}
+
+// ShowQrcodeUrl 二维码图片的地址， 不需要 access_token， 可以直接展示给用户
+func (api *QrcodeApi) ShowQrcodeUrl(ticket string) string {
+	params := url.Values{}
+	params.Add("ticket", ticket)
+	return api.ShowQrcodeServerUrl + apiShowQrcode + "?" + params.Encode()
+}
+
+/*
+通过ticket换取二维码
+
+返回二维码图片(jpg)， 调用者负责关闭
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Account_Management/Generating_a_Parametric_QR_Code.html
+
+GET https://mp.weixin.qq.com/cgi-bin/showqrcode?ticket=TICKET
+*/
+func (api *QrcodeApi) ShowQrcode(ctx context.Context, ticket string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, api.ShowQrcodeUrl(ticket), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := api.Client.HTTPClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// ticket 错误返回 404
+		resp.Body.Close()
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// ParseEventKey 从扫码事件的 EventKey 中取出场景值
+// 关注事件(subscribe)去掉 qrscene_ 前缀， 已关注用户的扫码事件(SCAN)就是场景值， 不是扫码关注时返回 false
+func ParseEventKey(eventKey string) (string, bool) {
+	scene := strings.TrimPrefix(eventKey, SubscribeScenePrefix)
+	return scene, scene != ""
+}
+
+// ParseSceneID 和 ParseEventKey 一样， 用于整型参数值的二维码
+func ParseSceneID(eventKey string) (int, bool) {
+	scene, ok := ParseEventKey(eventKey)
+	if !ok {
+		return 0, false
+	}
+	sceneID, err := strconv.Atoi(scene)
+	if err != nil {
+		return 0, false
+	}
+	return sceneID, true
+}
@@ -0,0 +1,110 @@
+package qrcode_api
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/lixinio/weixin/weixin/server_api"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEventKey(t *testing.T) {
+	scene, ok := ParseEventKey("qrscene_invite:alice")
+	require.True(t, ok)
+	require.Equal(t, "invite:alice", scene)
+	scene, ok = ParseEventKey("invite:alice")
+	require.True(t, ok)
+	require.Equal(t, "invite:alice", scene)
+	_, ok = ParseEventKey("")
+	require.False(t, ok)
+
+	sceneID, ok := ParseSceneID("qrscene_123")
+	require.True(t, ok)
+	require.Equal(t, 123, sceneID)
+	_, ok = ParseSceneID("qrscene_abc")
+	require.False(t, ok)
+}
+
+func TestQrcode(t *testing.T) {
+	server, officialAccount, _ := fixture.NewOfficialAccount(t)
+	api := NewOfficialAccountApi(officialAccount)
+	require.Equal(t, DefaultShowQrcodeServerUrl, api.ShowQrcodeServerUrl)
+	api.ShowQrcodeServerUrl = server.URL
+	ctx := context.Background()
+
+	// 参数在本地检查
+	_, err := api.CreatePermanent(ctx, MaxLimitSceneID+1)
+	require.True(t, errors.Is(err, ErrorInvalidScene))
+	_, err = api.CreateTemporaryStr(ctx, strings.Repeat("s", MaxSceneStrBytes+1), 60)
+	require.True(t, errors.Is(err, ErrorInvalidScene))
+	_, err = api.CreateTemporary(ctx, 1, MaxExpireSeconds+1)
+	require.True(t, errors.Is(err, ErrorInvalidScene))
+
+	temporary, err := api.CreateTemporary(ctx, 123, 0)
+	require.Equal(t, nil, err)
+	require.Equal(t, 60, temporary.ExpireSeconds)
+	require.NotEqual(t, "", temporary.Url)
+	permanent, err := api.CreatePermanentStr(ctx, "invite:alice")
+	require.Equal(t, nil, err)
+	require.Equal(t, 0, permanent.ExpireSeconds)
+
+	image, err := api.ShowQrcode(ctx, permanent.Ticket)
+	require.Equal(t, nil, err)
+	data, err := ioutil.ReadAll(image)
+	image.Close()
+	require.Equal(t, nil, err)
+	require.True(t, strings.HasSuffix(string(data), permanent.Ticket))
+	_, err = api.ShowQrcode(ctx, "invalid")
+	require.NotEqual(t, nil, err)
+
+	// 未关注用户扫码关注， 已关注用户扫码
+	var scenes []string
+	router := server_api.NewRouter(server_api.NewOfficialAccountApi(fixture.Token, fixture.EncodingAESKey, officialAccount))
+	router.OnSubscribe(func(ctx *server_api.Context, event server_api.EventSubscribe) (interface{}, error) {
+		sceneID, ok := ParseSceneID(event.EventKey)
+		require.True(t, ok)
+		require.Equal(t, temporary.Ticket, event.Ticket)
+		require.Equal(t, 123, sceneID)
+		scenes = append(scenes, "subscribe")
+		return nil, nil
+	})
+	router.OnScan("", func(ctx *server_api.Context, event server_api.EventScan) (interface{}, error) {
+		scene, ok := ParseEventKey(event.EventKey)
+		require.True(t, ok)
+		scenes = append(scenes, scene)
+		return nil, nil
+	})
+	callback := wxtest.NewOfficialAccountCallback(fixture.Token, fixture.EncodingAESKey, "appid")
+	event, ok := server.QrcodeScan(temporary.Ticket, "openid1")
+	require.True(t, ok)
+	_, err = callback.Invoke(router, event)
+	require.Equal(t, nil, err)
+	event, ok = server.QrcodeScan(permanent.Ticket, "openid1")
+	require.True(t, ok)
+	_, err = callback.Invoke(router, event)
+	require.Equal(t, nil, err)
+	require.Equal(t, []string{"subscribe", "invite:alice"}, scenes)
+}
+
+func TestShortKey(t *testing.T) {
+	_, officialAccount, _ := fixture.NewOfficialAccount(t)
+	api := NewOfficialAccountApi(officialAccount)
+	ctx := context.Background()
+
+	longData := strings.Repeat("loooooong data", 100)
+	key, err := api.GenShortKey(ctx, longData, 3600)
+	require.Equal(t, nil, err)
+	result, err := api.FetchShortKey(ctx, key)
+	require.Equal(t, nil, err)
+	require.Equal(t, longData, result.LongData)
+	require.True(t, result.ExpireSeconds > 0 && result.ExpireSeconds <= 3600)
+	require.NotEqual(t, int64(0), result.CreateTime)
+
+	_, err = api.FetchShortKey(ctx, "invalid")
+	require.NotEqual(t, nil, err)
+}
@@ -0,0 +1,63 @@
+package qrcode_api
+
+import (
+	"context"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	apiGenShortKey   = "/cgi-bin/shorten/gen"
+	apiFetchShortKey = "/cgi-bin/shorten/fetch"
+)
+
+// ShortKey 短key托管的数据
+type ShortKey struct {
+	utils.CommonError
+	LongData      string `json:"long_data"`
+	CreateTime    int64  `json:"create_time"`
+	ExpireSeconds int    `json:"expire_seconds"` // 剩余的有效期
+}
+
+/*
+生成短key
+
+把不超过4KB的长信息转成短key， 比如拼接到二维码的场景值里， 扫码后再用 FetchShortKey 还原；
+expireSeconds 最长30天， 0表示缺省的30天
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Account_Management/KEY_Shortener.html
+
+POST https://api.weixin.qq.com/cgi-bin/shorten/gen?access_token=ACCESS_TOKEN
+*/
+func (api *QrcodeApi) GenShortKey(ctx context.Context, longData string, expireSeconds int) (string, error) {
+	payload := struct {
+		LongData      string `json:"long_data"`
+		ExpireSeconds int    `json:"expire_seconds,omitempty"`
+	}{LongData: longData, ExpireSeconds: expireSeconds}
+	result := struct {
+		utils.CommonError
+		ShortKey string `json:"short_key"`
+	}{}
+	if err := api.Client.ApiPostWrapper(ctx, apiGenShortKey, payload, &result); err != nil {
+		return "", err
+	}
+	return result.ShortKey, nil
+}
+
+/*
+获取短key对应的长信息
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Account_Management/KEY_Shortener.html
+
+POST https://api.weixin.qq.com/cgi-bin/shorten/fetch?access_token=ACCESS_TOKEN
+*/
+func (api *QrcodeApi) FetchShortKey(ctx context.Context, shortKey string) (*ShortKey, error) {
+	result := &ShortKey{}
+	err := api.Client.ApiPostWrapper(ctx, apiFetchShortKey, map[string]string{
+		"short_key": shortKey,
+	}, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,287 @@
+package server_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/lixinio/weixin/weixin/custom_service_api"
+)
+
+const (
+	defaultAsyncWorkers        = 4
+	defaultAsyncQueueSize      = 1024
+	defaultAsyncDeliverTimeout = 10 * time.Second
+)
+
+var (
+	ErrorAsyncNotEnabled       = errors.New("async mode is not enabled")
+	ErrorAsyncQueueFull        = errors.New("async queue is full")
+	ErrorAsyncClosed           = errors.New("async processor is shut down")
+	ErrorAsyncReplyUnsupported = errors.New("reply can not be sent as customer service message")
+)
+
+// AsyncConfig 异步处理的配置
+type AsyncConfig struct {
+	Workers   int // 工作协程数量， 缺省 4
+	QueueSize int // 队列长度， 缺省 1024， 队满时返回503， 微信服务器会重试
+
+	// Deliver 发送处理结果， 缺省调用 DeliverReply 通过客服消息接口发给用户
+	Deliver func(ctx *Context, reply interface{}) error
+	// DeliverTimeout 缺省 Deliver 调用接口的超时时间， 缺省 10 秒， 避免卡住工作协程和 Shutdown
+	DeliverTimeout time.Duration
+	// ErrorHandler 处理失败(包括 panic)或者发送失败， 缺省 log.Printf
+	ErrorHandler func(ctx *Context, err error)
+}
+
+type asyncProcessor struct {
+	handler Handler
+	config  AsyncConfig
+	queue   chan *Context
+	mutex   sync.RWMutex
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+/*
+EnableAsync 开启异步模式
+
+被动回复必须在5秒内完成， 处理较慢时由 ServeDataAsync 立即回复 success，
+消息放入队列由 handler 在后台处理， handler 返回的被动回复消息(比如 ctx.ReplyText)
+改为通过客服消息接口发给用户， 用户48小时内与公众号有过互动才能发送
+*/
+func (s *ServerApi) EnableAsync(handler Handler, config *AsyncConfig) {
+	if s.async != nil {
+		panic("server_api: async mode is already enabled")
+	}
+
+	processor := &asyncProcessor{handler: handler}
+	if config != nil {
+		processor.config = *config
+	}
+	if processor.config.Workers <= 0 {
+		processor.config.Workers = defaultAsyncWorkers
+	}
+	if processor.config.QueueSize <= 0 {
+		processor.config.QueueSize = defaultAsyncQueueSize
+	}
+	if processor.config.DeliverTimeout <= 0 {
+		processor.config.DeliverTimeout = defaultAsyncDeliverTimeout
+	}
+	if processor.config.Deliver == nil {
+		processor.config.Deliver = func(ctx *Context, reply interface{}) error {
+			deliverCtx, cancel := context.WithTimeout(context.Background(), processor.config.DeliverTimeout)
+			defer cancel()
+			return s.DeliverReply(deliverCtx, reply)
+		}
+	}
+	if processor.config.ErrorHandler == nil {
+		processor.config.ErrorHandler = func(ctx *Context, err error) {
+			log.Printf(
+				"weixin async callback from %s msgtype=%s event=%s err=%v",
+				ctx.Message.FromUserName, ctx.Message.MsgType, ctx.Event, err,
+			)
+		}
+	}
+
+	processor.queue = make(chan *Context, processor.config.QueueSize)
+	processor.wg.Add(processor.config.Workers)
+	for i := 0; i < processor.config.Workers; i++ {
+		go processor.run()
+	}
+	s.async = processor
+}
+
+// ServeDataAsync 校验签名后立即回复 success， 消息交给 EnableAsync 注册的 handler 在后台处理
+func (s *ServerApi) ServeDataAsync(w http.ResponseWriter, r *http.Request) {
+	s.ServeData(w, r, func(w http.ResponseWriter, r *http.Request) {
+		if s.async == nil {
+			http.Error(w, ErrorAsyncNotEnabled.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			httpAbort(w, http.StatusBadRequest)
+			return
+		}
+		body, err = s.decryptXML(body)
+		if err != nil {
+			httpAbort(w, http.StatusBadRequest)
+			return
+		}
+		ctx, err := NewContext(r, body)
+		if err != nil {
+			httpAbort(w, http.StatusBadRequest)
+			return
+		}
+
+		if err = s.async.enqueue(ctx); err != nil {
+			// 不回复 success， 微信服务器会重试
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_ = s.response(w, r, nil)
+	})
+}
+
+// Shutdown 停止接收新的推送， 等待队列中的消息处理完， ctx 结束时返回 ctx.Err()
+func (s *ServerApi) Shutdown(ctx context.Context) error {
+	if s.async == nil {
+		return nil
+	}
+	return s.async.shutdown(ctx)
+}
+
+/*
+DeliverReply 通过客服消息接口发送被动回复消息
+
+支持 ReplyMessageText/Image/Voice/Video/Music/News 的指针， 接收者为消息的 ToUserName，
+其他类型的客服消息使用 *custom_service_api.Message， 转发客服(TransferCustomerService)不支持
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Service_Center_messages.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/custom/send?access_token=ACCESS_TOKEN
+*/
+func (s *ServerApi) DeliverReply(ctx context.Context, reply interface{}) error {
+	message, err := customMessage(reply)
+	if err != nil {
+		return err
+	}
+	api := &custom_service_api.CustomServiceApi{Client: s.Client}
+	return api.Send(ctx, message)
+}
+
+// customMessage 被动回复消息转换为客服消息
+func customMessage(reply interface{}) (*custom_service_api.Message, error) {
+	switch m := reply.(type) {
+	case *ReplyMessageText:
+		return &custom_service_api.Message{
+			ToUser:  string(m.ToUserName),
+			MsgType: custom_service_api.MsgTypeText,
+			Text:    &custom_service_api.Text{Content: string(m.Content)},
+		}, nil
+	case *ReplyMessageImage:
+		return &custom_service_api.Message{
+			ToUser:  string(m.ToUserName),
+			MsgType: custom_service_api.MsgTypeImage,
+			Image:   &custom_service_api.Media{MediaID: string(m.Image.MediaId)},
+		}, nil
+	case *ReplyMessageVoice:
+		return &custom_service_api.Message{
+			ToUser:  string(m.ToUserName),
+			MsgType: custom_service_api.MsgTypeVoice,
+			Voice:   &custom_service_api.Media{MediaID: string(m.Voice.MediaId)},
+		}, nil
+	case *ReplyMessageVideo:
+		return &custom_service_api.Message{
+			ToUser:  string(m.ToUserName),
+			MsgType: custom_service_api.MsgTypeVideo,
+			Video: &custom_service_api.Video{
+				MediaID:     string(m.Video.MediaId),
+				Title:       string(m.Video.Title),
+				Description: string(m.Video.Description),
+			},
+		}, nil
+	case *ReplyMessageMusic:
+		return &custom_service_api.Message{
+			ToUser:  string(m.ToUserName),
+			MsgType: custom_service_api.MsgTypeMusic,
+			Music: &custom_service_api.Music{
+				Title:        string(m.Music.Title),
+				Description:  string(m.Music.Description),
+				MusicUrl:     string(m.Music.MusicUrl),
+				HQMusicUrl:   string(m.Music.HQMusicUrl),
+				ThumbMediaID: string(m.Music.ThumbMediaId),
+			},
+		}, nil
+	case *ReplyMessageNews:
+		news := &custom_service_api.News{}
+		for _, item := range m.Articles.Item {
+			news.Articles = append(news.Articles, custom_service_api.Article{
+				Title:       string(item.Title),
+				Description: string(item.Description),
+				Url:         string(item.URL),
+				PicUrl:      string(item.PicUrl),
+			})
+		}
+		return &custom_service_api.Message{
+			ToUser:  string(m.ToUserName),
+			MsgType: custom_service_api.MsgTypeNews,
+			News:    news,
+		}, nil
+	case *custom_service_api.Message:
+		return m, nil
+	}
+	return nil, ErrorAsyncReplyUnsupported
+}
+
+func (p *asyncProcessor) enqueue(ctx *Context) error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.closed {
+		return ErrorAsyncClosed
+	}
+
+	select {
+	case p.queue <- ctx:
+		return nil
+	default:
+		return ErrorAsyncQueueFull
+	}
+}
+
+func (p *asyncProcessor) shutdown(ctx context.Context) error {
+	p.mutex.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *asyncProcessor) run() {
+	defer p.wg.Done()
+	for ctx := range p.queue {
+		p.process(ctx)
+	}
+}
+
+func (p *asyncProcessor) process(ctx *Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.config.ErrorHandler(ctx, fmt.Errorf("panic: %v\n%s", r, debug.Stack()))
+		}
+	}()
+
+	reply, err := p.handler(ctx)
+	if err != nil {
+		p.config.ErrorHandler(ctx, err)
+		return
+	}
+	if reply == nil {
+		return
+	}
+	if err = p.config.Deliver(ctx, reply); err != nil {
+		p.config.ErrorHandler(ctx, err)
+	}
+}
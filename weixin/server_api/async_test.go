@@ -0,0 +1,168 @@
+package server_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lixinio/weixin/weixin/custom_service_api"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+func testText(content string) string {
+	return fmt.Sprintf(`<xml>
+		<ToUserName><![CDATA[gh_123456]]></ToUserName>
+		<FromUserName><![CDATA[openid]]></FromUserName>
+		<CreateTime>1348831860</CreateTime>
+		<MsgType><![CDATA[text]]></MsgType>
+		<Content><![CDATA[%s]]></Content>
+		<MsgId>1234567890123456</MsgId>
+	</xml>`, content)
+}
+
+func TestAsync(t *testing.T) {
+	server, officialAccount, _ := fixture.NewOfficialAccount(t)
+
+	var mutex sync.Mutex
+	var messages []map[string]interface{}
+	server.Handle(wxtest.KindOfficialAccount, "/cgi-bin/message/custom/send", func(
+		app string, r *http.Request, body []byte,
+	) (wxtest.H, int64) {
+		message := map[string]interface{}{}
+		if err := json.Unmarshal(body, &message); err != nil {
+			return nil, 47001
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		messages = append(messages, message)
+		return nil, 0
+	})
+
+	router := NewRouter(NewOfficialAccountApi(fixture.Token, fixture.EncodingAESKey, officialAccount))
+	callback := wxtest.NewOfficialAccountCallback(fixture.Token, fixture.EncodingAESKey, "appid")
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	router.OnText(func(ctx *Context, message MessageText) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		if message.Content == "panic" {
+			panic("backend unavailable")
+		}
+		return ctx.ReplyText("echo " + message.Content), nil
+	})
+
+	var errs []error
+	router.EnableAsync(&AsyncConfig{
+		Workers:   1,
+		QueueSize: 1,
+		ErrorHandler: func(ctx *Context, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			errs = append(errs, err)
+		},
+	})
+
+	// 处理函数阻塞时立即回复 success
+	reply, err := callback.Invoke(router, testText("hello"))
+	require.Equal(t, nil, err)
+	require.Equal(t, "success", string(reply.Body))
+	<-started
+
+	// 唯一的工作协程正在处理， 第二条进入队列， 第三条队满
+	reply, err = callback.Invoke(router, testText("panic"))
+	require.Equal(t, nil, err)
+	require.Equal(t, "success", string(reply.Body))
+	reply, err = callback.Invoke(router, testText("full"))
+	require.NotEqual(t, nil, err)
+	require.Equal(t, http.StatusServiceUnavailable, reply.StatusCode)
+
+	// 等待队列处理完成
+	close(release)
+	require.Equal(t, nil, router.serverApi.Shutdown(context.Background()))
+	reply, err = callback.Invoke(router, testText("closed"))
+	require.NotEqual(t, nil, err)
+	require.Equal(t, http.StatusServiceUnavailable, reply.StatusCode)
+
+	require.Equal(t, []map[string]interface{}{{
+		"touser":  "openid",
+		"msgtype": "text",
+		"text":    map[string]interface{}{"content": "echo hello"},
+	}}, messages)
+	require.Equal(t, 1, len(errs))
+	require.Contains(t, errs[0].Error(), "panic: backend unavailable")
+}
+
+func TestCustomMessage(t *testing.T) {
+	ctx := &Context{Message: Message{ToUserName: "gh_123456", FromUserName: "openid"}}
+
+	message, err := customMessage(ctx.ReplyNews(ReplyMessageNewsItem{
+		Title: "title", Description: "description", PicUrl: "picurl", URL: "url",
+	}))
+	require.Equal(t, nil, err)
+	require.Equal(t, &custom_service_api.Message{
+		ToUser:  "openid",
+		MsgType: custom_service_api.MsgTypeNews,
+		News: &custom_service_api.News{Articles: []custom_service_api.Article{{
+			Title: "title", Description: "description", Url: "url", PicUrl: "picurl",
+		}}},
+	}, message)
+
+	// 客服消息原样发送
+	raw := &custom_service_api.Message{
+		ToUser: "openid", MsgType: custom_service_api.MsgTypeMpNews, MpNews: &custom_service_api.Media{MediaID: "media_id"},
+	}
+	message, err = customMessage(raw)
+	require.Equal(t, nil, err)
+	require.Equal(t, raw, message)
+
+	_, err = customMessage(ctx.TransferCustomerService(""))
+	require.Equal(t, ErrorAsyncReplyUnsupported, err)
+	_, err = customMessage(map[string]interface{}{"touser": "openid"})
+	require.Equal(t, ErrorAsyncReplyUnsupported, err)
+}
+
+func TestAsyncDeliverTimeout(t *testing.T) {
+	server, officialAccount, _ := fixture.NewOfficialAccount(t)
+
+	// 客服消息接口卡住
+	stuck := make(chan struct{})
+	defer close(stuck)
+	server.Handle(wxtest.KindOfficialAccount, "/cgi-bin/message/custom/send", func(
+		app string, r *http.Request, body []byte,
+	) (wxtest.H, int64) {
+		select {
+		case <-stuck:
+		case <-r.Context().Done():
+		}
+		return nil, 0
+	})
+
+	router := NewRouter(NewOfficialAccountApi(fixture.Token, fixture.EncodingAESKey, officialAccount))
+	callback := wxtest.NewOfficialAccountCallback(fixture.Token, fixture.EncodingAESKey, "appid")
+	router.OnText(func(ctx *Context, message MessageText) (interface{}, error) {
+		return ctx.ReplyText("echo " + message.Content), nil
+	})
+
+	errs := make(chan error, 1)
+	router.EnableAsync(&AsyncConfig{
+		DeliverTimeout: 50 * time.Millisecond,
+		ErrorHandler: func(ctx *Context, err error) {
+			errs <- err
+		},
+	})
+	_, err := callback.Invoke(router, testText("hello"))
+	require.Equal(t, nil, err)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.Equal(t, nil, router.serverApi.Shutdown(shutdownCtx))
+	require.True(t, errors.Is(<-errs, context.DeadlineExceeded))
+}
@@ -0,0 +1,423 @@
+package server_api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+// Context 一次推送的上下文
+type Context struct {
+	Request  *http.Request
+	Body     []byte      // 解密之后的xml
+	Message  Message     // 公共字段
+	Event    string      // 事件类型， 仅 MsgType 为 event 时有效
+	EventKey string      // 事件KEY值
+	MsgId    string      // 消息id， 事件没有
+	Content  interface{} // ParseXML 的结果， 比如 MessageText/EventSubscribe， 未知类型为 nil
+
+	keys map[string]interface{}
+}
+
+// Set 在中间件和处理函数之间传递数据
+func (ctx *Context) Set(key string, value interface{}) {
+	if ctx.keys == nil {
+		ctx.keys = map[string]interface{}{}
+	}
+	ctx.keys[key] = value
+}
+
+// Get 读取 Set 保存的数据
+func (ctx *Context) Get(key string) (value interface{}, ok bool) {
+	value, ok = ctx.keys[key]
+	return
+}
+
+func (ctx *Context) replyMessage(msgType string) ReplyMessage {
+	return ReplyMessage{
+		ToUserName:   CDATA(ctx.Message.FromUserName),
+		FromUserName: CDATA(ctx.Message.ToUserName),
+		CreateTime:   strconv.FormatInt(time.Now().Unix(), 10),
+		MsgType:      CDATA(msgType),
+	}
+}
+
+// ReplyText 回复文本消息
+func (ctx *Context) ReplyText(content string) *ReplyMessageText {
+	return &ReplyMessageText{
+		ReplyMessage: ctx.replyMessage(ReplyMsgTypeText),
+		Content:      CDATA(content),
+	}
+}
+
+// ReplyImage 回复图片消息
+func (ctx *Context) ReplyImage(mediaId string) *ReplyMessageImage {
+	reply := &ReplyMessageImage{ReplyMessage: ctx.replyMessage(ReplyMsgTypeImage)}
+	reply.Image.MediaId = CDATA(mediaId)
+	return reply
+}
+
+// ReplyVoice 回复语音消息
+func (ctx *Context) ReplyVoice(mediaId string) *ReplyMessageVoice {
+	reply := &ReplyMessageVoice{ReplyMessage: ctx.replyMessage(ReplyMsgTypeVoice)}
+	reply.Voice.MediaId = CDATA(mediaId)
+	return reply
+}
+
+// ReplyNews 回复图文消息
+func (ctx *Context) ReplyNews(items ...ReplyMessageNewsItem) *ReplyMessageNews {
+	reply := &ReplyMessageNews{
+		ReplyMessage: ctx.replyMessage(ReplyMsgTypeNews),
+		ArticleCount: strconv.Itoa(len(items)),
+	}
+	reply.Articles.Item = items
+	return reply
+}
+
+// TransferCustomerService 消息转发到客服， kfAccount 为空表示不指定客服
+func (ctx *Context) TransferCustomerService(kfAccount string) *ReplyMessageTransferCustomerService {
+	reply := &ReplyMessageTransferCustomerService{
+		ReplyMessage: ctx.replyMessage(ReplyMsgTypeTransferCustomerService),
+	}
+	reply.TransInfo.KfAccount = CDATA(kfAccount)
+	return reply
+}
+
+// Handler 处理消息/事件， 返回被动回复(比如 ReplyMessageText)， nil 表示回复 success
+type Handler func(ctx *Context) (reply interface{}, err error)
+
+// Middleware 中间件， 包装 Handler
+type Middleware func(next Handler) Handler
+
+// Router 按 MsgType/Event/EventKey 分发推送
+type Router struct {
+	serverApi      *ServerApi
+	middlewares    []Middleware
+	messages       map[string]Handler // MsgType
+	events         map[string]Handler // Event
+	eventKeys      map[string]Handler // Event + EventKey
+	defaultHandler Handler
+
+	// ErrorHandler 处理失败， 缺省返回500， 微信服务器会重试
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+func NewRouter(serverApi *ServerApi) *Router {
+	return &Router{
+		serverApi: serverApi,
+		messages:  map[string]Handler{},
+		events:    map[string]Handler{},
+		eventKeys: map[string]Handler{},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		},
+	}
+}
+
+// Use 添加中间件， 先添加的在外层
+func (router *Router) Use(middlewares ...Middleware) {
+	router.middlewares = append(router.middlewares, middlewares...)
+}
+
+// Handle 按 MsgType 注册， 比如 MsgTypeText
+func (router *Router) Handle(msgType string, handler Handler) {
+	router.messages[msgType] = handler
+}
+
+// HandleEvent 按 Event 注册， 比如 EventTypeSubscribe
+func (router *Router) HandleEvent(event string, handler Handler) {
+	router.events[event] = handler
+}
+
+// HandleEventKey 按 Event 和 EventKey 注册， 优先于 HandleEvent
+func (router *Router) HandleEventKey(event, eventKey string, handler Handler) {
+	router.eventKeys[event+":"+eventKey] = handler
+}
+
+// Default 没有匹配时的处理函数， 未设置则回复 success
+func (router *Router) Default(handler Handler) {
+	router.defaultHandler = handler
+}
+
+func (router *Router) OnText(handler func(ctx *Context, message MessageText) (interface{}, error)) {
+	router.Handle(MsgTypeText, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageText))
+	})
+}
+
+func (router *Router) OnImage(handler func(ctx *Context, message MessageImage) (interface{}, error)) {
+	router.Handle(MsgTypeImage, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageImage))
+	})
+}
+
+func (router *Router) OnVoice(handler func(ctx *Context, message MessageVoice) (interface{}, error)) {
+	router.Handle(MsgTypeVoice, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageVoice))
+	})
+}
+
+func (router *Router) OnVideo(handler func(ctx *Context, message MessageVideo) (interface{}, error)) {
+	router.Handle(MsgTypeVideo, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageVideo))
+	})
+}
+
+func (router *Router) OnShortVideo(handler func(ctx *Context, message MessageShortVideo) (interface{}, error)) {
+	router.Handle(MsgTypeShortVideo, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageShortVideo))
+	})
+}
+
+func (router *Router) OnLocation(handler func(ctx *Context, message MessageLocation) (interface{}, error)) {
+	router.Handle(MsgTypeLocation, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageLocation))
+	})
+}
+
+func (router *Router) OnLink(handler func(ctx *Context, message MessageLink) (interface{}, error)) {
+	router.Handle(MsgTypeLink, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageLink))
+	})
+}
+
+func (router *Router) OnFile(handler func(ctx *Context, message MessageFile) (interface{}, error)) {
+	router.Handle(MsgTypeFile, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageFile))
+	})
+}
+
+// OnSubscribe 关注， 扫描带参数二维码关注时 EventKey 为 qrscene_ 加场景值
+func (router *Router) OnSubscribe(handler func(ctx *Context, event EventSubscribe) (interface{}, error)) {
+	router.HandleEvent(EventTypeSubscribe, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventSubscribe))
+	})
+}
+
+func (router *Router) OnUnsubscribe(handler func(ctx *Context, event EventUnsubscribe) (interface{}, error)) {
+	router.HandleEvent(EventTypeUnsubscribe, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventUnsubscribe))
+	})
+}
+
+// OnScan 已关注用户扫描带参数二维码， sceneStr 为空匹配所有场景值
+func (router *Router) OnScan(sceneStr string, handler func(ctx *Context, event EventScan) (interface{}, error)) {
+	h := func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventScan))
+	}
+	if sceneStr == "" {
+		router.HandleEvent(EventTypeScan, h)
+	} else {
+		router.HandleEventKey(EventTypeScan, sceneStr, h)
+	}
+}
+
+// OnReportLocation 上报地理位置事件
+func (router *Router) OnReportLocation(handler func(ctx *Context, event EventLocation) (interface{}, error)) {
+	router.HandleEvent(EventTypeLocation, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventLocation))
+	})
+}
+
+// OnMenuClick 点击菜单拉取消息， key 为空匹配所有菜单
+func (router *Router) OnMenuClick(key string, handler func(ctx *Context, event EventMenuClick) (interface{}, error)) {
+	h := func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventMenuClick))
+	}
+	if key == "" {
+		router.HandleEvent(EventTypeMenuClick, h)
+	} else {
+		router.HandleEventKey(EventTypeMenuClick, key, h)
+	}
+}
+
+// OnMenuView 点击菜单跳转链接
+func (router *Router) OnMenuView(handler func(ctx *Context, event EventMenuView) (interface{}, error)) {
+	router.HandleEvent(EventTypeMenuView, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventMenuView))
+	})
+}
+
+// OnTemplateSendJobFinish 模版消息发送任务完成
+func (router *Router) OnTemplateSendJobFinish(
+	handler func(ctx *Context, event EventTemplateSendJobFinish) (interface{}, error),
+) {
+	router.HandleEvent(EventTypeTemplateSendJobFinish, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventTemplateSendJobFinish))
+	})
+}
+
+// OnMassSendJobFinish 群发任务完成
+func (router *Router) OnMassSendJobFinish(
+	handler func(ctx *Context, event EventMassSendJobFinish) (interface{}, error),
+) {
+	router.HandleEvent(EventTypeMassSendJobFinish, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventMassSendJobFinish))
+	})
+}
+
+// 查找处理函数
+func (router *Router) route(ctx *Context) Handler {
+	if ctx.Message.MsgType == MsgTypeEvent {
+		if handler, ok := router.eventKeys[ctx.Event+":"+ctx.EventKey]; ok {
+			return handler
+		}
+		if handler, ok := router.events[ctx.Event]; ok {
+			return handler
+		}
+	} else if handler, ok := router.messages[ctx.Message.MsgType]; ok {
+		return handler
+	}
+
+	if router.defaultHandler != nil {
+		return router.defaultHandler
+	}
+	return func(ctx *Context) (interface{}, error) {
+		return nil, nil
+	}
+}
+
+// Dispatch 经过中间件调用处理函数
+func (router *Router) Dispatch(ctx *Context) (interface{}, error) {
+	handler := router.route(ctx)
+	for i := len(router.middlewares) - 1; i >= 0; i-- {
+		handler = router.middlewares[i](handler)
+	}
+	return handler(ctx)
+}
+
+// NewContext 解析明文xml
+func NewContext(r *http.Request, body []byte) (*Context, error) {
+	header := struct {
+		Message
+		Event    string
+		EventKey string
+		MsgId    string
+	}{}
+	if err := xml.Unmarshal(body, &header); err != nil {
+		return nil, err
+	}
+	content, err := parseMessage(body)
+	if err != nil {
+		return nil, err
+	}
+	return &Context{
+		Request:  r,
+		Body:     body,
+		Message:  header.Message,
+		Event:    header.Event,
+		EventKey: header.EventKey,
+		MsgId:    header.MsgId,
+		Content:  content,
+	}, nil
+}
+
+// EnableAsync 开启异步模式， 推送立即回复 success， 由 Dispatch 在后台处理， 回复改用客服消息发送
+// See: ServerApi.EnableAsync
+func (router *Router) EnableAsync(config *AsyncConfig) {
+	router.serverApi.EnableAsync(router.Dispatch, config)
+}
+
+// ServeHTTP GET 验证服务器地址， POST 接收推送
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		router.serverApi.ServeEcho(w, r)
+	case http.MethodPost:
+		if router.serverApi.async != nil {
+			router.serverApi.ServeDataAsync(w, r)
+			return
+		}
+		router.serverApi.ServeData(w, r, router.serveData)
+	default:
+		httpAbort(w, http.StatusBadRequest)
+	}
+}
+
+func (router *Router) serveData(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpAbort(w, http.StatusBadRequest)
+		return
+	}
+	body, err = router.serverApi.decryptXML(body)
+	if err != nil {
+		httpAbort(w, http.StatusBadRequest)
+		return
+	}
+	ctx, err := NewContext(r, body)
+	if err != nil {
+		httpAbort(w, http.StatusBadRequest)
+		return
+	}
+
+	reply, err := router.Dispatch(ctx)
+	if err != nil {
+		router.ErrorHandler(w, r, err)
+		return
+	}
+	if err = router.serverApi.response(w, r, reply); err != nil {
+		router.ErrorHandler(w, r, err)
+	}
+}
+
+// Recover 中间件， 处理函数 panic 时返回错误
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx *Context) (reply interface{}, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+				}
+			}()
+			return next(ctx)
+		}
+	}
+}
+
+// Logging 中间件， 记录推送类型、耗时和错误， printf 为空使用 log.Printf
+func Logging(printf func(format string, v ...interface{})) Middleware {
+	if printf == nil {
+		printf = log.Printf
+	}
+	return func(next Handler) Handler {
+		return func(ctx *Context) (interface{}, error) {
+			begin := time.Now()
+			reply, err := next(ctx)
+			printf(
+				"weixin callback from %s msgtype=%s event=%s eventkey=%s cost=%s err=%v",
+				ctx.Message.FromUserName, ctx.Message.MsgType, ctx.Event, ctx.EventKey,
+				time.Since(begin), err,
+			)
+			return reply, err
+		}
+	}
+}
+
+// Dedupe 中间件， 重复的推送不再处理， 直接回复success， 处理失败则允许重试
+func Dedupe(deduplicator *utils.CallbackDeduplicator) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx *Context) (interface{}, error) {
+			key := utils.CallbackDedupeKey(
+				ctx.Message.ToUserName, ctx.Message.FromUserName, ctx.Message.CreateTime, ctx.Event, ctx.MsgId,
+			)
+			first, err := deduplicator.Acquire(key)
+			if err == nil && !first {
+				return nil, nil
+			}
+			// 缓存出错时照常处理， 宁可重复也不丢消息
+			reply, err := next(ctx)
+			if err != nil && first {
+				_ = deduplicator.Release(key)
+			}
+			return reply, err
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package server_api
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/weixin/official_account"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServerApi(t *testing.T) *ServerApi {
+	cache := memory.NewMemory(nil)
+	t.Cleanup(cache.Close)
+	officialAccount := official_account.New(cache, cache, &official_account.Config{Appid: "appid"})
+	return NewOfficialAccountApi(fixture.Token, fixture.EncodingAESKey, officialAccount)
+}
+
+func testEvent(event, eventKey string) string {
+	return fmt.Sprintf(`<xml>
+		<ToUserName><![CDATA[gh_123456]]></ToUserName>
+		<FromUserName><![CDATA[openid]]></FromUserName>
+		<CreateTime>1348831860</CreateTime>
+		<MsgType><![CDATA[event]]></MsgType>
+		<Event><![CDATA[%s]]></Event>
+		<EventKey><![CDATA[%s]]></EventKey>
+	</xml>`, event, eventKey)
+}
+
+func TestRouter(t *testing.T) {
+	router := NewRouter(newTestServerApi(t))
+	callback := wxtest.NewOfficialAccountCallback(fixture.Token, fixture.EncodingAESKey, "appid")
+
+	var calls []string
+	router.Use(Recover(), func(next Handler) Handler {
+		return func(ctx *Context) (interface{}, error) {
+			calls = append(calls, "middleware")
+			return next(ctx)
+		}
+	})
+	router.OnText(func(ctx *Context, message MessageText) (interface{}, error) {
+		calls = append(calls, "text")
+		return ctx.ReplyText("echo " + message.Content), nil
+	})
+	router.OnSubscribe(func(ctx *Context, event EventSubscribe) (interface{}, error) {
+		calls = append(calls, "subscribe:"+event.EventKey)
+		return ctx.ReplyText("welcome"), nil
+	})
+	router.OnMenuClick("", func(ctx *Context, event EventMenuClick) (interface{}, error) {
+		calls = append(calls, "click")
+		return nil, nil
+	})
+	router.OnMenuClick("V1001_HELP", func(ctx *Context, event EventMenuClick) (interface{}, error) {
+		calls = append(calls, "click:"+event.EventKey)
+		return nil, nil
+	})
+	router.OnScan("", func(ctx *Context, event EventScan) (interface{}, error) {
+		panic("scan")
+	})
+	router.Default(func(ctx *Context) (interface{}, error) {
+		calls = append(calls, "default:"+ctx.Message.MsgType)
+		return nil, errors.New("not supported")
+	})
+
+	// 文本消息， 加密回复
+	reply, err := callback.Invoke(router, `<xml>
+		<ToUserName><![CDATA[gh_123456]]></ToUserName>
+		<FromUserName><![CDATA[openid]]></FromUserName>
+		<CreateTime>1348831860</CreateTime>
+		<MsgType><![CDATA[text]]></MsgType>
+		<Content><![CDATA[hello]]></Content>
+		<MsgId>1234567890123456</MsgId>
+	</xml>`)
+	require.Equal(t, nil, err)
+	replyText := ReplyMessageText{}
+	require.Equal(t, nil, reply.Unmarshal(&replyText))
+	require.Equal(t, CDATA("echo hello"), replyText.Content)
+	require.Equal(t, CDATA(ReplyMsgTypeText), replyText.MsgType)
+	require.Equal(t, []string{"middleware", "text"}, calls)
+
+	// 事件的回复类型不是 event
+	calls = nil
+	reply, err = callback.Invoke(router, testEvent(EventTypeSubscribe, "qrscene_123"))
+	require.Equal(t, nil, err)
+	require.Equal(t, nil, reply.Unmarshal(&replyText))
+	require.Equal(t, CDATA("welcome"), replyText.Content)
+	require.Equal(t, CDATA(ReplyMsgTypeText), replyText.MsgType)
+	require.Equal(t, []string{"middleware", "subscribe:qrscene_123"}, calls)
+
+	// EventKey 优先
+	calls = nil
+	reply, err = callback.Invoke(router, testEvent(EventTypeMenuClick, "V1001_HELP"))
+	require.Equal(t, nil, err)
+	require.Equal(t, "success", string(reply.Body))
+	reply, err = callback.Invoke(router, testEvent(EventTypeMenuClick, "V1001_OTHER"))
+	require.Equal(t, nil, err)
+	require.Equal(t, []string{"middleware", "click:V1001_HELP", "middleware", "click"}, calls)
+
+	// 缺省处理， 出错返回500
+	calls = nil
+	reply, err = callback.Invoke(router, testEvent(EventTypeUnsubscribe, ""))
+	require.NotEqual(t, nil, err)
+	require.Equal(t, 500, reply.StatusCode)
+	require.Equal(t, []string{"middleware", "default:event"}, calls)
+
+	// panic
+	reply, err = callback.Invoke(router, testEvent(EventTypeScan, "123"))
+	require.NotEqual(t, nil, err)
+	require.Equal(t, 500, reply.StatusCode)
+}
+
+func TestMassSendJobFinish(t *testing.T) {
+	router := NewRouter(newTestServerApi(t))
+	callback := wxtest.NewOfficialAccountCallback(fixture.Token, fixture.EncodingAESKey, "appid")
+
+	var events []EventMassSendJobFinish
+	router.OnMassSendJobFinish(func(ctx *Context, event EventMassSendJobFinish) (interface{}, error) {
+		events = append(events, event)
+		return nil, nil
+	})
+	_, err := callback.Invoke(router, `<xml>
+		<ToUserName><![CDATA[gh_4d00ed8d6399]]></ToUserName>
+		<FromUserName><![CDATA[oV5CrjpxgaGXNHIQigzNlgLTnwic]]></FromUserName>
+		<CreateTime>1481013459</CreateTime>
+		<MsgType><![CDATA[event]]></MsgType>
+		<Event><![CDATA[MASSSENDJOBFINISH]]></Event>
+		<MsgID>1000001625</MsgID>
+		<Status><![CDATA[sendsuccess]]></Status>
+		<TotalCount>100</TotalCount>
+		<FilterCount>80</FilterCount>
+		<SentCount>75</SentCount>
+		<ErrorCount>5</ErrorCount>
+		<CopyrightCheckResult>
+			<Count>1</Count>
+			<ResultList>
+				<item>
+					<ArticleIdx>1</ArticleIdx>
+					<UserDeclareState>0</UserDeclareState>
+					<AuditState>2</AuditState>
+					<OriginalArticleUrl><![CDATA[Url_1]]></OriginalArticleUrl>
+					<OriginalArticleType>1</OriginalArticleType>
+					<CanReprint>1</CanReprint>
+					<NeedReplaceContent>1</NeedReplaceContent>
+					<NeedShowReprintSource>1</NeedShowReprintSource>
+				</item>
+			</ResultList>
+			<CheckState>2</CheckState>
+		</CopyrightCheckResult>
+		<ArticleUrlResult>
+			<Count>1</Count>
+			<ResultList>
+				<item>
+					<ArticleIdx>1</ArticleIdx>
+					<ArticleUrl><![CDATA[Url]]></ArticleUrl>
+				</item>
+			</ResultList>
+		</ArticleUrlResult>
+	</xml>`)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, len(events))
+	event := events[0]
+	require.Equal(t, "1000001625", event.MsgID)
+	require.Equal(t, MassSendStatusSuccess, event.Status)
+	require.Equal(t, []int{100, 80, 75, 5}, []int{event.TotalCount, event.FilterCount, event.SentCount, event.ErrorCount})
+	require.Equal(t, 2, event.CopyrightCheckResult.CheckState)
+	require.Equal(t, "Url_1", event.CopyrightCheckResult.ResultList[0].OriginalArticleUrl)
+	require.Equal(t, []ArticleUrlItem{{ArticleIdx: 1, ArticleUrl: "Url"}}, event.ArticleUrlResult.ResultList)
+}
+
+func TestDedupe(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+
+	router := NewRouter(newTestServerApi(t))
+	router.Use(Dedupe(utils.NewCallbackDeduplicator(cache, 0)))
+	callback := wxtest.NewOfficialAccountCallback(fixture.Token, fixture.EncodingAESKey, "appid")
+
+	calls, failed := 0, false
+	router.OnText(func(ctx *Context, message MessageText) (interface{}, error) {
+		calls++
+		if message.Content == "fail" && !failed {
+			failed = true
+			return nil, errors.New("backend unavailable")
+		}
+		return ctx.ReplyText(message.Content), nil
+	})
+	router.OnSubscribe(func(ctx *Context, event EventSubscribe) (interface{}, error) {
+		calls++
+		return nil, nil
+	})
+	text := func(msgId, content string) string {
+		return fmt.Sprintf(`<xml>
+			<ToUserName><![CDATA[gh_123456]]></ToUserName>
+			<FromUserName><![CDATA[openid]]></FromUserName>
+			<CreateTime>1348831860</CreateTime>
+			<MsgType><![CDATA[text]]></MsgType>
+			<Content><![CDATA[%s]]></Content>
+			<MsgId>%s</MsgId>
+		</xml>`, content, msgId)
+	}
+
+	// 重试的消息直接回复 success
+	reply, err := callback.Invoke(router, text("1", "hello"))
+	require.Equal(t, nil, err)
+	require.NotEqual(t, 0, len(reply.XML))
+	reply, err = callback.Invoke(router, text("1", "hello"))
+	require.Equal(t, nil, err)
+	require.Equal(t, "success", string(reply.Body))
+	require.Equal(t, 1, calls)
+
+	// 不同的消息
+	_, err = callback.Invoke(router, text("2", "hello"))
+	require.Equal(t, nil, err)
+	require.Equal(t, 2, calls)
+
+	// 处理失败可以重试
+	_, err = callback.Invoke(router, text("3", "fail"))
+	require.NotEqual(t, nil, err)
+	reply, err = callback.Invoke(router, text("3", "fail"))
+	require.Equal(t, nil, err)
+	require.NotEqual(t, 0, len(reply.XML))
+	require.Equal(t, 4, calls)
+
+	// 事件使用 FromUserName + CreateTime
+	for i := 0; i < 3; i++ {
+		_, err = callback.Invoke(router, testEvent(EventTypeSubscribe, ""))
+		require.Equal(t, nil, err)
+	}
+	require.Equal(t, 5, calls)
+}
@@ -36,6 +36,9 @@ type ServerApi struct {
 	OAConfig       *official_account.Config
 	Token          string
 	EncodingAESKey string
+
+	async          *asyncProcessor // EnableAsync
+	componentAppid string          // 第三方平台代收消息时用第三方平台的 appid 加密
 }
 
 func NewOfficialAccountApi(token, encodingAESKey string, officialAccount *official_account.OfficialAccount) *ServerApi {
@@ -47,6 +50,16 @@ func NewOfficialAccountApi(token, encodingAESKey string, officialAccount *offici
 	}
 }
 
+// NewAuthorizerApi 第三方平台代公众号接收消息， token/encodingAESKey 是第三方平台的消息校验Token和加解密Key
+// officialAccount 参考 wxopen/open.Open.NewOfficialAccount
+func NewAuthorizerApi(
+	token, encodingAESKey, componentAppid string, officialAccount *official_account.OfficialAccount,
+) *ServerApi {
+	serverApi := NewOfficialAccountApi(token, encodingAESKey, officialAccount)
+	serverApi.componentAppid = componentAppid
+	return serverApi
+}
+
 func calcSignature(timestamp, nonce, token string) string {
 	strs := []string{timestamp, nonce, token}
 	sort.Strings(strs)
@@ -90,7 +103,15 @@ func (s *ServerApi) ServeData(w http.ResponseWriter, r *http.Request, processor
 
 // ParseXML 解析微信推送过来的消息/事件
 func (s *ServerApi) ParseXML(body []byte) (m interface{}, err error) {
+	body, err = s.decryptXML(body)
+	if err != nil {
+		return
+	}
+	return parseMessage(body)
+}
 
+// decryptXML 如果是加密消息则解密， 否则原样返回
+func (s *ServerApi) decryptXML(body []byte) (xmlMsg []byte, err error) {
 	// 是否加密消息
 	encryptMsg := EncryptMessage{}
 	err = xml.Unmarshal(body, &encryptMsg)
@@ -100,15 +121,14 @@ func (s *ServerApi) ParseXML(body []byte) (m interface{}, err error) {
 
 	// 需要解密
 	if encryptMsg.Encrypt != "" {
-		var xmlMsg []byte
 		_, xmlMsg, _, err = utils.AESDecryptMsg(encryptMsg.Encrypt, s.EncodingAESKey)
-		if err != nil {
-			return
-		}
-		body = xmlMsg
-
+		return
 	}
+	return body, nil
+}
 
+// parseMessage 解析明文的消息/事件
+func parseMessage(body []byte) (m interface{}, err error) {
 	message := Message{}
 	err = xml.Unmarshal(body, &message)
 	//fmt.Println(message)
@@ -438,6 +458,15 @@ func parseEvent(body []byte) (m interface{}, err error) {
 		}
 		return msg, nil
 
+		// 群发任务完成
+	case EventTypeMassSendJobFinish:
+		msg := EventMassSendJobFinish{}
+		err = xml.Unmarshal(body, &msg)
+		if err != nil {
+			return
+		}
+		return msg, nil
+
 	case EventTypeAuthorizeInvoice:
 		msg := EventAuthorizeInvoice{}
 		err = xml.Unmarshal(body, &msg)
@@ -467,7 +496,6 @@ func (s *ServerApi) response(w http.ResponseWriter, r *http.Request, reply inter
 		if err != nil {
 			return
 		}
-		fmt.Println(string(output))
 
 		// 加密
 		if r.URL.Query().Get("encrypt_type") == "aes" {
@@ -490,7 +518,11 @@ func (s *ServerApi) response(w http.ResponseWriter, r *http.Request, reply inter
 
 // encryptReplyMessage 加密回复消息
 func (s *ServerApi) encryptReplyMessage(rawXmlMsg []byte) (*ReplyEncryptMessage, error) {
-	cipherText, err := utils.AESEncryptMsg([]byte(utils.GetRandString(16)), rawXmlMsg, s.OAConfig.Appid, s.EncodingAESKey)
+	appid := s.OAConfig.Appid
+	if s.componentAppid != "" {
+		appid = s.componentAppid
+	}
+	cipherText, err := utils.AESEncryptMsg([]byte(utils.GetRandString(16)), rawXmlMsg, appid, s.EncodingAESKey)
 	if err != nil {
 		return nil, err
 	}
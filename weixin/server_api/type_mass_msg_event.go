@@ -0,0 +1,89 @@
+package server_api
+
+const (
+	EventTypeMassSendJobFinish = "MASSSENDJOBFINISH" // 群发任务完成
+)
+
+// 群发任务完成事件的 Status， 其他失败为 err(错误码)
+const (
+	MassSendStatusSuccess = "sendsuccess"
+	MassSendStatusFail    = "sendfail"
+)
+
+// CopyrightCheckItem 单篇图文的原创校验结果
+type CopyrightCheckItem struct {
+	ArticleIdx            int
+	UserDeclareState      int
+	AuditState            int
+	OriginalArticleUrl    string
+	OriginalArticleType   int
+	CanReprint            int
+	NeedReplaceContent    int
+	NeedShowReprintSource int
+}
+
+// ArticleUrlItem 群发成功的图文地址
+type ArticleUrlItem struct {
+	ArticleIdx int
+	ArticleUrl string
+}
+
+/*
+<xml>
+  <ToUserName><![CDATA[gh_4d00ed8d6399]]></ToUserName>
+  <FromUserName><![CDATA[oV5CrjpxgaGXNHIQigzNlgLTnwic]]></FromUserName>
+  <CreateTime>1481013459</CreateTime>
+  <MsgType><![CDATA[event]]></MsgType>
+  <Event><![CDATA[MASSSENDJOBFINISH]]></Event>
+  <MsgID>1000001625</MsgID>
+  <Status><![CDATA[err(30003)]]></Status>
+  <TotalCount>0</TotalCount>
+  <FilterCount>0</FilterCount>
+  <SentCount>0</SentCount>
+  <ErrorCount>0</ErrorCount>
+  <CopyrightCheckResult>
+    <Count>2</Count>
+    <ResultList>
+      <item>
+        <ArticleIdx>1</ArticleIdx>
+        <UserDeclareState>0</UserDeclareState>
+        <AuditState>2</AuditState>
+        <OriginalArticleUrl><![CDATA[Url_1]]></OriginalArticleUrl>
+        <OriginalArticleType>1</OriginalArticleType>
+        <CanReprint>1</CanReprint>
+        <NeedReplaceContent>1</NeedReplaceContent>
+        <NeedShowReprintSource>1</NeedShowReprintSource>
+      </item>
+    </ResultList>
+    <CheckState>2</CheckState>
+  </CopyrightCheckResult>
+  <ArticleUrlResult>
+    <Count>1</Count>
+    <ResultList>
+      <item>
+        <ArticleIdx>1</ArticleIdx>
+        <ArticleUrl><![CDATA[Url]]></ArticleUrl>
+      </item>
+    </ResultList>
+  </ArticleUrlResult>
+</xml>
+*/
+type EventMassSendJobFinish struct {
+	Event
+	MsgID       string
+	Status      string
+	TotalCount  int // 发送的粉丝数
+	FilterCount int // 过滤后准备发送的粉丝数
+	SentCount   int // 发送成功的粉丝数
+	ErrorCount  int // 发送失败的粉丝数
+
+	CopyrightCheckResult struct {
+		Count      int
+		ResultList []CopyrightCheckItem `xml:"ResultList>item"`
+		CheckState int                  // 1 未被判为转载， 2 被判为转载可以群发， 3 被判为转载不能群发
+	}
+	ArticleUrlResult struct {
+		Count      int
+		ResultList []ArticleUrlItem `xml:"ResultList>item"`
+	}
+}
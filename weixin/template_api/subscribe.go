@@ -0,0 +1,212 @@
+package template_api
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	apiGetCategory             = "/wxaapi/newtmpl/getcategory"
+	apiGetPubTemplateTitles    = "/wxaapi/newtmpl/getpubtemplatetitles"
+	apiGetPubTemplateKeywords  = "/wxaapi/newtmpl/getpubtemplatekeywords"
+	apiAddSubscribeTemplate    = "/wxaapi/newtmpl/addtemplate"
+	apiDeleteSubscribeTemplate = "/wxaapi/newtmpl/deltemplate"
+	apiGetSubscribeTemplates   = "/wxaapi/newtmpl/gettemplate"
+	apiSendSubscribe           = "/cgi-bin/message/subscribe/bizsend"
+)
+
+// 订阅消息模板类型
+const (
+	SubscribeTemplateTypeOnce     = 2 // 一次性订阅
+	SubscribeTemplateTypeLongTerm = 3 // 长期订阅
+)
+
+type Category struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type PubTemplateTitle struct {
+	Tid        int    `json:"tid"`
+	Title      string `json:"title"`
+	Type       int    `json:"type"`
+	CategoryID string `json:"categoryId"`
+}
+
+type PubTemplateTitleList struct {
+	Count int                `json:"count"`
+	Data  []PubTemplateTitle `json:"data"`
+}
+
+type PubTemplateKeyword struct {
+	Kid     int    `json:"kid"`
+	Name    string `json:"name"`
+	Example string `json:"example"`
+	Rule    string `json:"rule"` // 参数类型， 比如 thing/number/time
+}
+
+type SubscribeTemplate struct {
+	PriTmplID string `json:"priTmplId"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	Example   string `json:"example"`
+	Type      int    `json:"type"`
+}
+
+// SubscribeMessage 订阅通知， Data 的 Color 无效
+type SubscribeMessage struct {
+	ToUser      string       `json:"touser"`
+	TemplateID  string       `json:"template_id"`
+	Page        string       `json:"page,omitempty"` // 跳转网页
+	MiniProgram *MiniProgram `json:"miniprogram,omitempty"`
+	Data        Data         `json:"data"`
+}
+
+/*
+获取公众号类目
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Subscription_Messages/api.html
+
+GET https://api.weixin.qq.com/wxaapi/newtmpl/getcategory?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) GetCategory(ctx context.Context) ([]Category, error) {
+	result := struct {
+		utils.CommonError
+		Data []Category `json:"data"`
+	}{}
+	if err := api.Client.ApiGetNullWrapper(ctx, apiGetCategory, &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+/*
+获取类目下的公共模板
+
+ids 为类目 id， start 从0开始， limit 最大30
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Subscription_Messages/api.html
+
+GET https://api.weixin.qq.com/wxaapi/newtmpl/getpubtemplatetitles?access_token=ACCESS_TOKEN&ids=IDS&start=0&limit=30
+*/
+func (api *TemplateApi) GetPubTemplateTitles(
+	ctx context.Context, ids []int, start, limit int,
+) (*PubTemplateTitleList, error) {
+	strIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strIDs = append(strIDs, strconv.Itoa(id))
+	}
+	var result PubTemplateTitleList
+	err := api.Client.ApiGetWrapper(ctx, apiGetPubTemplateTitles, func(params url.Values) {
+		params.Add("ids", strings.Join(strIDs, ","))
+		params.Add("start", strconv.Itoa(start))
+		params.Add("limit", strconv.Itoa(limit))
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+/*
+获取模板中的关键词
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Subscription_Messages/api.html
+
+GET https://api.weixin.qq.com/wxaapi/newtmpl/getpubtemplatekeywords?access_token=ACCESS_TOKEN&tid=TID
+*/
+func (api *TemplateApi) GetPubTemplateKeywords(ctx context.Context, tid int) ([]PubTemplateKeyword, error) {
+	result := struct {
+		utils.CommonError
+		Count int                  `json:"count"`
+		Data  []PubTemplateKeyword `json:"data"`
+	}{}
+	err := api.Client.ApiGetWrapper(ctx, apiGetPubTemplateKeywords, func(params url.Values) {
+		params.Add("tid", strconv.Itoa(tid))
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+/*
+选用模板
+
+从公共模板库中选用模板到私有模板库， kidList 为关键词 id， 最多5个， 返回私有模板 id
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Subscription_Messages/api.html
+
+POST https://api.weixin.qq.com/wxaapi/newtmpl/addtemplate?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) AddSubscribeTemplate(
+	ctx context.Context, tid int, kidList []int, sceneDesc string,
+) (string, error) {
+	params := &struct {
+		Tid       string `json:"tid"`
+		KidList   []int  `json:"kidList"`
+		SceneDesc string `json:"sceneDesc,omitempty"`
+	}{
+		Tid:       strconv.Itoa(tid),
+		KidList:   kidList,
+		SceneDesc: sceneDesc,
+	}
+	result := struct {
+		utils.CommonError
+		PriTmplID string `json:"priTmplId"`
+	}{}
+	if err := api.Client.ApiPostWrapper(ctx, apiAddSubscribeTemplate, params, &result); err != nil {
+		return "", err
+	}
+	return result.PriTmplID, nil
+}
+
+/*
+删除模板
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Subscription_Messages/api.html
+
+POST https://api.weixin.qq.com/wxaapi/newtmpl/deltemplate?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) DeleteSubscribeTemplate(ctx context.Context, priTmplID string) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiDeleteSubscribeTemplate, map[string]string{
+		"priTmplId": priTmplID,
+	}, &result)
+}
+
+/*
+获取私有模板列表
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Subscription_Messages/api.html
+
+GET https://api.weixin.qq.com/wxaapi/newtmpl/gettemplate?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) GetSubscribeTemplates(ctx context.Context) ([]SubscribeTemplate, error) {
+	result := struct {
+		utils.CommonError
+		Data []SubscribeTemplate `json:"data"`
+	}{}
+	if err := api.Client.ApiGetNullWrapper(ctx, apiGetSubscribeTemplates, &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+/*
+发送订阅通知
+
+用户通过网页或者图文中的订阅按钮同意订阅后发送， 用户拒收返回 43101
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Subscription_Messages/api.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/subscribe/bizsend?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) SendSubscribe(ctx context.Context, message *SubscribeMessage) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiSendSubscribe, message, &result)
+}
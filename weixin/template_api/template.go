@@ -0,0 +1,208 @@
+// Package template_api 模板消息和订阅消息
+package template_api
+
+import (
+	"context"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/official_account"
+)
+
+const (
+	apiSetIndustry       = "/cgi-bin/template/api_set_industry"
+	apiGetIndustry       = "/cgi-bin/template/get_industry"
+	apiGetAllTemplates   = "/cgi-bin/template/get_all_private_template"
+	apiAddTemplate       = "/cgi-bin/template/api_add_template"
+	apiDeleteTemplate    = "/cgi-bin/template/del_private_template"
+	apiSend              = "/cgi-bin/message/template/send"
+	apiSendSubscribeOnce = "/cgi-bin/message/template/subscribe"
+)
+
+type TemplateApi struct {
+	*utils.Client
+}
+
+func NewOfficialAccountApi(officialAccount *official_account.OfficialAccount) *TemplateApi {
+	return &TemplateApi{
+		Client: officialAccount.Client,
+	}
+}
+
+type Industry struct {
+	FirstClass  string `json:"first_class"`
+	SecondClass string `json:"second_class"`
+}
+
+type IndustryInfo struct {
+	PrimaryIndustry   Industry `json:"primary_industry"`
+	SecondaryIndustry Industry `json:"secondary_industry"`
+}
+
+type Template struct {
+	TemplateID      string `json:"template_id"`
+	Title           string `json:"title"`
+	PrimaryIndustry string `json:"primary_industry"`
+	DeputyIndustry  string `json:"deputy_industry"`
+	Content         string `json:"content"`
+	Example         string `json:"example"`
+}
+
+// DataItem 模板内容中的一个字段， Color 为空使用默认颜色
+type DataItem struct {
+	Value string `json:"value"`
+	Color string `json:"color,omitempty"`
+}
+
+// Data 模板内容， key 为模板中的字段名， 比如 {{first.DATA}} 的 first
+type Data map[string]DataItem
+
+// MiniProgram 跳转小程序， 优先于 Url
+type MiniProgram struct {
+	Appid    string `json:"appid"`
+	PagePath string `json:"pagepath,omitempty"`
+}
+
+type Message struct {
+	ToUser      string       `json:"touser"`
+	TemplateID  string       `json:"template_id"`
+	Url         string       `json:"url,omitempty"`
+	MiniProgram *MiniProgram `json:"miniprogram,omitempty"`
+	ClientMsgID string       `json:"client_msg_id,omitempty"` // 防重入id， 24小时内相同的id只发送一次
+	Data        Data         `json:"data"`
+}
+
+// SubscribeOnceMessage 一次性订阅消息， Data 只有 content 一个字段
+type SubscribeOnceMessage struct {
+	ToUser      string       `json:"touser"`
+	TemplateID  string       `json:"template_id"`
+	Url         string       `json:"url,omitempty"`
+	MiniProgram *MiniProgram `json:"miniprogram,omitempty"`
+	Scene       string       `json:"scene"` // 订阅场景值， 0-10000
+	Title       string       `json:"title"`
+	Data        Data         `json:"data"`
+}
+
+/*
+设置所属行业
+
+每月可修改行业1次
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Template_Message_Interface.html
+
+POST https://api.weixin.qq.com/cgi-bin/template/api_set_industry?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) SetIndustry(ctx context.Context, industryID1, industryID2 string) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiSetIndustry, map[string]string{
+		"industry_id1": industryID1,
+		"industry_id2": industryID2,
+	}, &result)
+}
+
+/*
+获取设置的行业信息
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Template_Message_Interface.html
+
+GET https://api.weixin.qq.com/cgi-bin/template/get_industry?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) GetIndustry(ctx context.Context) (*IndustryInfo, error) {
+	var result IndustryInfo
+	if err := api.Client.ApiGetNullWrapper(ctx, apiGetIndustry, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+/*
+获取模板列表
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Template_Message_Interface.html
+
+GET https://api.weixin.qq.com/cgi-bin/template/get_all_private_template?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) GetAllTemplates(ctx context.Context) ([]Template, error) {
+	result := struct {
+		utils.CommonError
+		TemplateList []Template `json:"template_list"`
+	}{}
+	if err := api.Client.ApiGetNullWrapper(ctx, apiGetAllTemplates, &result); err != nil {
+		return nil, err
+	}
+	return result.TemplateList, nil
+}
+
+/*
+获得模板ID
+
+从行业模板库选择模板到帐号后台， 返回模板ID， keywordNameList 为选用的关键词
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Template_Message_Interface.html
+
+POST https://api.weixin.qq.com/cgi-bin/template/api_add_template?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) AddTemplate(ctx context.Context, templateIDShort string, keywordNameList []string) (string, error) {
+	params := &struct {
+		TemplateIDShort string   `json:"template_id_short"`
+		KeywordNameList []string `json:"keyword_name_list,omitempty"`
+	}{
+		TemplateIDShort: templateIDShort,
+		KeywordNameList: keywordNameList,
+	}
+	result := struct {
+		utils.CommonError
+		TemplateID string `json:"template_id"`
+	}{}
+	if err := api.Client.ApiPostWrapper(ctx, apiAddTemplate, params, &result); err != nil {
+		return "", err
+	}
+	return result.TemplateID, nil
+}
+
+/*
+删除模板
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Template_Message_Interface.html
+
+POST https://api.weixin.qq.com/cgi-bin/template/del_private_template?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) DeleteTemplate(ctx context.Context, templateID string) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiDeleteTemplate, map[string]string{
+		"template_id": templateID,
+	}, &result)
+}
+
+/*
+发送模板消息
+
+返回的 msgid 和发送任务完成事件(TEMPLATESENDJOBFINISH)中的 MsgID 对应， 参考 SendTracker
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Template_Message_Interface.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/template/send?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) Send(ctx context.Context, message *Message) (int64, error) {
+	result := struct {
+		utils.CommonError
+		MsgID int64 `json:"msgid"`
+	}{}
+	if err := api.Client.ApiPostWrapper(ctx, apiSend, message, &result); err != nil {
+		return 0, err
+	}
+	return result.MsgID, nil
+}
+
+/*
+推送一次性订阅消息
+
+用户在授权页同意订阅后(回调地址带上 openid 和 scene)， 可以推送一条订阅消息
+
+See: https://developers.weixin.qq.com/doc/offiaccount/Message_Management/One-time_subscription_info.html
+
+POST https://api.weixin.qq.com/cgi-bin/message/template/subscribe?access_token=ACCESS_TOKEN
+*/
+func (api *TemplateApi) SendSubscribeOnce(ctx context.Context, message *SubscribeOnceMessage) error {
+	var result utils.CommonError
+	return api.Client.ApiPostWrapper(ctx, apiSendSubscribeOnce, message, &result)
+}
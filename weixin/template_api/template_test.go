@@ -0,0 +1,133 @@
+package template_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/weixin/server_api"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestApi(t *testing.T) (*TemplateApi, *wxtest.Server) {
+	server, officialAccount, _ := fixture.NewOfficialAccount(t, wxtest.OfficialAccountUser{OpenID: "openid1"})
+	return NewOfficialAccountApi(officialAccount), server
+}
+
+func TestTemplate(t *testing.T) {
+	api, server := newTestApi(t)
+	ctx := context.Background()
+
+	require.Equal(t, nil, api.SetIndustry(ctx, "1", "4"))
+	industry, err := api.GetIndustry(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, "互联网/电子商务", industry.PrimaryIndustry.SecondClass)
+	require.Equal(t, "电子技术", industry.SecondaryIndustry.SecondClass)
+
+	templateID, err := api.AddTemplate(ctx, "TM00015", []string{"订单号", "金额"})
+	require.Equal(t, nil, err)
+	templates, err := api.GetAllTemplates(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, len(templates))
+	require.Equal(t, templateID, templates[0].TemplateID)
+
+	message := &Message{
+		ToUser:      "openid1",
+		TemplateID:  templateID,
+		MiniProgram: &MiniProgram{Appid: "wxappid", PagePath: "pages/order"},
+		Data: Data{
+			"first":    {Value: "下单成功", Color: "#173177"},
+			"keyword1": {Value: "20211001"},
+		},
+	}
+	msgID, err := api.Send(ctx, message)
+	require.Equal(t, nil, err)
+	require.NotEqual(t, int64(0), msgID)
+
+	require.Equal(t, nil, api.SendSubscribeOnce(ctx, &SubscribeOnceMessage{
+		ToUser:     "openid1",
+		TemplateID: "SUBSCRIBE_TEMPLATE_ID",
+		Scene:      "1000",
+		Title:      "订阅提醒",
+		Data:       Data{"content": {Value: "您订阅的内容已更新"}},
+	}))
+
+	sent := []Message{}
+	for _, raw := range server.TemplateMessages() {
+		message := Message{}
+		require.Equal(t, nil, json.Unmarshal(raw, &message))
+		sent = append(sent, message)
+	}
+	require.Equal(t, 2, len(sent))
+	require.Equal(t, *message, sent[0])
+	require.Equal(t, "您订阅的内容已更新", sent[1].Data["content"].Value)
+
+	require.Equal(t, nil, api.DeleteTemplate(ctx, templateID))
+	_, err = api.Send(ctx, message)
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeInvalidTemplateId}))
+}
+
+func TestSubscribe(t *testing.T) {
+	api, server := newTestApi(t)
+	ctx := context.Background()
+
+	categories, err := api.GetCategory(ctx)
+	require.Equal(t, nil, err)
+	require.NotEmpty(t, categories)
+
+	priTmplID, err := api.AddSubscribeTemplate(ctx, 99, []int{1, 2}, "发货提醒")
+	require.Equal(t, nil, err)
+	templates, err := api.GetSubscribeTemplates(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, len(templates))
+	require.Equal(t, priTmplID, templates[0].PriTmplID)
+	require.Equal(t, SubscribeTemplateTypeOnce, templates[0].Type)
+
+	require.Equal(t, nil, api.SendSubscribe(ctx, &SubscribeMessage{
+		ToUser:     "openid1",
+		TemplateID: priTmplID,
+		Page:       "https://example.com",
+		Data:       Data{"thing1": {Value: "已发货"}},
+	}))
+	require.Equal(t, 1, len(server.TemplateMessages()))
+
+	require.Equal(t, nil, api.DeleteSubscribeTemplate(ctx, priTmplID))
+	err = api.DeleteSubscribeTemplate(ctx, priTmplID)
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeInvalidTemplateId}))
+}
+
+func TestSendTracker(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	tracker := NewSendTracker(cache, "appid", 0)
+	require.Equal(t, nil, tracker.Track(200163836, "order1"))
+
+	var results []*SendResult
+	handler := tracker.OnJobFinish(func(ctx *server_api.Context, result *SendResult) error {
+		results = append(results, result)
+		if len(results) == 1 {
+			return errors.New("retry")
+		}
+		return nil
+	})
+	event := server_api.EventTemplateSendJobFinish{MsgID: "200163836", Status: SendStatusUserBlock}
+
+	// 处理失败时保留记录
+	_, err := handler(&server_api.Context{}, event)
+	require.NotEqual(t, nil, err)
+	_, err = handler(&server_api.Context{}, event)
+	require.Equal(t, nil, err)
+	_, err = handler(&server_api.Context{}, event)
+	require.Equal(t, nil, err)
+
+	require.Equal(t, 3, len(results))
+	require.Equal(t, "order1", results[1].Value)
+	require.True(t, results[1].Found)
+	require.False(t, results[1].Success())
+	require.False(t, results[2].Found)
+}
@@ -0,0 +1,77 @@
+package template_api
+
+import (
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/server_api"
+)
+
+// 发送任务完成事件的 Status
+const (
+	SendStatusSuccess      = "success"
+	SendStatusUserBlock    = "failed:user block"     // 用户拒收
+	SendStatusSystemFailed = "failed: system failed" // 其他原因
+)
+
+// 发送任务完成事件通常几秒内推送， 保留一天
+const defaultSendTrackerTTL = 24 * time.Hour
+
+// SendResult 发送任务完成事件和 Track 时记录的数据
+type SendResult struct {
+	MsgID       string
+	Status      string
+	Value       string    // Track 记录的数据
+	SubmittedAt time.Time // Track 的时间
+	Found       bool      // 是否找到 Track 的记录， 记录过期或者不是通过 Track 发送的为 false
+}
+
+// Success 是否送达
+func (result *SendResult) Success() bool {
+	return result.Status == SendStatusSuccess
+}
+
+// SendTracker 通过 msgid 关联发送的模板消息和发送任务完成事件(TEMPLATESENDJOBFINISH)
+type SendTracker struct {
+	*utils.MsgTracker
+}
+
+// NewSendTracker appid 用于区分不同的公众号， ttl 为记录保存的时长， 0表示缺省一天
+func NewSendTracker(cache utils.Cache, appid string, ttl time.Duration) *SendTracker {
+	if ttl <= 0 {
+		ttl = defaultSendTrackerTTL
+	}
+	return &SendTracker{
+		MsgTracker: utils.NewMsgTracker(cache, "template-send", appid, ttl),
+	}
+}
+
+func sendResult(event *server_api.EventTemplateSendJobFinish, record utils.TrackRecord, found bool) *SendResult {
+	return &SendResult{
+		MsgID:       event.MsgID,
+		Status:      event.Status,
+		Value:       record.Value,
+		SubmittedAt: record.SubmittedAt,
+		Found:       found,
+	}
+}
+
+// Resolve 查找事件对应的记录
+func (tracker *SendTracker) Resolve(event *server_api.EventTemplateSendJobFinish) (*SendResult, error) {
+	record, found, err := tracker.Lookup(event.MsgID)
+	if err != nil {
+		return nil, err
+	}
+	return sendResult(event, record, found), nil
+}
+
+// OnJobFinish 生成 server_api.Router.OnTemplateSendJobFinish 的处理函数， handler 成功后删除记录
+func (tracker *SendTracker) OnJobFinish(
+	handler func(ctx *server_api.Context, result *SendResult) error,
+) func(ctx *server_api.Context, event server_api.EventTemplateSendJobFinish) (interface{}, error) {
+	return func(ctx *server_api.Context, event server_api.EventTemplateSendJobFinish) (interface{}, error) {
+		return nil, tracker.Finish(event.MsgID, func(record utils.TrackRecord, found bool) error {
+			return handler(ctx, sendResult(&event, record, found))
+		})
+	}
+}
@@ -1,20 +1,12 @@
-package open
-
-// Copyright 2020 FastWeGo
-//
-// Licensed under the Apache License, Version 2.0 (the "License");
-// you may not use this file except in compliance with the License.
-// You may obtain a copy of the License at
-//
-//      http://www.apache.org/licenses/LICENSE-2.0
-//
-// Unless required by applicable law or agreed to in writing, software
-// distributed under the License is distributed on an "AS IS" BASIS,
-// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-// See the License for the specific language governing permissions and
-// limitations under the License.
-
-// Package account 开放平台-账号管理
+// Package account_api 开放平台-账号管理， 第三方平台代公众号/小程序调用
+package account_api
+
+import (
+	"context"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/official_account"
+)
 
 const (
 	apiCreate = "/cgi-bin/open/create"
@@ -23,6 +15,17 @@ const (
 	apiGet    = "/cgi-bin/open/get"
 )
 
+// AccountApi 使用授权方(公众号/小程序)的 access_token
+type AccountApi struct {
+	*utils.Client
+}
+
+func NewOfficialAccountApi(officialAccount *official_account.OfficialAccount) *AccountApi {
+	return &AccountApi{
+		Client: officialAccount.Client,
+	}
+}
+
 /*
 创建开放平台帐号并绑定公众号/小程序
 
@@ -32,8 +35,16 @@ See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/ac
 
 POST https://api.weixin.qq.com/cgi-bin/open/create?access_token=ACCESS_TOKEN
 */
-func (open *Open) Create(authorizer_access_token string, payload []byte) (resp []byte, err error) {
-	return httpPost(apiCreate+"?access_token="+authorizer_access_token, payload)
+func (api *AccountApi) Create(ctx context.Context, appid string) (openAppid string, err error) {
+	result := struct {
+		utils.CommonError
+		OpenAppid string `json:"open_appid"`
+	}{}
+	err = api.Client.ApiPostWrapper(ctx, apiCreate, map[string]string{"appid": appid}, &result)
+	if err != nil {
+		return
+	}
+	return result.OpenAppid, nil
 }
 
 /*
@@ -45,8 +56,11 @@ See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/ac
 
 POST https://api.weixin.qq.com/cgi-bin/open/bind?access_token=xxxx
 */
-func (open *Open) Bind(authorizer_access_token string, payload []byte) (resp []byte, err error) {
-	return httpPost(apiBind+"?access_token="+authorizer_access_token, payload)
+func (api *AccountApi) Bind(ctx context.Context, appid, openAppid string) error {
+	return api.Client.ApiPostWrapper(ctx, apiBind, map[string]string{
+		"appid":      appid,
+		"open_appid": openAppid,
+	}, nil)
 }
 
 /*
@@ -58,8 +72,11 @@ See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/ac
 
 POST https://api.weixin.qq.com/cgi-bin/open/unbind?access_token=ACCESS_TOKEN
 */
-func (open *Open) Unbind(authorizer_access_token string, payload []byte) (resp []byte, err error) {
-	return httpPost(apiUnbind+"?access_token="+authorizer_access_token, payload)
+func (api *AccountApi) Unbind(ctx context.Context, appid, openAppid string) error {
+	return api.Client.ApiPostWrapper(ctx, apiUnbind, map[string]string{
+		"appid":      appid,
+		"open_appid": openAppid,
+	}, nil)
 }
 
 /*
@@ -71,19 +88,14 @@ See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/ac
 
 POST https://api.weixin.qq.com/cgi-bin/open/get?access_token=ACCESS_TOKEN
 */
-func (open *Open) Get(authorizer_access_token string, payload []byte) (resp []byte, err error) {
-	return httpPost(apiGet+"?access_token="+authorizer_access_token, payload)
+func (api *AccountApi) Get(ctx context.Context, appid string) (openAppid string, err error) {
+	result := struct {
+		utils.CommonError
+		OpenAppid string `json:"open_appid"`
+	}{}
+	err = api.Client.ApiPostWrapper(ctx, apiGet, map[string]string{"appid": appid}, &result)
+	if err != nil {
+		return
+	}
+	return result.OpenAppid, nil
 }
-
-// func httpPost(api string, payload []byte) (resp []byte, err error) {
-// 	response, err := http.Post(wxopen.WXServerUrl+api, "application/json;charset=utf-8", bytes.NewReader(payload))
-// 	if err != nil {
-// 		return
-// 	}
-// 	defer response.Body.Close()
-// 	resp, err = ioutil.ReadAll(response.Body)
-// 	if err != nil {
-// 		return
-// 	}
-// 	return
-// }
@@ -19,7 +19,7 @@ package open
 // Package auth 开放平台
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"net/url"
 
@@ -45,6 +45,15 @@ const (
 	apiApiGetAuthorizerList         = "/cgi-bin/component/api_get_authorizer_list"
 )
 
+// AuthorizerOption 授权方的选项
+const (
+	OptionLocationReport  = "location_report"  // 地理位置上报 0:无上报 1:进入会话时上报 2:每5s上报
+	OptionVoiceRecognize  = "voice_recognize"  // 语音识别开关 0:关闭 1:开启
+	OptionCustomerService = "customer_service" // 多客服开关 0:关闭 1:开启
+)
+
+const maxAuthorizerListCount = 500 // 拉取授权方列表每次最多500个
+
 /*
 获取 预授权码
 
@@ -54,26 +63,19 @@ See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/2.0/ap
 
 POST https://api.weixin.qq.com/cgi-bin/component/api_create_preauthcode?component_access_token=COMPONENT_ACCESS_TOKEN
 */
-func (open *Open) CreatePreauthCodeRaw(payload []byte) (resp []byte, err error) {
-	return open.Client.HTTPPost(apiCreatePreauthCode, bytes.NewReader(payload), "application/json;charset=utf-8", 0)
-}
-func (open *Open) CreatePreauthCode() (component_access_token string, expires_in int, err error) {
-	var result = struct {
-		AccessToken string  `json:"component_access_token"`
-		ExpiresIn   int     `json:"expires_in"`
-		Errcode     float64 `json:"errcode"`
-		Errmsg      string  `json:"errmsg"`
+func (open *Open) CreatePreauthCode(ctx context.Context) (preAuthCode string, expiresIn int, err error) {
+	result := struct {
+		utils.CommonError
+		PreAuthCode string `json:"pre_auth_code"`
+		ExpiresIn   int    `json:"expires_in"`
 	}{}
-
-	params := &struct {
-		ComponentAppid string `json:"component_appid"`
-	}{ComponentAppid: open.Config.ComponentAppid}
-
-	err = utils.ApiPostWrapper(open.CreatePreauthCodeRaw, params, &result)
+	err = open.Client.ApiPostWrapper(ctx, apiCreatePreauthCode, map[string]string{
+		"component_appid": open.Config.ComponentAppid,
+	}, &result)
 	if err != nil {
 		return
 	}
-	return result.AccessToken, result.ExpiresIn, nil
+	return result.PreAuthCode, result.ExpiresIn, nil
 }
 
 func (open *Open) buildAuthParams(pre_auth_code, redirect_uri, biz_appid string, auth_type int) url.Values {
@@ -84,7 +86,7 @@ func (open *Open) buildAuthParams(pre_auth_code, redirect_uri, biz_appid string,
 	if len(biz_appid) > 0 {
 		params.Add("biz_appid", biz_appid)
 	}
-	if auth_type < 1 {
+	if auth_type > 0 {
 		params.Add("auth_type", fmt.Sprintf("%d", auth_type))
 	}
 	return params
@@ -118,12 +120,33 @@ See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/Author
 GET https://mp.weixin.qq.com/safe/bindcomponent?action=bindcomponent&auth_type=3&no_scan=1&component_appid=xxxx&pre_auth_code=xxxxx&redirect_uri=xxxx&auth_type=xxx&biz_appid=xxxx#wechat_redirect
 */
 func (open *Open) GetAuthorizationRedirectUri2(pre_auth_code, redirect_uri, biz_appid string, auth_type int) (uri string) {
-	return AuthorizationRedirectUri + "/safe/bindcomponent?" + open.buildAuthParams(
+	params := open.buildAuthParams(
 		pre_auth_code,
 		redirect_uri,
 		biz_appid,
 		auth_type,
-	).Encode() + "#wechat_redirect"
+	)
+	params.Add("action", "bindcomponent")
+	params.Add("no_scan", "1")
+	return AuthorizationRedirectUri + "/safe/bindcomponent?" + params.Encode() + "#wechat_redirect"
+}
+
+// FuncInfo 授权给第三方平台的权限集
+type FuncInfo struct {
+	FuncscopeCategory TypeInfo `json:"funcscope_category"`
+}
+
+type TypeInfo struct {
+	ID int `json:"id"`
+}
+
+// AuthorizationInfo 授权信息， 需要保存 AuthorizerRefreshToken
+type AuthorizationInfo struct {
+	AuthorizerAppid        string     `json:"authorizer_appid"`
+	AuthorizerAccessToken  string     `json:"authorizer_access_token"`
+	ExpiresIn              int        `json:"expires_in"`
+	AuthorizerRefreshToken string     `json:"authorizer_refresh_token"`
+	FuncInfo               []FuncInfo `json:"func_info"`
 }
 
 /*
@@ -135,8 +158,26 @@ See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/au
 
 POST https://api.weixin.qq.com/cgi-bin/component/api_query_auth?component_access_token=COMPONENT_ACCESS_TOKEN
 */
-func (open *Open) ApiQueryAuth(payload []byte) (resp []byte, err error) {
-	return open.Client.HTTPPost(apiApiQueryAuth, bytes.NewReader(payload), "application/json;charset=utf-8", 0)
+func (open *Open) ApiQueryAuth(ctx context.Context, authorizationCode string) (*AuthorizationInfo, error) {
+	result := struct {
+		utils.CommonError
+		AuthorizationInfo AuthorizationInfo `json:"authorization_info"`
+	}{}
+	err := open.Client.ApiPostWrapper(ctx, apiApiQueryAuth, map[string]string{
+		"component_appid":    open.Config.ComponentAppid,
+		"authorization_code": authorizationCode,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result.AuthorizationInfo, nil
+}
+
+type AuthorizerToken struct {
+	utils.CommonError
+	AuthorizerAccessToken  string `json:"authorizer_access_token"`
+	ExpiresIn              int    `json:"expires_in"`
+	AuthorizerRefreshToken string `json:"authorizer_refresh_token"`
 }
 
 /*
@@ -148,8 +189,52 @@ See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/ap
 
 POST https://api.weixin.qq.com/cgi-bin/component/api_authorizer_token?component_access_token=COMPONENT_ACCESS_TOKEN
 */
-func (open *Open) ApiAuthorizerToken(payload []byte) (resp []byte, err error) {
-	return open.Client.HTTPPost(apiApiAuthorizerToken, bytes.NewReader(payload), "application/json;charset=utf-8", 0)
+func (open *Open) ApiAuthorizerToken(
+	ctx context.Context, authorizerAppid, authorizerRefreshToken string,
+) (*AuthorizerToken, error) {
+	result := &AuthorizerToken{}
+	err := open.Client.ApiPostWrapper(ctx, apiApiAuthorizerToken, map[string]string{
+		"component_appid":          open.Config.ComponentAppid,
+		"authorizer_appid":         authorizerAppid,
+		"authorizer_refresh_token": authorizerRefreshToken,
+	}, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AuthorizerInfo 授权方的帐号基本信息
+type AuthorizerInfo struct {
+	NickName        string         `json:"nick_name"`
+	HeadImg         string         `json:"head_img"`
+	ServiceTypeInfo TypeInfo       `json:"service_type_info"` // 公众号 0:订阅号 1:由历史老帐号升级后的订阅号 2:服务号
+	VerifyTypeInfo  TypeInfo       `json:"verify_type_info"`  // -1:未认证 0:微信认证
+	UserName        string         `json:"user_name"`         // 原始ID
+	PrincipalName   string         `json:"principal_name"`    // 主体名称
+	Alias           string         `json:"alias"`             // 微信号
+	QrcodeUrl       string         `json:"qrcode_url"`
+	Signature       string         `json:"signature"`     // 帐号介绍
+	BusinessInfo    map[string]int `json:"business_info"` // 功能的开通状况 0:未开通 1:已开通
+	MiniProgramInfo *struct {
+		Network struct {
+			RequestDomain   []string `json:"RequestDomain"`
+			WsRequestDomain []string `json:"WsRequestDomain"`
+			UploadDomain    []string `json:"UploadDomain"`
+			DownloadDomain  []string `json:"DownloadDomain"`
+		} `json:"network"`
+		Categories []struct {
+			First  string `json:"first"`
+			Second string `json:"second"`
+		} `json:"categories"`
+		VisitStatus int `json:"visit_status"`
+	} `json:"MiniProgramInfo,omitempty"` // 小程序才有
+}
+
+type AuthorizerDetail struct {
+	utils.CommonError
+	AuthorizerInfo    AuthorizerInfo    `json:"authorizer_info"`
+	AuthorizationInfo AuthorizationInfo `json:"authorization_info"`
 }
 
 /*
@@ -161,8 +246,16 @@ See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/ap
 
 POST https://api.weixin.qq.com/cgi-bin/component/api_get_authorizer_info?component_access_token=COMPONENT_ACCESS_TOKEN
 */
-func (open *Open) ApiGetAuthorizerInfo(payload []byte) (resp []byte, err error) {
-	return open.Client.HTTPPost(apiApiGetAuthorizerInfo, bytes.NewReader(payload), "application/json;charset=utf-8", 0)
+func (open *Open) ApiGetAuthorizerInfo(ctx context.Context, authorizerAppid string) (*AuthorizerDetail, error) {
+	result := &AuthorizerDetail{}
+	err := open.Client.ApiPostWrapper(ctx, apiApiGetAuthorizerInfo, map[string]string{
+		"component_appid":  open.Config.ComponentAppid,
+		"authorizer_appid": authorizerAppid,
+	}, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 /*
@@ -174,8 +267,22 @@ See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/ap
 
 POST https://api.weixin.qq.com/cgi-bin/component/api_get_authorizer_option?component_access_token=COMPONENT_ACCESS_TOKEN
 */
-func (open *Open) ApiGetAuthorizerOption(payload []byte) (resp []byte, err error) {
-	return open.Client.HTTPPost(apiApiGetAuthorizerOption, bytes.NewReader(payload), "application/json;charset=utf-8", 0)
+func (open *Open) ApiGetAuthorizerOption(ctx context.Context, authorizerAppid, optionName string) (string, error) {
+	result := struct {
+		utils.CommonError
+		AuthorizerAppid string `json:"authorizer_appid"`
+		OptionName      string `json:"option_name"`
+		OptionValue     string `json:"option_value"`
+	}{}
+	err := open.Client.ApiPostWrapper(ctx, apiApiGetAuthorizerOption, map[string]string{
+		"component_appid":  open.Config.ComponentAppid,
+		"authorizer_appid": authorizerAppid,
+		"option_name":      optionName,
+	}, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.OptionValue, nil
 }
 
 /*
@@ -187,19 +294,64 @@ See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/ap
 
 POST https://api.weixin.qq.com/cgi-bin/component/api_set_authorizer_option?component_access_token=COMPONENT_ACCESS_TOKEN
 */
-func (open *Open) ApiSetAuthorizerOption(payload []byte) (resp []byte, err error) {
-	return open.Client.HTTPPost(apiApiSetAuthorizerOption, bytes.NewReader(payload), "application/json;charset=utf-8", 0)
+func (open *Open) ApiSetAuthorizerOption(ctx context.Context, authorizerAppid, optionName, optionValue string) error {
+	return open.Client.ApiPostWrapper(ctx, apiApiSetAuthorizerOption, map[string]string{
+		"component_appid":  open.Config.ComponentAppid,
+		"authorizer_appid": authorizerAppid,
+		"option_name":      optionName,
+		"option_value":     optionValue,
+	}, nil)
+}
+
+type AuthorizerListItem struct {
+	AuthorizerAppid string `json:"authorizer_appid"`
+	RefreshToken    string `json:"refresh_token"`
+	AuthTime        int64  `json:"auth_time"`
+}
+
+type AuthorizerList struct {
+	utils.CommonError
+	TotalCount int                  `json:"total_count"`
+	List       []AuthorizerListItem `json:"list"`
 }
 
 /*
 拉取所有已授权的帐号信息
 
-使用本 API 拉取当前所有已授权的帐号基本信息
+使用本 API 拉取当前所有已授权的帐号基本信息， count 最大500
 
 See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/api_get_authorizer_list.html
 
 POST https://api.weixin.qq.com/cgi-bin/component/api_get_authorizer_list?component_access_token=COMPONENT_ACCESS_TOKEN
 */
-func (open *Open) ApiGetAuthorizerList(payload []byte) (resp []byte, err error) {
-	return open.Client.HTTPPost(apiApiGetAuthorizerList, bytes.NewReader(payload), "application/json;charset=utf-8", 0)
+func (open *Open) ApiGetAuthorizerList(ctx context.Context, offset, count int) (*AuthorizerList, error) {
+	payload := struct {
+		ComponentAppid string `json:"component_appid"`
+		Offset         int    `json:"offset"`
+		Count          int    `json:"count"`
+	}{
+		ComponentAppid: open.Config.ComponentAppid,
+		Offset:         offset,
+		Count:          count,
+	}
+	result := &AuthorizerList{}
+	if err := open.Client.ApiPostWrapper(ctx, apiApiGetAuthorizerList, payload, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetAllAuthorizers 分页拉取所有已授权的帐号
+func (open *Open) GetAllAuthorizers(ctx context.Context) ([]AuthorizerListItem, error) {
+	authorizers := []AuthorizerListItem{}
+	for {
+		result, err := open.ApiGetAuthorizerList(ctx, len(authorizers), maxAuthorizerListCount)
+		if err != nil {
+			return nil, err
+		}
+		authorizers = append(authorizers, result.List...)
+		if len(result.List) == 0 || len(authorizers) >= result.TotalCount {
+			return authorizers, nil
+		}
+	}
 }
@@ -0,0 +1,144 @@
+package open
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/weixin/official_account"
+)
+
+// refresh_token 不会过期(除非取消授权)， 每次刷新 access_token 都会续期
+const defaultRefreshTokenTTL = 365 * 24 * time.Hour
+
+var ErrorAuthorizerNotFound = errors.New("authorizer_refresh_token not found")
+
+// RefreshTokenStore 保存授权方的 authorizer_refresh_token
+// refresh_token 丢失之后只能让管理员重新授权， 所以需要持久化保存
+type RefreshTokenStore interface {
+	Get(componentAppid, authorizerAppid string) (string, error) // 不存在返回空字符串
+	Set(componentAppid, authorizerAppid, refreshToken string) error
+	Delete(componentAppid, authorizerAppid string) error
+}
+
+type cacheRefreshTokenStore struct {
+	cache utils.Cache
+}
+
+// NewCacheRefreshTokenStore 用 utils.Cache 保存 refresh_token， 缓存需要是持久化的(比如redis)
+func NewCacheRefreshTokenStore(cache utils.Cache) RefreshTokenStore {
+	return &cacheRefreshTokenStore{cache: cache}
+}
+
+func (store *cacheRefreshTokenStore) key(componentAppid, authorizerAppid string) string {
+	return fmt.Sprintf("authorizer-refresh-token:wxopen:%s:%s", componentAppid, authorizerAppid)
+}
+
+func (store *cacheRefreshTokenStore) Get(componentAppid, authorizerAppid string) (string, error) {
+	refreshToken := ""
+	_, err := store.cache.Get(store.key(componentAppid, authorizerAppid), &refreshToken)
+	return refreshToken, err
+}
+
+func (store *cacheRefreshTokenStore) Set(componentAppid, authorizerAppid, refreshToken string) error {
+	return store.cache.Set(store.key(componentAppid, authorizerAppid), refreshToken, defaultRefreshTokenTTL)
+}
+
+func (store *cacheRefreshTokenStore) Delete(componentAppid, authorizerAppid string) error {
+	return store.cache.Delete(store.key(componentAppid, authorizerAppid))
+}
+
+// Authorizer 授权方(公众号/小程序)， 用 authorizer_refresh_token 获取 authorizer_access_token
+type Authorizer struct {
+	open  *Open
+	store RefreshTokenStore
+	Appid string
+}
+
+// NewAuthorizer 授权方的 refresh_token 需要先通过 QueryAuth 保存到 store
+func (open *Open) NewAuthorizer(store RefreshTokenStore, authorizerAppid string) *Authorizer {
+	return &Authorizer{
+		open:  open,
+		store: store,
+		Appid: authorizerAppid,
+	}
+}
+
+// GetAccessToken 接口 weixin.AccessTokenGetter 实现
+func (authorizer *Authorizer) GetAccessToken() (accessToken string, expiresIn int, err error) {
+	componentAppid := authorizer.open.Config.ComponentAppid
+	refreshToken, err := authorizer.store.Get(componentAppid, authorizer.Appid)
+	if err != nil {
+		return
+	}
+	if refreshToken == "" {
+		err = ErrorAuthorizerNotFound
+		return
+	}
+
+	result, err := authorizer.open.ApiAuthorizerToken(context.Background(), authorizer.Appid, refreshToken)
+	if err != nil {
+		return
+	}
+	if result.AuthorizerRefreshToken != "" {
+		// refresh_token 可能会变化， 同时给缓存续期
+		refreshToken = result.AuthorizerRefreshToken
+	}
+	// 新的 refresh_token 丢失之后只能重新授权， 保存失败时返回错误， 下次调用时重试
+	if err = authorizer.store.Set(componentAppid, authorizer.Appid, refreshToken); err != nil {
+		return "", 0, fmt.Errorf("save authorizer_refresh_token of %s: %w", authorizer.Appid, err)
+	}
+	return result.AuthorizerAccessToken, result.ExpiresIn, nil
+}
+
+// GetAccessTokenKey 接口 weixin.AccessTokenGetter 实现
+func (authorizer *Authorizer) GetAccessTokenKey() string {
+	return fmt.Sprintf(
+		"access-token:wxopen-authorizer:%s:%s",
+		authorizer.open.Config.ComponentAppid,
+		authorizer.Appid,
+	)
+}
+
+// GetAccessTokenLockKey 接口 weixin.AccessTokenGetter 实现
+func (authorizer *Authorizer) GetAccessTokenLockKey() string {
+	return fmt.Sprintf(
+		"access-token:wxopen-authorizer:%s:%s.lock",
+		authorizer.open.Config.ComponentAppid,
+		authorizer.Appid,
+	)
+}
+
+// QueryAuth 使用授权码获取授权信息， 并保存 authorizer_refresh_token
+func (open *Open) QueryAuth(
+	ctx context.Context, store RefreshTokenStore, authorizationCode string,
+) (*AuthorizationInfo, error) {
+	info, err := open.ApiQueryAuth(ctx, authorizationCode)
+	if err != nil {
+		return nil, err
+	}
+	err = store.Set(open.Config.ComponentAppid, info.AuthorizerAppid, info.AuthorizerRefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// NewOfficialAccount 代授权的公众号调用接口， 返回的对象可以用于所有 weixin/*_api 包
+// opts 参考 official_account.New
+func (open *Open) NewOfficialAccount(
+	cache utils.Cache,
+	locker utils.Lock,
+	store RefreshTokenStore,
+	authorizerAppid string,
+	opts ...utils.ClientOption,
+) *official_account.OfficialAccount {
+	return official_account.NewWithAccessTokenGetter(
+		cache, locker,
+		&official_account.Config{Appid: authorizerAppid},
+		open.NewAuthorizer(store, authorizerAppid),
+		opts...,
+	)
+}
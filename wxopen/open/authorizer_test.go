@@ -0,0 +1,89 @@
+package open
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/weixin/user_api"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/stretchr/testify/require"
+)
+
+// 保存 refresh_token 失败的 store
+type failingStore struct {
+	RefreshTokenStore
+	err error
+}
+
+func (store *failingStore) Set(componentAppid, authorizerAppid, refreshToken string) error {
+	if store.err != nil {
+		return store.err
+	}
+	return store.RefreshTokenStore.Set(componentAppid, authorizerAppid, refreshToken)
+}
+
+func TestAuthorizer(t *testing.T) {
+	server := wxtest.NewServer()
+	defer server.Close()
+	server.AddComponent("component_appid", "component_secret")
+
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	open := New(cache, cache, &Config{
+		ComponentAppid:  "component_appid",
+		ComponentSecret: "component_secret",
+	}, server.ComponentVerifyTicket, utils.WithServerUrl(server.URL))
+	store := NewCacheRefreshTokenStore(cache)
+	ctx := context.Background()
+
+	// 还没有授权
+	officialAccount := open.NewOfficialAccount(cache, cache, store, "appid1", utils.WithServerUrl(server.URL))
+	userApi := user_api.NewOfficialAccountApi(officialAccount)
+	_, err := userApi.CreateTag(ctx, "tag1")
+	require.True(t, errors.Is(err, ErrorAuthorizerNotFound))
+
+	code := server.AuthorizeComponent(wxtest.ComponentAuthorizer{Appid: "appid1"})
+	info, err := open.QueryAuth(ctx, store, code)
+	require.Equal(t, nil, err)
+	refreshToken, err := store.Get("component_appid", "appid1")
+	require.Equal(t, nil, err)
+	require.Equal(t, info.AuthorizerRefreshToken, refreshToken)
+
+	// 代公众号调用接口
+	tag, err := userApi.CreateTag(ctx, "tag1")
+	require.Equal(t, nil, err)
+	require.Equal(t, "tag1", tag.Tag.Name)
+	tags, err := userApi.GetTag(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, len(tags.Tags))
+	require.Equal(t, 1, server.RequestCount("/cgi-bin/component/api_authorizer_token"))
+
+	// token 失效后自动刷新， component_access_token 也同时失效， 刷新后重试
+	server.ExpireAccessTokens()
+	_, err = userApi.GetTag(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 3, server.RequestCount("/cgi-bin/component/api_authorizer_token"))
+	require.Equal(t, 2, server.RequestCount("/cgi-bin/component/api_component_token"))
+
+	// 保存 refresh_token 失败时返回错误
+	saveErr := errors.New("store unavailable")
+	failing := &failingStore{RefreshTokenStore: store, err: saveErr}
+	_, _, err = open.NewAuthorizer(failing, "appid1").GetAccessToken()
+	require.True(t, errors.Is(err, saveErr))
+	failing.err = nil
+	_, _, err = open.NewAuthorizer(failing, "appid1").GetAccessToken()
+	require.Equal(t, nil, err)
+
+	// 取消授权
+	server.UnauthorizeComponent("appid1")
+	server.ExpireAccessTokens()
+	_, err = userApi.GetTag(ctx)
+	require.NotEqual(t, nil, err)
+	require.Equal(t, nil, store.Delete("component_appid", "appid1"))
+	refreshToken, err = store.Get("component_appid", "appid1")
+	require.Equal(t, nil, err)
+	require.Equal(t, "", refreshToken)
+}
@@ -1,6 +1,7 @@
 package open
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/lixinio/weixin/utils"
@@ -10,10 +11,14 @@ var (
 	WXServerUrl = "https://api.weixin.qq.com" // 微信 api 服务器地址
 )
 
+// ComponentVerifyTicketGetter 获取微信服务器每10分钟推送的 component_verify_ticket
+// 配合 wxopen/server_api 使用 NewCacheVerifyTicketGetter
 type ComponentVerifyTicketGetter func(component_appid string) string
 
+var ErrorVerifyTicketMissing = errors.New("component_verify_ticket not received")
+
 /*
-公众号配置
+第三方平台配置
 */
 type Config struct {
 	ComponentAppid  string
@@ -26,17 +31,23 @@ type Open struct {
 	component_verify_ticket_getter ComponentVerifyTicketGetter
 }
 
+// New opts 可以指定 http.Client / 超时 / 代理 / 服务器地址等， 参考 utils.ClientOption
+// 第三方平台的接口使用 component_access_token 参数， 而不是 access_token
 func New(
 	cache utils.Cache,
 	locker utils.Lock,
 	config *Config,
 	component_verify_ticket_getter ComponentVerifyTicketGetter,
+	opts ...utils.ClientOption,
 ) *Open {
 	instance := &Open{
 		Config:                         config,
 		component_verify_ticket_getter: component_verify_ticket_getter,
 	}
-	instance.Client = utils.NewClient(WXServerUrl, utils.NewAccessTokenCache(instance, cache, locker, 0))
+	opts = append([]utils.ClientOption{utils.WithAccessTokenParam("component_access_token")}, opts...)
+	instance.Client = utils.NewClient(
+		WXServerUrl, utils.NewAccessTokenCache(instance, cache, locker, 0), opts...,
+	)
 	return instance
 }
 
@@ -0,0 +1,95 @@
+package open
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent(t *testing.T) {
+	server := wxtest.NewServer()
+	defer server.Close()
+	server.AddComponent("component_appid", "component_secret")
+
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	config := &Config{
+		ComponentAppid:  "component_appid",
+		ComponentSecret: "component_secret",
+	}
+	ctx := context.Background()
+
+	// 还没有收到 component_verify_ticket
+	noTicket := New(cache, cache, config, func(string) string { return "" }, utils.WithServerUrl(server.URL))
+	_, _, err := noTicket.CreatePreauthCode(ctx)
+	require.True(t, errors.Is(err, ErrorVerifyTicketMissing))
+
+	open := New(cache, cache, config, server.ComponentVerifyTicket, utils.WithServerUrl(server.URL))
+	preAuthCode, expiresIn, err := open.CreatePreauthCode(ctx)
+	require.Equal(t, nil, err)
+	require.NotEqual(t, "", preAuthCode)
+	require.Equal(t, 600, expiresIn)
+
+	uri, err := url.Parse(open.GetAuthorizationRedirectUri2(preAuthCode, "https://example.com/auth", "", AuthTypeOf))
+	require.Equal(t, nil, err)
+	require.Equal(t, "bindcomponent", uri.Query().Get("action"))
+	require.Equal(t, "1", uri.Query().Get("auth_type"))
+	require.Equal(t, preAuthCode, uri.Query().Get("pre_auth_code"))
+
+	// 管理员授权后用授权码换取授权信息
+	code := server.AuthorizeComponent(wxtest.ComponentAuthorizer{
+		Appid: "appid1", NickName: "公众号1", UserName: "gh_1", ServiceType: 2, FuncInfo: []int{1, 15},
+	})
+	info, err := open.ApiQueryAuth(ctx, code)
+	require.Equal(t, nil, err)
+	require.Equal(t, "appid1", info.AuthorizerAppid)
+	require.NotEqual(t, "", info.AuthorizerAccessToken)
+	require.NotEqual(t, "", info.AuthorizerRefreshToken)
+	require.Equal(t, 2, len(info.FuncInfo))
+	require.Equal(t, 15, info.FuncInfo[1].FuncscopeCategory.ID)
+	_, err = open.ApiQueryAuth(ctx, code)
+	require.True(t, errors.Is(err, utils.ErrorInvalidCode))
+
+	token, err := open.ApiAuthorizerToken(ctx, "appid1", info.AuthorizerRefreshToken)
+	require.Equal(t, nil, err)
+	require.NotEqual(t, info.AuthorizerAccessToken, token.AuthorizerAccessToken)
+	require.Equal(t, info.AuthorizerRefreshToken, token.AuthorizerRefreshToken)
+	_, err = open.ApiAuthorizerToken(ctx, "appid1", "invalid")
+	require.NotEqual(t, nil, err)
+
+	detail, err := open.ApiGetAuthorizerInfo(ctx, "appid1")
+	require.Equal(t, nil, err)
+	require.Equal(t, "公众号1", detail.AuthorizerInfo.NickName)
+	require.Equal(t, "gh_1", detail.AuthorizerInfo.UserName)
+	require.Equal(t, 2, detail.AuthorizerInfo.ServiceTypeInfo.ID)
+	require.Equal(t, "appid1", detail.AuthorizationInfo.AuthorizerAppid)
+
+	// 选项
+	require.Equal(t, nil, open.ApiSetAuthorizerOption(ctx, "appid1", OptionVoiceRecognize, "1"))
+	value, err := open.ApiGetAuthorizerOption(ctx, "appid1", OptionVoiceRecognize)
+	require.Equal(t, nil, err)
+	require.Equal(t, "1", value)
+	_, err = open.ApiGetAuthorizerOption(ctx, "appid2", OptionVoiceRecognize)
+	require.NotEqual(t, nil, err)
+
+	// 分页拉取授权方
+	server.AuthorizeComponent(wxtest.ComponentAuthorizer{Appid: "appid2"})
+	server.AuthorizeComponent(wxtest.ComponentAuthorizer{Appid: "appid3"})
+	list, err := open.ApiGetAuthorizerList(ctx, 1, 1)
+	require.Equal(t, nil, err)
+	require.Equal(t, 3, list.TotalCount)
+	require.Equal(t, 1, len(list.List))
+	require.Equal(t, "appid2", list.List[0].AuthorizerAppid)
+	authorizers, err := open.GetAllAuthorizers(ctx)
+	require.Equal(t, nil, err)
+	require.Equal(t, 3, len(authorizers))
+
+	// 第三方平台的 token 只获取了一次
+	require.Equal(t, 1, server.RequestCount("/cgi-bin/component/api_component_token"))
+}
@@ -0,0 +1,30 @@
+package open
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+// component_verify_ticket 每10分钟推送一次， 有效期12小时
+const componentVerifyTicketTTL = 12 * time.Hour
+
+func componentVerifyTicketKey(componentAppid string) string {
+	return fmt.Sprintf("component-verify-ticket:wxopen:%s", componentAppid)
+}
+
+// SaveComponentVerifyTicket 保存推送的 component_verify_ticket， wxopen/server_api 收到推送时自动调用
+func SaveComponentVerifyTicket(cache utils.Cache, componentAppid, ticket string) error {
+	return cache.Set(componentVerifyTicketKey(componentAppid), ticket, componentVerifyTicketTTL)
+}
+
+// NewCacheVerifyTicketGetter 从缓存读取 SaveComponentVerifyTicket 保存的 ticket， 用于 New
+func NewCacheVerifyTicketGetter(cache utils.Cache) ComponentVerifyTicketGetter {
+	return func(componentAppid string) string {
+		ticket := ""
+		// 读取失败当作还没有收到推送
+		_, _ = cache.Get(componentVerifyTicketKey(componentAppid), &ticket)
+		return ticket
+	}
+}
@@ -27,6 +27,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+
+	"github.com/lixinio/weixin/utils"
 )
 
 /*
@@ -35,10 +37,16 @@ import (
 See: https://developers.weixin.qq.com/doc/offiaccount/Basic_Information/Get_access_token.html
 */
 func (open *Open) refreshAccessTokenFromWXServer() (accessToken string, expiresIn int, err error) {
+	ticket := open.component_verify_ticket_getter(open.Config.ComponentAppid)
+	if ticket == "" {
+		// 还没有收到推送的 ticket
+		err = ErrorVerifyTicketMissing
+		return
+	}
 	params := map[string]string{
 		"component_appid":         open.Config.ComponentAppid,
 		"component_appsecret":     open.Config.ComponentSecret,
-		"component_verify_ticket": open.component_verify_ticket_getter(open.Config.ComponentAppid),
+		"component_verify_ticket": ticket,
 	}
 	payload, err := json.Marshal(params)
 	if err != nil {
@@ -53,9 +61,11 @@ func (open *Open) refreshAccessTokenFromWXServer() (accessToken string, expiresI
 	  "component_verify_ticket": "ticket_value"
 	}
 	*/
-	url := WXServerUrl + "/cgi-bin/component/api_component_token"
+	url := open.Client.ServerUrl() + "/cgi-bin/component/api_component_token"
 
-	response, err := http.Post(url, "application/json;charset=utf-8", bytes.NewReader(payload))
+	response, err := open.Client.HTTPClient().Post(
+		url, "application/json;charset=utf-8", bytes.NewReader(payload),
+	)
 	if err != nil {
 		return
 	}
@@ -92,6 +102,10 @@ func (open *Open) refreshAccessTokenFromWXServer() (accessToken string, expiresI
 	}
 
 	if result.AccessToken == "" {
+		if result.Errcode != 0 {
+			err = utils.NewWeixinError("/cgi-bin/component/api_component_token", int64(result.Errcode), result.Errmsg)
+			return
+		}
 		err = fmt.Errorf("%s", string(resp))
 		return
 	}
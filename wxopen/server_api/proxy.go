@@ -0,0 +1,232 @@
+package server_api
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+	weixin_server_api "github.com/lixinio/weixin/weixin/server_api"
+	"github.com/lixinio/weixin/wxopen/open"
+)
+
+// 全网发布检测
+// See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/Operation/Thirdparty_Platforms_Release.html
+const (
+	releaseTestText          = "TESTCOMPONENT_MSG_TYPE_TEXT"
+	releaseTestQueryAuthCode = "QUERY_AUTH_CODE:"
+	releaseTestTimeout       = 10 * time.Second
+)
+
+// ReleaseTestAppids 全网发布检测使用的专用测试公众号和小程序
+var ReleaseTestAppids = []string{"wx570bc396a51b8ff8", "wxd101a85aa106f53e"}
+
+/*
+MessageProxy 第三方平台代授权方接收消息和事件
+
+消息与事件接收URL 配置为 /$APPID$/callback， 所有授权方的推送都用第三方平台的 Token/EncodingAESKey 加解密，
+每个授权方使用独立的 weixin/server_api.Router， 处理函数里可以用 Router 的 ServerApi 代授权方调用接口
+
+推送必须是加密的并且 msg_signature 正确， 签名不包含路径， 所以只给保存了 refresh_token 的授权方
+(以及全网发布检测的授权方)创建 Router， 取消授权删除 refresh_token 之后自动释放授权方的 Router
+*/
+type MessageProxy struct {
+	Component      *open.Open
+	Token          string // 消息校验Token
+	EncodingAESKey string // 消息加解密Key
+	cache          utils.Cache
+	locker         utils.Lock
+	store          open.RefreshTokenStore
+	opts           []utils.ClientOption
+
+	setup   func(authorizerAppid string, router *weixin_server_api.Router)
+	mutex   sync.Mutex
+	routers map[string]*weixin_server_api.Router
+
+	// AppidFromRequest 从请求中获取授权方 appid， 缺省为路径中 callback 前面的一段
+	AppidFromRequest func(r *http.Request) string
+	// ReleaseTestAppids 自动回复全网发布检测消息的授权方， 缺省为 ReleaseTestAppids
+	ReleaseTestAppids []string
+	// ErrorHandler 全网发布检测用客服消息回复失败， 缺省 log.Printf
+	ErrorHandler func(authorizerAppid string, err error)
+}
+
+// NewMessageProxy setup 在授权方第一次收到推送时调用， 用来注册处理函数
+// cache/locker/store/opts 用于代授权方调用接口， 参考 open.Open.NewOfficialAccount
+func NewMessageProxy(
+	token, encodingAESKey string,
+	cache utils.Cache,
+	locker utils.Lock,
+	store open.RefreshTokenStore,
+	component *open.Open,
+	setup func(authorizerAppid string, router *weixin_server_api.Router),
+	opts ...utils.ClientOption,
+) *MessageProxy {
+	return &MessageProxy{
+		Component:         component,
+		Token:             token,
+		EncodingAESKey:    encodingAESKey,
+		cache:             cache,
+		locker:            locker,
+		store:             store,
+		opts:              opts,
+		setup:             setup,
+		routers:           map[string]*weixin_server_api.Router{},
+		AppidFromRequest:  appidFromPath,
+		ReleaseTestAppids: ReleaseTestAppids,
+		ErrorHandler: func(authorizerAppid string, err error) {
+			log.Printf("wxopen release test for %s err=%v", authorizerAppid, err)
+		},
+	}
+}
+
+// /$APPID$/callback
+func appidFromPath(r *http.Request) string {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) < 2 {
+		return ""
+	}
+	return segments[len(segments)-2]
+}
+
+// Router 授权方的路由， 不存在则创建
+func (proxy *MessageProxy) Router(authorizerAppid string) *weixin_server_api.Router {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	if router, ok := proxy.routers[authorizerAppid]; ok {
+		return router
+	}
+
+	officialAccount := proxy.Component.NewOfficialAccount(
+		proxy.cache, proxy.locker, proxy.store, authorizerAppid, proxy.opts...,
+	)
+	serverApi := weixin_server_api.NewAuthorizerApi(
+		proxy.Token, proxy.EncodingAESKey, proxy.Component.Config.ComponentAppid, officialAccount,
+	)
+	router := weixin_server_api.NewRouter(serverApi)
+	for _, appid := range proxy.ReleaseTestAppids {
+		if appid == authorizerAppid {
+			router.Use(proxy.releaseTest(authorizerAppid, serverApi))
+			break
+		}
+	}
+	if proxy.setup != nil {
+		proxy.setup(authorizerAppid, router)
+	}
+	proxy.routers[authorizerAppid] = router
+	return router
+}
+
+// Remove 删除授权方的路由
+func (proxy *MessageProxy) Remove(authorizerAppid string) {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	delete(proxy.routers, authorizerAppid)
+}
+
+// authorized 是否已经授权， 全网发布检测的授权方在检测过程中才授权
+// 每次推送都检查 refresh_token， 取消授权之后删除授权方的 Router
+func (proxy *MessageProxy) authorized(authorizerAppid string) (bool, error) {
+	for _, appid := range proxy.ReleaseTestAppids {
+		if appid == authorizerAppid {
+			return true, nil
+		}
+	}
+	refreshToken, err := proxy.store.Get(proxy.Component.Config.ComponentAppid, authorizerAppid)
+	if err != nil {
+		return false, err
+	}
+	if refreshToken == "" {
+		proxy.Remove(authorizerAppid)
+		return false, nil
+	}
+	return true, nil
+}
+
+// verifyBody 推送的消息必须加密， 校验 msg_signature 并解密成功之后才交给 Router
+func (proxy *MessageProxy) verifyBody(r *http.Request) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	_, err = decryptXML(r, body, proxy.Token, proxy.EncodingAESKey, proxy.Component.Config.ComponentAppid)
+	if err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+// 全网发布检测， 在其他中间件和处理函数之前执行
+func (proxy *MessageProxy) releaseTest(
+	authorizerAppid string, serverApi *weixin_server_api.ServerApi,
+) weixin_server_api.Middleware {
+	return func(next weixin_server_api.Handler) weixin_server_api.Handler {
+		return func(ctx *weixin_server_api.Context) (interface{}, error) {
+			message, ok := ctx.Content.(weixin_server_api.MessageText)
+			if !ok {
+				return next(ctx)
+			}
+			switch {
+			case message.Content == releaseTestText:
+				// 立即回复 TESTCOMPONENT_MSG_TYPE_TEXT_callback
+				return ctx.ReplyText(releaseTestText + "_callback"), nil
+			case strings.HasPrefix(message.Content, releaseTestQueryAuthCode):
+				// 先回复空串， 再用授权码换取 token， 通过客服消息回复 $query_auth_code$_from_api
+				code := strings.TrimPrefix(message.Content, releaseTestQueryAuthCode)
+				reply := ctx.ReplyText(code + "_from_api")
+				go func() {
+					bgCtx, cancel := context.WithTimeout(context.Background(), releaseTestTimeout)
+					defer cancel()
+					_, err := proxy.Component.QueryAuth(bgCtx, proxy.store, code)
+					if err == nil {
+						err = serverApi.DeliverReply(bgCtx, reply)
+					}
+					if err != nil {
+						proxy.ErrorHandler(authorizerAppid, err)
+					}
+				}()
+				return nil, nil
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// ServeHTTP 校验签名并解密成功后交给授权方的 Router 处理
+func (proxy *MessageProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	authorizerAppid := proxy.AppidFromRequest(r)
+	if authorizerAppid == "" {
+		httpAbort(w, http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	signature := calcSignature(query.Get("timestamp"), query.Get("nonce"), "", proxy.Token)
+	if signature != query.Get("signature") {
+		httpAbort(w, http.StatusBadRequest)
+		return
+	}
+	// 明文消息没有校验内容， 只接受加密的消息
+	if r.Method == http.MethodPost {
+		if err := proxy.verifyBody(r); err != nil {
+			httpAbort(w, http.StatusBadRequest)
+			return
+		}
+	}
+	// 签名不包含路径， 同一个签名可以用在任意 appid 上， 未授权的 appid 不创建 Router， 避免占用内存
+	ok, err := proxy.authorized(authorizerAppid)
+	if err != nil {
+		httpAbort(w, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		httpAbort(w, http.StatusNotFound)
+		return
+	}
+	proxy.Router(authorizerAppid).ServeHTTP(w, r)
+}
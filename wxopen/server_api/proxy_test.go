@@ -0,0 +1,162 @@
+package server_api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	weixin_server_api "github.com/lixinio/weixin/weixin/server_api"
+	"github.com/lixinio/weixin/wxopen/open"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+func textMessage(toUser, content string) weixin_server_api.MessageText {
+	return weixin_server_api.MessageText{
+		Message: weixin_server_api.Message{
+			ToUserName:   toUser,
+			FromUserName: "openid1",
+			CreateTime:   "1348831860",
+			MsgType:      weixin_server_api.MsgTypeText,
+		},
+		Content: content,
+		MsgId:   "1234567890123456",
+	}
+}
+
+func TestMessageProxy(t *testing.T) {
+	server := wxtest.NewServer()
+	defer server.Close()
+	server.AddComponent(testComponentAppid, "component_secret")
+	server.AddOfficialAccountUser(wxtest.OfficialAccountUser{OpenID: "openid1"})
+
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	component := open.New(cache, cache, &open.Config{
+		ComponentAppid:  testComponentAppid,
+		ComponentSecret: "component_secret",
+	}, server.ComponentVerifyTicket, utils.WithServerUrl(server.URL))
+
+	store := open.NewCacheRefreshTokenStore(cache)
+	_, err := component.QueryAuth(
+		context.Background(), store, server.AuthorizeComponent(wxtest.ComponentAuthorizer{Appid: "appid1"}),
+	)
+	require.Equal(t, nil, err)
+
+	var appids []string
+	proxy := NewMessageProxy(
+		fixture.Token, fixture.EncodingAESKey, cache, cache, store, component,
+		func(authorizerAppid string, router *weixin_server_api.Router) {
+			appids = append(appids, authorizerAppid)
+			router.OnText(func(ctx *weixin_server_api.Context, message weixin_server_api.MessageText) (interface{}, error) {
+				return ctx.ReplyText(authorizerAppid + " " + message.Content), nil
+			})
+		},
+		utils.WithServerUrl(server.URL),
+	)
+	errs := make(chan error, 1)
+	proxy.ErrorHandler = func(authorizerAppid string, err error) {
+		errs <- err
+	}
+	ts := httptest.NewServer(proxy)
+	defer ts.Close()
+
+	// 用第三方平台的 Token/EncodingAESKey 加解密
+	callback := wxtest.NewOfficialAccountCallback(fixture.Token, fixture.EncodingAESKey, testComponentAppid)
+	reply, err := callback.Send(ts.URL+"/appid1/callback", textMessage("gh_1", "hello"))
+	require.Equal(t, nil, err)
+	require.Equal(t, testComponentAppid, reply.AppId)
+	text := weixin_server_api.ReplyMessageText{}
+	require.Equal(t, nil, reply.Unmarshal(&text))
+	require.Equal(t, "appid1 hello", string(text.Content))
+	_, err = callback.Send(ts.URL+"/appid1/callback", textMessage("gh_1", "again"))
+	require.Equal(t, nil, err)
+	require.Equal(t, []string{"appid1"}, appids)
+
+	// 签名错误或者没有 appid
+	invalid := wxtest.NewOfficialAccountCallback("invalid", fixture.EncodingAESKey, testComponentAppid)
+	reply, err = invalid.Send(ts.URL+"/appid2/callback", textMessage("gh_2", "hello"))
+	require.NotEqual(t, nil, err)
+	require.Equal(t, http.StatusBadRequest, reply.StatusCode)
+	reply, err = callback.Send(ts.URL+"/callback", textMessage("gh_2", "hello"))
+	require.NotEqual(t, nil, err)
+	require.Equal(t, http.StatusNotFound, reply.StatusCode)
+	require.Equal(t, []string{"appid1"}, appids)
+
+	// 签名不包含路径， 未授权的 appid 不创建 Router
+	for _, appid := range []string{"appid2", "appid3"} {
+		reply, err = callback.Send(ts.URL+"/"+appid+"/callback", textMessage("gh_2", "hello"))
+		require.NotEqual(t, nil, err)
+		require.Equal(t, http.StatusNotFound, reply.StatusCode)
+	}
+	require.Equal(t, []string{"appid1"}, appids)
+	require.Equal(t, 1, len(proxy.routers))
+
+	// 明文消息和不是发给这个第三方平台的消息， 即使 signature 正确也不处理
+	for _, c := range []*wxtest.Callback{
+		wxtest.NewOfficialAccountCallback(fixture.Token, "", testComponentAppid),
+		wxtest.NewOfficialAccountCallback(fixture.Token, fixture.EncodingAESKey, "other_appid"),
+	} {
+		reply, err = c.Send(ts.URL+"/"+ReleaseTestAppids[0]+"/callback", textMessage("gh_1", "QUERY_AUTH_CODE:code"))
+		require.NotEqual(t, nil, err)
+		require.Equal(t, http.StatusBadRequest, reply.StatusCode)
+	}
+	require.Equal(t, []string{"appid1"}, appids)
+
+	// 全网发布检测： 文本消息
+	testAppid := ReleaseTestAppids[0]
+	target := ts.URL + "/" + testAppid + "/callback"
+	reply, err = callback.Send(target, textMessage("gh_3c884a361561", "TESTCOMPONENT_MSG_TYPE_TEXT"))
+	require.Equal(t, nil, err)
+	require.Equal(t, nil, reply.Unmarshal(&text))
+	require.Equal(t, "TESTCOMPONENT_MSG_TYPE_TEXT_callback", string(text.Content))
+	require.Equal(t, "openid1", string(text.ToUserName))
+
+	// 全网发布检测： 先回复空串， 再用授权码换取 token 发送客服消息
+	code := server.AuthorizeComponent(wxtest.ComponentAuthorizer{Appid: testAppid})
+	reply, err = callback.Send(target, textMessage("gh_3c884a361561", "QUERY_AUTH_CODE:"+code))
+	require.Equal(t, nil, err)
+	require.Equal(t, 0, len(reply.XML))
+	require.Eventually(t, func() bool {
+		return len(server.OfficialAccountMessages()) == 1
+	}, time.Second, 10*time.Millisecond)
+	message := struct {
+		ToUser string `json:"touser"`
+		Text   struct {
+			Content string `json:"content"`
+		} `json:"text"`
+	}{}
+	require.Equal(t, nil, json.Unmarshal(server.OfficialAccountMessages()[0], &message))
+	require.Equal(t, "openid1", message.ToUser)
+	require.Equal(t, code+"_from_api", message.Text.Content)
+
+	// 授权码只能用一次
+	_, err = callback.Send(target, textMessage("gh_3c884a361561", "QUERY_AUTH_CODE:"+code))
+	require.Equal(t, nil, err)
+	select {
+	case err = <-errs:
+		require.NotEqual(t, nil, err)
+	case <-time.After(time.Second):
+		t.Fatal("release test error not reported")
+	}
+
+	// 其他授权方不处理检测消息
+	reply, err = callback.Send(ts.URL+"/appid1/callback", textMessage("gh_1", "TESTCOMPONENT_MSG_TYPE_TEXT"))
+	require.Equal(t, nil, err)
+	require.Equal(t, nil, reply.Unmarshal(&text))
+	require.Equal(t, "appid1 TESTCOMPONENT_MSG_TYPE_TEXT", string(text.Content))
+
+	// 取消授权删除 refresh_token 之后不再处理， 并删除 Router
+	require.Equal(t, nil, store.Delete(testComponentAppid, "appid1"))
+	reply, err = callback.Send(ts.URL+"/appid1/callback", textMessage("gh_1", "hello"))
+	require.NotEqual(t, nil, err)
+	require.Equal(t, http.StatusNotFound, reply.StatusCode)
+	_, ok := proxy.routers["appid1"]
+	require.False(t, ok)
+}
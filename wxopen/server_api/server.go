@@ -1,54 +1,82 @@
 package server_api
 
-// https://github.com/fastwego/wxopen/blob/master/server.go
-
-// Copyright 2020 FastWeGo
-//
-// Licensed under the Apache License, Version 2.0 (the "License");
-// you may not use this file except in compliance with the License.
-// You may obtain a copy of the License at
-//
-//      http://www.apache.org/licenses/LICENSE-2.0
-//
-// Unless required by applicable law or agreed to in writing, software
-// distributed under the License is distributed on an "AS IS" BASIS,
-// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-// See the License for the specific language governing permissions and
-// limitations under the License.
+/*
+第三方平台 授权事件接收URL
+
+See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/authorize_event.html
+*/
 
 import (
 	"crypto/sha1"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/lixinio/weixin/utils"
-	"github.com/lixinio/weixin/weixin/official_account"
+	"github.com/lixinio/weixin/wxopen/open"
 )
 
+// 授权码一小时内有效， 换取的授权信息保存同样的时长， 供微信服务器重试推送时使用
+const authorizationInfoTTL = time.Hour
+
+var (
+	ErrorInvalidSignature = errors.New("invalid msg_signature")
+	ErrorInvalidAppid     = errors.New("appid mismatch")
+)
+
+// Context 一次推送的上下文
+type Context struct {
+	Request *http.Request
+	Body    []byte      // 解密之后的xml
+	Event   Event       // 公共字段
+	Content interface{} // ParseXML 的结果， 比如 EventAuthorized， 未知类型为 nil
+
+	// 设置了 RefreshTokenStore 时， 授权成功/更新授权 自动换取的授权信息
+	AuthorizationInfo *open.AuthorizationInfo
+}
+
+// Handler 处理授权事件， 返回错误时回复500， 微信服务器会重试
+type Handler func(ctx *Context) error
+
 type ServerApi struct {
-	*utils.Client
-	OAConfig       *official_account.Config
-	Token          string
-	EncodingAESKey string
+	Component      *open.Open
+	Token          string // 消息校验Token
+	EncodingAESKey string // 消息加解密Key
+	cache          utils.Cache
+
+	// 不为空时， 授权成功/更新授权 自动用授权码换取并保存 authorizer_refresh_token， 取消授权时删除
+	// 授权码只能使用一次， 这时不要再在授权回调页里调用 QueryAuth
+	RefreshTokenStore open.RefreshTokenStore
+
+	handlers       map[string]Handler // InfoType
+	defaultHandler Handler
+
+	// ErrorHandler 处理失败， 缺省返回500
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
 }
 
-func NewOfficialAccountApi(token, encodingAESKey string, officialAccount *official_account.OfficialAccount) *ServerApi {
+// NewComponentApi 推送的 component_verify_ticket 自动保存到 cache， 用 open.NewCacheVerifyTicketGetter(cache) 读取
+func NewComponentApi(token, encodingAESKey string, cache utils.Cache, component *open.Open) *ServerApi {
 	return &ServerApi{
-		Client:         officialAccount.Client,
-		OAConfig:       officialAccount.Config,
+		Component:      component,
 		Token:          token,
 		EncodingAESKey: encodingAESKey,
+		cache:          cache,
+		handlers:       map[string]Handler{},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		},
 	}
 }
 
-func calcSignature(timestamp, nonce, token string) string {
-	strs := []string{timestamp, nonce, token}
+func calcSignature(timestamp, nonce, encrypt, token string) string {
+	strs := []string{timestamp, nonce, token, encrypt}
 	sort.Strings(strs)
 
 	h := sha1.New()
@@ -56,486 +84,236 @@ func calcSignature(timestamp, nonce, token string) string {
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
-func calcSignatureFromHttp(r *http.Request, token string) string {
-	return calcSignature(
-		r.URL.Query().Get("timestamp"),
-		r.URL.Query().Get("nonce"),
-		token,
-	)
+func httpAbort(w http.ResponseWriter, code int) {
+	w.WriteHeader(code)
+	io.WriteString(w, http.StatusText(code))
 }
 
-func httpAbort(w http.ResponseWriter, code int) {
-	w.WriteHeader(http.StatusBadRequest)
-	io.WriteString(w, http.StatusText(http.StatusBadRequest))
+// Handle 按 InfoType 注册， 比如 InfoTypeAuthorized
+func (s *ServerApi) Handle(infoType string, handler Handler) {
+	s.handlers[infoType] = handler
 }
 
-func (s *ServerApi) ServeEcho(w http.ResponseWriter, r *http.Request) {
-	signature := calcSignatureFromHttp(r, s.Token)
-	echoStr := r.URL.Query().Get("echostr")
-	if echoStr != "" && signature == r.URL.Query().Get("signature") {
-		io.WriteString(w, echoStr)
-	} else {
-		httpAbort(w, http.StatusBadRequest)
-	}
+// Default 没有匹配时的处理函数， 未设置则回复 success
+func (s *ServerApi) Default(handler Handler) {
+	s.defaultHandler = handler
 }
 
-func (s *ServerApi) ServeData(w http.ResponseWriter, r *http.Request, processor http.HandlerFunc) {
-	signature := calcSignatureFromHttp(r, s.Token)
-	if signature == r.URL.Query().Get("signature") {
-		processor(w, r)
-	} else {
-		httpAbort(w, http.StatusBadRequest)
-	}
+// OnComponentVerifyTicket 验证票据， ticket 已经自动保存
+func (s *ServerApi) OnComponentVerifyTicket(handler func(ctx *Context, event EventComponentVerifyTicket) error) {
+	s.Handle(InfoTypeComponentVerifyTicket, func(ctx *Context) error {
+		return handler(ctx, ctx.Content.(EventComponentVerifyTicket))
+	})
 }
 
-// ParseXML 解析微信推送过来的消息/事件
-func (s *ServerApi) ParseXML(body []byte) (m interface{}, err error) {
+// OnAuthorized 授权成功
+func (s *ServerApi) OnAuthorized(handler func(ctx *Context, event EventAuthorized) error) {
+	s.Handle(InfoTypeAuthorized, func(ctx *Context) error {
+		return handler(ctx, ctx.Content.(EventAuthorized))
+	})
+}
+
+// OnUpdateAuthorized 更新授权(权限集变化)
+func (s *ServerApi) OnUpdateAuthorized(handler func(ctx *Context, event EventUpdateAuthorized) error) {
+	s.Handle(InfoTypeUpdateAuthorized, func(ctx *Context) error {
+		return handler(ctx, ctx.Content.(EventUpdateAuthorized))
+	})
+}
+
+// OnUnauthorized 取消授权
+func (s *ServerApi) OnUnauthorized(handler func(ctx *Context, event EventUnauthorized) error) {
+	s.Handle(InfoTypeUnauthorized, func(ctx *Context) error {
+		return handler(ctx, ctx.Content.(EventUnauthorized))
+	})
+}
 
-	// 是否加密消息
+// OnFastRegister 快速注册小程序
+func (s *ServerApi) OnFastRegister(handler func(ctx *Context, event EventFastRegister) error) {
+	s.Handle(InfoTypeFastRegister, func(ctx *Context) error {
+		return handler(ctx, ctx.Content.(EventFastRegister))
+	})
+}
+
+/*
+DecryptXML 校验签名并解密， 返回明文xml
+
+POST /component/callback?signature=SIGNATURE&timestamp=TIMESTAMP&nonce=NONCE&encrypt_type=aes&msg_signature=MSG_SIGNATURE
+
+<xml>
+  <AppId><![CDATA[]]></AppId>
+  <Encrypt><![CDATA[]]></Encrypt>
+</xml>
+*/
+func (s *ServerApi) DecryptXML(r *http.Request, body []byte) (xmlMsg []byte, err error) {
+	return decryptXML(r, body, s.Token, s.EncodingAESKey, s.Component.Config.ComponentAppid)
+}
+
+// decryptXML 第三方平台收到的推送总是加密的， 校验 msg_signature 并确认是发给 componentAppid 的
+func decryptXML(r *http.Request, body []byte, token, encodingAESKey, componentAppid string) (xmlMsg []byte, err error) {
 	encryptMsg := EncryptMessage{}
 	err = xml.Unmarshal(body, &encryptMsg)
 	if err != nil {
 		return
 	}
 
-	// 需要解密
-	if encryptMsg.Encrypt != "" {
-		var xmlMsg []byte
-		_, xmlMsg, _, err = utils.AESDecryptMsg(encryptMsg.Encrypt, s.EncodingAESKey)
-		if err != nil {
-			return
-		}
-		body = xmlMsg
-
+	signature := calcSignature(
+		r.URL.Query().Get("timestamp"),
+		r.URL.Query().Get("nonce"),
+		encryptMsg.Encrypt,
+		token,
+	)
+	if encryptMsg.Encrypt == "" || signature != r.URL.Query().Get("msg_signature") {
+		return nil, ErrorInvalidSignature
 	}
 
-	message := Message{}
-	err = xml.Unmarshal(body, &message)
-	//fmt.Println(message)
+	var appid []byte
+	_, xmlMsg, appid, err = utils.AESDecryptMsg(encryptMsg.Encrypt, encodingAESKey)
 	if err != nil {
 		return
 	}
-
-	switch message.MsgType {
-	case MsgTypeText:
-		msg := MessageText{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case MsgTypeImage:
-		msg := MessageImage{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case MsgTypeVoice:
-		msg := MessageVoice{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case MsgTypeVideo:
-		msg := MessageVideo{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case MsgTypeShortVideo:
-		msg := MessageShortVideo{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case MsgTypeLocation:
-		msg := MessageLocation{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case MsgTypeLink:
-		msg := MessageLink{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case MsgTypeFile:
-		msg := MessageFile{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case MsgTypeEvent:
-		return parseEvent(body)
+	if string(appid) != componentAppid {
+		return nil, ErrorInvalidAppid
 	}
 	return
 }
 
-// parseEvent 解析微信推送过来的事件
-func parseEvent(body []byte) (m interface{}, err error) {
+// ParseXML 解析解密之后的授权事件， 未知类型返回 nil
+func (s *ServerApi) ParseXML(body []byte) (m interface{}, err error) {
 	event := Event{}
 	err = xml.Unmarshal(body, &event)
 	if err != nil {
 		return
 	}
-	switch event.Event {
 
-	// 关注事件
-	case EventTypeSubscribe:
-		msg := EventSubscribe{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeUnsubscribe:
-		msg := EventUnsubscribe{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeScan:
-		msg := EventScan{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeLocation:
-		msg := EventLocation{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-
-	// 菜单事件
-	case EventTypeMenuClick:
-		msg := EventMenuClick{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeMenuView:
-		msg := EventMenuView{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeMenuScanCodePush:
-		msg := EventMenuScanCodePush{}
+	switch event.InfoType {
+	case InfoTypeComponentVerifyTicket:
+		msg := EventComponentVerifyTicket{}
 		err = xml.Unmarshal(body, &msg)
 		if err != nil {
 			return
 		}
 		return msg, nil
-	case EventTypeMenuScanCodeWaitMsg:
-		msg := EventMenuScanCodeWaitMsg{}
+	case InfoTypeAuthorized:
+		msg := EventAuthorized{}
 		err = xml.Unmarshal(body, &msg)
 		if err != nil {
 			return
 		}
 		return msg, nil
-	case EventTypeMenuPicSysPhoto:
-		msg := EventMenuPicSysPhoto{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeMenuPicSysPhotoOrAlbum:
-		msg := EventMenuPicSysPhotoOrAlbum{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeMenuPicWeixin:
-		msg := EventMenuPicWeixin{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeMenuLocationSelect:
-		msg := EventMenuLocationSelect{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeMenuViewMiniprogram:
-		msg := EventMenuViewMiniprogram{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-
-	// 资质事件
-	case EventTypeQualificationVerifySuccess:
-		msg := EventQualificationVerifySuccess{}
+	case InfoTypeUpdateAuthorized:
+		msg := EventUpdateAuthorized{}
 		err = xml.Unmarshal(body, &msg)
 		if err != nil {
 			return
 		}
 		return msg, nil
-	case EventTypeQualificationVerifyFail:
-		msg := EventQualificationVerifyFail{}
+	case InfoTypeUnauthorized:
+		msg := EventUnauthorized{}
 		err = xml.Unmarshal(body, &msg)
 		if err != nil {
 			return
 		}
 		return msg, nil
-	case EventTypeNamingVerifySuccess:
-		msg := EventNamingVerifySuccess{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeNamingVerifyFail:
-		msg := EventNamingVerifyFail{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeAnnualRenew:
-		msg := EventAnnualRenew{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeVerifyExpired:
-		msg := EventVerifyExpired{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-
-		// 卡券事件
-	case EventTypeCardPassChecke:
-		msg := EventCardPassChecke{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeCardNotPassChecke:
-		msg := EventCardNotPassChecke{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeUserGetCard:
-		msg := EventUserGetCard{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeUserGiftingCard:
-		msg := EventUserGiftingCard{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeUserDelCard:
-		msg := EventUserDelCard{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeUserConsumeCard:
-		msg := EventUserConsumeCard{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeUserPayFromPayCell:
-		msg := EventUserPayFromPayCell{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeUserViewCard:
-		msg := EventUserViewCard{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeUserEnterSessionFromCard:
-		msg := EventUserEnterSessionFromCard{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeUpdateMemberCard:
-		msg := EventUpdateMemberCard{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeCardSkuRemind:
-		msg := EventCardSkuRemind{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeCardPayOrder:
-		msg := EventCardPayOrder{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-	case EventTypeSubmitMembercardUserInfo:
-		msg := EventSubmitMembercardUserInfo{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-
-		// 导购事件
-	case EventTypeGuideQrcodeScan:
-		msg := EventGuideQrcodeScan{}
-		err = xml.Unmarshal(body, &msg)
-		if err != nil {
-			return
-		}
-		return msg, nil
-
-		// 模版消息发送任务完成
-	case EventTypeTemplateSendJobFinish:
-		msg := EventTemplateSendJobFinish{}
+	case InfoTypeFastRegister:
+		msg := EventFastRegister{}
 		err = xml.Unmarshal(body, &msg)
 		if err != nil {
 			return
 		}
 		return msg, nil
 	}
-
 	return
 }
 
-// Response 响应微信消息 (自动判断是否要加密)
-func (s *ServerApi) response(w http.ResponseWriter, r *http.Request, reply interface{}) (err error) {
-
-	// 如果 开启加密，微信服务器 发过来的请求 带有 如下参数
-	//signature=c44d29564aa1d57bd0e274c37baa92bd5b3da5bd
-	//&timestamp=1596184957
-	//&nonce=1250398014
-	//&openid=oEnxesxpxWw-PKkz-vW5IMdfcQaE
-	//&encrypt_type=aes
-	//&msg_signature=cc24cc38467417603fc3689170e8b0fd3c9bf4a2
-
-	output := []byte("success") // 默认回复
-	if reply != nil {
-		output, err = xml.Marshal(reply)
-		if err != nil {
-			return
+// 保存 ticket / refresh_token， 在处理函数之前执行
+func (s *ServerApi) preprocess(ctx *Context) (err error) {
+	componentAppid := s.Component.Config.ComponentAppid
+	switch content := ctx.Content.(type) {
+	case EventComponentVerifyTicket:
+		return open.SaveComponentVerifyTicket(s.cache, componentAppid, content.ComponentVerifyTicket)
+	case EventAuthorized:
+		if s.RefreshTokenStore != nil {
+			ctx.AuthorizationInfo, err = s.queryAuth(ctx, content.AuthorizationCode)
+		}
+	case EventUpdateAuthorized:
+		if s.RefreshTokenStore != nil {
+			ctx.AuthorizationInfo, err = s.queryAuth(ctx, content.AuthorizationCode)
 		}
-		fmt.Println(string(output))
-
-		// 加密
-		if r.URL.Query().Get("encrypt_type") == "aes" {
-			var message *ReplyEncryptMessage
-			message, err = s.encryptReplyMessage(output)
-			if err != nil {
-				return
-			}
-			output, err = xml.Marshal(message)
-			if err != nil {
-				return
-			}
+	case EventUnauthorized:
+		if s.RefreshTokenStore != nil {
+			err = s.RefreshTokenStore.Delete(componentAppid, content.AuthorizerAppid)
 		}
 	}
-
-	_, err = w.Write(output)
-
 	return
 }
 
-// encryptReplyMessage 加密回复消息
-func (s *ServerApi) encryptReplyMessage(rawXmlMsg []byte) (*ReplyEncryptMessage, error) {
-	cipherText, err := utils.AESEncryptMsg([]byte(utils.GetRandString(16)), rawXmlMsg, s.OAConfig.Appid, s.EncodingAESKey)
+// queryAuth 用授权码换取授权信息， 授权码只能使用一次
+// 处理函数失败时微信服务器会重试推送， 这时使用第一次换取的授权信息
+func (s *ServerApi) queryAuth(ctx *Context, authorizationCode string) (*open.AuthorizationInfo, error) {
+	key := fmt.Sprintf(
+		"authorization-info:wxopen:%s:%s", s.Component.Config.ComponentAppid, authorizationCode,
+	)
+	info := &open.AuthorizationInfo{}
+	if found, err := s.cache.Get(key, info); err != nil {
+		return nil, err
+	} else if found {
+		return info, nil
+	}
+
+	info, err := s.Component.QueryAuth(ctx.Request.Context(), s.RefreshTokenStore, authorizationCode)
 	if err != nil {
 		return nil, err
 	}
-	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
-	nonce := utils.GetRandString(6)
-
-	strs := []string{
-		timestamp,
-		nonce,
-		s.Token,
-		cipherText,
+	if err = s.cache.Set(key, info, authorizationInfoTTL); err != nil {
+		return nil, err
 	}
-	sort.Strings(strs)
-	h := sha1.New()
-	_, _ = io.WriteString(h, strings.Join(strs, ""))
-	signature := fmt.Sprintf("%x", h.Sum(nil))
-
-	return &ReplyEncryptMessage{
-		Encrypt:      cipherText,
-		MsgSignature: signature,
-		TimeStamp:    timestamp,
-		Nonce:        nonce,
-	}, nil
+	return info, nil
 }
 
-func (s *ServerApi) ResponseText(w http.ResponseWriter, r *http.Request, message *ReplyMessageText) (err error) {
-	return s.response(w, r, message)
-}
-
-func (s *ServerApi) ResponseImage(w http.ResponseWriter, r *http.Request, message *ReplyMessageImage) (err error) {
-	return s.response(w, r, message)
-}
-
-func (s *ServerApi) ResponseVoice(w http.ResponseWriter, r *http.Request, message *ReplyMessageVoice) (err error) {
-	return s.response(w, r, message)
-}
-
-func (s *ServerApi) ResponseVideo(w http.ResponseWriter, r *http.Request, message *ReplyMessageVideo) (err error) {
-	return s.response(w, r, message)
+// Dispatch 调用 InfoType 对应的处理函数
+func (s *ServerApi) Dispatch(ctx *Context) error {
+	if err := s.preprocess(ctx); err != nil {
+		return err
+	}
+	if handler, ok := s.handlers[ctx.Event.InfoType]; ok {
+		return handler(ctx)
+	}
+	if s.defaultHandler != nil {
+		return s.defaultHandler(ctx)
+	}
+	return nil
 }
 
-func (s *ServerApi) ResponseMusic(w http.ResponseWriter, r *http.Request, message *ReplyMessageMusic) (err error) {
-	return s.response(w, r, message)
-}
+// ServeHTTP 接收授权事件， 处理成功回复 success
+func (s *ServerApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpAbort(w, http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpAbort(w, http.StatusBadRequest)
+		return
+	}
+	body, err = s.DecryptXML(r, body)
+	if err != nil {
+		httpAbort(w, http.StatusBadRequest)
+		return
+	}
 
-func (s *ServerApi) ResponseNews(w http.ResponseWriter, r *http.Request, message *ReplyMessageNews) (err error) {
-	return s.response(w, r, message)
-}
+	ctx := &Context{Request: r, Body: body}
+	if err = xml.Unmarshal(body, &ctx.Event); err != nil {
+		httpAbort(w, http.StatusBadRequest)
+		return
+	}
+	if ctx.Content, err = s.ParseXML(body); err != nil {
+		httpAbort(w, http.StatusBadRequest)
+		return
+	}
 
-func (s *ServerApi) ResponseTransferCustomerService(
-	w http.ResponseWriter,
-	r *http.Request,
-	message *ReplyMessageTransferCustomerService,
-) (err error) {
-	return s.response(w, r, message)
+	if err = s.Dispatch(ctx); err != nil {
+		s.ErrorHandler(w, r, err)
+		return
+	}
+	_, _ = io.WriteString(w, "success")
 }
@@ -0,0 +1,144 @@
+package server_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/wxopen/open"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/stretchr/testify/require"
+)
+
+const testComponentAppid = "component_appid"
+
+func testInfo(infoType, fields string) string {
+	return fmt.Sprintf(`<xml>
+		<AppId><![CDATA[%s]]></AppId>
+		<CreateTime>1413192605</CreateTime>
+		<InfoType><![CDATA[%s]]></InfoType>
+		%s
+	</xml>`, testComponentAppid, infoType, fields)
+}
+
+func TestComponentServer(t *testing.T) {
+	server := wxtest.NewServer()
+	defer server.Close()
+	server.AddComponent(testComponentAppid, "component_secret")
+
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	component := open.New(cache, cache, &open.Config{
+		ComponentAppid:  testComponentAppid,
+		ComponentSecret: "component_secret",
+	}, open.NewCacheVerifyTicketGetter(cache), utils.WithServerUrl(server.URL))
+	store := open.NewCacheRefreshTokenStore(cache)
+	serverApi := NewComponentApi(fixture.Token, fixture.EncodingAESKey, cache, component)
+	serverApi.RefreshTokenStore = store
+	callback := wxtest.NewComponentCallback(fixture.Token, fixture.EncodingAESKey, testComponentAppid)
+	ctx := context.Background()
+
+	var calls []string
+	serverApi.OnComponentVerifyTicket(func(ctx *Context, event EventComponentVerifyTicket) error {
+		calls = append(calls, "ticket")
+		return nil
+	})
+	authorizedFailed := false
+	serverApi.OnAuthorized(func(ctx *Context, event EventAuthorized) error {
+		require.Equal(t, "appid1", ctx.AuthorizationInfo.AuthorizerAppid)
+		if !authorizedFailed {
+			// 第一次处理失败， 微信服务器重试
+			authorizedFailed = true
+			return errors.New("failed")
+		}
+		calls = append(calls, "authorized:"+event.AuthorizerAppid)
+		return nil
+	})
+	serverApi.OnUnauthorized(func(ctx *Context, event EventUnauthorized) error {
+		calls = append(calls, "unauthorized:"+event.AuthorizerAppid)
+		return nil
+	})
+	serverApi.OnFastRegister(func(ctx *Context, event EventFastRegister) error {
+		calls = append(calls, fmt.Sprintf("fastregister:%s:%d:%s", event.Appid, event.Status, event.Info.Name))
+		return errors.New("failed")
+	})
+
+	// 还没有收到 ticket
+	_, _, err := component.CreatePreauthCode(ctx)
+	require.True(t, errors.Is(err, open.ErrorVerifyTicketMissing))
+
+	// 推送 ticket 之后可以获取 component_access_token
+	reply, err := callback.Invoke(serverApi, testInfo(InfoTypeComponentVerifyTicket, fmt.Sprintf(
+		"<ComponentVerifyTicket>%s</ComponentVerifyTicket>", server.ComponentVerifyTicket(testComponentAppid),
+	)))
+	require.Equal(t, nil, err)
+	require.Equal(t, "success", string(reply.Body))
+	_, _, err = component.CreatePreauthCode(ctx)
+	require.Equal(t, nil, err)
+
+	// 签名错误或者不是发给这个第三方平台的
+	for _, c := range []*wxtest.Callback{
+		wxtest.NewComponentCallback("invalid", fixture.EncodingAESKey, testComponentAppid),
+		wxtest.NewComponentCallback(fixture.Token, fixture.EncodingAESKey, "other_appid"),
+	} {
+		reply, err = c.Invoke(serverApi, testInfo(InfoTypeComponentVerifyTicket, ""))
+		require.NotEqual(t, nil, err)
+		require.Equal(t, http.StatusBadRequest, reply.StatusCode)
+	}
+
+	// 授权成功后自动保存 refresh_token
+	// 处理函数失败后重试， 不再用已经使用过的授权码换取授权信息
+	code := server.AuthorizeComponent(wxtest.ComponentAuthorizer{Appid: "appid1"})
+	authorized := testInfo(InfoTypeAuthorized, fmt.Sprintf(`
+		<AuthorizerAppid>appid1</AuthorizerAppid>
+		<AuthorizationCode>%s</AuthorizationCode>
+		<AuthorizationCodeExpiredTime>1413196360</AuthorizationCodeExpiredTime>
+		<PreAuthCode>preauthcode</PreAuthCode>`, code,
+	))
+	reply, err = callback.Invoke(serverApi, authorized)
+	require.NotEqual(t, nil, err)
+	require.Equal(t, http.StatusInternalServerError, reply.StatusCode)
+	_, err = callback.Invoke(serverApi, authorized)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, server.RequestCount("/cgi-bin/component/api_query_auth"))
+	refreshToken, err := store.Get(testComponentAppid, "appid1")
+	require.Equal(t, nil, err)
+	require.NotEqual(t, "", refreshToken)
+
+	// 取消授权后删除 refresh_token
+	_, err = callback.Invoke(serverApi, testInfo(InfoTypeUnauthorized, "<AuthorizerAppid>appid1</AuthorizerAppid>"))
+	require.Equal(t, nil, err)
+	refreshToken, err = store.Get(testComponentAppid, "appid1")
+	require.Equal(t, nil, err)
+	require.Equal(t, "", refreshToken)
+
+	// 处理失败返回500， 微信服务器会重试
+	reply, err = callback.Invoke(serverApi, testInfo(InfoTypeFastRegister, `
+		<appid>wxappid</appid>
+		<status>0</status>
+		<auth_code>auth_code</auth_code>
+		<msg>OK</msg>
+		<info><name><![CDATA[公司名称]]></name><code_type>1</code_type></info>`,
+	))
+	require.NotEqual(t, nil, err)
+	require.Equal(t, http.StatusInternalServerError, reply.StatusCode)
+
+	// 授权码无效， 换取授权信息失败
+	_, err = callback.Invoke(serverApi, testInfo(InfoTypeUpdateAuthorized, "<AuthorizerAppid>appid2</AuthorizerAppid>"))
+	require.NotEqual(t, nil, err)
+
+	// 没有 RefreshTokenStore 也没有注册处理函数， 回复 success
+	serverApi.RefreshTokenStore = nil
+	reply, err = callback.Invoke(serverApi, testInfo(InfoTypeUpdateAuthorized, "<AuthorizerAppid>appid2</AuthorizerAppid>"))
+	require.Equal(t, nil, err)
+	require.Equal(t, "success", string(reply.Body))
+
+	require.Equal(t, []string{
+		"ticket", "authorized:appid1", "unauthorized:appid1", "fastregister:wxappid:0:公司名称",
+	}, calls)
+}
@@ -0,0 +1,124 @@
+package server_api
+
+import "encoding/xml"
+
+// 授权事件类型
+// See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/api/authorize_event.html
+const (
+	InfoTypeComponentVerifyTicket = "component_verify_ticket"    // 验证票据
+	InfoTypeAuthorized            = "authorized"                 // 授权成功
+	InfoTypeUpdateAuthorized      = "updateauthorized"           // 更新授权
+	InfoTypeUnauthorized          = "unauthorized"               // 取消授权
+	InfoTypeFastRegister          = "notify_third_fasteregister" // 快速注册小程序
+)
+
+/*
+授权事件接收URL 收到的消息格式， 总是加密
+<xml>
+  <AppId><![CDATA[]]></AppId>
+  <Encrypt><![CDATA[]]></Encrypt>
+</xml>
+*/
+type EncryptMessage struct {
+	XMLName xml.Name `xml:"xml"`
+	AppId   string
+	Encrypt string
+}
+
+// Event 授权事件的公共字段， AppId 为第三方平台 appid
+type Event struct {
+	XMLName    xml.Name `xml:"xml"`
+	AppId      string
+	CreateTime string
+	InfoType   string
+}
+
+/*
+验证票据， 每10分钟推送一次
+<xml>
+  <AppId>some_appid</AppId>
+  <CreateTime>1413192605</CreateTime>
+  <InfoType>component_verify_ticket</InfoType>
+  <ComponentVerifyTicket>some_verify_ticket</ComponentVerifyTicket>
+</xml>
+*/
+type EventComponentVerifyTicket struct {
+	Event
+	ComponentVerifyTicket string
+}
+
+/*
+授权成功
+<xml>
+  <AppId>第三方平台appid</AppId>
+  <CreateTime>1413192760</CreateTime>
+  <InfoType>authorized</InfoType>
+  <AuthorizerAppid>公众号appid</AuthorizerAppid>
+  <AuthorizationCode>授权码</AuthorizationCode>
+  <AuthorizationCodeExpiredTime>过期时间</AuthorizationCodeExpiredTime>
+  <PreAuthCode>预授权码</PreAuthCode>
+</xml>
+*/
+type EventAuthorized struct {
+	Event
+	AuthorizerAppid              string
+	AuthorizationCode            string
+	AuthorizationCodeExpiredTime string
+	PreAuthCode                  string
+}
+
+// EventUpdateAuthorized 更新授权， 字段同 EventAuthorized
+type EventUpdateAuthorized EventAuthorized
+
+/*
+取消授权
+<xml>
+  <AppId>第三方平台appid</AppId>
+  <CreateTime>1413192760</CreateTime>
+  <InfoType>unauthorized</InfoType>
+  <AuthorizerAppid>公众号appid</AuthorizerAppid>
+</xml>
+*/
+type EventUnauthorized struct {
+	Event
+	AuthorizerAppid string
+}
+
+/*
+快速注册小程序
+
+See: https://developers.weixin.qq.com/doc/oplatform/Third-party_Platforms/Mini_Programs/Fast_Registration_Interface_document.html
+
+<xml>
+  <AppId><![CDATA[第三方平台appid]]></AppId>
+  <CreateTime>1535442403</CreateTime>
+  <InfoType><![CDATA[notify_third_fasteregister]]></InfoType>
+  <appid>创建小程序appid</appid>
+  <status>0</status>
+  <auth_code>第三方授权码</auth_code>
+  <msg>OK</msg>
+  <info>
+    <name><![CDATA[公司名称]]></name>
+    <code><![CDATA[机构代码]]></code>
+    <code_type>1</code_type>
+    <legal_persona_wechat><![CDATA[法人微信号]]></legal_persona_wechat>
+    <legal_persona_name><![CDATA[法人姓名]]></legal_persona_name>
+    <component_phone><![CDATA[第三方联系电话]]></component_phone>
+  </info>
+</xml>
+*/
+type EventFastRegister struct {
+	Event
+	Appid    string `xml:"appid"`     // 创建的小程序appid
+	Status   int    `xml:"status"`    // 0 成功， 其他为错误码
+	AuthCode string `xml:"auth_code"` // 用于 open.ApiQueryAuth 换取授权信息
+	Msg      string `xml:"msg"`
+	Info     struct {
+		Name               string `xml:"name"`
+		Code               string `xml:"code"`
+		CodeType           int    `xml:"code_type"`
+		LegalPersonaWechat string `xml:"legal_persona_wechat"`
+		LegalPersonaName   string `xml:"legal_persona_name"`
+		ComponentPhone     string `xml:"component_phone"`
+	} `xml:"info"`
+}
@@ -0,0 +1,291 @@
+package wxtest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+// Callback 模拟微信/企业微信服务器推送消息和事件， 生成签名(加密)的请求并校验回复
+// 参考 https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Message_encryption_and_decryption_instructions.html
+//      https://work.weixin.qq.com/api/doc/90000/90139/90968
+type Callback struct {
+	Kind           string // KindOfficialAccount / KindWxwork / KindComponent
+	Token          string // 接收消息服务器配置（Token）
+	EncodingAESKey string // 接收消息服务器配置（EncodingAESKey）， 公众号为空表示明文模式
+	AppId          string // 公众号appid / 企业微信corpid / 第三方平台appid， 加密时附加在消息之后
+	Client         *http.Client
+}
+
+// NewOfficialAccountCallback 公众号推送， encodingAESKey 为空则使用明文模式
+func NewOfficialAccountCallback(token, encodingAESKey, appid string) *Callback {
+	return &Callback{
+		Kind:           KindOfficialAccount,
+		Token:          token,
+		EncodingAESKey: encodingAESKey,
+		AppId:          appid,
+		Client:         http.DefaultClient,
+	}
+}
+
+// NewWxworkCallback 企业微信推送， 总是加密
+func NewWxworkCallback(token, encodingAESKey, corpid string) *Callback {
+	return &Callback{
+		Kind:           KindWxwork,
+		Token:          token,
+		EncodingAESKey: encodingAESKey,
+		AppId:          corpid,
+		Client:         http.DefaultClient,
+	}
+}
+
+// NewComponentCallback 第三方平台授权事件推送(component_verify_ticket/authorized等)， 总是加密
+func NewComponentCallback(token, encodingAESKey, componentAppid string) *Callback {
+	return &Callback{
+		Kind:           KindComponent,
+		Token:          token,
+		EncodingAESKey: encodingAESKey,
+		AppId:          componentAppid,
+		Client:         http.DefaultClient,
+	}
+}
+
+// Reply 回调的响应
+type Reply struct {
+	StatusCode int
+	Body       []byte // 原始响应
+	XML        []byte // 被动回复的消息(已解密)， 为空表示没有回复
+	AppId      string // 加密回复中附带的 appid/corpid
+}
+
+// Unmarshal 解析被动回复的消息， 比如 server_api.ReplyMessageText
+func (reply *Reply) Unmarshal(v interface{}) error {
+	if len(reply.XML) == 0 {
+		return fmt.Errorf("empty reply: %s", string(reply.Body))
+	}
+	return xml.Unmarshal(reply.XML, v)
+}
+
+// 推送的外层结构
+type callbackEnvelope struct {
+	XMLName    xml.Name `xml:"xml"`
+	AppId      string   `xml:",omitempty"` // 第三方平台
+	ToUserName string   `xml:",omitempty"`
+	AgentID    string   `xml:",omitempty"`
+	Encrypt    string
+}
+
+// 加密的回复
+type encryptedReply struct {
+	XMLName      xml.Name `xml:"xml"`
+	Encrypt      string
+	MsgSignature string
+	TimeStamp    string
+	Nonce        string
+}
+
+// 原始消息中用于构造外层结构的字段
+type callbackHeader struct {
+	AppId        string
+	ToUserName   string
+	FromUserName string
+	AgentID      string
+}
+
+func signature(strs ...string) string {
+	sort.Strings(strs)
+	h := sha1.New()
+	_, _ = io.WriteString(h, strings.Join(strs, ""))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func (c *Callback) encrypted() bool {
+	return c.Kind != KindOfficialAccount || c.EncodingAESKey != ""
+}
+
+// MarshalMessage 消息或事件序列化成xml， []byte/string 原样返回
+func MarshalMessage(message interface{}) ([]byte, error) {
+	switch v := message.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := xml.NewEncoder(buf)
+	// 根节点统一为 <xml>
+	if err := encoder.EncodeElement(message, xml.StartElement{Name: xml.Name{Local: "xml"}}); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewRequest 构造推送请求， message 为 server_api 中的消息/事件结构， 或者原始xml
+func (c *Callback) NewRequest(target string, message interface{}) (*http.Request, error) {
+	rawXML, err := MarshalMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	header := callbackHeader{}
+	if err = xml.Unmarshal(rawXML, &header); err != nil {
+		return nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := utils.GetRandString(10)
+	params := url.Values{}
+	params.Set("timestamp", timestamp)
+	params.Set("nonce", nonce)
+	switch c.Kind {
+	case KindOfficialAccount:
+		params.Set("signature", signature(timestamp, nonce, c.Token))
+		params.Set("openid", header.FromUserName)
+	case KindComponent:
+		params.Set("signature", signature(timestamp, nonce, c.Token))
+	}
+
+	body := rawXML
+	if c.encrypted() {
+		var cipherText string
+		cipherText, err = utils.AESEncryptMsg([]byte(utils.GetRandString(16)), rawXML, c.AppId, c.EncodingAESKey)
+		if err != nil {
+			return nil, err
+		}
+		envelope := callbackEnvelope{ToUserName: header.ToUserName, Encrypt: cipherText}
+		switch c.Kind {
+		case KindWxwork:
+			envelope.AgentID = header.AgentID
+		case KindComponent:
+			envelope.AppId = header.AppId
+			params.Set("encrypt_type", "aes")
+		default:
+			params.Set("encrypt_type", "aes")
+		}
+		params.Set("msg_signature", signature(timestamp, nonce, c.Token, cipherText))
+		if body, err = xml.Marshal(envelope); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, withQuery(target, params), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	return req, nil
+}
+
+// NewEchoRequest 构造验证URL有效性的请求， 服务器应该原样返回 echostr
+func (c *Callback) NewEchoRequest(target, echostr string) (*http.Request, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := utils.GetRandString(10)
+	params := url.Values{}
+	params.Set("timestamp", timestamp)
+	params.Set("nonce", nonce)
+
+	if c.Kind == KindWxwork {
+		cipherText, err := utils.AESEncryptMsg([]byte(utils.GetRandString(16)), []byte(echostr), c.AppId, c.EncodingAESKey)
+		if err != nil {
+			return nil, err
+		}
+		params.Set("echostr", cipherText)
+		params.Set("msg_signature", signature(timestamp, nonce, c.Token, cipherText))
+	} else {
+		params.Set("echostr", echostr)
+		params.Set("signature", signature(timestamp, nonce, c.Token))
+	}
+	return http.NewRequest(http.MethodGet, withQuery(target, params), nil)
+}
+
+func withQuery(target string, params url.Values) string {
+	if strings.Contains(target, "?") {
+		return target + "&" + params.Encode()
+	}
+	return target + "?" + params.Encode()
+}
+
+// ParseReply 校验签名并解密被动回复
+func (c *Callback) ParseReply(statusCode int, body []byte) (*Reply, error) {
+	reply := &Reply{StatusCode: statusCode, Body: body}
+	if statusCode != http.StatusOK {
+		return reply, fmt.Errorf("http status %d: %s", statusCode, string(body))
+	}
+
+	content := bytes.TrimSpace(body)
+	if len(content) == 0 || string(content) == "success" {
+		// 没有被动回复
+		return reply, nil
+	}
+	if !c.encrypted() {
+		reply.XML = content
+		return reply, nil
+	}
+
+	message := encryptedReply{}
+	if err := xml.Unmarshal(content, &message); err != nil {
+		return reply, err
+	}
+	if message.Encrypt == "" {
+		return reply, fmt.Errorf("reply is not encrypted: %s", string(content))
+	}
+	expected := signature(message.TimeStamp, message.Nonce, c.Token, message.Encrypt)
+	if expected != message.MsgSignature {
+		return reply, fmt.Errorf("invalid reply signature %s != %s", message.MsgSignature, expected)
+	}
+	_, rawXML, appId, err := utils.AESDecryptMsg(message.Encrypt, c.EncodingAESKey)
+	if err != nil {
+		return reply, err
+	}
+	reply.XML = rawXML
+	reply.AppId = string(appId)
+	return reply, nil
+}
+
+// Send 推送到 target 并校验回复
+func (c *Callback) Send(target string, message interface{}) (*Reply, error) {
+	req, err := c.NewRequest(target, message)
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return c.ParseReply(resp.StatusCode, body)
+}
+
+// Invoke 直接调用 handler， 不需要启动http服务
+func (c *Callback) Invoke(handler http.Handler, message interface{}) (*Reply, error) {
+	req, err := c.NewRequest("/", message)
+	if err != nil {
+		return nil, err
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return c.ParseReply(recorder.Code, recorder.Body.Bytes())
+}
@@ -0,0 +1,146 @@
+package wxtest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/weixin/official_account"
+	"github.com/lixinio/weixin/weixin/server_api"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxwork"
+	"github.com/lixinio/weixin/wxwork/agent"
+	wxwork_server_api "github.com/lixinio/weixin/wxwork/server_api"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	callbackToken  = "token"
+	callbackAESKey = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+)
+
+// 文本消息原样回复， 其他消息回复 success
+func officialAccountHandler(serverApi *server_api.ServerApi) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			serverApi.ServeEcho(w, r)
+			return
+		}
+		serverApi.ServeData(w, r, func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			content, err := serverApi.ParseXML(body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if v, ok := content.(server_api.MessageText); ok {
+				_ = serverApi.ResponseText(w, r, &server_api.ReplyMessageText{
+					ReplyMessage: *v.Reply(),
+					Content:      server_api.CDATA(v.Content),
+				})
+				return
+			}
+			_, _ = w.Write([]byte("success"))
+		})
+	})
+}
+
+func TestOfficialAccountCallback(t *testing.T) {
+	for _, aesKey := range []string{"", callbackAESKey} {
+		cache := memory.NewMemory(nil)
+		defer cache.Close()
+		officialAccount := official_account.New(cache, cache, &official_account.Config{Appid: "appid"})
+		handler := officialAccountHandler(server_api.NewOfficialAccountApi(callbackToken, aesKey, officialAccount))
+		callback := wxtest.NewOfficialAccountCallback(callbackToken, aesKey, "appid")
+
+		message := server_api.MessageText{
+			Message: server_api.Message{
+				ToUserName:   "gh_123456",
+				FromUserName: "openid",
+				CreateTime:   "1348831860",
+				MsgType:      server_api.MsgTypeText,
+			},
+			MsgId:   "1234567890123456",
+			Content: "hello",
+		}
+		reply, err := callback.Invoke(handler, message)
+		require.Equal(t, nil, err)
+		replyText := server_api.ReplyMessageText{}
+		require.Equal(t, nil, reply.Unmarshal(&replyText))
+		require.Equal(t, server_api.CDATA("hello"), replyText.Content)
+		require.Equal(t, server_api.CDATA("openid"), replyText.ToUserName)
+		if aesKey != "" {
+			require.Equal(t, "appid", reply.AppId)
+		}
+
+		// 事件， 没有被动回复
+		reply, err = callback.Invoke(handler, server_api.EventSubscribe{
+			Event: server_api.Event{
+				Message: server_api.Message{
+					ToUserName:   "gh_123456",
+					FromUserName: "openid",
+					CreateTime:   "1348831860",
+					MsgType:      server_api.MsgTypeEvent,
+				},
+				Event: server_api.EventTypeSubscribe,
+			},
+		})
+		require.Equal(t, nil, err)
+		require.Equal(t, 0, len(reply.XML))
+
+		// 签名错误
+		callback.Token = "invalid"
+		_, err = callback.Invoke(handler, message)
+		require.NotEqual(t, nil, err)
+		callback.Token = callbackToken
+
+		// 验证URL
+		server := httptest.NewServer(handler)
+		req, err := callback.NewEchoRequest(server.URL, "echostr")
+		require.Equal(t, nil, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.Equal(t, nil, err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Equal(t, "echostr", string(body))
+		server.Close()
+	}
+}
+
+func TestWxworkCallback(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	corpAgent := agent.New(wxwork.New(&wxwork.Config{Corpid: "corpid"}), cache, cache, &agent.Config{AgentId: "1000002"})
+	serverApi := wxwork_server_api.NewAgentApi(callbackToken, callbackAESKey, corpAgent)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverApi.ServeData(w, r, func(w http.ResponseWriter, r *http.Request, body []byte) {
+			content, err := serverApi.ParseXML(body)
+			require.Equal(t, nil, err)
+			v, ok := content.(wxwork_server_api.MessageText)
+			require.True(t, ok)
+			_ = serverApi.ResponseText(w, r, &wxwork_server_api.ReplyMessageText{
+				ReplyMessage: *v.Reply(),
+				Content:      wxwork_server_api.CDATA(v.Content),
+			})
+		})
+	})
+
+	callback := wxtest.NewWxworkCallback(callbackToken, callbackAESKey, "corpid")
+	reply, err := callback.Invoke(handler, []byte(`<xml>
+		<ToUserName><![CDATA[corpid]]></ToUserName>
+		<FromUserName><![CDATA[zhangsan]]></FromUserName>
+		<CreateTime>1348831860</CreateTime>
+		<MsgType><![CDATA[text]]></MsgType>
+		<Content><![CDATA[hello]]></Content>
+		<MsgId>1234567890123456</MsgId>
+		<AgentID>1000002</AgentID>
+	</xml>`))
+	require.Equal(t, nil, err)
+	replyText := wxwork_server_api.ReplyMessageText{}
+	require.Equal(t, nil, reply.Unmarshal(&replyText))
+	require.Equal(t, wxwork_server_api.CDATA("hello"), replyText.Content)
+	require.Equal(t, wxwork_server_api.CDATA("zhangsan"), replyText.ToUserName)
+}
@@ -0,0 +1,84 @@
+// wxcallback 模拟微信/企业微信推送， 用于本地调试回调
+//
+//	# 公众号安全模式， 从标准输入读取消息
+//	wxcallback -url http://127.0.0.1:5000/weixin/appid -token TOKEN -aeskey AESKEY -appid appid < message.xml
+//	# 企业微信验证URL
+//	wxcallback -kind wxwork -url http://127.0.0.1:5000/wxwork -token TOKEN -aeskey AESKEY -appid corpid -echo hello
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/lixinio/weixin/wxtest"
+)
+
+func main() {
+	kind := flag.String("kind", wxtest.KindOfficialAccount, "officialaccount / wxwork / component")
+	target := flag.String("url", "", "回调地址")
+	token := flag.String("token", "", "Token")
+	aesKey := flag.String("aeskey", "", "EncodingAESKey， 公众号为空表示明文模式")
+	appid := flag.String("appid", "", "公众号appid / 企业微信corpid / 第三方平台appid")
+	echo := flag.String("echo", "", "发送验证URL的请求， 服务器应该返回同样的内容")
+	file := flag.String("file", "", "消息xml文件， 缺省从标准输入读取")
+	flag.Parse()
+
+	if *target == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	callback := wxtest.NewOfficialAccountCallback(*token, *aesKey, *appid)
+	switch *kind {
+	case wxtest.KindWxwork:
+		callback = wxtest.NewWxworkCallback(*token, *aesKey, *appid)
+	case wxtest.KindComponent:
+		callback = wxtest.NewComponentCallback(*token, *aesKey, *appid)
+	}
+
+	if *echo != "" {
+		req, err := callback.NewEchoRequest(*target, *echo)
+		if err != nil {
+			log.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if string(body) != *echo {
+			log.Fatalf("echo mismatch: %d %s", resp.StatusCode, string(body))
+		}
+		fmt.Println("echo ok")
+		return
+	}
+
+	var message []byte
+	var err error
+	if *file == "" {
+		message, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		message, err = ioutil.ReadFile(*file)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	reply, err := callback.Send(*target, message)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(reply.XML) == 0 {
+		fmt.Printf("no reply: %s\n", string(reply.Body))
+		return
+	}
+	fmt.Println(string(reply.XML))
+}
@@ -0,0 +1,335 @@
+package wxtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	apiComponentToken  = "/cgi-bin/component/api_component_token"
+	componentApiPrefix = "/cgi-bin/component/" // 使用 component_access_token 的接口
+
+	defaultPreAuthCodeExpiresIn = 600
+	maxAuthorizerListCount      = 500
+)
+
+// 第三方平台的错误码
+const (
+	errcodeComponentNotAuthorized       int64 = 61003 // 公众号没有授权给第三方平台
+	errcodeComponentInvalidTicket       int64 = 61006 // component_verify_ticket 不合法
+	errcodeComponentInvalidRefreshToken int64 = 61023 // authorizer_refresh_token 不合法
+)
+
+// 授权方的选项和缺省值
+var componentAuthorizerOptions = map[string]string{
+	"location_report":  "0",
+	"voice_recognize":  "0",
+	"customer_service": "0",
+}
+
+// ComponentAuthorizer 授权给第三方平台的公众号/小程序
+type ComponentAuthorizer struct {
+	Appid       string
+	NickName    string
+	UserName    string // 原始ID
+	ServiceType int    // 公众号 0:订阅号 2:服务号
+	FuncInfo    []int  // 授权的权限集ID
+}
+
+type componentAuthorizer struct {
+	ComponentAuthorizer
+	refreshToken string
+	authTime     time.Time
+	options      map[string]string
+}
+
+type componentState struct {
+	mutex         sync.Mutex
+	verifyTickets map[string]string // component_appid -> component_verify_ticket
+	preAuthCodes  map[string]time.Time
+	authCodes     map[string]string // authorization_code -> authorizer_appid
+	authorizers   map[string]*componentAuthorizer
+	seq           int
+}
+
+func newComponentState() *componentState {
+	return &componentState{
+		verifyTickets: map[string]string{},
+		preAuthCodes:  map[string]time.Time{},
+		authCodes:     map[string]string{},
+		authorizers:   map[string]*componentAuthorizer{},
+	}
+}
+
+// AddComponent 添加第三方平台， 同时生成 component_verify_ticket
+func (s *Server) AddComponent(appid, secret string) {
+	s.mutex.Lock()
+	s.secrets[KindComponent+":"+appid] = secret
+	s.mutex.Unlock()
+
+	state := s.component
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.seq++
+	state.verifyTickets[appid] = fmt.Sprintf("ticket@@@wxtest-%d", state.seq)
+}
+
+// ComponentVerifyTicket 微信服务器推送给第三方平台的 component_verify_ticket
+func (s *Server) ComponentVerifyTicket(appid string) string {
+	state := s.component
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return state.verifyTickets[appid]
+}
+
+// AuthorizeComponent 模拟公众号管理员在授权页确认授权， 返回跳转到 redirect_uri 时带上的 auth_code
+// 已经授权过的公众号更新授权信息
+func (s *Server) AuthorizeComponent(authorizer ComponentAuthorizer) string {
+	state := s.component
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.seq++
+	item, ok := state.authorizers[authorizer.Appid]
+	if !ok {
+		item = &componentAuthorizer{
+			refreshToken: fmt.Sprintf("refreshtoken@@@wxtest-%d", state.seq),
+			options:      map[string]string{},
+		}
+		for name, value := range componentAuthorizerOptions {
+			item.options[name] = value
+		}
+		state.authorizers[authorizer.Appid] = item
+	}
+	item.ComponentAuthorizer = authorizer
+	item.authTime = time.Now()
+
+	code := fmt.Sprintf("queryauthcode@@@wxtest-%d", state.seq)
+	state.authCodes[code] = authorizer.Appid
+	return code
+}
+
+// UnauthorizeComponent 模拟公众号取消授权
+func (s *Server) UnauthorizeComponent(authorizerAppid string) {
+	state := s.component
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	delete(state.authorizers, authorizerAppid)
+}
+
+// POST /cgi-bin/component/api_component_token
+func (s *Server) serveComponentToken(w http.ResponseWriter, r *http.Request) {
+	params := struct {
+		ComponentAppid        string `json:"component_appid"`
+		ComponentAppsecret    string `json:"component_appsecret"`
+		ComponentVerifyTicket string `json:"component_verify_ticket"`
+	}{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil || json.Unmarshal(body, &params) != nil {
+		writeError(w, errcodeDataFormat)
+		return
+	}
+
+	ticket := s.ComponentVerifyTicket(params.ComponentAppid)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	secret, ok := s.secrets[KindComponent+":"+params.ComponentAppid]
+	if !ok {
+		writeError(w, utils.ErrcodeInvalidAppid)
+		return
+	}
+	if secret != params.ComponentAppsecret {
+		writeError(w, utils.ErrcodeInvalidAppSecret)
+		return
+	}
+	if ticket != params.ComponentVerifyTicket {
+		writeError(w, errcodeComponentInvalidTicket)
+		return
+	}
+	result := s.issueAccessToken(KindComponent, params.ComponentAppid)
+	writeJSON(w, H{
+		"component_access_token": result["access_token"],
+		"expires_in":             result["expires_in"],
+	})
+}
+
+// 调用者持有 state 的锁， 授权方的 access_token 可以调用公众号的接口
+func (s *Server) issueAuthorizerToken(item *componentAuthorizer) H {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := s.issueAccessToken(KindOfficialAccount, item.Appid)
+	return H{
+		"authorizer_appid":         item.Appid,
+		"authorizer_access_token":  result["access_token"],
+		"expires_in":               result["expires_in"],
+		"authorizer_refresh_token": item.refreshToken,
+	}
+}
+
+func (item *componentAuthorizer) funcInfo() []H {
+	funcInfo := []H{}
+	for _, id := range item.FuncInfo {
+		funcInfo = append(funcInfo, H{"funcscope_category": H{"id": id}})
+	}
+	return funcInfo
+}
+
+func (s *Server) registerComponent() {
+	state := s.component
+	// 所有接口都需要 component_appid 和 authorizer_appid(如果有)
+	handle := func(path string, handler func(app string, body []byte, authorizer *componentAuthorizer) (H, int64)) {
+		s.handlers[KindComponent+":"+componentApiPrefix+path] = func(app string, r *http.Request, body []byte) (H, int64) {
+			params := struct {
+				ComponentAppid  string `json:"component_appid"`
+				AuthorizerAppid string `json:"authorizer_appid"`
+			}{}
+			if errcode := decodeBody(body, &params); errcode != 0 {
+				return nil, errcode
+			}
+			if params.ComponentAppid != app {
+				return nil, utils.ErrcodeInvalidAppid
+			}
+			state.mutex.Lock()
+			defer state.mutex.Unlock()
+			var authorizer *componentAuthorizer
+			if params.AuthorizerAppid != "" {
+				var ok bool
+				if authorizer, ok = state.authorizers[params.AuthorizerAppid]; !ok {
+					return nil, errcodeComponentNotAuthorized
+				}
+			}
+			return handler(app, body, authorizer)
+		}
+	}
+
+	handle("api_create_preauthcode", func(app string, body []byte, _ *componentAuthorizer) (H, int64) {
+		state.seq++
+		code := fmt.Sprintf("preauthcode@@@wxtest-%d", state.seq)
+		state.preAuthCodes[code] = time.Now().Add(defaultPreAuthCodeExpiresIn * time.Second)
+		return H{"pre_auth_code": code, "expires_in": defaultPreAuthCodeExpiresIn}, 0
+	})
+	handle("api_query_auth", func(app string, body []byte, _ *componentAuthorizer) (H, int64) {
+		params := struct {
+			AuthorizationCode string `json:"authorization_code"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		appid, ok := state.authCodes[params.AuthorizationCode]
+		if !ok {
+			return nil, utils.ErrcodeInvalidCode
+		}
+		// 授权码只能使用一次
+		delete(state.authCodes, params.AuthorizationCode)
+		item, ok := state.authorizers[appid]
+		if !ok {
+			return nil, errcodeComponentNotAuthorized
+		}
+		info := s.issueAuthorizerToken(item)
+		info["func_info"] = item.funcInfo()
+		return H{"authorization_info": info}, 0
+	})
+	handle("api_authorizer_token", func(app string, body []byte, item *componentAuthorizer) (H, int64) {
+		params := struct {
+			AuthorizerRefreshToken string `json:"authorizer_refresh_token"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if item == nil {
+			return nil, errcodeInvalidParameter
+		}
+		if item.refreshToken != params.AuthorizerRefreshToken {
+			return nil, errcodeComponentInvalidRefreshToken
+		}
+		result := s.issueAuthorizerToken(item)
+		delete(result, "authorizer_appid")
+		return result, 0
+	})
+	handle("api_get_authorizer_info", func(app string, body []byte, item *componentAuthorizer) (H, int64) {
+		if item == nil {
+			return nil, errcodeInvalidParameter
+		}
+		return H{
+			"authorizer_info": H{
+				"nick_name":         item.NickName,
+				"user_name":         item.UserName,
+				"service_type_info": H{"id": item.ServiceType},
+				"verify_type_info":  H{"id": 0},
+				"business_info":     H{"open_store": 0, "open_scan": 0, "open_pay": 0, "open_card": 0, "open_shake": 0},
+			},
+			"authorization_info": H{
+				"authorizer_appid":         item.Appid,
+				"authorizer_refresh_token": item.refreshToken,
+				"func_info":                item.funcInfo(),
+			},
+		}, 0
+	})
+	handle("api_get_authorizer_option", func(app string, body []byte, item *componentAuthorizer) (H, int64) {
+		params := struct {
+			OptionName string `json:"option_name"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if item == nil {
+			return nil, errcodeInvalidParameter
+		}
+		value, ok := item.options[params.OptionName]
+		if !ok {
+			return nil, errcodeInvalidParameter
+		}
+		return H{"authorizer_appid": item.Appid, "option_name": params.OptionName, "option_value": value}, 0
+	})
+	handle("api_set_authorizer_option", func(app string, body []byte, item *componentAuthorizer) (H, int64) {
+		params := struct {
+			OptionName  string `json:"option_name"`
+			OptionValue string `json:"option_value"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if item == nil || strings.TrimSpace(params.OptionValue) == "" {
+			return nil, errcodeInvalidParameter
+		}
+		if _, ok := item.options[params.OptionName]; !ok {
+			return nil, errcodeInvalidParameter
+		}
+		item.options[params.OptionName] = params.OptionValue
+		return nil, 0
+	})
+	handle("api_get_authorizer_list", func(app string, body []byte, _ *componentAuthorizer) (H, int64) {
+		params := struct {
+			Offset int `json:"offset"`
+			Count  int `json:"count"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if params.Offset < 0 || params.Count <= 0 || params.Count > maxAuthorizerListCount {
+			return nil, errcodeInvalidParameter
+		}
+		appids := make([]string, 0, len(state.authorizers))
+		for appid := range state.authorizers {
+			appids = append(appids, appid)
+		}
+		sort.Strings(appids)
+		list := []H{}
+		for i := params.Offset; i < len(appids) && len(list) < params.Count; i++ {
+			item := state.authorizers[appids[i]]
+			list = append(list, H{
+				"authorizer_appid": item.Appid,
+				"refresh_token":    item.refreshToken,
+				"auth_time":        item.authTime.Unix(),
+			})
+		}
+		return H{"total_count": len(appids), "list": list}, 0
+	})
+}
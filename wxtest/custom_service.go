@@ -0,0 +1,311 @@
+package wxtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	officialAccountFirstKfID = 1000
+	kfInviteExpiresIn        = 7 * 24 * time.Hour // 邀请绑定的有效期
+
+	errcodeInvalidKfNickname int64 = 65403 // 客服昵称不合法
+	errcodeInvalidKfAccount  int64 = 65404 // 客服帐号不合法
+)
+
+// 客服消息支持的类型， 值为消息内容中必填的字段
+var customMessageFields = map[string]string{
+	"text":            "content",
+	"image":           "media_id",
+	"voice":           "media_id",
+	"video":           "media_id",
+	"music":           "musicurl",
+	"news":            "articles",
+	"mpnews":          "media_id",
+	"mpnewsarticle":   "article_id",
+	"msgmenu":         "list",
+	"wxcard":          "card_id",
+	"miniprogrampage": "pagepath",
+}
+
+// 通过接口添加的客服帐号视为已经绑定微信并且在线
+type kfAccount struct {
+	account          string
+	nickname         string
+	id               int
+	inviteWx         string
+	inviteExpireTime int64
+}
+
+type kfSession struct {
+	account    string
+	createTime int64
+}
+
+// OfficialAccountMessages 通过客服接口发送的消息(原始请求)
+func (s *Server) OfficialAccountMessages() []json.RawMessage {
+	state := s.officialAccount
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return append([]json.RawMessage{}, state.messages...)
+}
+
+func (state *officialAccountState) sortedKfAccounts() []*kfAccount {
+	accounts := []*kfAccount{}
+	for _, account := range state.kfAccounts {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].id < accounts[j].id
+	})
+	return accounts
+}
+
+func (s *Server) registerCustomService() {
+	state := s.officialAccount
+	handle := func(path string, handler HandlerFunc) {
+		s.handlers[KindOfficialAccount+":"+path] = func(app string, r *http.Request, body []byte) (H, int64) {
+			state.mutex.Lock()
+			defer state.mutex.Unlock()
+			return handler(app, r, body)
+		}
+	}
+
+	// 客服消息
+	handle("/cgi-bin/message/custom/send", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := map[string]json.RawMessage{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		var toUser, msgType string
+		_ = json.Unmarshal(params["touser"], &toUser)
+		_ = json.Unmarshal(params["msgtype"], &msgType)
+		if _, ok := state.users[toUser]; !ok {
+			return nil, utils.ErrcodeInvalidOpenid
+		}
+
+		field, ok := customMessageFields[msgType]
+		if !ok {
+			return nil, errcodeInvalidParameter
+		}
+		content := map[string]json.RawMessage{}
+		if json.Unmarshal(params[msgType], &content) != nil || len(content[field]) == 0 {
+			return nil, errcodeInvalidParameter
+		}
+
+		if raw, ok := params["customservice"]; ok {
+			customService := struct {
+				KfAccount string `json:"kf_account"`
+			}{}
+			_ = json.Unmarshal(raw, &customService)
+			if _, ok := state.kfAccounts[customService.KfAccount]; !ok {
+				return nil, utils.ErrcodeInvalidKfAccount
+			}
+		}
+
+		state.messages = append(state.messages, json.RawMessage(body))
+		return nil, 0
+	})
+	handle("/cgi-bin/message/custom/typing", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			ToUser  string `json:"touser"`
+			Command string `json:"command"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if _, ok := state.users[params.ToUser]; !ok {
+			return nil, utils.ErrcodeInvalidOpenid
+		}
+		if params.Command != "Typing" && params.Command != "CancelTyping" {
+			return nil, errcodeInvalidParameter
+		}
+		return nil, 0
+	})
+
+	// 客服帐号
+	handle("/customservice/kfaccount/add", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			KfAccount string `json:"kf_account"`
+			Nickname  string `json:"nickname"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if !strings.Contains(params.KfAccount, "@") {
+			return nil, errcodeInvalidKfAccount
+		}
+		if params.Nickname == "" {
+			return nil, errcodeInvalidKfNickname
+		}
+		if _, ok := state.kfAccounts[params.KfAccount]; ok {
+			return nil, utils.ErrcodeKfAccountExists
+		}
+		state.kfSeq++
+		state.kfAccounts[params.KfAccount] = &kfAccount{
+			account:  params.KfAccount,
+			nickname: params.Nickname,
+			id:       state.kfSeq,
+		}
+		return nil, 0
+	})
+	handle("/customservice/kfaccount/update", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			KfAccount string `json:"kf_account"`
+			Nickname  string `json:"nickname"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		account, ok := state.kfAccounts[params.KfAccount]
+		if !ok {
+			return nil, utils.ErrcodeInvalidKfAccount
+		}
+		if params.Nickname == "" {
+			return nil, errcodeInvalidKfNickname
+		}
+		account.nickname = params.Nickname
+		return nil, 0
+	})
+	handle("/customservice/kfaccount/del", func(app string, r *http.Request, body []byte) (H, int64) {
+		account := r.URL.Query().Get("kf_account")
+		if _, ok := state.kfAccounts[account]; !ok {
+			return nil, utils.ErrcodeInvalidKfAccount
+		}
+		delete(state.kfAccounts, account)
+		for openid, session := range state.kfSessions {
+			if session.account == account {
+				delete(state.kfSessions, openid)
+			}
+		}
+		return nil, 0
+	})
+	handle("/customservice/kfaccount/inviteworker", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			KfAccount string `json:"kf_account"`
+			InviteWx  string `json:"invite_wx"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		account, ok := state.kfAccounts[params.KfAccount]
+		if !ok {
+			return nil, utils.ErrcodeInvalidKfAccount
+		}
+		if params.InviteWx == "" {
+			return nil, errcodeInvalidParameter
+		}
+		account.inviteWx = params.InviteWx
+		account.inviteExpireTime = time.Now().Add(kfInviteExpiresIn).Unix()
+		return nil, 0
+	})
+	handle("/cgi-bin/customservice/getkflist", func(app string, r *http.Request, body []byte) (H, int64) {
+		list := []H{}
+		for _, account := range state.sortedKfAccounts() {
+			item := H{
+				"kf_account":    account.account,
+				"kf_nick":       account.nickname,
+				"kf_id":         strconv.Itoa(account.id),
+				"kf_headimgurl": "",
+			}
+			if account.inviteWx != "" {
+				item["invite_wx"] = account.inviteWx
+				item["invite_expire_time"] = account.inviteExpireTime
+				item["invite_status"] = "waiting"
+			}
+			list = append(list, item)
+		}
+		return H{"kf_list": list}, 0
+	})
+	handle("/cgi-bin/customservice/getonlinekflist", func(app string, r *http.Request, body []byte) (H, int64) {
+		list := []H{}
+		for _, account := range state.sortedKfAccounts() {
+			accepted := 0
+			for _, session := range state.kfSessions {
+				if session.account == account.account {
+					accepted++
+				}
+			}
+			list = append(list, H{
+				"kf_account":    account.account,
+				"status":        1,
+				"kf_id":         strconv.Itoa(account.id),
+				"accepted_case": accepted,
+			})
+		}
+		return H{"kf_online_list": list}, 0
+	})
+
+	// 会话控制
+	session := func(create bool) HandlerFunc {
+		return func(app string, r *http.Request, body []byte) (H, int64) {
+			params := struct {
+				KfAccount string `json:"kf_account"`
+				OpenID    string `json:"openid"`
+			}{}
+			if errcode := decodeBody(body, &params); errcode != 0 {
+				return nil, errcode
+			}
+			if _, ok := state.kfAccounts[params.KfAccount]; !ok {
+				return nil, utils.ErrcodeInvalidKfAccount
+			}
+			if _, ok := state.users[params.OpenID]; !ok {
+				return nil, utils.ErrcodeInvalidOpenid
+			}
+
+			current, ok := state.kfSessions[params.OpenID]
+			if create {
+				if ok && current.account != params.KfAccount {
+					return nil, utils.ErrcodeKfSessionOccupied
+				}
+				state.kfSessions[params.OpenID] = &kfSession{
+					account:    params.KfAccount,
+					createTime: time.Now().Unix(),
+				}
+				return nil, 0
+			}
+			if !ok || current.account != params.KfAccount {
+				return nil, utils.ErrcodeKfSessionNotFound
+			}
+			delete(state.kfSessions, params.OpenID)
+			return nil, 0
+		}
+	}
+	handle("/customservice/kfsession/create", session(true))
+	handle("/customservice/kfsession/close", session(false))
+	handle("/customservice/kfsession/getsession", func(app string, r *http.Request, body []byte) (H, int64) {
+		openid := r.URL.Query().Get("openid")
+		if _, ok := state.users[openid]; !ok {
+			return nil, utils.ErrcodeInvalidOpenid
+		}
+		if session, ok := state.kfSessions[openid]; ok {
+			return H{"kf_account": session.account, "createtime": session.createTime}, 0
+		}
+		return H{"kf_account": "", "createtime": 0}, 0
+	})
+	handle("/customservice/kfsession/getsessionlist", func(app string, r *http.Request, body []byte) (H, int64) {
+		account := r.URL.Query().Get("kf_account")
+		if _, ok := state.kfAccounts[account]; !ok {
+			return nil, utils.ErrcodeInvalidKfAccount
+		}
+		openids := state.sortedOpenIDs(func(openid string) bool {
+			session, ok := state.kfSessions[openid]
+			return ok && session.account == account
+		})
+		list := []H{}
+		for _, openid := range openids {
+			list = append(list, H{"openid": openid, "createtime": state.kfSessions[openid].createTime})
+		}
+		return H{"sessionlist": list}, 0
+	})
+	handle("/customservice/kfsession/getwaitcase", func(app string, r *http.Request, body []byte) (H, int64) {
+		// 模拟服务器不会产生未接入的会话
+		return H{"count": 0, "waitcaselist": []H{}}, 0
+	})
+}
@@ -0,0 +1,45 @@
+// Package fixture 单元测试共用的模拟服务器和公众号
+//
+// wxtest 只依赖 utils， 公众号等客户端的构造放在这里， 避免 official_account 自己的测试引用 wxtest 时循环依赖
+package fixture
+
+import (
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/weixin/official_account"
+	"github.com/lixinio/weixin/wxtest"
+)
+
+// 测试用的公众号和消息服务器配置
+const (
+	Appid          = "appid"
+	Secret         = "secret"
+	Token          = "token"
+	EncodingAESKey = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+)
+
+// Cleaner 测试结束时执行清理， *testing.T / *testing.B 都满足
+type Cleaner interface {
+	Cleanup(func())
+}
+
+// NewOfficialAccount 启动模拟服务器并添加公众号 Appid/Secret 和用户， 返回连接到模拟服务器的公众号
+// 以及公众号使用的缓存， 测试结束时自动关闭服务器和缓存
+func NewOfficialAccount(
+	t Cleaner, users ...wxtest.OfficialAccountUser,
+) (*wxtest.Server, *official_account.OfficialAccount, *memory.Memory) {
+	server := wxtest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddOfficialAccount(Appid, Secret)
+	for _, user := range users {
+		server.AddOfficialAccountUser(user)
+	}
+
+	cache := memory.NewMemory(nil)
+	t.Cleanup(cache.Close)
+	officialAccount := official_account.New(cache, cache, &official_account.Config{
+		Appid:  Appid,
+		Secret: Secret,
+	}, utils.WithServerUrl(server.URL))
+	return server, officialAccount, cache
+}
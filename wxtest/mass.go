@@ -0,0 +1,236 @@
+package wxtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	officialAccountFirstMassMsgID = 1000000001
+
+	massSendStatusSuccess    = "sendsuccess"
+	massMsgStatusSending     = "SENDING"
+	massMsgStatusSendSuccess = "SEND_SUCCESS"
+	massMsgStatusDelete      = "DELETE"
+
+	errcodeInvalidMsgType        int64 = 40008 // 不合法的消息类型
+	errcodeInvalidOpenidListSize int64 = 40130 // openid 列表至少2个
+)
+
+// 群发速度级别对应的真实速度(万/分钟)
+var massRealSpeeds = []int{80, 60, 45, 30, 10}
+
+type massJob struct {
+	status  string
+	openids []string
+}
+
+// MassMessages 群发和预览的消息(原始请求)
+func (s *Server) MassMessages() []json.RawMessage {
+	state := s.officialAccount
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return append([]json.RawMessage{}, state.massMessages...)
+}
+
+// MassSendJobFinish 完成群发任务， 返回微信服务器推送的群发任务完成事件(MASSSENDJOBFINISH)
+// 黑名单中的粉丝不计入 FilterCount
+func (s *Server) MassSendJobFinish(msgID int64) (string, bool) {
+	state := s.officialAccount
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	job, ok := state.massJobs[msgID]
+	if !ok {
+		return "", false
+	}
+	job.status = massMsgStatusSendSuccess
+
+	filterCount := 0
+	for _, openid := range job.openids {
+		if !state.blacklist[openid] {
+			filterCount++
+		}
+	}
+	return fmt.Sprintf(`<xml>
+	<ToUserName><![CDATA[gh_wxtest]]></ToUserName>
+	<FromUserName><![CDATA[mphelper]]></FromUserName>
+	<CreateTime>%d</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[MASSSENDJOBFINISH]]></Event>
+	<MsgID>%d</MsgID>
+	<Status><![CDATA[%s]]></Status>
+	<TotalCount>%d</TotalCount>
+	<FilterCount>%d</FilterCount>
+	<SentCount>%d</SentCount>
+	<ErrorCount>0</ErrorCount>
+</xml>`, time.Now().Unix(), msgID, massSendStatusSuccess, len(job.openids), filterCount, filterCount), true
+}
+
+// 检查消息类型和对应的内容
+func checkMassMessage(body []byte) int64 {
+	message := map[string]json.RawMessage{}
+	if errcode := decodeBody(body, &message); errcode != 0 {
+		return errcode
+	}
+	msgType := ""
+	if err := json.Unmarshal(message["msgtype"], &msgType); err != nil {
+		return errcodeInvalidMsgType
+	}
+	key := msgType
+	if msgType == "image" {
+		key = "images"
+	}
+	switch msgType {
+	case "mpnews", "text", "voice", "image", "mpvideo", "wxcard":
+		if _, ok := message[key]; !ok {
+			return errcodeInvalidParameter
+		}
+		return 0
+	}
+	return errcodeInvalidMsgType
+}
+
+func (s *Server) registerMass() {
+	state := s.officialAccount
+	handle := func(path string, handler HandlerFunc) {
+		s.handlers[KindOfficialAccount+":"+path] = func(app string, r *http.Request, body []byte) (H, int64) {
+			state.mutex.Lock()
+			defer state.mutex.Unlock()
+			return handler(app, r, body)
+		}
+	}
+	submit := func(body []byte, openids []string) H {
+		state.massMsgSeq++
+		state.massMessages = append(state.massMessages, append(json.RawMessage{}, body...))
+		state.massJobs[state.massMsgSeq] = &massJob{status: massMsgStatusSending, openids: openids}
+		return H{"msg_id": state.massMsgSeq, "msg_data_id": state.massMsgSeq * 10}
+	}
+
+	handle("/cgi-bin/message/mass/sendall", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			Filter struct {
+				IsToAll bool `json:"is_to_all"`
+				TagID   int  `json:"tag_id"`
+			} `json:"filter"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if errcode := checkMassMessage(body); errcode != 0 {
+			return nil, errcode
+		}
+
+		var openids []string
+		if params.Filter.IsToAll {
+			openids = state.sortedOpenIDs(nil)
+		} else {
+			tag, ok := state.tags[params.Filter.TagID]
+			if !ok {
+				return nil, errcodeInvalidTagID
+			}
+			openids = state.sortedOpenIDs(func(openid string) bool {
+				return tag.openids[openid]
+			})
+		}
+		return submit(body, openids), 0
+	})
+	handle("/cgi-bin/message/mass/send", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			ToUser []string `json:"touser"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if len(params.ToUser) < 2 {
+			return nil, errcodeInvalidOpenidListSize
+		}
+		for _, openid := range params.ToUser {
+			if _, ok := state.users[openid]; !ok {
+				return nil, utils.ErrcodeInvalidOpenid
+			}
+		}
+		if errcode := checkMassMessage(body); errcode != 0 {
+			return nil, errcode
+		}
+		return submit(body, params.ToUser), 0
+	})
+	handle("/cgi-bin/message/mass/preview", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			ToUser   string `json:"touser"`
+			ToWxName string `json:"towxname"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if _, ok := state.users[params.ToUser]; !ok && params.ToWxName == "" {
+			return nil, utils.ErrcodeInvalidOpenid
+		}
+		if errcode := checkMassMessage(body); errcode != 0 {
+			return nil, errcode
+		}
+		state.massMessages = append(state.massMessages, append(json.RawMessage{}, body...))
+		return nil, 0
+	})
+	handle("/cgi-bin/message/mass/delete", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			MsgID int64 `json:"msg_id"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		job, ok := state.massJobs[params.MsgID]
+		if !ok {
+			return nil, errcodeInvalidParameter
+		}
+		job.status = massMsgStatusDelete
+		return nil, 0
+	})
+	handle("/cgi-bin/message/mass/get", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			MsgID int64 `json:"msg_id"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		job, ok := state.massJobs[params.MsgID]
+		if !ok {
+			return nil, errcodeInvalidParameter
+		}
+		return H{"msg_id": params.MsgID, "msg_status": job.status}, 0
+	})
+	handle("/cgi-bin/message/mass/speed/get", func(app string, r *http.Request, body []byte) (H, int64) {
+		return H{"speed": state.massSpeed, "realspeed": massRealSpeeds[state.massSpeed]}, 0
+	})
+	handle("/cgi-bin/message/mass/speed/set", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			Speed int `json:"speed"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if params.Speed < 0 || params.Speed >= len(massRealSpeeds) {
+			return nil, errcodeInvalidParameter
+		}
+		state.massSpeed = params.Speed
+		return nil, 0
+	})
+	handle("/cgi-bin/media/uploadvideo", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			MediaID string `json:"media_id"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		s.media.mutex.Lock()
+		item, ok := s.media.items[params.MediaID]
+		s.media.mutex.Unlock()
+		if !ok || item.mediaType != "video" {
+			return nil, utils.ErrcodeInvalidMediaID
+		}
+		return H{"type": "video", "media_id": "MPVIDEO_" + params.MediaID, "created_at": time.Now().Unix()}, 0
+	})
+}
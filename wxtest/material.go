@@ -0,0 +1,170 @@
+package wxtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const apiMaterialGet = "/cgi-bin/material/get_material"
+
+// 调用者持有锁， 按照上传的顺序返回永久素材
+func (state *mediaState) materialIDs(mediaType string) []string {
+	ids := []string{}
+	for id, item := range state.items {
+		if item.permanent && (mediaType == "" || item.mediaType == mediaType) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if len(ids[i]) != len(ids[j]) {
+			return len(ids[i]) < len(ids[j])
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+func (s *Server) registerMaterial() {
+	state := s.media
+	handle := func(path string, handler HandlerFunc) {
+		s.handlers[KindOfficialAccount+":"+path] = handler
+	}
+
+	handle("/cgi-bin/material/add_material", func(app string, r *http.Request, body []byte) (H, int64) {
+		mediaType := r.URL.Query().Get("type")
+		switch mediaType {
+		case "image", "voice", "video", "thumb":
+		default:
+			return nil, utils.ErrcodeInvalidMediaType
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		description := struct {
+			Title        string `json:"title"`
+			Introduction string `json:"introduction"`
+		}{}
+		if mediaType == "video" {
+			// 视频素材需要 description 表单字段
+			if err := json.Unmarshal([]byte(r.FormValue("description")), &description); err != nil {
+				return nil, errcodeInvalidParameter
+			}
+			if description.Title == "" {
+				return nil, errcodeInvalidParameter
+			}
+		}
+
+		mediaID, errcode := state.save(r, mediaType, func(item *media) {
+			item.permanent = true
+			item.title = description.Title
+			item.introduction = description.Introduction
+			item.updateTime = time.Now().Unix()
+		})
+		if errcode != 0 {
+			return nil, errcode
+		}
+		result := H{"media_id": mediaID}
+		if mediaType == "image" {
+			result["url"] = s.URL + mediaFilePrefix + mediaID
+		}
+		return result, 0
+	})
+	handle("/cgi-bin/material/del_material", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			MediaID string `json:"media_id"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		state.mutex.Lock()
+		defer state.mutex.Unlock()
+		if item, ok := state.items[params.MediaID]; !ok || !item.permanent {
+			return nil, utils.ErrcodeInvalidMediaID
+		}
+		delete(state.items, params.MediaID)
+		return nil, 0
+	})
+	handle("/cgi-bin/material/get_materialcount", func(app string, r *http.Request, body []byte) (H, int64) {
+		state.mutex.Lock()
+		defer state.mutex.Unlock()
+		return H{
+			"voice_count": len(state.materialIDs("voice")),
+			"video_count": len(state.materialIDs("video")),
+			"image_count": len(state.materialIDs("image")),
+			"news_count":  0, // 不支持图文素材
+		}, 0
+	})
+	handle("/cgi-bin/material/batchget_material", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			Type   string `json:"type"`
+			Offset int    `json:"offset"`
+			Count  int    `json:"count"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		switch params.Type {
+		case "image", "voice", "video", "news":
+		default:
+			return nil, utils.ErrcodeInvalidMediaType
+		}
+		if params.Offset < 0 || params.Count < 1 || params.Count > 20 {
+			return nil, errcodeInvalidParameter
+		}
+
+		state.mutex.Lock()
+		defer state.mutex.Unlock()
+		ids := state.materialIDs(params.Type)
+		if params.Type == "news" {
+			ids = nil
+		}
+		items := []H{}
+		for i := params.Offset; i < len(ids) && len(items) < params.Count; i++ {
+			item := state.items[ids[i]]
+			result := H{"media_id": ids[i], "name": item.filename, "update_time": item.updateTime}
+			if item.mediaType == "image" {
+				result["url"] = s.URL + mediaFilePrefix + ids[i]
+			}
+			items = append(items, result)
+		}
+		return H{"total_count": len(ids), "item_count": len(items), "item": items}, 0
+	})
+}
+
+// POST /cgi-bin/material/get_material?access_token=ACCESS_TOKEN
+// 视频素材返回json， 其他素材返回文件内容
+func (s *Server) serveMaterialGet(w http.ResponseWriter, r *http.Request) {
+	params := struct {
+		MediaID string `json:"media_id"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, errcodeDataFormat)
+		return
+	}
+
+	state := s.media
+	state.mutex.Lock()
+	item, ok := state.items[params.MediaID]
+	state.mutex.Unlock()
+	if !ok || !item.permanent {
+		writeError(w, utils.ErrcodeInvalidMediaID)
+		return
+	}
+	if item.mediaType == "video" {
+		writeJSON(w, H{
+			"title":       item.title,
+			"description": item.introduction,
+			"down_url":    s.URL + mediaFilePrefix + params.MediaID,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", item.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, item.filename))
+	_, _ = w.Write(item.data)
+}
@@ -0,0 +1,161 @@
+package wxtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	apiMediaGet     = "/cgi-bin/media/get"
+	mediaFilePrefix = "/wxtest/media/" // uploadimg 返回的图片地址
+)
+
+type media struct {
+	mediaType   string
+	filename    string
+	contentType string
+	data        []byte
+
+	// 公众号永久素材
+	permanent    bool
+	title        string
+	introduction string
+	updateTime   int64
+}
+
+type mediaState struct {
+	mutex sync.Mutex
+	items map[string]*media
+	seq   int
+}
+
+func newMediaState() *mediaState {
+	return &mediaState{items: map[string]*media{}}
+}
+
+// Media 获取上传的素材内容
+func (s *Server) Media(mediaID string) (data []byte, ok bool) {
+	state := s.media
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	item, ok := state.items[mediaID]
+	if !ok {
+		return nil, false
+	}
+	return item.data, true
+}
+
+// 解析 multipart 中的 media 文件， 调用者可以通过 update 在锁内修改素材
+func (state *mediaState) save(r *http.Request, mediaType string, update func(item *media)) (string, int64) {
+	file, header, err := r.FormFile("media")
+	if err != nil {
+		return "", utils.ErrcodeMediaMissing
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil || len(data) == 0 {
+		return "", utils.ErrcodeInvalidMediaSize
+	}
+
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = http.DetectContentType(data)
+	}
+
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.seq++
+	mediaID := fmt.Sprintf("MEDIA_ID_%d", state.seq)
+	item := &media{
+		mediaType:   mediaType,
+		filename:    header.Filename,
+		contentType: contentType,
+		data:        data,
+	}
+	if update != nil {
+		update(item)
+	}
+	state.items[mediaID] = item
+	return mediaID, 0
+}
+
+func (s *Server) registerMedia() {
+	state := s.media
+	for _, kind := range []string{KindOfficialAccount, KindWxwork} {
+		kind := kind
+		s.handlers[kind+":/cgi-bin/media/upload"] = func(app string, r *http.Request, body []byte) (H, int64) {
+			mediaType := r.URL.Query().Get("type")
+			switch mediaType {
+			case "image", "voice", "video", "file", "thumb":
+			default:
+				return nil, utils.ErrcodeInvalidMediaType
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			mediaID, errcode := state.save(r, mediaType, nil)
+			if errcode != 0 {
+				return nil, errcode
+			}
+			var createdAt interface{} = time.Now().Unix()
+			if kind == KindWxwork {
+				// 企业微信返回字符串
+				createdAt = strconv.FormatInt(time.Now().Unix(), 10)
+			}
+			return H{"type": mediaType, "media_id": mediaID, "created_at": createdAt}, 0
+		}
+		s.handlers[kind+":/cgi-bin/media/uploadimg"] = func(app string, r *http.Request, body []byte) (H, int64) {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			mediaID, errcode := state.save(r, "image", nil)
+			if errcode != 0 {
+				return nil, errcode
+			}
+			return H{"url": s.URL + mediaFilePrefix + mediaID}, 0
+		}
+	}
+}
+
+// GET /cgi-bin/media/get?access_token=ACCESS_TOKEN&media_id=MEDIA_ID
+func (s *Server) serveMediaGet(w http.ResponseWriter, r *http.Request, kind string) {
+	state := s.media
+	mediaID := r.URL.Query().Get("media_id")
+	state.mutex.Lock()
+	item, ok := state.items[mediaID]
+	state.mutex.Unlock()
+	if !ok || item.permanent {
+		writeError(w, utils.ErrcodeInvalidMediaID)
+		return
+	}
+	if kind == KindOfficialAccount && item.mediaType == "video" {
+		// 公众号的视频素材返回下载地址
+		writeJSON(w, H{"video_url": s.URL + mediaFilePrefix + mediaID})
+		return
+	}
+	w.Header().Set("Content-Type", item.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, item.filename))
+	_, _ = w.Write(item.data)
+}
+
+// uploadimg 返回的地址不需要 access_token
+func (s *Server) serveMediaFile(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, mediaFilePrefix) {
+		return false
+	}
+	state := s.media
+	state.mutex.Lock()
+	item, ok := state.items[strings.TrimPrefix(r.URL.Path, mediaFilePrefix)]
+	state.mutex.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return true
+	}
+	w.Header().Set("Content-Type", item.contentType)
+	_, _ = w.Write(item.data)
+	return true
+}
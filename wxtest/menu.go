@@ -0,0 +1,196 @@
+package wxtest
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	officialAccountFirstMenuID = 208379532
+
+	errcodeInvalidButtonCount    int64 = 40016 // 不合法的按钮个数
+	errcodeInvalidButtonName     int64 = 40018 // 不合法的按钮名字长度
+	errcodeInvalidSubButtonCount int64 = 40023 // 不合法的子按钮个数
+)
+
+type menuButton struct {
+	Type      string        `json:"type,omitempty"`
+	Name      string        `json:"name"`
+	Key       string        `json:"key,omitempty"`
+	Url       string        `json:"url,omitempty"`
+	MediaID   string        `json:"media_id,omitempty"`
+	ArticleID string        `json:"article_id,omitempty"`
+	AppID     string        `json:"appid,omitempty"`
+	PagePath  string        `json:"pagepath,omitempty"`
+	SubButton []*menuButton `json:"sub_button,omitempty"`
+}
+
+type menuMatchRule struct {
+	TagID              string `json:"tag_id,omitempty"`
+	ClientPlatformType string `json:"client_platform_type,omitempty"`
+}
+
+type menu struct {
+	Button    []*menuButton  `json:"button"`
+	MatchRule *menuMatchRule `json:"matchrule,omitempty"`
+	MenuID    int64          `json:"menuid"`
+}
+
+// 只检查个数和名字， 其他限制由调用者保证
+func checkMenuButtons(buttons []*menuButton) int64 {
+	if len(buttons) == 0 || len(buttons) > 3 {
+		return errcodeInvalidButtonCount
+	}
+	for _, button := range buttons {
+		if button.Name == "" {
+			return errcodeInvalidButtonName
+		}
+		if len(button.SubButton) > 5 {
+			return errcodeInvalidSubButtonCount
+		}
+		for _, subButton := range button.SubButton {
+			if subButton.Name == "" {
+				return errcodeInvalidButtonName
+			}
+		}
+	}
+	return 0
+}
+
+// 公众平台官网查询菜单的格式
+func selfMenuButtons(buttons []*menuButton) []H {
+	list := []H{}
+	for _, button := range buttons {
+		item := H{"type": button.Type, "name": button.Name}
+		switch {
+		case len(button.SubButton) > 0:
+			item["sub_button"] = H{"list": selfMenuButtons(button.SubButton)}
+		case button.Key != "":
+			item["key"] = button.Key
+		case button.MediaID != "":
+			item["value"] = button.MediaID
+		case button.ArticleID != "":
+			item["value"] = button.ArticleID
+		}
+		if button.Url != "" {
+			item["url"] = button.Url
+		}
+		list = append(list, item)
+	}
+	return list
+}
+
+// 个性化菜单按照创建的倒序匹配， 模拟服务器只匹配标签
+func (state *officialAccountState) matchMenu(openid string) *menu {
+	for i := len(state.conditionalMenus) - 1; i >= 0; i-- {
+		conditionalMenu := state.conditionalMenus[i]
+		if conditionalMenu.MatchRule.TagID == "" {
+			continue
+		}
+		tagID, _ := strconv.Atoi(conditionalMenu.MatchRule.TagID)
+		if tag, ok := state.tags[tagID]; ok && tag.openids[openid] {
+			return conditionalMenu
+		}
+	}
+	return state.menu
+}
+
+func (s *Server) registerMenu() {
+	state := s.officialAccount
+	handle := func(path string, handler HandlerFunc) {
+		s.handlers[KindOfficialAccount+":"+path] = func(app string, r *http.Request, body []byte) (H, int64) {
+			state.mutex.Lock()
+			defer state.mutex.Unlock()
+			return handler(app, r, body)
+		}
+	}
+
+	handle("/cgi-bin/menu/create", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := menu{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if errcode := checkMenuButtons(params.Button); errcode != 0 {
+			return nil, errcode
+		}
+		state.menuSeq++
+		state.menu = &menu{Button: params.Button, MenuID: state.menuSeq}
+		return nil, 0
+	})
+	handle("/cgi-bin/menu/get", func(app string, r *http.Request, body []byte) (H, int64) {
+		if state.menu == nil {
+			return nil, utils.ErrcodeMenuNotExist
+		}
+		result := H{"menu": H{"button": state.menu.Button, "menuid": state.menu.MenuID}}
+		if len(state.conditionalMenus) > 0 {
+			result["conditionalmenu"] = state.conditionalMenus
+		}
+		return result, 0
+	})
+	handle("/cgi-bin/menu/delete", func(app string, r *http.Request, body []byte) (H, int64) {
+		state.menu = nil
+		state.conditionalMenus = nil
+		return nil, 0
+	})
+	handle("/cgi-bin/get_current_selfmenu_info", func(app string, r *http.Request, body []byte) (H, int64) {
+		if state.menu == nil {
+			return H{"is_menu_open": 0, "selfmenu_info": H{"button": []H{}}}, 0
+		}
+		return H{"is_menu_open": 1, "selfmenu_info": H{"button": selfMenuButtons(state.menu.Button)}}, 0
+	})
+
+	// 个性化菜单
+	handle("/cgi-bin/menu/addconditional", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := menu{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if state.menu == nil {
+			return nil, utils.ErrcodeNoDefaultMenu
+		}
+		if params.MatchRule == nil || *params.MatchRule == (menuMatchRule{}) {
+			return nil, utils.ErrcodeEmptyMatchRule
+		}
+		if errcode := checkMenuButtons(params.Button); errcode != 0 {
+			return nil, errcode
+		}
+		state.menuSeq++
+		params.MenuID = state.menuSeq
+		state.conditionalMenus = append(state.conditionalMenus, &params)
+		// 返回字符串
+		return H{"menuid": strconv.FormatInt(params.MenuID, 10)}, 0
+	})
+	handle("/cgi-bin/menu/delconditional", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			MenuID string `json:"menuid"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		for i, conditionalMenu := range state.conditionalMenus {
+			if strconv.FormatInt(conditionalMenu.MenuID, 10) == params.MenuID {
+				state.conditionalMenus = append(state.conditionalMenus[:i], state.conditionalMenus[i+1:]...)
+				return nil, 0
+			}
+		}
+		return nil, utils.ErrcodeConditionalMenuNotExist
+	})
+	handle("/cgi-bin/menu/trymatch", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			UserID string `json:"user_id"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if _, ok := state.users[params.UserID]; !ok {
+			return nil, utils.ErrcodeInvalidOpenid
+		}
+		matched := state.matchMenu(params.UserID)
+		if matched == nil {
+			return nil, utils.ErrcodeMenuNotExist
+		}
+		return H{"button": matched.Button}, 0
+	})
+}
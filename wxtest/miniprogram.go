@@ -0,0 +1,219 @@
+package wxtest
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const apiJscode2Session = "/sns/jscode2session"
+
+// MiniProgramUser 小程序用户
+type MiniProgramUser struct {
+	OpenID          string
+	UnionID         string
+	SessionKey      string   // 为空自动生成
+	PhoneNumber     string   // 带区号的手机号， 比如 +1 2025550100， 国内手机号没有区号
+	PurePhoneNumber string   // 没有区号的手机号
+	CountryCode     string   // 区号
+	Transactions    []string // 支付过的微信支付订单号， 用于 getpaidunionid
+}
+
+type miniProgramCode struct {
+	openid string
+	used   bool
+}
+
+type miniProgramState struct {
+	mutex      sync.Mutex
+	users      map[string]*MiniProgramUser
+	loginCodes map[string]*miniProgramCode
+	phoneCodes map[string]string // code -> openid
+	seq        int
+}
+
+func newMiniProgramState() *miniProgramState {
+	return &miniProgramState{
+		users:      map[string]*MiniProgramUser{},
+		loginCodes: map[string]*miniProgramCode{},
+		phoneCodes: map[string]string{},
+	}
+}
+
+// AddMiniProgram 添加小程序， 小程序和公众号使用同一个获取 access_token 的接口
+func (s *Server) AddMiniProgram(appid, secret string) {
+	s.AddOfficialAccount(appid, secret)
+}
+
+// AddMiniProgramUser 添加小程序用户， 返回的 SessionKey 可以用来生成 encryptedData
+func (s *Server) AddMiniProgramUser(user MiniProgramUser) MiniProgramUser {
+	if user.SessionKey == "" {
+		key := make([]byte, aes.BlockSize)
+		_, _ = rand.Read(key)
+		user.SessionKey = base64.StdEncoding.EncodeToString(key)
+	}
+	state := s.miniProgram
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.users[user.OpenID] = &user
+	return user
+}
+
+// MiniProgramLoginCode 模拟小程序调用 wx.login， 返回登录凭证 code
+func (s *Server) MiniProgramLoginCode(openid string) string {
+	state := s.miniProgram
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.seq++
+	code := fmt.Sprintf("JSCODE_%d", state.seq)
+	state.loginCodes[code] = &miniProgramCode{openid: openid}
+	return code
+}
+
+// MiniProgramPhoneCode 模拟用户通过手机号快速验证组件授权， 返回动态令牌 code
+func (s *Server) MiniProgramPhoneCode(openid string) string {
+	state := s.miniProgram
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.seq++
+	code := fmt.Sprintf("PHONECODE_%d", state.seq)
+	state.phoneCodes[code] = openid
+	return code
+}
+
+// MiniProgramEncryptedData 用 session_key 加密开放数据并加上水印， 模拟 wx.getUserInfo 等接口返回的 encryptedData/iv
+func MiniProgramEncryptedData(appid, sessionKey string, data H) (encryptedData, iv string, err error) {
+	aesKey, err := base64.StdEncoding.DecodeString(sessionKey)
+	if err != nil {
+		return
+	}
+	payload := H{}
+	for key, value := range data {
+		payload[key] = value
+	}
+	payload["watermark"] = H{"appid": appid, "timestamp": time.Now().Unix()}
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	// PKCS#7 补位
+	amountToPad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	plaintext = append(plaintext, bytes.Repeat([]byte{byte(amountToPad)}, amountToPad)...)
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return
+	}
+	aesIV := make([]byte, aes.BlockSize)
+	_, _ = rand.Read(aesIV)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, aesIV).CryptBlocks(ciphertext, plaintext)
+	return base64.StdEncoding.EncodeToString(ciphertext), base64.StdEncoding.EncodeToString(aesIV), nil
+}
+
+// GET /sns/jscode2session?appid=APPID&secret=SECRET&js_code=JSCODE&grant_type=authorization_code
+// 使用 secret， 不需要 access_token
+func (s *Server) serveJscode2Session(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Path != apiJscode2Session {
+		return false
+	}
+
+	query := r.URL.Query()
+	s.mutex.Lock()
+	secret, ok := s.secrets[KindOfficialAccount+":"+query.Get("appid")]
+	s.mutex.Unlock()
+
+	state := s.miniProgram
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if !ok {
+		writeError(w, utils.ErrcodeInvalidAppid)
+	} else if secret != query.Get("secret") {
+		writeError(w, utils.ErrcodeInvalidAppSecret)
+	} else if query.Get("grant_type") != "authorization_code" {
+		writeError(w, utils.ErrcodeInvalidGrantType)
+	} else if code, exist := state.loginCodes[query.Get("js_code")]; !exist {
+		writeError(w, utils.ErrcodeInvalidCode)
+	} else if code.used {
+		// code 只能使用一次
+		writeError(w, utils.ErrcodeCodeBeenUsed)
+	} else if user, exist := state.users[code.openid]; !exist {
+		writeError(w, utils.ErrcodeInvalidOpenid)
+	} else {
+		code.used = true
+		result := H{"openid": user.OpenID, "session_key": user.SessionKey}
+		if user.UnionID != "" {
+			result["unionid"] = user.UnionID
+		}
+		writeJSON(w, result)
+	}
+	return true
+}
+
+func (s *Server) registerMiniProgram() {
+	state := s.miniProgram
+	handle := func(path string, handler HandlerFunc) {
+		s.handlers[KindOfficialAccount+":"+path] = func(app string, r *http.Request, body []byte) (H, int64) {
+			state.mutex.Lock()
+			defer state.mutex.Unlock()
+			return handler(app, r, body)
+		}
+	}
+
+	// 支付后获取 UnionId
+	handle("/wxa/getpaidunionid", func(app string, r *http.Request, body []byte) (H, int64) {
+		query := r.URL.Query()
+		user, ok := state.users[query.Get("openid")]
+		if !ok {
+			return nil, utils.ErrcodeInvalidOpenid
+		}
+		order := query.Get("transaction_id")
+		if order == "" {
+			if query.Get("mch_id") == "" {
+				return nil, errcodeInvalidParameter
+			}
+			order = query.Get("out_trade_no")
+		}
+		for _, transaction := range user.Transactions {
+			if transaction == order && order != "" {
+				return H{"unionid": user.UnionID}, 0
+			}
+		}
+		return nil, errcodeMiniProgramInvalidOrder
+	})
+
+	// 获取手机号
+	handle("/wxa/business/getuserphonenumber", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			Code string `json:"code"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		openid, ok := state.phoneCodes[params.Code]
+		if !ok {
+			return nil, utils.ErrcodeInvalidCode
+		}
+		delete(state.phoneCodes, params.Code)
+		user, ok := state.users[openid]
+		if !ok {
+			return nil, utils.ErrcodeInvalidOpenid
+		}
+		return H{"phone_info": H{
+			"phoneNumber":     user.PhoneNumber,
+			"purePhoneNumber": user.PurePhoneNumber,
+			"countryCode":     user.CountryCode,
+			"watermark":       H{"appid": app, "timestamp": time.Now().Unix()},
+		}}, 0
+	})
+}
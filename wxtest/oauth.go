@@ -0,0 +1,173 @@
+package wxtest
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	apiSnsAccessToken  = "/sns/oauth2/access_token"
+	apiSnsRefreshToken = "/sns/oauth2/refresh_token"
+	apiSnsUserInfo     = "/sns/userinfo"
+	apiSnsAuth         = "/sns/auth"
+
+	snsRefreshTokenExpiresIn = 30 * 24 * time.Hour // refresh_token 有效期30天
+)
+
+type snsCode struct {
+	openid string
+	scope  string
+	used   bool
+}
+
+type snsToken struct {
+	openid  string
+	scope   string
+	expires time.Time
+}
+
+// OauthCode 模拟用户在授权页同意授权， 返回跳转到 redirect_uri 时带上的 code
+func (s *Server) OauthCode(openid, scope string) string {
+	state := s.officialAccount
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.snsSeq++
+	code := fmt.Sprintf("OAUTH_CODE_%d", state.snsSeq)
+	state.snsCodes[code] = &snsCode{openid: openid, scope: scope}
+	return code
+}
+
+// 调用者持有锁
+func (s *Server) issueSnsToken(state *officialAccountState, openid, scope, refreshToken string) H {
+	state.snsSeq++
+	accessToken := fmt.Sprintf("SNS_ACCESS_TOKEN_%d", state.snsSeq)
+	state.snsTokens[accessToken] = &snsToken{
+		openid:  openid,
+		scope:   scope,
+		expires: time.Now().Add(time.Duration(s.TokenExpiresIn) * time.Second),
+	}
+	if refreshToken == "" {
+		refreshToken = fmt.Sprintf("SNS_REFRESH_TOKEN_%d", state.snsSeq)
+		state.snsRefreshTokens[refreshToken] = &snsToken{
+			openid:  openid,
+			scope:   scope,
+			expires: time.Now().Add(snsRefreshTokenExpiresIn),
+		}
+	}
+	result := H{
+		"access_token":  accessToken,
+		"expires_in":    s.TokenExpiresIn,
+		"refresh_token": refreshToken,
+		"openid":        openid,
+		"scope":         scope,
+	}
+	if user, ok := state.users[openid]; ok && user.UnionID != "" {
+		result["unionid"] = user.UnionID
+	}
+	return result
+}
+
+// 调用者持有锁
+func (state *officialAccountState) checkSnsToken(accessToken, openid string) (*snsToken, int64) {
+	token, ok := state.snsTokens[accessToken]
+	if !ok {
+		return nil, utils.ErrcodeInvalidCredential
+	}
+	if !time.Now().Before(token.expires) {
+		return nil, utils.ErrcodeAccessTokenExpired
+	}
+	if token.openid != openid {
+		return nil, utils.ErrcodeInvalidOpenid
+	}
+	return token, 0
+}
+
+// 网页授权的接口使用用户的 access_token 或者 secret， 不需要公众号的 access_token
+func (s *Server) serveSns(w http.ResponseWriter, r *http.Request) bool {
+	query := r.URL.Query()
+	switch r.URL.Path {
+	case apiSnsAccessToken, apiSnsRefreshToken:
+	case apiSnsUserInfo, apiSnsAuth:
+		if query.Get("access_token") == "" {
+			writeError(w, utils.ErrcodeAccessTokenMissing)
+			return true
+		}
+	default:
+		return false
+	}
+
+	s.mutex.Lock()
+	secret, ok := s.secrets[KindOfficialAccount+":"+query.Get("appid")]
+	s.mutex.Unlock()
+
+	state := s.officialAccount
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	switch r.URL.Path {
+	case apiSnsAccessToken:
+		// GET /sns/oauth2/access_token?appid=APPID&secret=SECRET&code=CODE&grant_type=authorization_code
+		if !ok {
+			writeError(w, utils.ErrcodeInvalidAppid)
+		} else if secret != query.Get("secret") {
+			writeError(w, utils.ErrcodeInvalidAppSecret)
+		} else if query.Get("grant_type") != "authorization_code" {
+			writeError(w, utils.ErrcodeInvalidGrantType)
+		} else if code, exist := state.snsCodes[query.Get("code")]; !exist {
+			writeError(w, utils.ErrcodeInvalidCode)
+		} else if code.used {
+			writeError(w, utils.ErrcodeCodeBeenUsed)
+		} else {
+			code.used = true
+			writeJSON(w, s.issueSnsToken(state, code.openid, code.scope, ""))
+		}
+	case apiSnsRefreshToken:
+		// GET /sns/oauth2/refresh_token?appid=APPID&grant_type=refresh_token&refresh_token=REFRESH_TOKEN
+		refreshToken := query.Get("refresh_token")
+		if !ok {
+			writeError(w, utils.ErrcodeInvalidAppid)
+		} else if query.Get("grant_type") != "refresh_token" {
+			writeError(w, utils.ErrcodeInvalidGrantType)
+		} else if token, exist := state.snsRefreshTokens[refreshToken]; !exist {
+			writeError(w, utils.ErrcodeInvalidRefreshToken)
+		} else if !time.Now().Before(token.expires) {
+			writeError(w, utils.ErrcodeRefreshTokenExpire)
+		} else {
+			writeJSON(w, s.issueSnsToken(state, token.openid, token.scope, refreshToken))
+		}
+	case apiSnsUserInfo:
+		// GET /sns/userinfo?access_token=ACCESS_TOKEN&openid=OPENID&lang=zh_CN
+		openid := query.Get("openid")
+		token, errcode := state.checkSnsToken(query.Get("access_token"), openid)
+		if errcode != 0 {
+			writeError(w, errcode)
+		} else if token.scope != "snsapi_userinfo" {
+			writeError(w, utils.ErrcodeApiUnauthorized)
+		} else {
+			result := H{"openid": openid, "privilege": []string{}}
+			if user, exist := state.users[openid]; exist {
+				result["nickname"] = user.Nickname
+				result["sex"] = user.Sex
+				result["province"] = user.Province
+				result["city"] = user.City
+				result["country"] = user.Country
+				result["headimgurl"] = user.Headimgurl
+				if user.UnionID != "" {
+					result["unionid"] = user.UnionID
+				}
+			}
+			writeJSON(w, result)
+		}
+	case apiSnsAuth:
+		// GET /sns/auth?access_token=ACCESS_TOKEN&openid=OPENID
+		if _, errcode := state.checkSnsToken(query.Get("access_token"), query.Get("openid")); errcode != 0 {
+			writeError(w, errcode)
+		} else {
+			writeJSON(w, H{"errcode": 0, "errmsg": "ok"})
+		}
+	}
+	return true
+}
@@ -0,0 +1,412 @@
+package wxtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	officialAccountFirstTagID = 100   // 0/1/2 为系统保留的标签
+	officialAccountPageSize   = 10000 // 拉取关注者列表每次最多返回的数量
+)
+
+// OfficialAccountUser 公众号关注者
+type OfficialAccountUser struct {
+	OpenID         string `json:"openid"`
+	Nickname       string `json:"nickname"`
+	Sex            int32  `json:"sex"`
+	City           string `json:"city"`
+	Country        string `json:"country"`
+	Province       string `json:"province"`
+	Language       string `json:"language"`
+	Headimgurl     string `json:"headimgurl"`
+	SubscribeTime  int32  `json:"subscribe_time"`
+	UnionID        string `json:"unionid"`
+	Remark         string `json:"remark"`
+	SubscribeScene string `json:"subscribe_scene"`
+}
+
+type officialAccountTag struct {
+	id      int
+	name    string
+	openids map[string]bool
+}
+
+type officialAccountState struct {
+	mutex     sync.Mutex
+	users     map[string]*OfficialAccountUser
+	tags      map[int]*officialAccountTag
+	tagSeq    int
+	blacklist map[string]bool
+
+	// 客服
+	messages   []json.RawMessage
+	kfAccounts map[string]*kfAccount
+	kfSeq      int
+	kfSessions map[string]*kfSession // openid -> 会话
+
+	// 模板消息/订阅消息
+	industry           [2]string
+	templates          map[string]*template
+	subscribeTemplates map[string]*template
+	templateSeq        int
+	templateMessages   []json.RawMessage
+	templateMsgSeq     int64
+
+	// 自定义菜单
+	menu             *menu
+	conditionalMenus []*menu
+	menuSeq          int64
+
+	// 群发
+	massMessages []json.RawMessage
+	massJobs     map[int64]*massJob
+	massMsgSeq   int64
+	massSpeed    int
+
+	// 带参数二维码/短key
+	qrcodes     map[string]*qrcode
+	qrcodeSeq   int
+	shortKeys   map[string]*shortKey
+	shortKeySeq int
+
+	// 网页授权
+	snsCodes         map[string]*snsCode
+	snsTokens        map[string]*snsToken
+	snsRefreshTokens map[string]*snsToken
+	snsSeq           int
+}
+
+func newOfficialAccountState() *officialAccountState {
+	return &officialAccountState{
+		users:      map[string]*OfficialAccountUser{},
+		tags:       map[int]*officialAccountTag{},
+		tagSeq:     officialAccountFirstTagID,
+		blacklist:  map[string]bool{},
+		kfAccounts: map[string]*kfAccount{},
+		kfSeq:      officialAccountFirstKfID,
+		kfSessions: map[string]*kfSession{},
+
+		templates:          map[string]*template{},
+		subscribeTemplates: map[string]*template{},
+		templateMsgSeq:     officialAccountFirstTemplateMsgID,
+		menuSeq:            officialAccountFirstMenuID,
+		massJobs:           map[int64]*massJob{},
+		massMsgSeq:         officialAccountFirstMassMsgID - 1,
+		qrcodes:            map[string]*qrcode{},
+		shortKeys:          map[string]*shortKey{},
+		snsCodes:           map[string]*snsCode{},
+		snsTokens:          map[string]*snsToken{},
+		snsRefreshTokens:   map[string]*snsToken{},
+	}
+}
+
+// AddOfficialAccountUser 添加关注者
+func (s *Server) AddOfficialAccountUser(user OfficialAccountUser) {
+	state := s.officialAccount
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.users[user.OpenID] = &user
+}
+
+func (state *officialAccountState) sortedOpenIDs(filter func(openid string) bool) []string {
+	openids := []string{}
+	for openid := range state.users {
+		if filter == nil || filter(openid) {
+			openids = append(openids, openid)
+		}
+	}
+	sort.Strings(openids)
+	return openids
+}
+
+// 从 nextOpenID 之后开始分页
+func pageOpenIDs(openids []string, nextOpenID string) (page []string, next string) {
+	begin := 0
+	if nextOpenID != "" {
+		begin = sort.SearchStrings(openids, nextOpenID)
+		if begin < len(openids) && openids[begin] == nextOpenID {
+			begin++
+		}
+	}
+	end := begin + officialAccountPageSize
+	if end > len(openids) {
+		end = len(openids)
+	}
+	page = openids[begin:end]
+	if len(page) > 0 {
+		next = page[len(page)-1]
+	}
+	return page, next
+}
+
+func (state *officialAccountState) userInfo(user *OfficialAccountUser) H {
+	tagids := []int{}
+	for id, tag := range state.tags {
+		if tag.openids[user.OpenID] {
+			tagids = append(tagids, id)
+		}
+	}
+	sort.Ints(tagids)
+	return H{
+		"subscribe":       1,
+		"openid":          user.OpenID,
+		"nickname":        user.Nickname,
+		"sex":             user.Sex,
+		"city":            user.City,
+		"country":         user.Country,
+		"province":        user.Province,
+		"language":        user.Language,
+		"headimgurl":      user.Headimgurl,
+		"subscribe_time":  user.SubscribeTime,
+		"unionid":         user.UnionID,
+		"remark":          user.Remark,
+		"groupid":         0,
+		"tagid_list":      tagids,
+		"subscribe_scene": user.SubscribeScene,
+	}
+}
+
+func (s *Server) registerOfficialAccount() {
+	state := s.officialAccount
+	handle := func(path string, handler HandlerFunc) {
+		s.handlers[KindOfficialAccount+":"+path] = func(app string, r *http.Request, body []byte) (H, int64) {
+			state.mutex.Lock()
+			defer state.mutex.Unlock()
+			return handler(app, r, body)
+		}
+	}
+
+	// 用户管理
+	handle("/cgi-bin/user/get", func(app string, r *http.Request, body []byte) (H, int64) {
+		openids := state.sortedOpenIDs(nil)
+		page, next := pageOpenIDs(openids, r.URL.Query().Get("next_openid"))
+		return H{
+			"total":       len(openids),
+			"count":       len(page),
+			"data":        H{"openid": page},
+			"next_openid": next,
+		}, 0
+	})
+	handle("/cgi-bin/user/info", func(app string, r *http.Request, body []byte) (H, int64) {
+		user, ok := state.users[r.URL.Query().Get("openid")]
+		if !ok {
+			return nil, utils.ErrcodeInvalidOpenid
+		}
+		return state.userInfo(user), 0
+	})
+	handle("/cgi-bin/user/info/batchget", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			UserList []struct {
+				OpenID string `json:"openid"`
+			} `json:"user_list"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		users := []H{}
+		for _, item := range params.UserList {
+			user, ok := state.users[item.OpenID]
+			if !ok {
+				return nil, utils.ErrcodeInvalidOpenid
+			}
+			users = append(users, state.userInfo(user))
+		}
+		return H{"user_info_list": users}, 0
+	})
+	handle("/cgi-bin/user/info/updateremark", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			OpenID string `json:"openid"`
+			Remark string `json:"remark"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		user, ok := state.users[params.OpenID]
+		if !ok {
+			return nil, utils.ErrcodeInvalidOpenid
+		}
+		user.Remark = params.Remark
+		return nil, 0
+	})
+
+	// 黑名单
+	handle("/cgi-bin/tags/members/getblacklist", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			BeginOpenID string `json:"begin_openid"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		openids := state.sortedOpenIDs(func(openid string) bool {
+			return state.blacklist[openid]
+		})
+		page, next := pageOpenIDs(openids, params.BeginOpenID)
+		return H{
+			"total":       len(openids),
+			"count":       len(page),
+			"data":        H{"openid": page},
+			"next_openid": next,
+		}, 0
+	})
+	blacklist := func(black bool) HandlerFunc {
+		return func(app string, r *http.Request, body []byte) (H, int64) {
+			params := struct {
+				OpenIDList []string `json:"openid_list"`
+			}{}
+			if errcode := decodeBody(body, &params); errcode != 0 {
+				return nil, errcode
+			}
+			for _, openid := range params.OpenIDList {
+				if _, ok := state.users[openid]; !ok {
+					return nil, utils.ErrcodeInvalidOpenid
+				}
+			}
+			for _, openid := range params.OpenIDList {
+				if black {
+					state.blacklist[openid] = true
+				} else {
+					delete(state.blacklist, openid)
+				}
+			}
+			return nil, 0
+		}
+	}
+	handle("/cgi-bin/tags/members/batchblacklist", blacklist(true))
+	handle("/cgi-bin/tags/members/batchunblacklist", blacklist(false))
+
+	// 标签管理
+	handle("/cgi-bin/tags/create", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			Tag struct {
+				Name string `json:"name"`
+			} `json:"tag"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		for _, tag := range state.tags {
+			if tag.name == params.Tag.Name {
+				return nil, errcodeTagNameExists
+			}
+		}
+		state.tagSeq++
+		tag := &officialAccountTag{id: state.tagSeq, name: params.Tag.Name, openids: map[string]bool{}}
+		state.tags[tag.id] = tag
+		return H{"tag": H{"id": tag.id, "name": tag.name}}, 0
+	})
+	handle("/cgi-bin/tags/get", func(app string, r *http.Request, body []byte) (H, int64) {
+		ids := []int{}
+		for id := range state.tags {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		tags := []H{}
+		for _, id := range ids {
+			tag := state.tags[id]
+			tags = append(tags, H{"id": tag.id, "name": tag.name, "count": len(tag.openids)})
+		}
+		return H{"tags": tags}, 0
+	})
+	handle("/cgi-bin/tags/update", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			Tag struct {
+				ID   int    `json:"id"`
+				Name string `json:"name"`
+			} `json:"tag"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		tag, ok := state.tags[params.Tag.ID]
+		if !ok {
+			return nil, errcodeInvalidTagID
+		}
+		tag.name = params.Tag.Name
+		return nil, 0
+	})
+	handle("/cgi-bin/tags/delete", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			Tag struct {
+				ID int `json:"id"`
+			} `json:"tag"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if _, ok := state.tags[params.Tag.ID]; !ok {
+			return nil, errcodeInvalidTagID
+		}
+		delete(state.tags, params.Tag.ID)
+		return nil, 0
+	})
+	handle("/cgi-bin/user/tag/get", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			TagID      int    `json:"tagid"`
+			NextOpenID string `json:"next_openid"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		tag, ok := state.tags[params.TagID]
+		if !ok {
+			return nil, errcodeInvalidTagID
+		}
+		openids := state.sortedOpenIDs(func(openid string) bool {
+			return tag.openids[openid]
+		})
+		page, next := pageOpenIDs(openids, params.NextOpenID)
+		return H{
+			"count":       len(page),
+			"data":        H{"openid": page},
+			"next_openid": next,
+		}, 0
+	})
+	tagging := func(add bool) HandlerFunc {
+		return func(app string, r *http.Request, body []byte) (H, int64) {
+			params := struct {
+				TagID      int      `json:"tagid"`
+				OpenIDList []string `json:"openid_list"`
+			}{}
+			if errcode := decodeBody(body, &params); errcode != 0 {
+				return nil, errcode
+			}
+			tag, ok := state.tags[params.TagID]
+			if !ok {
+				return nil, errcodeInvalidTagID
+			}
+			for _, openid := range params.OpenIDList {
+				if _, ok := state.users[openid]; !ok {
+					return nil, utils.ErrcodeInvalidOpenid
+				}
+			}
+			for _, openid := range params.OpenIDList {
+				if add {
+					tag.openids[openid] = true
+				} else {
+					delete(tag.openids, openid)
+				}
+			}
+			return nil, 0
+		}
+	}
+	handle("/cgi-bin/tags/members/batchtagging", tagging(true))
+	handle("/cgi-bin/tags/members/batchuntagging", tagging(false))
+	handle("/cgi-bin/tags/getidlist", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			OpenID string `json:"openid"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		user, ok := state.users[params.OpenID]
+		if !ok {
+			return nil, utils.ErrcodeInvalidOpenid
+		}
+		return H{"tagid_list": state.userInfo(user)["tagid_list"]}, 0
+	})
+}
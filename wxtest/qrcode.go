@@ -0,0 +1,195 @@
+package wxtest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	apiShowQrcode = "/cgi-bin/showqrcode"
+
+	defaultQrcodeExpireSeconds = 60
+	maxQrcodeExpireSeconds     = 2592000
+	maxShortKeyDataBytes       = 4096
+)
+
+type qrcode struct {
+	scene   string
+	expires time.Time // 永久二维码为空
+}
+
+type shortKey struct {
+	longData   string
+	createTime time.Time
+	expires    time.Time
+}
+
+// 调用者持有锁
+func (state *officialAccountState) validQrcode(ticket string) (*qrcode, bool) {
+	item, ok := state.qrcodes[ticket]
+	if !ok || (!item.expires.IsZero() && !time.Now().Before(item.expires)) {
+		return nil, false
+	}
+	return item, true
+}
+
+// QrcodeScan 用户扫描二维码， 返回微信服务器推送的事件
+// 已关注的用户推送 SCAN 事件， 否则关注公众号并推送 EventKey 为 qrscene_ 前缀的 subscribe 事件
+func (s *Server) QrcodeScan(ticket, openid string) (string, bool) {
+	state := s.officialAccount
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	item, ok := state.validQrcode(ticket)
+	if !ok {
+		return "", false
+	}
+
+	event, eventKey := "SCAN", item.scene
+	if _, ok := state.users[openid]; !ok {
+		event, eventKey = "subscribe", "qrscene_"+item.scene
+		state.users[openid] = &OfficialAccountUser{
+			OpenID:         openid,
+			SubscribeTime:  int32(time.Now().Unix()),
+			SubscribeScene: "ADD_SCENE_QR_CODE",
+		}
+	}
+	return fmt.Sprintf(`<xml>
+	<ToUserName><![CDATA[gh_wxtest]]></ToUserName>
+	<FromUserName><![CDATA[%s]]></FromUserName>
+	<CreateTime>%d</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[%s]]></Event>
+	<EventKey><![CDATA[%s]]></EventKey>
+	<Ticket><![CDATA[%s]]></Ticket>
+</xml>`, openid, time.Now().Unix(), event, eventKey, ticket), true
+}
+
+func (s *Server) registerQrcode() {
+	state := s.officialAccount
+	handle := func(path string, handler HandlerFunc) {
+		s.handlers[KindOfficialAccount+":"+path] = func(app string, r *http.Request, body []byte) (H, int64) {
+			state.mutex.Lock()
+			defer state.mutex.Unlock()
+			return handler(app, r, body)
+		}
+	}
+
+	handle("/cgi-bin/qrcode/create", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			ExpireSeconds int    `json:"expire_seconds"`
+			ActionName    string `json:"action_name"`
+			ActionInfo    struct {
+				Scene struct {
+					SceneID  int    `json:"scene_id"`
+					SceneStr string `json:"scene_str"`
+				} `json:"scene"`
+			} `json:"action_info"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+
+		scene := params.ActionInfo.Scene
+		item := &qrcode{}
+		switch params.ActionName {
+		case "QR_SCENE", "QR_LIMIT_SCENE":
+			if scene.SceneID == 0 || (params.ActionName == "QR_LIMIT_SCENE" && scene.SceneID > 100000) {
+				return nil, errcodeInvalidParameter
+			}
+			item.scene = strconv.Itoa(scene.SceneID)
+		case "QR_STR_SCENE", "QR_LIMIT_STR_SCENE":
+			if scene.SceneStr == "" || len(scene.SceneStr) > 64 {
+				return nil, errcodeInvalidParameter
+			}
+			item.scene = scene.SceneStr
+		default:
+			return nil, errcodeInvalidParameter
+		}
+
+		expireSeconds := 0
+		if params.ActionName == "QR_SCENE" || params.ActionName == "QR_STR_SCENE" {
+			expireSeconds = params.ExpireSeconds
+			if expireSeconds <= 0 {
+				expireSeconds = defaultQrcodeExpireSeconds
+			}
+			if expireSeconds > maxQrcodeExpireSeconds {
+				expireSeconds = maxQrcodeExpireSeconds
+			}
+			item.expires = time.Now().Add(time.Duration(expireSeconds) * time.Second)
+		}
+
+		state.qrcodeSeq++
+		ticket := fmt.Sprintf("QRCODE_TICKET_%d", state.qrcodeSeq)
+		state.qrcodes[ticket] = item
+		result := H{"ticket": ticket, "url": fmt.Sprintf("http://weixin.qq.com/q/wxtest%d", state.qrcodeSeq)}
+		if expireSeconds > 0 {
+			result["expire_seconds"] = expireSeconds
+		}
+		return result, 0
+	})
+
+	// 短key托管
+	handle("/cgi-bin/shorten/gen", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			LongData      string `json:"long_data"`
+			ExpireSeconds int    `json:"expire_seconds"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if params.LongData == "" || len(params.LongData) > maxShortKeyDataBytes {
+			return nil, errcodeInvalidParameter
+		}
+		if params.ExpireSeconds <= 0 || params.ExpireSeconds > maxQrcodeExpireSeconds {
+			params.ExpireSeconds = maxQrcodeExpireSeconds
+		}
+		state.shortKeySeq++
+		key := fmt.Sprintf("SHORTKEY%d", state.shortKeySeq)
+		now := time.Now()
+		state.shortKeys[key] = &shortKey{
+			longData:   params.LongData,
+			createTime: now,
+			expires:    now.Add(time.Duration(params.ExpireSeconds) * time.Second),
+		}
+		return H{"short_key": key}, 0
+	})
+	handle("/cgi-bin/shorten/fetch", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			ShortKey string `json:"short_key"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		item, ok := state.shortKeys[params.ShortKey]
+		if !ok || !time.Now().Before(item.expires) {
+			return nil, errcodeInvalidParameter
+		}
+		return H{
+			"long_data":      item.longData,
+			"create_time":    item.createTime.Unix(),
+			"expire_seconds": int(time.Until(item.expires).Seconds()),
+		}, 0
+	})
+}
+
+// GET /cgi-bin/showqrcode?ticket=TICKET 不需要 access_token， ticket 无效返回404
+func (s *Server) serveShowQrcode(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Path != apiShowQrcode {
+		return false
+	}
+	ticket := r.URL.Query().Get("ticket")
+	state := s.officialAccount
+	state.mutex.Lock()
+	_, ok := state.validQrcode(ticket)
+	state.mutex.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return true
+	}
+	// 不是真正的图片， 测试时可以用内容判断是哪个二维码
+	w.Header().Set("Content-Type", "image/jpg")
+	_, _ = w.Write([]byte("\xff\xd8\xff" + ticket))
+	return true
+}
@@ -0,0 +1,381 @@
+// Package wxtest 本地模拟的微信/企业微信服务器， 用于单元测试和离线集成测试
+//
+// 使用方法:
+//
+//	server := wxtest.NewServer()
+//	defer server.Close()
+//	server.AddOfficialAccount("appid", "secret")
+//	officialAccount := official_account.New(cache, locker, &official_account.Config{
+//		Appid: "appid", Secret: "secret",
+//	}, utils.WithServerUrl(server.URL))
+//
+// 单元测试可以直接使用 wxtest/fixture:
+//
+//	server, officialAccount, cache := fixture.NewOfficialAccount(t)
+package wxtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	KindOfficialAccount = "officialaccount" // 公众号
+	KindWxwork          = "wxwork"          // 企业微信应用
+	KindComponent       = "component"       // 第三方平台
+
+	apiToken       = "/cgi-bin/token"    // 公众号获取token
+	apiWxworkToken = "/cgi-bin/gettoken" // 企业微信获取token
+
+	defaultTokenExpiresIn = 7200
+)
+
+// utils 中没有定义的错误码
+const (
+	errcodeInvalidParameter         int64 = 40058 // 不合法的参数
+	errcodeWxworkInvalidTagID       int64 = 40068 // 不合法的标签ID
+	errcodeWxworkTagNameExists      int64 = 40071 // 标签名字已经存在
+	errcodeDataFormat               int64 = 47001 // 解析 JSON/XML 内容错误
+	errcodeTagNameExists            int64 = 45157 // 标签名已经存在
+	errcodeInvalidTagID             int64 = 45159 // 非法的 tag_id
+	errcodeParentDepartmentNotFound int64 = 60004 // 父部门不存在
+	errcodeDepartmentHasUsers       int64 = 60005 // 部门下存在成员
+	errcodeDepartmentHasChildren    int64 = 60006 // 部门下存在子部门
+	errcodeMiniProgramInvalidOrder  int64 = 89300 // 订单无效
+)
+
+// H 接口返回的json
+type H map[string]interface{}
+
+// HandlerFunc 模拟接口， 返回 errcode 不为0表示出错
+// app 是 access_token 对应的公众号appid或者企业微信corpid
+type HandlerFunc func(app string, r *http.Request, body []byte) (result H, errcode int64)
+
+type accessToken struct {
+	kind    string
+	app     string
+	expires time.Time
+}
+
+type fault struct {
+	errcode int64
+	times   int
+}
+
+// Server 模拟服务器， 所有状态都保存在内存中
+type Server struct {
+	*httptest.Server
+	TokenExpiresIn int // 颁发token的有效期(秒)
+
+	mutex     sync.Mutex
+	secrets   map[string]string // kind:app -> secret
+	tokens    map[string]*accessToken
+	tokenSeq  int
+	ticketSeq int
+	handlers  map[string]HandlerFunc // kind:path -> handler
+	faults    map[string][]*fault    // path -> 注入的错误
+	quotas    map[string]int         // path -> 调用次数上限
+	requests  map[string]int         // path -> 调用次数
+
+	officialAccount *officialAccountState
+	wxwork          *wxworkState
+	media           *mediaState
+	component       *componentState
+	miniProgram     *miniProgramState
+}
+
+// NewServer 启动模拟服务器， 使用完毕调用 Close
+func NewServer() *Server {
+	s := &Server{
+		TokenExpiresIn:  defaultTokenExpiresIn,
+		secrets:         map[string]string{},
+		tokens:          map[string]*accessToken{},
+		handlers:        map[string]HandlerFunc{},
+		faults:          map[string][]*fault{},
+		quotas:          map[string]int{},
+		requests:        map[string]int{},
+		officialAccount: newOfficialAccountState(),
+		wxwork:          newWxworkState(),
+		media:           newMediaState(),
+		component:       newComponentState(),
+		miniProgram:     newMiniProgramState(),
+	}
+	s.registerOfficialAccount()
+	s.registerCustomService()
+	s.registerTemplate()
+	s.registerMenu()
+	s.registerMass()
+	s.registerQrcode()
+	s.registerWxwork()
+	s.registerMedia()
+	s.registerMaterial()
+	s.registerTicket()
+	s.registerComponent()
+	s.registerMiniProgram()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddOfficialAccount 添加公众号
+func (s *Server) AddOfficialAccount(appid, secret string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.secrets[KindOfficialAccount+":"+appid] = secret
+}
+
+// AddWxworkApp 添加企业微信应用， 同一个企业可以有多个secret
+func (s *Server) AddWxworkApp(corpid, secret string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.secrets[KindWxwork+":"+corpid+":"+secret] = secret
+}
+
+// Handle 注册(或者覆盖)模拟接口， kind 为 KindOfficialAccount 或 KindWxwork
+func (s *Server) Handle(kind, path string, handler HandlerFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handlers[kind+":"+path] = handler
+}
+
+// ExpireAccessTokens 所有已经颁发的token(包括网页授权的token)立即过期， 接口返回 42001
+func (s *Server) ExpireAccessTokens() {
+	s.mutex.Lock()
+	for _, token := range s.tokens {
+		token.expires = time.Now()
+	}
+	s.mutex.Unlock()
+
+	state := s.officialAccount
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	for _, token := range state.snsTokens {
+		token.expires = time.Now()
+	}
+}
+
+// InjectErrcode 接下来 times 次调用 path 返回 errcode， 比如 -1 系统繁忙
+func (s *Server) InjectErrcode(path string, errcode int64, times int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults[path] = append(s.faults[path], &fault{errcode: errcode, times: times})
+}
+
+// SetQuota path 调用次数超过 limit 之后返回 45009
+func (s *Server) SetQuota(path string, limit int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.quotas[path] = limit
+	s.requests[path] = 0
+}
+
+// RequestCount path 被调用的次数
+func (s *Server) RequestCount(path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests[path]
+}
+
+func writeJSON(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func writeError(w http.ResponseWriter, errcode int64) {
+	errmsg := utils.ErrcodeDescription(errcode)
+	if errmsg == "" {
+		errmsg = "error"
+	}
+	writeJSON(w, H{
+		"errcode": errcode,
+		"errmsg":  fmt.Sprintf("%s rid: wxtest-%d", errmsg, time.Now().UnixNano()),
+	})
+}
+
+// 调用者持有锁， 返回注入的错误
+func (s *Server) popFault(path string) int64 {
+	if limit, ok := s.quotas[path]; ok && s.requests[path] > limit {
+		return utils.ErrcodeApiFreqOutOfLimit
+	}
+
+	faults := s.faults[path]
+	if len(faults) == 0 {
+		return 0
+	}
+	f := faults[0]
+	f.times--
+	if f.times <= 0 {
+		s.faults[path] = faults[1:]
+	}
+	return f.errcode
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	s.mutex.Lock()
+	s.requests[path]++
+	errcode := s.popFault(path)
+	s.mutex.Unlock()
+
+	if errcode != 0 {
+		writeError(w, errcode)
+		return
+	}
+
+	switch path {
+	case apiToken:
+		s.serveToken(w, r)
+		return
+	case apiWxworkToken:
+		s.serveWxworkToken(w, r)
+		return
+	case apiComponentToken:
+		s.serveComponentToken(w, r)
+		return
+	}
+
+	if s.serveMediaFile(w, r) || s.serveShowQrcode(w, r) || s.serveSns(w, r) || s.serveJscode2Session(w, r) {
+		return
+	}
+
+	tokenParam := "access_token"
+	if strings.HasPrefix(path, componentApiPrefix) {
+		tokenParam = "component_access_token"
+	}
+	kind, app, errcode := s.checkAccessToken(r.URL.Query().Get(tokenParam))
+	if errcode != 0 {
+		writeError(w, errcode)
+		return
+	}
+
+	switch {
+	case path == apiMediaGet:
+		// 返回文件内容而不是json
+		s.serveMediaGet(w, r, kind)
+		return
+	case path == apiMaterialGet && kind == KindOfficialAccount:
+		s.serveMaterialGet(w, r)
+		return
+	}
+
+	s.mutex.Lock()
+	handler, ok := s.handlers[kind+":"+path]
+	s.mutex.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, errcode := handler(app, r, body)
+	if errcode != 0 {
+		writeError(w, errcode)
+		return
+	}
+	if result == nil {
+		result = H{}
+	}
+	if _, ok := result["errcode"]; !ok {
+		// 企业微信成功也返回errcode， 公众号只有部分接口返回
+		result["errcode"] = 0
+		result["errmsg"] = "ok"
+	}
+	writeJSON(w, result)
+}
+
+func (s *Server) checkAccessToken(token string) (kind, app string, errcode int64) {
+	if token == "" {
+		return "", "", utils.ErrcodeAccessTokenMissing
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	accessToken, ok := s.tokens[token]
+	if !ok {
+		return "", "", utils.ErrcodeInvalidAccessToken
+	}
+	if !time.Now().Before(accessToken.expires) {
+		return "", "", utils.ErrcodeAccessTokenExpired
+	}
+	return accessToken.kind, accessToken.app, 0
+}
+
+// 调用者持有锁
+func (s *Server) issueAccessToken(kind, app string) H {
+	s.tokenSeq++
+	token := fmt.Sprintf("ACCESS_TOKEN_%s_%d", kind, s.tokenSeq)
+	s.tokens[token] = &accessToken{
+		kind:    kind,
+		app:     app,
+		expires: time.Now().Add(time.Duration(s.TokenExpiresIn) * time.Second),
+	}
+	return H{
+		"access_token": token,
+		"expires_in":   s.TokenExpiresIn,
+	}
+}
+
+// GET /cgi-bin/token?grant_type=client_credential&appid=APPID&secret=APPSECRET
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	secret, ok := s.secrets[KindOfficialAccount+":"+query.Get("appid")]
+	if !ok {
+		writeError(w, utils.ErrcodeInvalidAppid)
+		return
+	}
+	if secret != query.Get("secret") {
+		writeError(w, utils.ErrcodeInvalidAppSecret)
+		return
+	}
+	if query.Get("grant_type") != "client_credential" {
+		writeError(w, utils.ErrcodeInvalidGrantType)
+		return
+	}
+	writeJSON(w, s.issueAccessToken(KindOfficialAccount, query.Get("appid")))
+}
+
+// GET /cgi-bin/gettoken?corpid=ID&corpsecret=SECRET
+func (s *Server) serveWxworkToken(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	corpid := query.Get("corpid")
+	if _, ok := s.secrets[KindWxwork+":"+corpid+":"+query.Get("corpsecret")]; !ok {
+		writeError(w, utils.ErrcodeInvalidCredential)
+		return
+	}
+	result := s.issueAccessToken(KindWxwork, corpid)
+	result["errcode"] = 0
+	result["errmsg"] = "ok"
+	writeJSON(w, result)
+}
+
+// 解析json请求体
+func decodeBody(body []byte, v interface{}) int64 {
+	if err := json.Unmarshal(body, v); err != nil {
+		return errcodeDataFormat
+	}
+	return 0
+}
+
+func queryInt(r *http.Request, key string) int {
+	value, _ := strconv.Atoi(r.URL.Query().Get(key))
+	return value
+}
@@ -0,0 +1,208 @@
+package wxtest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/weixin/official_account"
+	"github.com/lixinio/weixin/weixin/user_api"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxwork"
+	"github.com/lixinio/weixin/wxwork/agent"
+	"github.com/lixinio/weixin/wxwork/department_api"
+	"github.com/lixinio/weixin/wxwork/material_api"
+	"github.com/lixinio/weixin/wxwork/message_api"
+	wxwork_user_api "github.com/lixinio/weixin/wxwork/user_api"
+	"github.com/stretchr/testify/require"
+)
+
+func newOfficialAccount(t *testing.T, server *wxtest.Server) *official_account.OfficialAccount {
+	cache := memory.NewMemory(nil)
+	t.Cleanup(cache.Close)
+	server.AddOfficialAccount("appid", "secret")
+	return official_account.New(cache, cache, &official_account.Config{
+		Appid:  "appid",
+		Secret: "secret",
+	}, utils.WithServerUrl(server.URL))
+}
+
+func newAgent(t *testing.T, server *wxtest.Server) *agent.Agent {
+	cache := memory.NewMemory(nil)
+	t.Cleanup(cache.Close)
+	server.AddWxworkApp("corpid", "secret")
+	return agent.New(wxwork.New(&wxwork.Config{Corpid: "corpid"}), cache, cache, &agent.Config{
+		AgentId: "1000002",
+		Secret:  "secret",
+	}, utils.WithServerUrl(server.URL))
+}
+
+func TestOfficialAccountUser(t *testing.T) {
+	server := wxtest.NewServer()
+	defer server.Close()
+	server.AddOfficialAccountUser(wxtest.OfficialAccountUser{OpenID: "openid1", Nickname: "user1"})
+	server.AddOfficialAccountUser(wxtest.OfficialAccountUser{OpenID: "openid2", Nickname: "user2"})
+
+	ctx := context.Background()
+	api := user_api.NewOfficialAccountApi(newOfficialAccount(t, server))
+
+	openids, err := api.Get(ctx, "")
+	require.Equal(t, nil, err)
+	require.Equal(t, 2, openids.Total)
+	require.Equal(t, []string{"openid1", "openid2"}, openids.Data.OpenIDs)
+
+	require.Equal(t, nil, api.UpdateRemark(ctx, "openid1", "remark"))
+	user, err := api.GetUserInfo(ctx, "openid1", "zh_CN")
+	require.Equal(t, nil, err)
+	require.Equal(t, "user1", user.Nickname)
+	require.Equal(t, "remark", user.Remark)
+
+	_, err = api.GetUserInfo(ctx, "openid3", "zh_CN")
+	require.True(t, errors.Is(err, utils.ErrorInvalidOpenid))
+
+	tag, err := api.CreateTag(ctx, "tag1")
+	require.Equal(t, nil, err)
+	require.Equal(t, nil, api.BatchTagging(ctx, tag.Tag.ID, []string{"openid2"}))
+	tagUsers, err := api.GetUsersByTag(ctx, tag.Tag.ID, "")
+	require.Equal(t, nil, err)
+	require.Equal(t, []string{"openid2"}, tagUsers.Data.OpenIDs)
+	tagids, err := api.GetTagIdList(ctx, "openid2")
+	require.Equal(t, nil, err)
+	require.Equal(t, []int{tag.Tag.ID}, tagids.TagIDList)
+
+	require.Equal(t, nil, api.BatchBlackList(ctx, []string{"openid1"}))
+	blacklist, err := api.GetBlackList(ctx, "")
+	require.Equal(t, nil, err)
+	require.Equal(t, []string{"openid1"}, blacklist.Data.OpenIDs)
+}
+
+func TestAccessTokenErrors(t *testing.T) {
+	server := wxtest.NewServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	api := user_api.NewOfficialAccountApi(newOfficialAccount(t, server))
+
+	_, err := api.Get(ctx, "")
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, server.RequestCount("/cgi-bin/token"))
+
+	// token过期， 自动刷新并重试
+	server.ExpireAccessTokens()
+	_, err = api.Get(ctx, "")
+	require.Equal(t, nil, err)
+	require.Equal(t, 2, server.RequestCount("/cgi-bin/token"))
+	require.Equal(t, 3, server.RequestCount("/cgi-bin/user/get"))
+
+	// 系统繁忙， 缺省重试一次
+	server.InjectErrcode("/cgi-bin/user/get", utils.ErrcodeSystemBusy, 1)
+	_, err = api.Get(ctx, "")
+	require.Equal(t, nil, err)
+	require.Equal(t, 5, server.RequestCount("/cgi-bin/user/get"))
+
+	server.InjectErrcode("/cgi-bin/user/get", utils.ErrcodeSystemBusy, 2)
+	_, err = api.Get(ctx, "")
+	require.True(t, errors.Is(err, utils.ErrorSystemBusy))
+
+	// 超过调用次数
+	server.SetQuota("/cgi-bin/user/get", 1)
+	_, err = api.Get(ctx, "")
+	require.Equal(t, nil, err)
+	_, err = api.Get(ctx, "")
+	require.True(t, errors.Is(err, utils.ErrorApiFreqOutOfLimit))
+
+	// 错误的secret
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	_, err = user_api.NewOfficialAccountApi(official_account.New(cache, cache, &official_account.Config{
+		Appid:  "appid",
+		Secret: "invalid",
+	}, utils.WithServerUrl(server.URL))).Get(ctx, "")
+	require.NotEqual(t, nil, err)
+}
+
+func TestWxworkContact(t *testing.T) {
+	server := wxtest.NewServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	corpAgent := newAgent(t, server)
+
+	departmentApi := department_api.NewAgentApi(corpAgent)
+	department, err := departmentApi.Create(ctx, &department_api.CreateParam{Name: "研发", Parentid: 1})
+	require.Equal(t, nil, err)
+	_, err = departmentApi.Create(ctx, &department_api.CreateParam{Name: "研发", Parentid: 1})
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeDepartmentNameExists}))
+	require.Equal(t, nil, departmentApi.Update(ctx, &department_api.UpdateParam{ID: department.ID, Name: "技术"}))
+	departments, err := departmentApi.List(ctx, department.ID)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, len(departments.Department))
+	require.Equal(t, "技术", departments.Department[0].Name)
+
+	userApi := wxwork_user_api.NewAgentApi(corpAgent)
+	payload, _ := json.Marshal(map[string]interface{}{
+		"userid":     "zhangsan",
+		"name":       "张三",
+		"department": []int{department.ID},
+	})
+	_, err = userApi.Create(ctx, payload)
+	require.Equal(t, nil, err)
+	user, err := userApi.Get(ctx, "zhangsan")
+	require.Equal(t, nil, err)
+	require.Equal(t, "张三", user.Name)
+	require.Equal(t, []int{department.ID}, user.Department)
+	_, err = userApi.Get(ctx, "lisi")
+	require.True(t, errors.Is(err, utils.ErrorUseridNotFound))
+
+	// 部门下有成员不能删除
+	require.NotEqual(t, nil, departmentApi.Delete(ctx, department.ID))
+	_, err = userApi.Delete(ctx, url.Values{"userid": {"zhangsan"}})
+	require.Equal(t, nil, err)
+	require.Equal(t, nil, departmentApi.Delete(ctx, department.ID))
+}
+
+func TestWxworkMessageAndMedia(t *testing.T) {
+	server := wxtest.NewServer()
+	defer server.Close()
+	server.AddWxworkUser(wxtest.WxworkUser{UserID: "zhangsan", Name: "张三", Department: []int{1}})
+
+	ctx := context.Background()
+	corpAgent := newAgent(t, server)
+
+	messageApi := message_api.NewAgentApi(corpAgent)
+	payload := []byte(`{"touser":"zhangsan|lisi","msgtype":"text","agentid":1000002,"text":{"content":"hello"}}`)
+	resp, err := messageApi.Send(ctx, payload)
+	require.Equal(t, nil, err)
+	result := struct {
+		InvalidUser string `json:"invaliduser"`
+	}{}
+	require.Equal(t, nil, json.Unmarshal(resp, &result))
+	require.Equal(t, "lisi", result.InvalidUser)
+	require.Equal(t, 1, len(server.WxworkMessages()))
+	require.JSONEq(t, string(payload), string(server.WxworkMessages()[0]))
+
+	_, err = messageApi.Send(ctx, []byte(`{"touser":"lisi","msgtype":"text","agentid":1000002}`))
+	require.True(t, errors.Is(err, utils.WeixinError{Errcode: utils.ErrcodeInvalidContactTarget}))
+
+	materialApi := material_api.NewAgentApi(corpAgent)
+	content := []byte("hello wxtest")
+	material, err := materialApi.Upload(ctx, "hello.txt", bytes.NewReader(content), "file")
+	require.Equal(t, nil, err)
+	require.Equal(t, "file", material.Type)
+	data, ok := server.Media(material.MediaID)
+	require.True(t, ok)
+	require.Equal(t, content, data)
+
+	response, err := materialApi.Get(ctx, material.MediaID)
+	require.Equal(t, nil, err)
+	defer response.Body.Close()
+	data, err = ioutil.ReadAll(response.Body)
+	require.Equal(t, nil, err)
+	require.Equal(t, content, data)
+}
@@ -0,0 +1,236 @@
+package wxtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	officialAccountFirstTemplateMsgID = 200000000
+	officialAccountTemplateLimit      = 25 // 模板消息最多25个模板
+)
+
+// 模板消息行业代码(部分)
+var templateIndustries = map[string][2]string{
+	"1": {"IT科技", "互联网/电子商务"},
+	"2": {"IT科技", "IT软件与服务"},
+	"3": {"IT科技", "IT硬件与设备"},
+	"4": {"IT科技", "电子技术"},
+	"5": {"IT科技", "通信与运营商"},
+	"6": {"IT科技", "网络游戏"},
+	"7": {"金融业", "银行"},
+}
+
+// 订阅消息的公众号类目(部分)
+var subscribeCategories = []H{
+	{"id": 616, "name": "公交"},
+	{"id": 627, "name": "软件服务提供商"},
+}
+
+type template struct {
+	id      string
+	title   string
+	content string
+	kind    int // 订阅消息模板类型
+}
+
+// TemplateMessages 发送的模板消息、一次性订阅消息和订阅通知(原始请求)
+func (s *Server) TemplateMessages() []json.RawMessage {
+	state := s.officialAccount
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return append([]json.RawMessage{}, state.templateMessages...)
+}
+
+func sortedTemplates(templates map[string]*template) []*template {
+	list := []*template{}
+	for _, item := range templates {
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].id < list[j].id
+	})
+	return list
+}
+
+func (s *Server) registerTemplate() {
+	state := s.officialAccount
+	handle := func(path string, handler HandlerFunc) {
+		s.handlers[KindOfficialAccount+":"+path] = func(app string, r *http.Request, body []byte) (H, int64) {
+			state.mutex.Lock()
+			defer state.mutex.Unlock()
+			return handler(app, r, body)
+		}
+	}
+	industry := func(id string) H {
+		names := templateIndustries[id]
+		return H{"first_class": names[0], "second_class": names[1]}
+	}
+
+	// 模板消息
+	handle("/cgi-bin/template/api_set_industry", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			IndustryID1 string `json:"industry_id1"`
+			IndustryID2 string `json:"industry_id2"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		for _, id := range []string{params.IndustryID1, params.IndustryID2} {
+			if _, ok := templateIndustries[id]; !ok {
+				return nil, utils.ErrcodeInvalidIndustryId
+			}
+		}
+		state.industry = [2]string{params.IndustryID1, params.IndustryID2}
+		return nil, 0
+	})
+	handle("/cgi-bin/template/get_industry", func(app string, r *http.Request, body []byte) (H, int64) {
+		return H{
+			"primary_industry":   industry(state.industry[0]),
+			"secondary_industry": industry(state.industry[1]),
+		}, 0
+	})
+	handle("/cgi-bin/template/api_add_template", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			TemplateIDShort string   `json:"template_id_short"`
+			KeywordNameList []string `json:"keyword_name_list"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if params.TemplateIDShort == "" {
+			return nil, utils.ErrcodeInvalidTemplateId
+		}
+		if len(state.templates) >= officialAccountTemplateLimit {
+			return nil, utils.ErrcodeTemplateSizeLimit
+		}
+		content := ""
+		for _, keyword := range params.KeywordNameList {
+			content += fmt.Sprintf("%s：{{%s.DATA}}\n", keyword, keyword)
+		}
+		state.templateSeq++
+		id := fmt.Sprintf("TEMPLATE_ID_%d", state.templateSeq)
+		state.templates[id] = &template{id: id, title: params.TemplateIDShort, content: content}
+		return H{"template_id": id}, 0
+	})
+	handle("/cgi-bin/template/get_all_private_template", func(app string, r *http.Request, body []byte) (H, int64) {
+		list := []H{}
+		for _, item := range sortedTemplates(state.templates) {
+			list = append(list, H{
+				"template_id":      item.id,
+				"title":            item.title,
+				"primary_industry": templateIndustries[state.industry[0]][0],
+				"deputy_industry":  templateIndustries[state.industry[0]][1],
+				"content":          item.content,
+				"example":          "",
+			})
+		}
+		return H{"template_list": list}, 0
+	})
+	handle("/cgi-bin/template/del_private_template", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			TemplateID string `json:"template_id"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if _, ok := state.templates[params.TemplateID]; !ok {
+			return nil, utils.ErrcodeInvalidTemplateId
+		}
+		delete(state.templates, params.TemplateID)
+		return nil, 0
+	})
+
+	// 发送， templates 为 nil 表示不校验模板id(一次性订阅消息)
+	send := func(templates map[string]*template, returnMsgID bool) HandlerFunc {
+		return func(app string, r *http.Request, body []byte) (H, int64) {
+			params := struct {
+				ToUser     string                     `json:"touser"`
+				TemplateID string                     `json:"template_id"`
+				Data       map[string]json.RawMessage `json:"data"`
+			}{}
+			if errcode := decodeBody(body, &params); errcode != 0 {
+				return nil, errcode
+			}
+			if _, ok := state.users[params.ToUser]; !ok {
+				return nil, utils.ErrcodeInvalidOpenid
+			}
+			if params.TemplateID == "" {
+				return nil, utils.ErrcodeInvalidTemplateId
+			}
+			if _, ok := templates[params.TemplateID]; !ok && templates != nil {
+				return nil, utils.ErrcodeInvalidTemplateId
+			}
+			if len(params.Data) == 0 {
+				return nil, errcodeInvalidParameter
+			}
+			state.templateMessages = append(state.templateMessages, json.RawMessage(body))
+			if !returnMsgID {
+				return nil, 0
+			}
+			state.templateMsgSeq++
+			return H{"msgid": state.templateMsgSeq}, 0
+		}
+	}
+	handle("/cgi-bin/message/template/send", send(state.templates, true))
+	handle("/cgi-bin/message/template/subscribe", send(nil, false))
+	handle("/cgi-bin/message/subscribe/bizsend", send(state.subscribeTemplates, false))
+
+	// 订阅通知
+	handle("/wxaapi/newtmpl/getcategory", func(app string, r *http.Request, body []byte) (H, int64) {
+		return H{"data": subscribeCategories}, 0
+	})
+	handle("/wxaapi/newtmpl/addtemplate", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			Tid       string `json:"tid"`
+			KidList   []int  `json:"kidList"`
+			SceneDesc string `json:"sceneDesc"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if params.Tid == "" || len(params.KidList) == 0 || len(params.KidList) > 5 {
+			return nil, errcodeInvalidParameter
+		}
+		content := ""
+		for _, kid := range params.KidList {
+			content += fmt.Sprintf("thing%d:{{thing%d.DATA}}\n", kid, kid)
+		}
+		state.templateSeq++
+		id := fmt.Sprintf("PRI_TMPL_ID_%d", state.templateSeq)
+		state.subscribeTemplates[id] = &template{
+			id: id, title: "TID_" + params.Tid, content: content, kind: 2,
+		}
+		return H{"priTmplId": id}, 0
+	})
+	handle("/wxaapi/newtmpl/deltemplate", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			PriTmplID string `json:"priTmplId"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if _, ok := state.subscribeTemplates[params.PriTmplID]; !ok {
+			return nil, utils.ErrcodeInvalidTemplateId
+		}
+		delete(state.subscribeTemplates, params.PriTmplID)
+		return nil, 0
+	})
+	handle("/wxaapi/newtmpl/gettemplate", func(app string, r *http.Request, body []byte) (H, int64) {
+		list := []H{}
+		for _, item := range sortedTemplates(state.subscribeTemplates) {
+			list = append(list, H{
+				"priTmplId": item.id,
+				"title":     item.title,
+				"content":   item.content,
+				"example":   "",
+				"type":      item.kind,
+			})
+		}
+		return H{"data": list}, 0
+	})
+}
@@ -0,0 +1,40 @@
+package wxtest
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const defaultTicketExpiresIn = 7200
+
+// 调用者不持有锁
+func (s *Server) issueTicket(kind, app, ticketType string) H {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ticketSeq++
+	return H{
+		"ticket":     fmt.Sprintf("TICKET_%s_%s_%s_%d", kind, app, ticketType, s.ticketSeq),
+		"expires_in": defaultTicketExpiresIn,
+	}
+}
+
+// JS-SDK 和卡券的票据， 每次调用都颁发新的票据， 可以用 RequestCount 检查是否缓存
+func (s *Server) registerTicket() {
+	s.handlers[KindOfficialAccount+":/cgi-bin/ticket/getticket"] = func(app string, r *http.Request, body []byte) (H, int64) {
+		ticketType := r.URL.Query().Get("type")
+		if ticketType != "jsapi" && ticketType != "wx_card" {
+			return nil, errcodeInvalidParameter
+		}
+		return s.issueTicket(KindOfficialAccount, app, ticketType), 0
+	}
+	s.handlers[KindWxwork+":/cgi-bin/get_jsapi_ticket"] = func(app string, r *http.Request, body []byte) (H, int64) {
+		return s.issueTicket(KindWxwork, app, "jsapi"), 0
+	}
+	s.handlers[KindWxwork+":/cgi-bin/ticket/get"] = func(app string, r *http.Request, body []byte) (H, int64) {
+		ticketType := r.URL.Query().Get("type")
+		if ticketType != "agent_config" {
+			return nil, errcodeInvalidParameter
+		}
+		return s.issueTicket(KindWxwork, app, ticketType), 0
+	}
+}
@@ -0,0 +1,577 @@
+package wxtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const wxworkRootDepartmentID = 1 // 根部门
+
+// WxworkDepartment 企业微信部门
+type WxworkDepartment struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	NameEn   string `json:"name_en"`
+	Parentid int    `json:"parentid"`
+	Order    int    `json:"order"`
+}
+
+// WxworkUser 企业微信成员
+type WxworkUser struct {
+	UserID     string `json:"userid"`
+	Name       string `json:"name"`
+	Alias      string `json:"alias"`
+	Mobile     string `json:"mobile"`
+	Email      string `json:"email"`
+	Position   string `json:"position"`
+	AvatarURL  string `json:"avatar"`
+	Telephone  string `json:"telephone"`
+	Gender     string `json:"gender"`
+	Status     int    `json:"status"`
+	Department []int  `json:"department"`
+}
+
+type wxworkTag struct {
+	id       int
+	name     string
+	userids  map[string]bool
+	partyids map[int]bool
+}
+
+type wxworkState struct {
+	mutex         sync.Mutex
+	departments   map[int]*WxworkDepartment
+	departmentSeq int
+	users         map[string]*WxworkUser
+	tags          map[int]*wxworkTag
+	tagSeq        int
+	messages      []json.RawMessage
+	msgSeq        int
+}
+
+func newWxworkState() *wxworkState {
+	return &wxworkState{
+		departments: map[int]*WxworkDepartment{
+			wxworkRootDepartmentID: {ID: wxworkRootDepartmentID, Name: "wxtest"},
+		},
+		departmentSeq: wxworkRootDepartmentID,
+		users:         map[string]*WxworkUser{},
+		tags:          map[int]*wxworkTag{},
+	}
+}
+
+// AddWxworkDepartment 添加部门， 父部门必须存在
+func (s *Server) AddWxworkDepartment(department WxworkDepartment) {
+	state := s.wxwork
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.departments[department.ID] = &department
+	if department.ID > state.departmentSeq {
+		state.departmentSeq = department.ID
+	}
+}
+
+// AddWxworkUser 添加成员
+func (s *Server) AddWxworkUser(user WxworkUser) {
+	state := s.wxwork
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.users[user.UserID] = &user
+}
+
+// WxworkMessages 通过应用发送的消息(原始请求)
+func (s *Server) WxworkMessages() []json.RawMessage {
+	state := s.wxwork
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return append([]json.RawMessage{}, state.messages...)
+}
+
+// 部门及其所有子部门
+func (state *wxworkState) subDepartments(id int) []int {
+	ids := []int{id}
+	for _, department := range state.departments {
+		if department.Parentid == id && department.ID != id {
+			ids = append(ids, state.subDepartments(department.ID)...)
+		}
+	}
+	return ids
+}
+
+func (state *wxworkState) checkDepartments(ids []int) int64 {
+	for _, id := range ids {
+		if _, ok := state.departments[id]; !ok {
+			return utils.ErrcodeInvalidPartyId
+		}
+	}
+	return 0
+}
+
+func (state *wxworkState) checkMobile(userid, mobile string) int64 {
+	if mobile == "" {
+		return 0
+	}
+	for _, user := range state.users {
+		if user.Mobile == mobile && user.UserID != userid {
+			return utils.ErrcodeMobileExists
+		}
+	}
+	return 0
+}
+
+// 部门下的成员
+func (state *wxworkState) departmentUsers(r *http.Request) ([]*WxworkUser, int64) {
+	id := queryInt(r, "department_id")
+	if _, ok := state.departments[id]; !ok {
+		return nil, utils.ErrcodeInvalidPartyId
+	}
+	ids := []int{id}
+	if queryInt(r, "fetch_child") == 1 {
+		ids = state.subDepartments(id)
+	}
+	wanted := map[int]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	users := []*WxworkUser{}
+	for _, user := range state.users {
+		for _, id := range user.Department {
+			if wanted[id] {
+				users = append(users, user)
+				break
+			}
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].UserID < users[j].UserID
+	})
+	return users, 0
+}
+
+// 返回无效的成员和部门
+func (state *wxworkState) invalidTargets(userids []string, partyids []int) ([]string, []int) {
+	invalidUsers := []string{}
+	for _, userid := range userids {
+		if _, ok := state.users[userid]; !ok {
+			invalidUsers = append(invalidUsers, userid)
+		}
+	}
+	invalidParties := []int{}
+	for _, id := range partyids {
+		if _, ok := state.departments[id]; !ok {
+			invalidParties = append(invalidParties, id)
+		}
+	}
+	return invalidUsers, invalidParties
+}
+
+func (s *Server) registerWxwork() {
+	state := s.wxwork
+	handle := func(path string, handler HandlerFunc) {
+		s.handlers[KindWxwork+":"+path] = func(app string, r *http.Request, body []byte) (H, int64) {
+			state.mutex.Lock()
+			defer state.mutex.Unlock()
+			return handler(app, r, body)
+		}
+	}
+
+	// 部门管理
+	handle("/cgi-bin/department/create", func(app string, r *http.Request, body []byte) (H, int64) {
+		department := WxworkDepartment{}
+		if errcode := decodeBody(body, &department); errcode != 0 {
+			return nil, errcode
+		}
+		if _, ok := state.departments[department.Parentid]; !ok {
+			return nil, errcodeParentDepartmentNotFound
+		}
+		if _, ok := state.departments[department.ID]; ok {
+			return nil, utils.ErrcodeInvalidPartyId
+		}
+		for _, item := range state.departments {
+			if item.Parentid == department.Parentid && item.Name == department.Name {
+				return nil, utils.ErrcodeDepartmentNameExists
+			}
+		}
+		if department.ID == 0 {
+			state.departmentSeq++
+			department.ID = state.departmentSeq
+		} else if department.ID > state.departmentSeq {
+			state.departmentSeq = department.ID
+		}
+		state.departments[department.ID] = &department
+		return H{"id": department.ID}, 0
+	})
+	handle("/cgi-bin/department/update", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			ID       int    `json:"id"`
+			Name     string `json:"name"`
+			NameEn   string `json:"name_en"`
+			Parentid int    `json:"parentid"`
+			Order    int    `json:"order"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		department, ok := state.departments[params.ID]
+		if !ok {
+			return nil, utils.ErrcodeInvalidPartyId
+		}
+		if params.Parentid != 0 {
+			if _, ok := state.departments[params.Parentid]; !ok {
+				return nil, errcodeParentDepartmentNotFound
+			}
+			department.Parentid = params.Parentid
+		}
+		if params.Name != "" {
+			department.Name = params.Name
+		}
+		if params.NameEn != "" {
+			department.NameEn = params.NameEn
+		}
+		if params.Order != 0 {
+			department.Order = params.Order
+		}
+		return nil, 0
+	})
+	handle("/cgi-bin/department/delete", func(app string, r *http.Request, body []byte) (H, int64) {
+		id := queryInt(r, "id")
+		if _, ok := state.departments[id]; !ok {
+			return nil, utils.ErrcodeInvalidPartyId
+		}
+		if len(state.subDepartments(id)) > 1 {
+			return nil, errcodeDepartmentHasChildren
+		}
+		for _, user := range state.users {
+			for _, department := range user.Department {
+				if department == id {
+					return nil, errcodeDepartmentHasUsers
+				}
+			}
+		}
+		delete(state.departments, id)
+		return nil, 0
+	})
+	handle("/cgi-bin/department/list", func(app string, r *http.Request, body []byte) (H, int64) {
+		ids := []int{}
+		if r.URL.Query().Get("id") == "" {
+			for id := range state.departments {
+				ids = append(ids, id)
+			}
+		} else {
+			id := queryInt(r, "id")
+			if _, ok := state.departments[id]; !ok {
+				return nil, utils.ErrcodeInvalidPartyId
+			}
+			ids = state.subDepartments(id)
+		}
+		sort.Ints(ids)
+		departments := []*WxworkDepartment{}
+		for _, id := range ids {
+			departments = append(departments, state.departments[id])
+		}
+		return H{"department": departments}, 0
+	})
+
+	// 成员管理
+	handle("/cgi-bin/user/create", func(app string, r *http.Request, body []byte) (H, int64) {
+		user := WxworkUser{}
+		if errcode := decodeBody(body, &user); errcode != 0 {
+			return nil, errcode
+		}
+		if user.UserID == "" || user.Name == "" {
+			return nil, errcodeInvalidParameter
+		}
+		if _, ok := state.users[user.UserID]; ok {
+			return nil, utils.ErrcodeUseridExists
+		}
+		if errcode := state.checkMobile(user.UserID, user.Mobile); errcode != 0 {
+			return nil, errcode
+		}
+		if len(user.Department) == 0 {
+			user.Department = []int{wxworkRootDepartmentID}
+		}
+		if errcode := state.checkDepartments(user.Department); errcode != 0 {
+			return nil, errcode
+		}
+		if user.Status == 0 {
+			user.Status = 4 // 未激活
+		}
+		state.users[user.UserID] = &user
+		return H{"errcode": 0, "errmsg": "created"}, 0
+	})
+	handle("/cgi-bin/user/get", func(app string, r *http.Request, body []byte) (H, int64) {
+		user, ok := state.users[r.URL.Query().Get("userid")]
+		if !ok {
+			return nil, utils.ErrcodeUseridNotFound
+		}
+		result := H{}
+		data, _ := json.Marshal(user)
+		_ = json.Unmarshal(data, &result)
+		return result, 0
+	})
+	handle("/cgi-bin/user/update", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := WxworkUser{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		user, ok := state.users[params.UserID]
+		if !ok {
+			return nil, utils.ErrcodeUseridNotFound
+		}
+		if errcode := state.checkMobile(user.UserID, params.Mobile); errcode != 0 {
+			return nil, errcode
+		}
+		if errcode := state.checkDepartments(params.Department); errcode != 0 {
+			return nil, errcode
+		}
+		// 只更新传入的字段
+		if err := json.Unmarshal(body, user); err != nil {
+			return nil, errcodeDataFormat
+		}
+		return H{"errcode": 0, "errmsg": "updated"}, 0
+	})
+	handle("/cgi-bin/user/delete", func(app string, r *http.Request, body []byte) (H, int64) {
+		userid := r.URL.Query().Get("userid")
+		if _, ok := state.users[userid]; !ok {
+			return nil, utils.ErrcodeUseridNotFound
+		}
+		delete(state.users, userid)
+		for _, tag := range state.tags {
+			delete(tag.userids, userid)
+		}
+		return H{"errcode": 0, "errmsg": "deleted"}, 0
+	})
+	handle("/cgi-bin/user/simplelist", func(app string, r *http.Request, body []byte) (H, int64) {
+		users, errcode := state.departmentUsers(r)
+		if errcode != 0 {
+			return nil, errcode
+		}
+		userlist := []H{}
+		for _, user := range users {
+			userlist = append(userlist, H{
+				"userid":     user.UserID,
+				"name":       user.Name,
+				"department": user.Department,
+			})
+		}
+		return H{"userlist": userlist}, 0
+	})
+	handle("/cgi-bin/user/list", func(app string, r *http.Request, body []byte) (H, int64) {
+		users, errcode := state.departmentUsers(r)
+		if errcode != 0 {
+			return nil, errcode
+		}
+		return H{"userlist": users}, 0
+	})
+
+	// 标签管理
+	handle("/cgi-bin/tag/create", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			TagName string `json:"tagname"`
+			TagID   int    `json:"tagid"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		for _, tag := range state.tags {
+			if tag.name == params.TagName {
+				return nil, errcodeWxworkTagNameExists
+			}
+		}
+		if _, ok := state.tags[params.TagID]; ok {
+			return nil, errcodeWxworkInvalidTagID
+		}
+		if params.TagID == 0 {
+			state.tagSeq++
+			params.TagID = state.tagSeq
+		} else if params.TagID > state.tagSeq {
+			state.tagSeq = params.TagID
+		}
+		state.tags[params.TagID] = &wxworkTag{
+			id:       params.TagID,
+			name:     params.TagName,
+			userids:  map[string]bool{},
+			partyids: map[int]bool{},
+		}
+		return H{"errcode": 0, "errmsg": "created", "tagid": params.TagID}, 0
+	})
+	handle("/cgi-bin/tag/update", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			TagID   int    `json:"tagid"`
+			TagName string `json:"tagname"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		tag, ok := state.tags[params.TagID]
+		if !ok {
+			return nil, errcodeWxworkInvalidTagID
+		}
+		tag.name = params.TagName
+		return H{"errcode": 0, "errmsg": "updated"}, 0
+	})
+	handle("/cgi-bin/tag/delete", func(app string, r *http.Request, body []byte) (H, int64) {
+		id := queryInt(r, "tagid")
+		if _, ok := state.tags[id]; !ok {
+			return nil, errcodeWxworkInvalidTagID
+		}
+		delete(state.tags, id)
+		return H{"errcode": 0, "errmsg": "deleted"}, 0
+	})
+	handle("/cgi-bin/tag/get", func(app string, r *http.Request, body []byte) (H, int64) {
+		tag, ok := state.tags[queryInt(r, "tagid")]
+		if !ok {
+			return nil, errcodeWxworkInvalidTagID
+		}
+		userids := []string{}
+		for userid := range tag.userids {
+			userids = append(userids, userid)
+		}
+		sort.Strings(userids)
+		userlist := []H{}
+		for _, userid := range userids {
+			userlist = append(userlist, H{"userid": userid, "name": state.users[userid].Name})
+		}
+		partylist := []int{}
+		for id := range tag.partyids {
+			partylist = append(partylist, id)
+		}
+		sort.Ints(partylist)
+		return H{"tagname": tag.name, "userlist": userlist, "partylist": partylist}, 0
+	})
+	tagUsers := func(add bool) HandlerFunc {
+		return func(app string, r *http.Request, body []byte) (H, int64) {
+			params := struct {
+				TagID     int      `json:"tagid"`
+				UserList  []string `json:"userlist"`
+				PartyList []int    `json:"partylist"`
+			}{}
+			if errcode := decodeBody(body, &params); errcode != 0 {
+				return nil, errcode
+			}
+			tag, ok := state.tags[params.TagID]
+			if !ok {
+				return nil, errcodeWxworkInvalidTagID
+			}
+			invalidUsers, invalidParties := state.invalidTargets(params.UserList, params.PartyList)
+			if len(invalidUsers) == len(params.UserList) && len(invalidParties) == len(params.PartyList) {
+				return nil, utils.ErrcodeInvalidContactTarget
+			}
+			for _, userid := range params.UserList {
+				if _, ok := state.users[userid]; ok {
+					if add {
+						tag.userids[userid] = true
+					} else {
+						delete(tag.userids, userid)
+					}
+				}
+			}
+			for _, id := range params.PartyList {
+				if _, ok := state.departments[id]; ok {
+					if add {
+						tag.partyids[id] = true
+					} else {
+						delete(tag.partyids, id)
+					}
+				}
+			}
+			result := H{}
+			if len(invalidUsers) > 0 {
+				result["invalidlist"] = strings.Join(invalidUsers, "|")
+			}
+			if len(invalidParties) > 0 {
+				result["invalidparty"] = invalidParties
+			}
+			return result, 0
+		}
+	}
+	handle("/cgi-bin/tag/addtagusers", tagUsers(true))
+	handle("/cgi-bin/tag/deltagusers", tagUsers(false))
+	handle("/cgi-bin/tag/list", func(app string, r *http.Request, body []byte) (H, int64) {
+		ids := []int{}
+		for id := range state.tags {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		taglist := []H{}
+		for _, id := range ids {
+			taglist = append(taglist, H{"tagid": id, "tagname": state.tags[id].name})
+		}
+		return H{"taglist": taglist}, 0
+	})
+
+	// 发送应用消息
+	handle("/cgi-bin/message/send", func(app string, r *http.Request, body []byte) (H, int64) {
+		params := struct {
+			ToUser  string `json:"touser"`
+			ToParty string `json:"toparty"`
+			ToTag   string `json:"totag"`
+			MsgType string `json:"msgtype"`
+			AgentID int    `json:"agentid"`
+		}{}
+		if errcode := decodeBody(body, &params); errcode != 0 {
+			return nil, errcode
+		}
+		if params.AgentID == 0 {
+			return nil, utils.ErrcodeInvalidAgentid
+		}
+		if params.MsgType == "" {
+			return nil, errcodeInvalidParameter
+		}
+
+		invalidUsers, invalidParties, invalidTags := []string{}, []string{}, []string{}
+		valid := params.ToUser == "@all"
+		if !valid {
+			for _, userid := range splitTargets(params.ToUser) {
+				if _, ok := state.users[userid]; ok {
+					valid = true
+				} else {
+					invalidUsers = append(invalidUsers, userid)
+				}
+			}
+			for _, party := range splitTargets(params.ToParty) {
+				id, _ := strconv.Atoi(party)
+				if _, ok := state.departments[id]; ok {
+					valid = true
+				} else {
+					invalidParties = append(invalidParties, party)
+				}
+			}
+			for _, tag := range splitTargets(params.ToTag) {
+				id, _ := strconv.Atoi(tag)
+				if _, ok := state.tags[id]; ok {
+					valid = true
+				} else {
+					invalidTags = append(invalidTags, tag)
+				}
+			}
+		}
+		if !valid {
+			return nil, utils.ErrcodeInvalidContactTarget
+		}
+
+		state.messages = append(state.messages, json.RawMessage(body))
+		state.msgSeq++
+		return H{
+			"invaliduser":  strings.Join(invalidUsers, "|"),
+			"invalidparty": strings.Join(invalidParties, "|"),
+			"invalidtag":   strings.Join(invalidTags, "|"),
+			"msgid":        fmt.Sprintf("wxtest_msgid_%d", state.msgSeq),
+		}, 0
+	})
+}
+
+func splitTargets(targets string) []string {
+	if targets == "" {
+		return nil
+	}
+	return strings.Split(targets, "|")
+}
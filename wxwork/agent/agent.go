@@ -16,17 +16,34 @@ type Agent struct {
 	Config *Config
 	wxwork *work.WxWork
 	Client *utils.Client
+
+	jsapiTicketCache       *utils.AccessTokenCache // 缓存企业的 jsapi_ticket
+	agentConfigTicketCache *utils.AccessTokenCache // 缓存应用的 jsapi_ticket
 }
 
-func New(corp *work.WxWork, cache utils.Cache, locker utils.Lock, config *Config) *Agent {
+// New opts 可以指定 http.Client / 超时 / 代理 / 服务器地址等， 参考 utils.ClientOption
+func New(corp *work.WxWork, cache utils.Cache, locker utils.Lock, config *Config, opts ...utils.ClientOption) *Agent {
 	instance := &Agent{
 		Config: config,
 		wxwork: corp,
 	}
-	instance.Client = corp.NewClient(utils.NewAccessTokenCache(instance, cache, locker, 0))
+	instance.Client = corp.NewClient(utils.NewAccessTokenCache(instance, cache, locker, 0), opts...)
+	instance.jsapiTicketCache = utils.NewTicketCache(
+		fmt.Sprintf("jsapi-ticket:qywx-agent:%s:%s", corp.Config.Corpid, config.AgentId),
+		instance.GetJSApiTicket, cache, locker,
+	)
+	instance.agentConfigTicketCache = utils.NewTicketCache(
+		fmt.Sprintf("agent-config-ticket:qywx-agent:%s:%s", corp.Config.Corpid, config.AgentId),
+		instance.GetAgentConfigTicket, cache, locker,
+	)
 	return instance
 }
 
+// Corpid 应用所属企业的 corpid
+func (agent *Agent) Corpid() string {
+	return agent.wxwork.Config.Corpid
+}
+
 // GetAccessToken 接口 weixin.AccessTokenGetter 实现
 func (agent *Agent) GetAccessToken() (accessToken string, expiresIn int, err error) {
 	accessToken, expiresIn, err = agent.refreshAccessTokenFromWXServer()
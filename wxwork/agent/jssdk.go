@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+const (
+	apiGetJSApiTicket = "/cgi-bin/get_jsapi_ticket"
+	apiGetTicket      = "/cgi-bin/ticket/get"
+)
+
+type ticketResponse struct {
+	utils.CommonError
+	Ticket    string `json:"ticket"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+/*
+获取企业的jsapi_ticket
+
+用于 wx.config 签名， 有效期7200秒， 调用次数有限， 本方法不做缓存， 一般使用 GetCachedJSApiTicket 或者 SignJSConfig
+
+See: https://work.weixin.qq.com/api/doc/90000/90136/90506
+
+GET https://qyapi.weixin.qq.com/cgi-bin/get_jsapi_ticket?access_token=ACCESS_TOKEN
+*/
+func (agent *Agent) GetJSApiTicket(ctx context.Context) (ticket string, expiresIn int64, err error) {
+	result := &ticketResponse{}
+	err = agent.Client.ApiGetNullWrapper(ctx, apiGetJSApiTicket, result)
+	if err != nil {
+		return
+	}
+	return result.Ticket, result.ExpiresIn, nil
+}
+
+/*
+获取应用的jsapi_ticket
+
+用于 wx.agentConfig 签名， 有效期7200秒， 调用次数有限， 本方法不做缓存， 一般使用 GetCachedAgentConfigTicket 或者 SignAgentConfig
+
+See: https://work.weixin.qq.com/api/doc/90000/90136/90506
+
+GET https://qyapi.weixin.qq.com/cgi-bin/ticket/get?access_token=ACCESS_TOKEN&type=agent_config
+*/
+func (agent *Agent) GetAgentConfigTicket(ctx context.Context) (ticket string, expiresIn int64, err error) {
+	result := &ticketResponse{}
+	err = agent.Client.ApiGetWrapper(ctx, apiGetTicket, func(params url.Values) {
+		params.Add("type", "agent_config")
+	}, result)
+	if err != nil {
+		return
+	}
+	return result.Ticket, result.ExpiresIn, nil
+}
+
+// JSApiTicketCache 企业 jsapi_ticket 的缓存， 可以加到 utils.AccessTokenRefresher 后台刷新
+func (agent *Agent) JSApiTicketCache() *utils.AccessTokenCache {
+	return agent.jsapiTicketCache
+}
+
+// AgentConfigTicketCache 应用 jsapi_ticket 的缓存
+func (agent *Agent) AgentConfigTicketCache() *utils.AccessTokenCache {
+	return agent.agentConfigTicketCache
+}
+
+// GetCachedJSApiTicket 优先从缓存获取企业的 jsapi_ticket
+func (agent *Agent) GetCachedJSApiTicket() (string, error) {
+	return agent.jsapiTicketCache.GetAccessToken()
+}
+
+// GetCachedAgentConfigTicket 优先从缓存获取应用的 jsapi_ticket
+func (agent *Agent) GetCachedAgentConfigTicket() (string, error) {
+	return agent.agentConfigTicketCache.GetAccessToken()
+}
+
+/*
+JS-SDK 使用权限签名
+
+返回 wx.config 需要的 appId(企业ID)/timestamp/nonceStr/signature， url 为调用JS接口页面的完整URL， #及其后面部分会被去掉
+
+See: https://work.weixin.qq.com/api/doc/90000/90136/90506
+*/
+func (agent *Agent) SignJSConfig(url string) (*utils.JSConfig, error) {
+	ticket, err := agent.GetCachedJSApiTicket()
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewJSConfig(agent.wxwork.Config.Corpid, ticket, url), nil
+}
+
+// AgentConfig wx.agentConfig 的参数
+type AgentConfig struct {
+	CorpID    string `json:"corpid"`
+	AgentID   string `json:"agentid"`
+	Timestamp int64  `json:"timestamp"`
+	NonceStr  string `json:"nonceStr"`
+	Signature string `json:"signature"`
+}
+
+/*
+应用的 JS-SDK 签名(wx.agentConfig)
+
+签名算法和 wx.config 一样， 用应用的 jsapi_ticket
+
+See: https://work.weixin.qq.com/api/doc/90000/90136/94313
+*/
+func (agent *Agent) SignAgentConfig(url string) (*AgentConfig, error) {
+	ticket, err := agent.GetCachedAgentConfigTicket()
+	if err != nil {
+		return nil, err
+	}
+	config := utils.NewJSConfig(agent.wxwork.Config.Corpid, ticket, url)
+	return &AgentConfig{
+		CorpID:    config.AppID,
+		AgentID:   agent.Config.AgentId,
+		Timestamp: config.Timestamp,
+		NonceStr:  config.NonceStr,
+		Signature: config.Signature,
+	}, nil
+}
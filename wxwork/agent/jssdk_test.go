@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxwork"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignJSConfig(t *testing.T) {
+	server := wxtest.NewServer()
+	defer server.Close()
+	server.AddWxworkApp("corpid", "secret")
+
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+	agent := New(wxwork.New(&wxwork.Config{Corpid: "corpid"}), cache, cache, &Config{
+		AgentId: "1000002",
+		Secret:  "secret",
+	}, utils.WithServerUrl(server.URL))
+
+	url := "https://example.com/page"
+	config, err := agent.SignJSConfig(url)
+	require.Equal(t, nil, err)
+	agentConfig, err := agent.SignAgentConfig(url)
+	require.Equal(t, nil, err)
+	_, err = agent.SignAgentConfig(url)
+	require.Equal(t, nil, err)
+	require.Equal(t, 1, server.RequestCount(apiGetJSApiTicket))
+	require.Equal(t, 1, server.RequestCount(apiGetTicket))
+
+	ticket, err := agent.GetCachedJSApiTicket()
+	require.Equal(t, nil, err)
+	require.Equal(t, "corpid", config.AppID)
+	require.Equal(t, utils.JSApiSignature(ticket, config.NonceStr, config.Timestamp, url), config.Signature)
+
+	agentTicket, err := agent.GetCachedAgentConfigTicket()
+	require.Equal(t, nil, err)
+	require.NotEqual(t, ticket, agentTicket)
+	require.Equal(t, "corpid", agentConfig.CorpID)
+	require.Equal(t, "1000002", agentConfig.AgentID)
+	require.Equal(t, utils.JSApiSignature(
+		agentTicket, agentConfig.NonceStr, agentConfig.Timestamp, url,
+	), agentConfig.Signature)
+}
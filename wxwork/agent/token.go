@@ -8,7 +8,6 @@ import (
 	"net/url"
 
 	"github.com/lixinio/weixin/utils"
-	"github.com/lixinio/weixin/wxwork"
 )
 
 /*
@@ -20,16 +19,18 @@ func (agent *Agent) refreshAccessTokenFromWXServer() (accessToken string, expire
 	params := url.Values{}
 	params.Add("corpid", agent.wxwork.Config.Corpid)
 	params.Add("corpsecret", agent.Config.Secret)
-	url := wxwork.QyWXServerUrl + "/cgi-bin/gettoken?" + params.Encode()
+	url := agent.Client.ServerUrl() + "/cgi-bin/gettoken?" + params.Encode()
 
-	response, err := http.Get(url)
+	response, err := agent.Client.HTTPClient().Get(url)
 	if err != nil {
+		// url 里面有 secret， 不能出现在错误信息里
+		err = utils.StripUrlError(err)
 		return
 	}
 
 	defer response.Body.Close()
 	if response.StatusCode != http.StatusOK {
-		err = fmt.Errorf("GET %s RETURN %s", url, response.Status)
+		err = fmt.Errorf("GET %s RETURN %s", "/cgi-bin/gettoken", response.Status)
 		return
 	}
 
@@ -47,6 +48,10 @@ func (agent *Agent) refreshAccessTokenFromWXServer() (accessToken string, expire
 	}
 
 	if result.AccessToken == "" {
+		if result.Errcode != 0 {
+			err = utils.NewWeixinError("/cgi-bin/gettoken", int64(result.Errcode), result.Errmsg)
+			return
+		}
 		err = fmt.Errorf("%s", string(resp))
 		return
 	}
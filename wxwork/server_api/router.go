@@ -0,0 +1,474 @@
+package server_api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/lixinio/weixin/utils"
+)
+
+// Context 一次推送的上下文
+type Context struct {
+	Request    *http.Request
+	Body       []byte      // 解密之后的xml
+	Message    Message     // 公共字段
+	Event      string      // 事件类型， 仅 MsgType 为 event 时有效
+	ChangeType string      // 通讯录/客户变更的类型， 比如 create_user
+	EventKey   string      // 菜单/任务卡片的KEY值
+	Content    interface{} // ParseXML 的结果， 比如 MessageText/EventChangeContactCreateUser， 未知类型为 nil
+
+	keys map[string]interface{}
+}
+
+// Set 在中间件和处理函数之间传递数据
+func (ctx *Context) Set(key string, value interface{}) {
+	if ctx.keys == nil {
+		ctx.keys = map[string]interface{}{}
+	}
+	ctx.keys[key] = value
+}
+
+// Get 读取 Set 保存的数据
+func (ctx *Context) Get(key string) (value interface{}, ok bool) {
+	value, ok = ctx.keys[key]
+	return
+}
+
+func (ctx *Context) replyMessage(msgType string) ReplyMessage {
+	return ReplyMessage{
+		ToUserName:   CDATA(ctx.Message.FromUserName),
+		FromUserName: CDATA(ctx.Message.ToUserName),
+		CreateTime:   strconv.FormatInt(time.Now().Unix(), 10),
+		MsgType:      CDATA(msgType),
+	}
+}
+
+// ReplyText 回复文本消息
+func (ctx *Context) ReplyText(content string) *ReplyMessageText {
+	return &ReplyMessageText{
+		ReplyMessage: ctx.replyMessage(ReplyMsgTypeText),
+		Content:      CDATA(content),
+	}
+}
+
+// ReplyNews 回复图文消息
+func (ctx *Context) ReplyNews(items ...ReplyMessageNewsItem) *ReplyMessageNews {
+	reply := &ReplyMessageNews{
+		ReplyMessage: ctx.replyMessage(ReplyMsgTypeNews),
+		ArticleCount: strconv.Itoa(len(items)),
+	}
+	reply.Articles.Item = items
+	return reply
+}
+
+// ReplyTaskCard 点击任务卡片按钮后更新按钮文案
+func (ctx *Context) ReplyTaskCard(replaceName string) *ReplyMessageTaskCard {
+	reply := &ReplyMessageTaskCard{ReplyMessage: ctx.replyMessage(ReplyMsgTypeTaskCard)}
+	reply.TaskCard.ReplaceName = CDATA(replaceName)
+	return reply
+}
+
+// Handler 处理消息/事件， 返回被动回复(比如 ReplyMessageText)， nil 表示不回复
+type Handler func(ctx *Context) (reply interface{}, err error)
+
+// Middleware 中间件， 包装 Handler
+type Middleware func(next Handler) Handler
+
+// Router 按 MsgType/Event/ChangeType/EventKey 分发推送
+type Router struct {
+	serverApi      *ServerApi
+	middlewares    []Middleware
+	messages       map[string]Handler // MsgType
+	events         map[string]Handler // Event
+	changeTypes    map[string]Handler // Event + ChangeType
+	eventKeys      map[string]Handler // Event + EventKey
+	defaultHandler Handler
+
+	// ErrorHandler 处理失败， 缺省返回500， 企业微信服务器会重试
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+func NewRouter(serverApi *ServerApi) *Router {
+	return &Router{
+		serverApi:   serverApi,
+		messages:    map[string]Handler{},
+		events:      map[string]Handler{},
+		changeTypes: map[string]Handler{},
+		eventKeys:   map[string]Handler{},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		},
+	}
+}
+
+// Use 添加中间件， 先添加的在外层
+func (router *Router) Use(middlewares ...Middleware) {
+	router.middlewares = append(router.middlewares, middlewares...)
+}
+
+// Handle 按 MsgType 注册， 比如 MsgTypeText
+func (router *Router) Handle(msgType string, handler Handler) {
+	router.messages[msgType] = handler
+}
+
+// HandleEvent 按 Event 注册， 比如 EventTypeChangeContact
+func (router *Router) HandleEvent(event string, handler Handler) {
+	router.events[event] = handler
+}
+
+// HandleChangeType 按 Event 和 ChangeType 注册， 优先于 HandleEvent
+func (router *Router) HandleChangeType(event, changeType string, handler Handler) {
+	router.changeTypes[event+":"+changeType] = handler
+}
+
+// HandleEventKey 按 Event 和 EventKey 注册， 优先于 HandleEvent
+func (router *Router) HandleEventKey(event, eventKey string, handler Handler) {
+	router.eventKeys[event+":"+eventKey] = handler
+}
+
+// Default 没有匹配时的处理函数， 未设置则不回复
+func (router *Router) Default(handler Handler) {
+	router.defaultHandler = handler
+}
+
+func (router *Router) OnText(handler func(ctx *Context, message MessageText) (interface{}, error)) {
+	router.Handle(MsgTypeText, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageText))
+	})
+}
+
+func (router *Router) OnImage(handler func(ctx *Context, message MessageImage) (interface{}, error)) {
+	router.Handle(MsgTypeImage, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageImage))
+	})
+}
+
+func (router *Router) OnVoice(handler func(ctx *Context, message MessageVoice) (interface{}, error)) {
+	router.Handle(MsgTypeVoice, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageVoice))
+	})
+}
+
+func (router *Router) OnVideo(handler func(ctx *Context, message MessageVideo) (interface{}, error)) {
+	router.Handle(MsgTypeVideo, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageVideo))
+	})
+}
+
+func (router *Router) OnLocation(handler func(ctx *Context, message MessageLocation) (interface{}, error)) {
+	router.Handle(MsgTypeLocation, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageLocation))
+	})
+}
+
+func (router *Router) OnLink(handler func(ctx *Context, message MessageLink) (interface{}, error)) {
+	router.Handle(MsgTypeLink, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(MessageLink))
+	})
+}
+
+// 通讯录变更
+
+func (router *Router) OnCreateUser(handler func(ctx *Context, event EventChangeContactCreateUser) (interface{}, error)) {
+	router.HandleChangeType(EventTypeChangeContact, EventTypeChangeContactCreateUser, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventChangeContactCreateUser))
+	})
+}
+
+func (router *Router) OnUpdateUser(handler func(ctx *Context, event EventChangeContactUpdateUser) (interface{}, error)) {
+	router.HandleChangeType(EventTypeChangeContact, EventTypeChangeContactUpdateUser, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventChangeContactUpdateUser))
+	})
+}
+
+func (router *Router) OnDeleteUser(handler func(ctx *Context, event EventChangeContactDeleteUser) (interface{}, error)) {
+	router.HandleChangeType(EventTypeChangeContact, EventTypeChangeContactDeleteUser, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventChangeContactDeleteUser))
+	})
+}
+
+func (router *Router) OnCreateParty(handler func(ctx *Context, event EventChangeContactCreateParty) (interface{}, error)) {
+	router.HandleChangeType(EventTypeChangeContact, EventTypeChangeContactCreateParty, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventChangeContactCreateParty))
+	})
+}
+
+func (router *Router) OnUpdateParty(handler func(ctx *Context, event EventChangeContactUpdateParty) (interface{}, error)) {
+	router.HandleChangeType(EventTypeChangeContact, EventTypeChangeContactUpdateParty, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventChangeContactUpdateParty))
+	})
+}
+
+func (router *Router) OnDeleteParty(handler func(ctx *Context, event EventChangeContactDeleteParty) (interface{}, error)) {
+	router.HandleChangeType(EventTypeChangeContact, EventTypeChangeContactDeleteParty, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventChangeContactDeleteParty))
+	})
+}
+
+func (router *Router) OnUpdateTag(handler func(ctx *Context, event EventChangeContactUpdateTag) (interface{}, error)) {
+	router.HandleChangeType(EventTypeChangeContact, EventTypeChangeContactUpdateTag, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventChangeContactUpdateTag))
+	})
+}
+
+func (router *Router) OnBatchJobResult(handler func(ctx *Context, event EventBatchJobResult) (interface{}, error)) {
+	router.HandleEvent(EventTypeBatchJobResult, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventBatchJobResult))
+	})
+}
+
+// 客户变更
+
+func (router *Router) OnAddExternalContact(
+	handler func(ctx *Context, event EventChangeExternalContactAddExternalContact) (interface{}, error),
+) {
+	router.HandleChangeType(
+		EventTypeChangeExternalContact, EventTypeChangeExternalContactAddExternalContact,
+		func(ctx *Context) (interface{}, error) {
+			return handler(ctx, ctx.Content.(EventChangeExternalContactAddExternalContact))
+		},
+	)
+}
+
+func (router *Router) OnEditExternalContact(
+	handler func(ctx *Context, event EventChangeExternalContactEditExternalContact) (interface{}, error),
+) {
+	router.HandleChangeType(
+		EventTypeChangeExternalContact, EventTypeChangeExternalContactEditExternalContact,
+		func(ctx *Context) (interface{}, error) {
+			return handler(ctx, ctx.Content.(EventChangeExternalContactEditExternalContact))
+		},
+	)
+}
+
+func (router *Router) OnAddHalfExternalContact(
+	handler func(ctx *Context, event EventChangeExternalContactAddHalfExternalContact) (interface{}, error),
+) {
+	router.HandleChangeType(
+		EventTypeChangeExternalContact, EventTypeChangeExternalContactAddHalfExternalContact,
+		func(ctx *Context) (interface{}, error) {
+			return handler(ctx, ctx.Content.(EventChangeExternalContactAddHalfExternalContact))
+		},
+	)
+}
+
+func (router *Router) OnDelExternalContact(
+	handler func(ctx *Context, event EventChangeExternalContactDelExternalContact) (interface{}, error),
+) {
+	router.HandleChangeType(
+		EventTypeChangeExternalContact, EventTypeChangeExternalContactDelExternalContact,
+		func(ctx *Context) (interface{}, error) {
+			return handler(ctx, ctx.Content.(EventChangeExternalContactDelExternalContact))
+		},
+	)
+}
+
+func (router *Router) OnDelFollowUser(
+	handler func(ctx *Context, event EventChangeExternalContactDelFollowUser) (interface{}, error),
+) {
+	router.HandleChangeType(
+		EventTypeChangeExternalContact, EventTypeChangeExternalContactDelFollowUser,
+		func(ctx *Context) (interface{}, error) {
+			return handler(ctx, ctx.Content.(EventChangeExternalContactDelFollowUser))
+		},
+	)
+}
+
+func (router *Router) OnChangeExternalChat(
+	handler func(ctx *Context, event EventChangeExternalContactChangeExternalChat) (interface{}, error),
+) {
+	router.HandleChangeType(
+		EventTypeChangeExternalContact, EventTypeChangeExternalContactChangeExternalChat,
+		func(ctx *Context) (interface{}, error) {
+			return handler(ctx, ctx.Content.(EventChangeExternalContactChangeExternalChat))
+		},
+	)
+}
+
+// OnApproval 审批状态变化
+func (router *Router) OnApproval(handler func(ctx *Context, event EventApproval) (interface{}, error)) {
+	router.HandleEvent(EventTypeApproval, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventApproval))
+	})
+}
+
+// OnTaskCardClick 点击任务卡片按钮， key 为空匹配所有按钮
+func (router *Router) OnTaskCardClick(key string, handler func(ctx *Context, event EventTaskCardClick) (interface{}, error)) {
+	h := func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventTaskCardClick))
+	}
+	if key == "" {
+		router.HandleEvent(EventTypeTaskCardClick, h)
+	} else {
+		router.HandleEventKey(EventTypeTaskCardClick, key, h)
+	}
+}
+
+// OnMenuClick 点击菜单拉取消息， key 为空匹配所有菜单
+func (router *Router) OnMenuClick(key string, handler func(ctx *Context, event EventMenuClick) (interface{}, error)) {
+	h := func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventMenuClick))
+	}
+	if key == "" {
+		router.HandleEvent(EventTypeMenuClick, h)
+	} else {
+		router.HandleEventKey(EventTypeMenuClick, key, h)
+	}
+}
+
+// OnMenuView 点击菜单跳转链接
+func (router *Router) OnMenuView(handler func(ctx *Context, event EventMenuView) (interface{}, error)) {
+	router.HandleEvent(EventTypeMenuView, func(ctx *Context) (interface{}, error) {
+		return handler(ctx, ctx.Content.(EventMenuView))
+	})
+}
+
+// 查找处理函数
+func (router *Router) route(ctx *Context) Handler {
+	if ctx.Message.MsgType == MsgTypeEvent {
+		if ctx.ChangeType != "" {
+			if handler, ok := router.changeTypes[ctx.Event+":"+ctx.ChangeType]; ok {
+				return handler
+			}
+		}
+		if handler, ok := router.eventKeys[ctx.Event+":"+ctx.EventKey]; ok {
+			return handler
+		}
+		if handler, ok := router.events[ctx.Event]; ok {
+			return handler
+		}
+	} else if handler, ok := router.messages[ctx.Message.MsgType]; ok {
+		return handler
+	}
+
+	if router.defaultHandler != nil {
+		return router.defaultHandler
+	}
+	return func(ctx *Context) (interface{}, error) {
+		return nil, nil
+	}
+}
+
+// Dispatch 经过中间件调用处理函数
+func (router *Router) Dispatch(ctx *Context) (interface{}, error) {
+	handler := router.route(ctx)
+	for i := len(router.middlewares) - 1; i >= 0; i-- {
+		handler = router.middlewares[i](handler)
+	}
+	return handler(ctx)
+}
+
+// NewContext 解析明文xml
+func NewContext(r *http.Request, body []byte) (*Context, error) {
+	header := struct {
+		Message
+		Event      string
+		ChangeType string
+		EventKey   string
+	}{}
+	if err := xml.Unmarshal(body, &header); err != nil {
+		return nil, err
+	}
+	content, err := parseMessage(body)
+	if err != nil {
+		return nil, err
+	}
+	return &Context{
+		Request:    r,
+		Body:       body,
+		Message:    header.Message,
+		Event:      header.Event,
+		ChangeType: header.ChangeType,
+		EventKey:   header.EventKey,
+		Content:    content,
+	}, nil
+}
+
+// ServeHTTP GET 验证服务器地址， POST 接收推送
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		router.serverApi.ServeEcho(w, r)
+	case http.MethodPost:
+		router.serverApi.ServeData(w, r, router.serveData)
+	default:
+		httpAbort(w, http.StatusBadRequest)
+	}
+}
+
+func (router *Router) serveData(w http.ResponseWriter, r *http.Request, body []byte) {
+	ctx, err := NewContext(r, body)
+	if err != nil {
+		httpAbort(w, http.StatusBadRequest)
+		return
+	}
+
+	reply, err := router.Dispatch(ctx)
+	if err != nil {
+		router.ErrorHandler(w, r, err)
+		return
+	}
+	if err = router.serverApi.response(w, r, reply); err != nil {
+		router.ErrorHandler(w, r, err)
+	}
+}
+
+// Recover 中间件， 处理函数 panic 时返回错误
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx *Context) (reply interface{}, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+				}
+			}()
+			return next(ctx)
+		}
+	}
+}
+
+// Logging 中间件， 记录推送类型、耗时和错误， printf 为空使用 log.Printf
+func Logging(printf func(format string, v ...interface{})) Middleware {
+	if printf == nil {
+		printf = log.Printf
+	}
+	return func(next Handler) Handler {
+		return func(ctx *Context) (interface{}, error) {
+			begin := time.Now()
+			reply, err := next(ctx)
+			printf(
+				"wxwork callback from %s agent=%s msgtype=%s event=%s changetype=%s cost=%s err=%v",
+				ctx.Message.FromUserName, ctx.Message.AgentID, ctx.Message.MsgType, ctx.Event, ctx.ChangeType,
+				time.Since(begin), err,
+			)
+			return reply, err
+		}
+	}
+}
+
+// Dedupe 中间件， 重复的推送不再处理， 直接回复空， 处理失败则允许重试
+func Dedupe(deduplicator *utils.CallbackDeduplicator) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx *Context) (interface{}, error) {
+			key := utils.CallbackDedupeKey(
+				ctx.Message.ToUserName+":"+ctx.Message.AgentID,
+				ctx.Message.FromUserName, ctx.Message.CreateTime, ctx.Event+":"+ctx.ChangeType, ctx.Message.MsgId,
+			)
+			first, err := deduplicator.Acquire(key)
+			if err == nil && !first {
+				return nil, nil
+			}
+			// 缓存出错时照常处理， 宁可重复也不丢消息
+			reply, err := next(ctx)
+			if err != nil && first {
+				_ = deduplicator.Release(key)
+			}
+			return reply, err
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package server_api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/lixinio/weixin/utils"
+	"github.com/lixinio/weixin/utils/memory"
+	"github.com/lixinio/weixin/wxtest"
+	"github.com/lixinio/weixin/wxtest/fixture"
+	"github.com/lixinio/weixin/wxwork"
+	"github.com/lixinio/weixin/wxwork/agent"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServerApi(t *testing.T) *ServerApi {
+	cache := memory.NewMemory(nil)
+	t.Cleanup(cache.Close)
+	corpAgent := agent.New(wxwork.New(&wxwork.Config{Corpid: "corpid"}), cache, cache, &agent.Config{AgentId: "1000002"})
+	return NewAgentApi(fixture.Token, fixture.EncodingAESKey, corpAgent)
+}
+
+func testEvent(event, changeType, extra string) string {
+	return fmt.Sprintf(`<xml>
+		<ToUserName><![CDATA[corpid]]></ToUserName>
+		<FromUserName><![CDATA[sys]]></FromUserName>
+		<CreateTime>1403610513</CreateTime>
+		<MsgType><![CDATA[event]]></MsgType>
+		<Event><![CDATA[%s]]></Event>
+		<ChangeType><![CDATA[%s]]></ChangeType>
+		%s
+	</xml>`, event, changeType, extra)
+}
+
+func TestRouter(t *testing.T) {
+	router := NewRouter(newTestServerApi(t))
+	callback := wxtest.NewWxworkCallback(fixture.Token, fixture.EncodingAESKey, "corpid")
+
+	var calls []string
+	router.Use(Recover())
+	router.OnText(func(ctx *Context, message MessageText) (interface{}, error) {
+		calls = append(calls, "text:"+ctx.Message.AgentID)
+		return ctx.ReplyText("echo " + message.Content), nil
+	})
+	router.OnCreateUser(func(ctx *Context, event EventChangeContactCreateUser) (interface{}, error) {
+		calls = append(calls, "create_user:"+event.UserID)
+		return nil, nil
+	})
+	router.OnUpdateParty(func(ctx *Context, event EventChangeContactUpdateParty) (interface{}, error) {
+		calls = append(calls, "update_party:"+event.ID)
+		return nil, nil
+	})
+	router.OnAddExternalContact(func(ctx *Context, event EventChangeExternalContactAddExternalContact) (interface{}, error) {
+		calls = append(calls, "add_external_contact:"+event.ExternalUserID)
+		return nil, nil
+	})
+	router.HandleEvent(EventTypeChangeContact, func(ctx *Context) (interface{}, error) {
+		calls = append(calls, "change_contact:"+ctx.ChangeType)
+		return nil, nil
+	})
+	router.OnTaskCardClick("approve", func(ctx *Context, event EventTaskCardClick) (interface{}, error) {
+		calls = append(calls, "taskcard:"+event.TaskId)
+		return ctx.ReplyTaskCard("已同意"), nil
+	})
+	router.Default(func(ctx *Context) (interface{}, error) {
+		calls = append(calls, "default:"+ctx.Event)
+		return nil, nil
+	})
+
+	reply, err := callback.Invoke(router, `<xml>
+		<ToUserName><![CDATA[corpid]]></ToUserName>
+		<FromUserName><![CDATA[zhangsan]]></FromUserName>
+		<CreateTime>1348831860</CreateTime>
+		<MsgType><![CDATA[text]]></MsgType>
+		<Content><![CDATA[hello]]></Content>
+		<MsgId>1234567890123456</MsgId>
+		<AgentID>1000002</AgentID>
+	</xml>`)
+	require.Equal(t, nil, err)
+	// 被动回复用 corpid 加密
+	require.Equal(t, "corpid", reply.AppId)
+	replyText := ReplyMessageText{}
+	require.Equal(t, nil, reply.Unmarshal(&replyText))
+	require.Equal(t, CDATA("echo hello"), replyText.Content)
+
+	// 签名错误
+	invalid := wxtest.NewWxworkCallback("invalid", fixture.EncodingAESKey, "corpid")
+	reply, err = invalid.Invoke(router, testEvent(EventTypeChangeContact, EventTypeChangeContactCreateUser, ""))
+	require.NotEqual(t, nil, err)
+	require.Equal(t, http.StatusBadRequest, reply.StatusCode)
+
+	for _, event := range []string{
+		testEvent(EventTypeChangeContact, EventTypeChangeContactCreateUser, "<UserID><![CDATA[zhangsan]]></UserID>"),
+		testEvent(EventTypeChangeContact, EventTypeChangeContactUpdateParty, "<Id>2</Id>"),
+		// 没有注册的 ChangeType 由 HandleEvent 处理
+		testEvent(EventTypeChangeContact, EventTypeChangeContactDeleteUser, "<UserID><![CDATA[zhangsan]]></UserID>"),
+		testEvent(
+			EventTypeChangeExternalContact, EventTypeChangeExternalContactAddExternalContact,
+			"<ExternalUserID><![CDATA[woAJ2GCAAAXtWyujaWJHDDGi0mACAAAA]]></ExternalUserID>",
+		),
+		testEvent(
+			EventTypeChangeExternalContact, EventTypeChangeExternalContactDelFollowUser,
+			"<ExternalUserID><![CDATA[woAJ2GCAAAXtWyujaWJHDDGi0mACAAAA]]></ExternalUserID>",
+		),
+	} {
+		reply, err = callback.Invoke(router, event)
+		require.Equal(t, nil, err)
+		require.Equal(t, 0, len(reply.XML))
+	}
+
+	reply, err = callback.Invoke(router, testEvent(
+		EventTypeTaskCardClick, "",
+		"<EventKey><![CDATA[approve]]></EventKey><TaskId><![CDATA[taskid1]]></TaskId>",
+	))
+	require.Equal(t, nil, err)
+	replyTaskCard := ReplyMessageTaskCard{}
+	require.Equal(t, nil, reply.Unmarshal(&replyTaskCard))
+	require.Equal(t, CDATA("已同意"), replyTaskCard.TaskCard.ReplaceName)
+	require.Equal(t, CDATA(ReplyMsgTypeTaskCard), replyTaskCard.MsgType)
+
+	require.Equal(t, []string{
+		"text:1000002",
+		"create_user:zhangsan",
+		"update_party:2",
+		"change_contact:delete_user",
+		"add_external_contact:woAJ2GCAAAXtWyujaWJHDDGi0mACAAAA",
+		"default:change_external_contact",
+		"taskcard:taskid1",
+	}, calls)
+}
+
+func TestDedupe(t *testing.T) {
+	cache := memory.NewMemory(nil)
+	defer cache.Close()
+
+	router := NewRouter(newTestServerApi(t))
+	router.Use(Dedupe(utils.NewCallbackDeduplicator(cache, 0)))
+	callback := wxtest.NewWxworkCallback(fixture.Token, fixture.EncodingAESKey, "corpid")
+
+	var calls []string
+	router.OnCreateUser(func(ctx *Context, event EventChangeContactCreateUser) (interface{}, error) {
+		calls = append(calls, "create_user:"+event.UserID)
+		return nil, nil
+	})
+	router.OnDeleteUser(func(ctx *Context, event EventChangeContactDeleteUser) (interface{}, error) {
+		calls = append(calls, "delete_user:"+event.UserID)
+		return nil, nil
+	})
+
+	// 同一时间不同 ChangeType 的事件不会被误判为重复
+	for i := 0; i < 2; i++ {
+		for _, event := range []string{
+			testEvent(EventTypeChangeContact, EventTypeChangeContactCreateUser, "<UserID><![CDATA[zhangsan]]></UserID>"),
+			testEvent(EventTypeChangeContact, EventTypeChangeContactDeleteUser, "<UserID><![CDATA[lisi]]></UserID>"),
+		} {
+			reply, err := callback.Invoke(router, event)
+			require.Equal(t, nil, err)
+			require.Equal(t, 0, len(reply.XML))
+		}
+	}
+	require.Equal(t, []string{"create_user:zhangsan", "delete_user:lisi"}, calls)
+}
@@ -35,6 +35,7 @@ import (
 type ServerApi struct {
 	*utils.Client
 	AgentConfig    *agent.Config
+	Corpid         string // 企业ID， 加密回复时作为 ReceiveId
 	Token          string // 接收消息服务器配置（Token）
 	EncodingAESKey string // 接收消息服务器配置（EncodingAESKey）
 }
@@ -43,6 +44,7 @@ func NewAgentApi(token, encodingAESKey string, agent *agent.Agent) *ServerApi {
 	return &ServerApi{
 		Client:         agent.Client,
 		AgentConfig:    agent.Config,
+		Corpid:         agent.Corpid(),
 		Token:          token,
 		EncodingAESKey: encodingAESKey,
 	}
@@ -90,6 +92,7 @@ func (s *ServerApi) ServeEcho(w http.ResponseWriter, r *http.Request) {
 func (s *ServerApi) ServeData(w http.ResponseWriter, r *http.Request, processor utils.XmlHandlerFunc) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
+		httpAbort(w, http.StatusBadRequest)
 		return
 	}
 
@@ -97,6 +100,7 @@ func (s *ServerApi) ServeData(w http.ResponseWriter, r *http.Request, processor
 	encryptMsg := EncryptMessage{}
 	err = xml.Unmarshal(body, &encryptMsg)
 	if err != nil {
+		httpAbort(w, http.StatusBadRequest)
 		return
 	}
 
@@ -108,8 +112,8 @@ func (s *ServerApi) ServeData(w http.ResponseWriter, r *http.Request, processor
 		s.Token,
 	)
 
-	if msgSignature := r.URL.Query().Get("msg_signature"); signature != msgSignature {
-		err = fmt.Errorf("%s != %s", signature, msgSignature)
+	if signature != r.URL.Query().Get("msg_signature") {
+		httpAbort(w, http.StatusBadRequest)
 		return
 	}
 
@@ -117,6 +121,7 @@ func (s *ServerApi) ServeData(w http.ResponseWriter, r *http.Request, processor
 	var xmlMsg []byte
 	_, xmlMsg, _, err = utils.AESDecryptMsg(encryptMsg.Encrypt, s.EncodingAESKey)
 	if err != nil {
+		httpAbort(w, http.StatusBadRequest)
 		return
 	}
 	processor(w, r, xmlMsg)
@@ -136,6 +141,11 @@ POST /api/callback?msg_signature=ASDFQWEXZCVAQFASDFASDFSS
 </xml>
 */
 func (s *ServerApi) ParseXML(body []byte) (m interface{}, err error) {
+	return parseMessage(body)
+}
+
+// parseMessage 解析明文的消息/事件
+func parseMessage(body []byte) (m interface{}, err error) {
 	message := Message{}
 	err = xml.Unmarshal(body, &message)
 	// fmt.Println(message)
@@ -425,7 +435,7 @@ func (s *ServerApi) encryptReplyMessage(rawXmlMsg []byte) (replyEncryptMessage *
 	cipherText, err := utils.AESEncryptMsg(
 		[]byte(utils.GetRandString(16)),
 		rawXmlMsg,
-		s.AgentConfig.AgentId,
+		s.Corpid,
 		s.EncodingAESKey,
 	)
 	if err != nil {
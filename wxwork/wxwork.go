@@ -22,6 +22,6 @@ func New(config *Config) (corp *WxWork) {
 	return &instance
 }
 
-func (corp *WxWork) NewClient(accessTokenCache *utils.AccessTokenCache) *utils.Client {
-	return utils.NewClient(QyWXServerUrl, accessTokenCache)
+func (corp *WxWork) NewClient(accessTokenCache *utils.AccessTokenCache, opts ...utils.ClientOption) *utils.Client {
+	return utils.NewClient(QyWXServerUrl, accessTokenCache, opts...)
 }